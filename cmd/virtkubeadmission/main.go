@@ -0,0 +1,77 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"libvirt.org/libvirt-kube/pkg/admission"
+)
+
+var (
+	kubeconfig = pflag.String("kubeconfig", "", "Path to a kube config, if running outside cluster")
+
+	addr = pflag.String("addr", "0.0.0.0:443",
+		"TCP address and port to serve webhooks on")
+	tlscert = pflag.String("tls-cert", "/etc/pki/virtkubeadmission/server-cert.pem",
+		"Path to TLS server cert PEM file")
+	tlskey = pflag.String("tls-key", "/etc/pki/virtkubeadmission/server-key.pem",
+		"Path to TLS server key PEM file")
+	cacert = pflag.String("ca-cert", "/etc/pki/virtkubeadmission/ca-cert.pem",
+		"Path to the CA cert PEM file the apiserver checks the conversion webhook with, or empty to serve only v1alpha2")
+
+	overrideallow = pflag.StringSlice("override-allow", []string{},
+		"Domain XML elements which machine overrides may set, eg /domain/features/pmu")
+)
+
+func main() {
+	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	pflag.Parse()
+	// Convince glog that we really have parsed CLI
+	flag.CommandLine.Parse([]string{})
+
+	cert, err := tls.LoadX509KeyPair(*tlscert, *tlskey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	svc, err := admission.NewService(*addr, tlsConfig, *kubeconfig, *cacert, *overrideallow)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	err = svc.Run()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
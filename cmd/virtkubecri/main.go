@@ -34,6 +34,8 @@ var (
 		"UNIX socket path to listen on")
 	connect = pflag.String("connect", "qemu:///system",
 		"Libvirt connection URI")
+	kubeconfig = pflag.String("kubeconfig", "",
+		"Path to a kube config, for posting events about pods")
 )
 
 func main() {
@@ -42,7 +44,7 @@ func main() {
 	// Convince glog that we really have parsed CLI
 	flag.CommandLine.Parse([]string{})
 
-	svc, err := cri.NewService(*listen, *connect)
+	svc, err := cri.NewService(*listen, *connect, *kubeconfig)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -0,0 +1,168 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+// virtkubectl runs operations on libvirt-kube machines and
+// image files. Installed on $PATH as 'kubectl-virt' it can
+// also be run as a kubectl plugin, 'kubectl virt ...'
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+	"libvirt.org/libvirt-kube/pkg/virtkubectl"
+)
+
+var (
+	kubeconfig = pflag.String("kubeconfig", "", "Path to a kube config, instead of the kubectl default")
+	namespace  = pflag.StringP("namespace", "n", "", "Namespace of machines, instead of the context's")
+
+	streamurl = pflag.String("stream-url", "http://localhost:9000",
+		"Base URL of the image repo streamer")
+	streamca = pflag.String("stream-ca", "",
+		"Path to the CA cert PEM file for a streamer using TLS")
+	libvirturi = pflag.String("libvirt-uri", "qemu+tls://%s/system",
+		"Libvirt connection URI for nodes, with %s replaced by the node address")
+	angelimage = pflag.String("angel-image", "localhost:5000/libvirtkubevmangel",
+		"Image for pods started to run machines")
+
+	repo       = pflag.String("repo", "default", "Name of virtimagerepo to create image files in")
+	accessmode = pflag.String("access-mode", string(apiv2.VirtimagefileReadWriteOnce),
+		"Access mode of created image files")
+	format = pflag.String("format", "",
+		"Image format to upload from or download to, converting it, instead of the file's own")
+)
+
+const usage = `Usage: virtkubectl [OPTIONS] COMMAND ARGS...
+
+Commands:
+  get machines|nodes|files|repos|snapshots
+                                   Show the status of resources
+  upload FILE PATH                 Replace image file content with a local file
+  download FILE PATH               Save image file content to a local file
+  create-file FILE PATH            Create an image file from a local disk image
+  console MACHINE                  Attach to a machine's console
+  display MACHINE                  Open a graphical session on a machine
+  start MACHINE                    Start a pod running a machine
+  stop MACHINE                     Delete a machine's pod
+  restart MACHINE                  Replace a machine's pod
+  pause MACHINE                    Suspend a machine's CPUs
+  resume MACHINE                   Resume a paused machine
+
+Options:
+`
+
+func run(client *virtkubectl.Client, cmd string, args []string) error {
+	want := map[string]int{
+		"get":         1,
+		"upload":      2,
+		"download":    2,
+		"create-file": 2,
+	}
+	nargs, ok := want[cmd]
+	if !ok {
+		nargs = 1
+	}
+	if len(args) != nargs {
+		return fmt.Errorf("Command '%s' needs %d arguments, not %d", cmd, nargs, len(args))
+	}
+
+	switch cmd {
+	case "get":
+		switch args[0] {
+		case "machines", "machine", "vm", "vms":
+			return client.ShowMachines()
+		case "nodes", "node":
+			return client.ShowNodes()
+		case "files", "file":
+			return client.ShowFiles()
+		case "repos", "repo":
+			return client.ShowRepos()
+		case "snapshots", "snapshot":
+			return client.ShowSnapshots()
+		default:
+			return fmt.Errorf("Unknown resource '%s'", args[0])
+		}
+	case "upload":
+		return client.Upload(args[0], args[1], *format)
+	case "download":
+		return client.Download(args[0], args[1], *format)
+	case "create-file":
+		return client.CreateFile(args[0], *repo, args[1], apiv2.VirtimagefileAccessMode(*accessmode))
+	case "console":
+		return client.Console(args[0])
+	case "display":
+		return client.Display(args[0])
+	case "start":
+		return client.Start(args[0])
+	case "stop":
+		return client.Stop(args[0])
+	case "restart":
+		return client.Restart(args[0])
+	case "pause":
+		return client.Pause(args[0])
+	case "resume":
+		return client.Resume(args[0])
+	default:
+		return fmt.Errorf("Unknown command '%s'", cmd)
+	}
+}
+
+func main() {
+	pflag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		pflag.PrintDefaults()
+	}
+	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	pflag.Parse()
+	// Convince glog that we really have parsed CLI
+	flag.CommandLine.Parse([]string{})
+
+	if pflag.NArg() < 1 {
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	client, err := virtkubectl.NewClient(*kubeconfig, *namespace)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	client.StreamURL = *streamurl
+	client.LibvirtURI = *libvirturi
+	client.AngelImage = *angelimage
+	if *streamca != "" {
+		if err := client.SetStreamCA(*streamca); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	args := pflag.Args()
+	if err := run(client, args[0], args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
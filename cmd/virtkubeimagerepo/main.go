@@ -44,6 +44,8 @@ var (
 		"Run public streamer without TLS encryption")
 	streamaddr = pflag.String("stream-addr", "0.0.0.0:80",
 		"TCP address and port to stream on")
+	streamurl = pflag.String("stream-url", "",
+		"URL clients and other repos reach the streamer at, eg http://host:9000")
 	streamtlscert = pflag.String("stream-tls-cert", "/etc/pki/virtkubeimagerepo/server-cert.pem",
 		"Path to TLS public server cert PEM file")
 	streamtlskey = pflag.String("stream-tls-key", "/etc/pki/virtkubeimagerepo/server-key.pem",
@@ -93,7 +95,7 @@ func main() {
 		}
 	}
 
-	svc, err := imagerepo.NewService(*connect, *streamaddr, *streaminsecure, streamTLS, *kubeconfig, *reponame, *repopath)
+	svc, err := imagerepo.NewService(*connect, *streamaddr, *streamurl, *streaminsecure, streamTLS, *kubeconfig, *reponame, *repopath)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
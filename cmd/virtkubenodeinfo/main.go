@@ -25,7 +25,7 @@ import (
 	"os"
 
 	"github.com/spf13/pflag"
-	kubeapi "k8s.io/client-go/pkg/api"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"libvirt.org/libvirt-kube/pkg/nodeinfo"
 )
@@ -48,7 +48,7 @@ func main() {
 	if *namespace == "" {
 		*namespace = os.Getenv("LIBVIRT_KUBE_NODEINFO_NAMESPACE")
 		if *namespace == "" {
-			*namespace = kubeapi.NamespaceDefault
+			*namespace = v1.NamespaceDefault
 		}
 	}
 
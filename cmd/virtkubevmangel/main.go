@@ -26,7 +26,7 @@ import (
 	"time"
 
 	"github.com/spf13/pflag"
-	kubeapi "k8s.io/client-go/pkg/api"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"libvirt.org/libvirt-kube/pkg/vmangel"
 )
@@ -48,7 +48,7 @@ func main() {
 	if *namespace == "" {
 		*namespace = os.Getenv("LIBVIRT_KUBE_VM_ANGEL_NAMESPACE")
 		if *namespace == "" {
-			*namespace = kubeapi.NamespaceDefault
+			*namespace = v1.NamespaceDefault
 		}
 	}
 
@@ -38,6 +38,9 @@ var (
 		"Libvirt connection URI")
 	kubeconfig = pflag.String("kubeconfig", "", "Path to a kube config, if running outside cluster")
 	repopath   = pflag.String("repopath", "/srv/images", "Path to image repository mount point")
+
+	overrideallow = pflag.StringSlice("override-allow", []string{},
+		"Domain XML elements which machine overrides may set, eg /domain/features/pmu")
 )
 
 func main() {
@@ -46,7 +49,7 @@ func main() {
 	// Convince glog that we really have parsed CLI
 	flag.CommandLine.Parse([]string{})
 
-	svc, err := vmshim.NewShim(*shimaddr, *skipvalidate, *connect, *repopath, *kubeconfig)
+	svc, err := vmshim.NewShim(*shimaddr, *skipvalidate, *connect, *repopath, *kubeconfig, *overrideallow)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
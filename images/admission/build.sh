@@ -0,0 +1,8 @@
+#!/bin/sh
+
+set -e
+set -v
+
+cp $GOPATH/bin/virtkubeadmission .
+
+docker build -t libvirtkubeadmission .
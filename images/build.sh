@@ -1,5 +1,5 @@
 
-for i in imagerepo nodeinfo virtd virtlogd vmangel vmshim
+for i in admission imagerepo nodeinfo virtd virtlogd vmangel vmshim
 do
     cd $i
     ./build.sh
@@ -0,0 +1,10 @@
+#!/bin/sh
+
+if ! test -f cacert.pem
+then
+    ./makecert.sh
+fi
+kubectl create -f sec-virtkubeadmission.yaml
+kubectl create -f svc-virtkubeadmission.yaml
+kubectl create -f rc-virtkubeadmission.yaml
+kubectl create -f webhook-virtkubeadmission.yaml
@@ -0,0 +1,42 @@
+#!/bin/sh
+
+# The API server only calls webhooks over TLS, checking
+# the cert against the CA bundle in the webhook config
+SERVICE=virtkubeadmission.libvirt-kube.svc
+
+certtool --generate-privkey > cakey.pem
+
+cat >ca.info <<EOT
+cn = libvirt kube admission demo
+ca
+cert_signing_key
+EOT
+
+certtool --generate-self-signed --load-privkey cakey.pem \
+  --template ca.info --outfile cacert.pem
+
+certtool --generate-privkey > server-key.pem
+
+cat >server.info <<EOT
+cn = $SERVICE
+dns_name = $SERVICE
+tls_www_server
+encryption_key
+signing_key
+EOT
+
+certtool --generate-certificate --load-privkey server-key.pem \
+  --load-ca-certificate cacert.pem --load-ca-privkey cakey.pem \
+  --template server.info --outfile server-cert.pem
+
+CACERT=`base64 -w 0 cacert.pem`
+SERVERCERT=`base64 -w 0 server-cert.pem`
+SERVERKEY=`base64 -w 0 server-key.pem`
+
+cp sec-virtkubeadmission.yaml.in sec-virtkubeadmission.yaml
+echo "  server-cert.pem: \"$SERVERCERT\"" >> sec-virtkubeadmission.yaml
+echo "  server-key.pem: \"$SERVERKEY\"" >> sec-virtkubeadmission.yaml
+echo "  ca-cert.pem: \"$CACERT\"" >> sec-virtkubeadmission.yaml
+
+sed -e "s/@CABUNDLE@/$CACERT/" webhook-virtkubeadmission.yaml.in \
+  > webhook-virtkubeadmission.yaml
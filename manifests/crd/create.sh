@@ -0,0 +1,15 @@
+#!/bin/sh
+
+kubectl create -f virtimagefile.yaml
+kubectl create -f virtimagerepo.yaml
+kubectl create -f virtimagesnapshot.yaml
+kubectl create -f virtnode.yaml
+kubectl create -f virtmachine.yaml
+kubectl create -f virtmachineclass.yaml
+kubectl wait --for condition=established --timeout=60s \
+    crd/virtimagefiles.libvirt.org \
+    crd/virtimagerepos.libvirt.org \
+    crd/virtimagesnapshots.libvirt.org \
+    crd/virtnodes.libvirt.org \
+    crd/virtmachines.libvirt.org \
+    crd/virtmachineclasses.libvirt.org
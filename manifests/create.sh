@@ -1,6 +1,6 @@
 #!/bin/sh
 
-for dir in tpr libvirt virtimagerepo virtimagefile virtnode
+for dir in crd libvirt admission virtmachineclass virtimagerepo virtimagefile virtnode
 do
     echo
     echo $dir
@@ -0,0 +1,4 @@
+#!/bin/sh
+
+kubectl create -f small.yaml
+kubectl create -f windows-desktop.yaml
@@ -0,0 +1,86 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/glog"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+)
+
+func convert(req *apiextv1.ConversionRequest) *apiextv1.ConversionResponse {
+	resp := &apiextv1.ConversionResponse{
+		UID: req.UID,
+	}
+
+	for _, obj := range req.Objects {
+		data, err := api.ConvertObject(obj.Raw, req.DesiredAPIVersion)
+		if err != nil {
+			glog.V(1).Infof("Conversion to %s failed: %s", req.DesiredAPIVersion, err)
+			resp.Result = v1.Status{
+				Status:  v1.StatusFailure,
+				Message: err.Error(),
+			}
+			return resp
+		}
+		resp.ConvertedObjects = append(resp.ConvertedObjects, runtime.RawExtension{Raw: data})
+	}
+
+	resp.Result = v1.Status{
+		Status: v1.StatusSuccess,
+	}
+	return resp
+}
+
+// The apiserver calls this to convert resources between the
+// version stored and the version a client asked for
+func (s *Service) handleConvert(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := &apiextv1.ConversionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("Cannot parse conversion review: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	glog.V(1).Infof("Convert %d objects to %s", len(review.Request.Objects), review.Request.DesiredAPIVersion)
+	review.Response = convert(review.Request)
+	review.Request = nil
+	data, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
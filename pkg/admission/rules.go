@@ -0,0 +1,446 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package admission
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+	"libvirt.org/libvirt-kube/pkg/designer"
+	"libvirt.org/libvirt-kube/pkg/registry"
+)
+
+// Rules checks resources against the same constraints the
+// daemons apply when they act on them, so mistakes are
+// reported when the resource is saved instead of when a
+// machine starts or a file is created
+type Rules struct {
+	clientset       kubernetes.Interface
+	imageRepoLister *api.VirtimagerepoLister
+	imageFileLister *api.VirtimagefileLister
+	snapshotLister  *api.VirtimagesnapshotLister
+	classLister     *api.VirtmachineclassLister
+	overridePolicy  *designer.OverridePolicy
+}
+
+func NewRules(clientset kubernetes.Interface, imageRepoLister *api.VirtimagerepoLister, imageFileLister *api.VirtimagefileLister, snapshotLister *api.VirtimagesnapshotLister, classLister *api.VirtmachineclassLister, overridePolicy *designer.OverridePolicy) *Rules {
+	return &Rules{
+		clientset:       clientset,
+		imageRepoLister: imageRepoLister,
+		imageFileLister: imageFileLister,
+		snapshotLister:  snapshotLister,
+		classLister:     classLister,
+		overridePolicy:  overridePolicy,
+	}
+}
+
+// DefaultVirtmachine fills in the fields the shim would
+// otherwise pick when the machine starts. Machines with a
+// class are left alone, since their hardware isn't known
+// until it is merged with the class
+func (r *Rules) DefaultVirtmachine(machine *apiv2.Virtmachine) error {
+	apiv2.SetDefaults_Virtmachine(machine)
+	if machine.Spec.Class != "" {
+		return nil
+	}
+	return designer.DefaultHardware(&machine.Spec.Hardware)
+}
+
+func (r *Rules) DefaultVirtimagefile(file *apiv2.Virtimagefile) error {
+	apiv2.SetDefaults_Virtimagefile(file)
+	return nil
+}
+
+func (r *Rules) DefaultVirtimagerepo(repo *apiv2.Virtimagerepo) error {
+	apiv2.SetDefaults_Virtimagerepo(repo)
+	return nil
+}
+
+func (r *Rules) DefaultVirtimagesnapshot(snapshot *apiv2.Virtimagesnapshot) error {
+	apiv2.SetDefaults_Virtimagesnapshot(snapshot)
+	return nil
+}
+
+// Design the domain for the hardware, without starting it
+func (r *Rules) validateHardware(hardware *apiv2.VirtmachineHardware, overrides []apiv2.VirtmachineOverride) error {
+	domdesign := designer.NewDomainDesigner(r.clientset, "", r.imageRepoLister, r.imageFileLister)
+	if err := domdesign.ApplyVirtMachine(hardware); err != nil {
+		return err
+	}
+
+	_, err := domdesign.ApplyOverrides(overrides, r.overridePolicy)
+	return err
+}
+
+func (r *Rules) ValidateVirtmachine(machine, old *apiv2.Virtmachine) error {
+	// Files or classes it uses may have changed since, but
+	// that mustn't stop its metadata being updated
+	if old != nil && reflect.DeepEqual(machine.Spec, old.Spec) {
+		return nil
+	}
+
+	hardware := api.DeepCopyVirtmachine(machine).Spec.Hardware
+	if machine.Spec.Class != "" {
+		cached, err := r.classLister.Get(machine.Spec.Class)
+		if err != nil {
+			return fmt.Errorf("Unable to load machine class '%s': %s", machine.Spec.Class, err)
+		}
+		class := api.DeepCopyVirtmachineclass(cached)
+		hardware = designer.MergeHardware(&class.Spec.Hardware, &hardware)
+	} else {
+		apiv2.SetDefaults_VirtmachineHardware(&hardware)
+	}
+
+	return r.validateHardware(&hardware, machine.Spec.Overrides)
+}
+
+// Classes only need to be valid once a machine's fields are
+// merged in, so check what a machine setting nothing would get
+func (r *Rules) ValidateVirtmachineclass(class, old *apiv2.Virtmachineclass) error {
+	if old != nil && reflect.DeepEqual(class.Spec, old.Spec) {
+		return nil
+	}
+
+	hardware := designer.MergeHardware(&api.DeepCopyVirtmachineclass(class).Spec.Hardware,
+		&apiv2.VirtmachineHardware{})
+
+	if err := r.validateHardware(&hardware, nil); err != nil {
+		return fmt.Errorf("Machines using class '%s' would fail: %s", class.Metadata.Name, err)
+	}
+	return nil
+}
+
+func validateDigest(name, digest string, size int) error {
+	if digest == "" {
+		return nil
+	}
+	raw, err := hex.DecodeString(digest)
+	if err != nil || len(raw) != size {
+		return fmt.Errorf("Digest %s must be %d hex digits", name, size*2)
+	}
+	return nil
+}
+
+func validateSourceHTTP(src *apiv2.VirtimagefileSourceHTTP) error {
+	u, err := url.Parse(src.URL)
+	if err != nil {
+		return fmt.Errorf("Unable to parse source URL '%s': %s", src.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Source URL '%s' must be http or https", src.URL)
+	}
+
+	if err := validateDigest("sha256", src.SHA256, sha256.Size); err != nil {
+		return err
+	}
+	return validateDigest("sha512", src.SHA512, sha512.Size)
+}
+
+func validateSource(file *apiv2.Virtimagefile) error {
+	src := file.Spec.Source
+	if src == nil {
+		return nil
+	}
+
+	if file.Spec.BackingImageFile != "" {
+		return fmt.Errorf("Files with a backing image file cannot be imported")
+	}
+
+	sources := 0
+	if src.HTTP != nil {
+		sources++
+		if err := validateSourceHTTP(src.HTTP); err != nil {
+			return err
+		}
+	}
+	if src.Registry != nil {
+		sources++
+		if _, err := registry.ParseReference(src.Registry.Image); err != nil {
+			return err
+		}
+	}
+	if src.ImageFile != nil {
+		sources++
+		if src.ImageFile.Name == "" {
+			return fmt.Errorf("Source image file name must not be empty")
+		}
+		if src.ImageFile.Name == file.Metadata.Name {
+			return fmt.Errorf("Image file cannot be cloned from itself")
+		}
+	}
+	if src.Snapshot != nil {
+		sources++
+		if src.Snapshot.Name == "" {
+			return fmt.Errorf("Source snapshot name must not be empty")
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("Source must give exactly one place to import from")
+	}
+	return nil
+}
+
+// Check a file can be cloned from the one it names
+func (r *Rules) validateCloneSource(file *apiv2.Virtimagefile) error {
+	name := file.Spec.Source.ImageFile.Name
+	src, err := r.imageFileLister.Get(v1.NamespaceDefault, name)
+	if err != nil {
+		return fmt.Errorf("Unable to load source image file '%s': %s", name, err)
+	}
+
+	if src.Spec.BackingImageFile != "" {
+		return fmt.Errorf("Source image file '%s' has a backing image file, so cannot be cloned", name)
+	}
+	if src.Spec.Capacity > file.Spec.Capacity {
+		return fmt.Errorf("Capacity %d is smaller than source image file '%s' capacity %d",
+			file.Spec.Capacity, name, src.Spec.Capacity)
+	}
+
+	if src.Spec.RepoName != file.Spec.RepoName {
+		// The copy is streamed using the source's token
+		mode := src.Spec.Stream.AccessMode
+		if (mode != apiv2.VirtimagefileStreamDownload && mode != apiv2.VirtimagefileStreamBoth) ||
+			src.Spec.Stream.TokenSecret == "" {
+			return fmt.Errorf("Source image file '%s' is in another repo, so must permit downloads", name)
+		}
+	}
+	return nil
+}
+
+// Check a file can be created from the snapshot it names
+func (r *Rules) validateSnapshotSource(file *apiv2.Virtimagefile) error {
+	name := file.Spec.Source.Snapshot.Name
+	snapshot, err := r.snapshotLister.Get(v1.NamespaceDefault, name)
+	if err != nil {
+		return fmt.Errorf("Unable to load source snapshot '%s': %s", name, err)
+	}
+	if snapshot.Status.Phase == apiv2.VirtimagesnapshotFailed {
+		return fmt.Errorf("Source snapshot '%s' failed", name)
+	}
+
+	src, err := r.imageFileLister.Get(v1.NamespaceDefault, snapshot.Spec.FileName)
+	if err != nil {
+		return fmt.Errorf("Unable to load image file '%s' of source snapshot '%s': %s", snapshot.Spec.FileName, name, err)
+	}
+	if src.Spec.RepoName != file.Spec.RepoName {
+		return fmt.Errorf("Source snapshot '%s' is of a file in repo '%s', not '%s'", name, src.Spec.RepoName, file.Spec.RepoName)
+	}
+
+	// Until the snapshot is taken, the file's
+	// capacity is the best guess of its size
+	capacity := snapshot.Status.Capacity
+	if capacity == 0 {
+		capacity = src.Spec.Capacity
+	}
+	if capacity > file.Spec.Capacity {
+		return fmt.Errorf("Capacity %d is smaller than source snapshot '%s' capacity %d",
+			file.Spec.Capacity, name, capacity)
+	}
+	return nil
+}
+
+// Check a file can be reverted to the snapshot it names
+func (r *Rules) validateRevert(file *apiv2.Virtimagefile) error {
+	name := file.Spec.Revert.Snapshot
+	if name == "" {
+		return fmt.Errorf("Revert snapshot name must not be empty")
+	}
+	snapshot, err := r.snapshotLister.Get(v1.NamespaceDefault, name)
+	if err != nil {
+		return fmt.Errorf("Unable to load snapshot '%s': %s", name, err)
+	}
+	if snapshot.Spec.FileName != file.Metadata.Name {
+		return fmt.Errorf("Snapshot '%s' is of image file '%s'", name, snapshot.Spec.FileName)
+	}
+	if snapshot.Status.Phase != apiv2.VirtimagesnapshotReady {
+		return fmt.Errorf("Snapshot '%s' is not ready", name)
+	}
+
+	// Overlays would see their backing content
+	// change underneath them
+	files, err := r.imageFileLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, other := range files {
+		if other.Spec.BackingImageFile == file.Metadata.Name {
+			return fmt.Errorf("Image file is the backing image file of '%s', so cannot be reverted", other.Metadata.Name)
+		}
+	}
+	return nil
+}
+
+func (r *Rules) ValidateVirtimagefile(file, old *apiv2.Virtimagefile) error {
+	switch file.Spec.AccessMode {
+	case apiv2.VirtimagefileReadWriteOnce, apiv2.VirtimagefileReadOnlyMany, apiv2.VirtimagefileReadWriteMany:
+		// nada
+	default:
+		return fmt.Errorf("Unknown access mode '%s'", file.Spec.AccessMode)
+	}
+
+	switch file.Spec.Stream.AccessMode {
+	case "":
+		// nada
+	case apiv2.VirtimagefileStreamUpload, apiv2.VirtimagefileStreamDownload, apiv2.VirtimagefileStreamBoth:
+		if file.Spec.Stream.TokenSecret == "" {
+			return fmt.Errorf("Stream access mode '%s' requires a token secret", file.Spec.Stream.AccessMode)
+		}
+	default:
+		return fmt.Errorf("Unknown stream access mode '%s'", file.Spec.Stream.AccessMode)
+	}
+
+	if file.Spec.Capacity == 0 {
+		return fmt.Errorf("Capacity must be greater than zero")
+	}
+
+	switch file.Spec.Format {
+	case "", "raw", "qcow2":
+		// nada
+	default:
+		return fmt.Errorf("Unknown image format '%s'", file.Spec.Format)
+	}
+
+	if err := validateSource(file); err != nil {
+		return err
+	}
+
+	if file.Spec.Revert != nil && (old == nil || !reflect.DeepEqual(file.Spec.Revert, old.Spec.Revert)) {
+		if err := r.validateRevert(file); err != nil {
+			return err
+		}
+	}
+
+	if old != nil {
+		if file.Spec.RepoName != old.Spec.RepoName {
+			return fmt.Errorf("Repo name cannot be changed from '%s'", old.Spec.RepoName)
+		}
+		if file.Spec.BackingImageFile != old.Spec.BackingImageFile {
+			return fmt.Errorf("Backing image file cannot be changed from '%s'", old.Spec.BackingImageFile)
+		}
+		// Volume names include the format, so the
+		// file would no longer be found
+		if file.Spec.Format != old.Spec.Format {
+			return fmt.Errorf("Format cannot be changed from '%s'", old.Spec.Format)
+		}
+		if !reflect.DeepEqual(file.Spec.Source, old.Spec.Source) {
+			return fmt.Errorf("Source cannot be changed")
+		}
+		if file.Spec.Capacity < old.Spec.Capacity {
+			return fmt.Errorf("Capacity cannot shrink from %d to %d", old.Spec.Capacity, file.Spec.Capacity)
+		}
+		// The repo may since have gone away, which
+		// mustn't block removing the file's finalizer
+		return nil
+	}
+
+	if file.Spec.RepoName == "" {
+		return fmt.Errorf("Repo name must not be empty")
+	}
+	if _, err := r.imageRepoLister.Get(v1.NamespaceDefault, file.Spec.RepoName); err != nil {
+		return fmt.Errorf("Unable to load image repo '%s': %s", file.Spec.RepoName, err)
+	}
+
+	if file.Spec.BackingImageFile != "" {
+		if _, err := r.imageFileLister.Get(v1.NamespaceDefault, file.Spec.BackingImageFile); err != nil {
+			return fmt.Errorf("Unable to load backing image file '%s': %s", file.Spec.BackingImageFile, err)
+		}
+	}
+
+	if file.Spec.Source != nil && file.Spec.Source.ImageFile != nil {
+		if err := r.validateCloneSource(file); err != nil {
+			return err
+		}
+	}
+	if file.Spec.Source != nil && file.Spec.Source.Snapshot != nil {
+		if err := r.validateSnapshotSource(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Rules) ValidateVirtimagerepo(repo, old *apiv2.Virtimagerepo) error {
+	switch repo.Spec.Format {
+	case "raw", "qcow2":
+		// nada
+	default:
+		return fmt.Errorf("Unknown image format '%s'", repo.Spec.Format)
+	}
+
+	if old != nil {
+		// Volume names include the format, so existing
+		// files would no longer be found
+		if repo.Spec.Format != old.Spec.Format {
+			return fmt.Errorf("Format cannot be changed from '%s'", old.Spec.Format)
+		}
+		if repo.Spec.ClaimName != old.Spec.ClaimName {
+			return fmt.Errorf("Claim name cannot be changed from '%s'", old.Spec.ClaimName)
+		}
+	}
+
+	return nil
+}
+
+func (r *Rules) ValidateVirtimagesnapshot(snapshot, old *apiv2.Virtimagesnapshot) error {
+	switch snapshot.Spec.Type {
+	case apiv2.VirtimagesnapshotInternal, apiv2.VirtimagesnapshotExternal:
+		// nada
+	default:
+		return fmt.Errorf("Unknown snapshot type '%s'", snapshot.Spec.Type)
+	}
+
+	if old != nil {
+		if snapshot.Spec.FileName != old.Spec.FileName {
+			return fmt.Errorf("File name cannot be changed from '%s'", old.Spec.FileName)
+		}
+		if snapshot.Spec.Type != old.Spec.Type {
+			return fmt.Errorf("Type cannot be changed from '%s'", old.Spec.Type)
+		}
+		return nil
+	}
+
+	if snapshot.Spec.FileName == "" {
+		return fmt.Errorf("File name must not be empty")
+	}
+	file, err := r.imageFileLister.Get(v1.NamespaceDefault, snapshot.Spec.FileName)
+	if err != nil {
+		return fmt.Errorf("Unable to load image file '%s': %s", snapshot.Spec.FileName, err)
+	}
+	repo, err := r.imageRepoLister.Get(v1.NamespaceDefault, file.Spec.RepoName)
+	if err != nil {
+		return fmt.Errorf("Unable to load image repo '%s': %s", file.Spec.RepoName, err)
+	}
+	if format := api.ImageFileFormat(file, repo); format != "qcow2" {
+		return fmt.Errorf("Image file '%s' uses format '%s', but snapshots need 'qcow2'", file.Metadata.Name, format)
+	}
+
+	return nil
+}
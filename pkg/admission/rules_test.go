@@ -0,0 +1,628 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package admission
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+	"libvirt.org/libvirt-kube/pkg/designer"
+)
+
+const mebibyte = 1024 * 1024
+
+func newIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// Rules whose listers hold the objects, as though the
+// informers had seen them
+func newTestRules(t *testing.T, objects ...interface{}) *Rules {
+	repos, files, snapshots, classes := newIndexer(), newIndexer(), newIndexer(), newIndexer()
+	for _, obj := range objects {
+		var indexer cache.Indexer
+		switch obj.(type) {
+		case *apiv2.Virtimagerepo:
+			indexer = repos
+		case *apiv2.Virtimagefile:
+			indexer = files
+		case *apiv2.Virtimagesnapshot:
+			indexer = snapshots
+		case *apiv2.Virtmachineclass:
+			indexer = classes
+		default:
+			t.Fatalf("No lister for %T", obj)
+		}
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewRules(nil,
+		api.NewVirtimagerepoLister(repos),
+		api.NewVirtimagefileLister(files),
+		api.NewVirtimagesnapshotLister(snapshots),
+		api.NewVirtmachineclassLister(classes),
+		designer.NewOverridePolicy([]string{"/domain/features"}))
+}
+
+func checkErr(t *testing.T, err error, want string) {
+	if want == "" {
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("Expected error containing '%s'", want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected error containing '%s', got '%s'", want, err)
+	}
+}
+
+func testRepo(name string) *apiv2.Virtimagerepo {
+	return &apiv2.Virtimagerepo{
+		Metadata: v1.ObjectMeta{
+			Name:      name,
+			Namespace: v1.NamespaceDefault,
+		},
+		Spec: apiv2.VirtimagerepoSpec{
+			ClaimName: name,
+			Format:    "raw",
+		},
+	}
+}
+
+func testFile(name, repo string) *apiv2.Virtimagefile {
+	return &apiv2.Virtimagefile{
+		Metadata: v1.ObjectMeta{
+			Name:      name,
+			Namespace: v1.NamespaceDefault,
+		},
+		Spec: apiv2.VirtimagefileSpec{
+			RepoName:   repo,
+			AccessMode: apiv2.VirtimagefileReadWriteOnce,
+			Capacity:   mebibyte,
+		},
+	}
+}
+
+func testSnapshot(name, file string, phase apiv2.VirtimagesnapshotPhase) *apiv2.Virtimagesnapshot {
+	return &apiv2.Virtimagesnapshot{
+		Metadata: v1.ObjectMeta{
+			Name:      name,
+			Namespace: v1.NamespaceDefault,
+		},
+		Spec: apiv2.VirtimagesnapshotSpec{
+			FileName: file,
+			Type:     apiv2.VirtimagesnapshotInternal,
+		},
+		Status: apiv2.VirtimagesnapshotStatus{
+			Phase: phase,
+		},
+	}
+}
+
+func testMachine() *apiv2.Virtmachine {
+	return &apiv2.Virtmachine{
+		Metadata: v1.ObjectMeta{
+			Name:      "vm",
+			Namespace: v1.NamespaceDefault,
+		},
+		Spec: apiv2.VirtmachineSpec{
+			Hardware: apiv2.VirtmachineHardware{
+				Arch: "x86_64",
+				Memory: apiv2.VirtmachineMemory{
+					Initial: 1024,
+				},
+			},
+		},
+	}
+}
+
+func TestValidateVirtmachine(t *testing.T) {
+	class := &apiv2.Virtmachineclass{
+		Metadata: v1.ObjectMeta{
+			Name: "small",
+		},
+		Spec: apiv2.VirtmachineclassSpec{
+			Hardware: testMachine().Spec.Hardware,
+		},
+	}
+	rules := newTestRules(t, class)
+
+	tests := []struct {
+		name string
+		// Validate as an update of the unmodified machine
+		update bool
+		modify func(machine *apiv2.Virtmachine)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(machine *apiv2.Virtmachine) {},
+		},
+		{
+			name: "memory not multiple of slots",
+			modify: func(machine *apiv2.Virtmachine) {
+				machine.Spec.Hardware.Memory.Maximum = 2048
+				machine.Spec.Hardware.Memory.Slots = 3
+			},
+			err: "must be multiple of slots 3",
+		},
+		{
+			name: "memory above maximum",
+			modify: func(machine *apiv2.Virtmachine) {
+				machine.Spec.Hardware.Memory.Maximum = 512
+			},
+			err: "must not exceed maximum 512",
+		},
+		{
+			name: "direct boot without kernel",
+			modify: func(machine *apiv2.Virtmachine) {
+				machine.Spec.Hardware.Boot.Type = "direct"
+			},
+			err: "Boot type 'direct' requires a kernel",
+		},
+		{
+			name: "unknown boot type",
+			modify: func(machine *apiv2.Virtmachine) {
+				machine.Spec.Hardware.Boot.Type = "pxe"
+			},
+			err: "Unknown boot type 'pxe'",
+		},
+		{
+			name: "class",
+			modify: func(machine *apiv2.Virtmachine) {
+				machine.Spec.Class = "small"
+				machine.Spec.Hardware = apiv2.VirtmachineHardware{}
+			},
+		},
+		{
+			name: "missing class",
+			modify: func(machine *apiv2.Virtmachine) {
+				machine.Spec.Class = "large"
+			},
+			err: "Unable to load machine class 'large'",
+		},
+		{
+			name: "forbidden override",
+			modify: func(machine *apiv2.Virtmachine) {
+				machine.Spec.Overrides = []apiv2.VirtmachineOverride{
+					{
+						Name: "clock",
+						XML:  `<domain><clock offset="utc"/></domain>`,
+					},
+				}
+			},
+			err: "Override 'clock' rejected",
+		},
+		{
+			name:   "unchanged spec",
+			update: true,
+			modify: func(machine *apiv2.Virtmachine) {
+				// Only the spec is validated
+				machine.Spec.Hardware.Boot.Type = "pxe"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			machine := testMachine()
+			test.modify(machine)
+			var old *apiv2.Virtmachine
+			if test.update {
+				old = api.DeepCopyVirtmachine(machine)
+				machine.Metadata.Labels = map[string]string{"changed": "yes"}
+			}
+			checkErr(t, rules.ValidateVirtmachine(machine, old), test.err)
+		})
+	}
+}
+
+func TestValidateVirtimagefile(t *testing.T) {
+	base := testFile("base", "repo")
+	overlay := testFile("overlay", "repo")
+	overlay.Spec.BackingImageFile = "base"
+	far := testFile("far", "other")
+	large := testFile("large", "repo")
+	large.Spec.Capacity = 2 * mebibyte
+
+	rules := newTestRules(t,
+		testRepo("repo"), testRepo("other"),
+		base, overlay, far, large, testFile("disk", "repo"),
+		testSnapshot("snap", "disk", apiv2.VirtimagesnapshotReady),
+		testSnapshot("pending", "disk", apiv2.VirtimagesnapshotPending),
+		testSnapshot("failed", "base", apiv2.VirtimagesnapshotFailed),
+		testSnapshot("basesnap", "base", apiv2.VirtimagesnapshotReady),
+		testSnapshot("farsnap", "far", apiv2.VirtimagesnapshotReady))
+
+	tests := []struct {
+		name string
+		// Validate as an update of the unmodified file
+		update bool
+		modify func(file *apiv2.Virtimagefile)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(file *apiv2.Virtimagefile) {},
+		},
+		{
+			name: "missing repo name",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.RepoName = ""
+			},
+			err: "Repo name must not be empty",
+		},
+		{
+			name: "unknown repo",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.RepoName = "nowhere"
+			},
+			err: "Unable to load image repo 'nowhere'",
+		},
+		{
+			name: "zero capacity",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Capacity = 0
+			},
+			err: "Capacity must be greater than zero",
+		},
+		{
+			name: "unknown access mode",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.AccessMode = "ReadWriteSometimes"
+			},
+			err: "Unknown access mode",
+		},
+		{
+			name: "stream without token",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Stream.AccessMode = apiv2.VirtimagefileStreamUpload
+			},
+			err: "requires a token secret",
+		},
+		{
+			name: "unknown format",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Format = "vmdk"
+			},
+			err: "Unknown image format 'vmdk'",
+		},
+		{
+			name: "missing backing file",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.BackingImageFile = "nothing"
+			},
+			err: "Unable to load backing image file 'nothing'",
+		},
+		{
+			name: "two sources",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					HTTP:      &apiv2.VirtimagefileSourceHTTP{URL: "https://example.com/disk.qcow2"},
+					ImageFile: &apiv2.VirtimagefileSourceImageFile{Name: "base"},
+				}
+			},
+			err: "exactly one place",
+		},
+		{
+			name: "source URL scheme",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					HTTP: &apiv2.VirtimagefileSourceHTTP{URL: "file:///etc/shadow"},
+				}
+			},
+			err: "must be http or https",
+		},
+		{
+			name: "source digest",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					HTTP: &apiv2.VirtimagefileSourceHTTP{
+						URL:    "https://example.com/disk.qcow2",
+						SHA256: "abcd",
+					},
+				}
+			},
+			err: "Digest sha256 must be 64 hex digits",
+		},
+		{
+			name: "clone of itself",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					ImageFile: &apiv2.VirtimagefileSourceImageFile{Name: "new"},
+				}
+			},
+			err: "cannot be cloned from itself",
+		},
+		{
+			name: "clone of larger file",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					ImageFile: &apiv2.VirtimagefileSourceImageFile{Name: "large"},
+				}
+			},
+			err: "is smaller than source image file 'large'",
+		},
+		{
+			name: "clone of overlay",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					ImageFile: &apiv2.VirtimagefileSourceImageFile{Name: "overlay"},
+				}
+			},
+			err: "has a backing image file",
+		},
+		{
+			name: "clone from repo without downloads",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					ImageFile: &apiv2.VirtimagefileSourceImageFile{Name: "far"},
+				}
+			},
+			err: "must permit downloads",
+		},
+		{
+			name: "snapshot source",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					Snapshot: &apiv2.VirtimagefileSourceSnapshot{Name: "snap"},
+				}
+			},
+		},
+		{
+			name: "failed snapshot source",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					Snapshot: &apiv2.VirtimagefileSourceSnapshot{Name: "failed"},
+				}
+			},
+			err: "Source snapshot 'failed' failed",
+		},
+		{
+			name: "snapshot source in other repo",
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					Snapshot: &apiv2.VirtimagefileSourceSnapshot{Name: "farsnap"},
+				}
+			},
+			err: "is of a file in repo 'other'",
+		},
+		{
+			name:   "growing capacity",
+			update: true,
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Capacity = 2 * mebibyte
+			},
+		},
+		{
+			name:   "shrinking capacity",
+			update: true,
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Capacity = mebibyte / 2
+			},
+			err: "Capacity cannot shrink",
+		},
+		{
+			name:   "changing repo name",
+			update: true,
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.RepoName = "other"
+			},
+			err: "Repo name cannot be changed from 'repo'",
+		},
+		{
+			name:   "changing format",
+			update: true,
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Format = "qcow2"
+			},
+			err: "Format cannot be changed",
+		},
+		{
+			name:   "changing source",
+			update: true,
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Spec.Source = &apiv2.VirtimagefileSource{
+					HTTP: &apiv2.VirtimagefileSourceHTTP{URL: "https://example.com/disk.qcow2"},
+				}
+			},
+			err: "Source cannot be changed",
+		},
+		{
+			name:   "revert",
+			update: true,
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Metadata.Name = "disk"
+				file.Spec.Revert = &apiv2.VirtimagefileRevert{Snapshot: "snap"}
+			},
+		},
+		{
+			name:   "revert to pending snapshot",
+			update: true,
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Metadata.Name = "disk"
+				file.Spec.Revert = &apiv2.VirtimagefileRevert{Snapshot: "pending"}
+			},
+			err: "Snapshot 'pending' is not ready",
+		},
+		{
+			name:   "revert to snapshot of other file",
+			update: true,
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Metadata.Name = "disk"
+				file.Spec.Revert = &apiv2.VirtimagefileRevert{Snapshot: "basesnap"}
+			},
+			err: "Snapshot 'basesnap' is of image file 'base'",
+		},
+		{
+			name:   "revert of backing file",
+			update: true,
+			modify: func(file *apiv2.Virtimagefile) {
+				file.Metadata.Name = "base"
+				file.Spec.Revert = &apiv2.VirtimagefileRevert{Snapshot: "basesnap"}
+			},
+			err: "backing image file of 'overlay'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := testFile("new", "repo")
+			var old *apiv2.Virtimagefile
+			if test.update {
+				old = testFile("new", "repo")
+			}
+			test.modify(file)
+			if old != nil {
+				old.Metadata.Name = file.Metadata.Name
+			}
+			checkErr(t, rules.ValidateVirtimagefile(file, old), test.err)
+		})
+	}
+}
+
+func TestValidateVirtimagesnapshot(t *testing.T) {
+	disk := testFile("disk", "repo")
+	disk.Spec.Format = "qcow2"
+	rules := newTestRules(t, testRepo("repo"), disk, testFile("rawdisk", "repo"))
+
+	tests := []struct {
+		name   string
+		update bool
+		modify func(snapshot *apiv2.Virtimagesnapshot)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(snapshot *apiv2.Virtimagesnapshot) {},
+		},
+		{
+			name: "unknown type",
+			modify: func(snapshot *apiv2.Virtimagesnapshot) {
+				snapshot.Spec.Type = "Live"
+			},
+			err: "Unknown snapshot type 'Live'",
+		},
+		{
+			name: "missing file",
+			modify: func(snapshot *apiv2.Virtimagesnapshot) {
+				snapshot.Spec.FileName = "nothing"
+			},
+			err: "Unable to load image file 'nothing'",
+		},
+		{
+			name: "raw file",
+			modify: func(snapshot *apiv2.Virtimagesnapshot) {
+				snapshot.Spec.FileName = "rawdisk"
+			},
+			err: "snapshots need 'qcow2'",
+		},
+		{
+			name:   "changing file",
+			update: true,
+			modify: func(snapshot *apiv2.Virtimagesnapshot) {
+				snapshot.Spec.FileName = "rawdisk"
+			},
+			err: "File name cannot be changed from 'disk'",
+		},
+		{
+			name:   "changing type",
+			update: true,
+			modify: func(snapshot *apiv2.Virtimagesnapshot) {
+				snapshot.Spec.Type = apiv2.VirtimagesnapshotExternal
+			},
+			err: "Type cannot be changed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := testSnapshot("snap", "disk", "")
+			var old *apiv2.Virtimagesnapshot
+			if test.update {
+				old = testSnapshot("snap", "disk", "")
+			}
+			test.modify(snapshot)
+			checkErr(t, rules.ValidateVirtimagesnapshot(snapshot, old), test.err)
+		})
+	}
+}
+
+func TestValidateVirtimagerepo(t *testing.T) {
+	rules := newTestRules(t)
+
+	tests := []struct {
+		name   string
+		update bool
+		modify func(repo *apiv2.Virtimagerepo)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(repo *apiv2.Virtimagerepo) {},
+		},
+		{
+			name: "unknown format",
+			modify: func(repo *apiv2.Virtimagerepo) {
+				repo.Spec.Format = "vmdk"
+			},
+			err: "Unknown image format 'vmdk'",
+		},
+		{
+			name:   "changing format",
+			update: true,
+			modify: func(repo *apiv2.Virtimagerepo) {
+				repo.Spec.Format = "qcow2"
+			},
+			err: "Format cannot be changed from 'raw'",
+		},
+		{
+			name:   "changing claim",
+			update: true,
+			modify: func(repo *apiv2.Virtimagerepo) {
+				repo.Spec.ClaimName = "elsewhere"
+			},
+			err: "Claim name cannot be changed from 'repo'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := testRepo("repo")
+			var old *apiv2.Virtimagerepo
+			if test.update {
+				old = testRepo("repo")
+			}
+			test.modify(repo)
+			checkErr(t, rules.ValidateVirtimagerepo(repo, old), test.err)
+		})
+	}
+}
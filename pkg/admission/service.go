@@ -0,0 +1,422 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+// Package admission implements the webhooks the apiserver calls
+// before saving libvirt.org resources, to fill in defaults and
+// reject specs the daemons would be unable to apply
+package admission
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+	admissionv1 "k8s.io/api/admission/v1"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+	"libvirt.org/libvirt-kube/pkg/designer"
+)
+
+const resyncPeriod = 5 * time.Minute
+
+// Where the apiserver finds us, as in the manifests
+const (
+	serviceName      = "virtkubeadmission"
+	serviceNamespace = "libvirt-kube"
+)
+
+type Service struct {
+	addr      string
+	tlsConfig *tls.Config
+	informers *api.InformerFactory
+	rules     *Rules
+}
+
+func getKubeConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	return rest.InClusterConfig()
+}
+
+// The apiserver calls the conversion webhook with the same CA
+// bundle as the admission webhooks
+func conversionWebhook(cacertfile string) (*apiextv1.WebhookClientConfig, error) {
+	cabundle, err := ioutil.ReadFile(cacertfile)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/convert"
+	return &apiextv1.WebhookClientConfig{
+		Service: &apiextv1.ServiceReference{
+			Name:      serviceName,
+			Namespace: serviceNamespace,
+			Path:      &path,
+		},
+		CABundle: cabundle,
+	}, nil
+}
+
+// NewService creates the service. If cacertfile is set, resource
+// definitions are registered with the conversion webhook, so that
+// their v1alpha1 versions are served
+func NewService(addr string, tlsConfig *tls.Config, kubeconfigfile string, cacertfile string, overrideAllow []string) (*Service, error) {
+	kubeconfig, err := getKubeConfig(kubeconfigfile)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacertfile != "" {
+		webhook, err := conversionWebhook(cacertfile)
+		if err != nil {
+			return nil, err
+		}
+		api.SetConversionWebhook(webhook)
+	}
+
+	clientset, err := kubernetes.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.RegisterVirtimagerepo(clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.RegisterVirtimagefile(clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.RegisterVirtimagesnapshot(clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.RegisterVirtmachineclass(clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.RegisterVirtmachine(clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.RegisterVirtnodeinfo(clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	apiclientset, err := api.NewClientset(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewServiceWithClients(addr, tlsConfig, clientset, apiclientset, overrideAllow)
+}
+
+// NewServiceWithClients creates the service using the clients given,
+// which may be fakes. The resource definitions must already be
+// registered
+func NewServiceWithClients(addr string, tlsConfig *tls.Config, clientset kubernetes.Interface, apiclientset api.Interface, overrideAllow []string) (*Service, error) {
+	informers := api.NewInformerFactory(apiclientset, v1.NamespaceDefault, resyncPeriod)
+
+	rules := NewRules(clientset,
+		informers.VirtimagerepoLister(),
+		informers.VirtimagefileLister(),
+		informers.VirtimagesnapshotLister(),
+		informers.VirtmachineclassLister(),
+		designer.NewOverridePolicy(overrideAllow))
+
+	return &Service{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+		informers: informers,
+		rules:     rules,
+	}, nil
+}
+
+// Decode the object, and the object it replaces for updates,
+// into new instances of the type of obj
+func decodeRequest(req *admissionv1.AdmissionRequest, obj runtime.Object) (runtime.Object, runtime.Object, error) {
+	newobj := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err := json.Unmarshal(req.Object.Raw, newobj); err != nil {
+		return nil, nil, err
+	}
+
+	if req.Operation != admissionv1.Update {
+		return newobj, nil, nil
+	}
+	oldobj := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err := json.Unmarshal(req.OldObject.Raw, oldobj); err != nil {
+		return nil, nil, err
+	}
+	return newobj, oldobj, nil
+}
+
+// Replace the whole spec when defaulting changed it
+func specPatch(orig, spec interface{}) ([]byte, error) {
+	if reflect.DeepEqual(orig, spec) {
+		return nil, nil
+	}
+
+	return json.Marshal([]map[string]interface{}{
+		{
+			"op":    "add",
+			"path":  "/spec",
+			"value": spec,
+		},
+	})
+}
+
+func (s *Service) mutate(req *admissionv1.AdmissionRequest) ([]byte, error) {
+	switch req.Resource.Resource {
+	case "virtmachines":
+		obj, _, err := decodeRequest(req, &apiv2.Virtmachine{})
+		if err != nil {
+			return nil, err
+		}
+		machine := obj.(*apiv2.Virtmachine)
+		orig := api.DeepCopyVirtmachine(machine)
+		if err := s.rules.DefaultVirtmachine(machine); err != nil {
+			return nil, err
+		}
+		return specPatch(orig.Spec, machine.Spec)
+
+	case "virtimagefiles":
+		obj, _, err := decodeRequest(req, &apiv2.Virtimagefile{})
+		if err != nil {
+			return nil, err
+		}
+		file := obj.(*apiv2.Virtimagefile)
+		orig := api.DeepCopyVirtimagefile(file)
+		if err := s.rules.DefaultVirtimagefile(file); err != nil {
+			return nil, err
+		}
+		return specPatch(orig.Spec, file.Spec)
+
+	case "virtimagerepos":
+		obj, _, err := decodeRequest(req, &apiv2.Virtimagerepo{})
+		if err != nil {
+			return nil, err
+		}
+		repo := obj.(*apiv2.Virtimagerepo)
+		orig := api.DeepCopyVirtimagerepo(repo)
+		if err := s.rules.DefaultVirtimagerepo(repo); err != nil {
+			return nil, err
+		}
+		return specPatch(orig.Spec, repo.Spec)
+
+	case "virtimagesnapshots":
+		obj, _, err := decodeRequest(req, &apiv2.Virtimagesnapshot{})
+		if err != nil {
+			return nil, err
+		}
+		snapshot := obj.(*apiv2.Virtimagesnapshot)
+		orig := api.DeepCopyVirtimagesnapshot(snapshot)
+		if err := s.rules.DefaultVirtimagesnapshot(snapshot); err != nil {
+			return nil, err
+		}
+		return specPatch(orig.Spec, snapshot.Spec)
+
+	case "virtmachineclasses":
+		// Unset fields are deliberately left for machines
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("Unexpected resource '%s'", req.Resource.Resource)
+	}
+}
+
+func (s *Service) validate(req *admissionv1.AdmissionRequest) error {
+	switch req.Resource.Resource {
+	case "virtmachines":
+		obj, old, err := decodeRequest(req, &apiv2.Virtmachine{})
+		if err != nil {
+			return err
+		}
+		var oldmachine *apiv2.Virtmachine
+		if old != nil {
+			oldmachine = old.(*apiv2.Virtmachine)
+		}
+		return s.rules.ValidateVirtmachine(obj.(*apiv2.Virtmachine), oldmachine)
+
+	case "virtmachineclasses":
+		obj, old, err := decodeRequest(req, &apiv2.Virtmachineclass{})
+		if err != nil {
+			return err
+		}
+		var oldclass *apiv2.Virtmachineclass
+		if old != nil {
+			oldclass = old.(*apiv2.Virtmachineclass)
+		}
+		return s.rules.ValidateVirtmachineclass(obj.(*apiv2.Virtmachineclass), oldclass)
+
+	case "virtimagefiles":
+		obj, old, err := decodeRequest(req, &apiv2.Virtimagefile{})
+		if err != nil {
+			return err
+		}
+		var oldfile *apiv2.Virtimagefile
+		if old != nil {
+			oldfile = old.(*apiv2.Virtimagefile)
+		}
+		return s.rules.ValidateVirtimagefile(obj.(*apiv2.Virtimagefile), oldfile)
+
+	case "virtimagerepos":
+		obj, old, err := decodeRequest(req, &apiv2.Virtimagerepo{})
+		if err != nil {
+			return err
+		}
+		var oldrepo *apiv2.Virtimagerepo
+		if old != nil {
+			oldrepo = old.(*apiv2.Virtimagerepo)
+		}
+		return s.rules.ValidateVirtimagerepo(obj.(*apiv2.Virtimagerepo), oldrepo)
+
+	case "virtimagesnapshots":
+		obj, old, err := decodeRequest(req, &apiv2.Virtimagesnapshot{})
+		if err != nil {
+			return err
+		}
+		var oldsnapshot *apiv2.Virtimagesnapshot
+		if old != nil {
+			oldsnapshot = old.(*apiv2.Virtimagesnapshot)
+		}
+		return s.rules.ValidateVirtimagesnapshot(obj.(*apiv2.Virtimagesnapshot), oldsnapshot)
+
+	default:
+		return fmt.Errorf("Unexpected resource '%s'", req.Resource.Resource)
+	}
+}
+
+func denied(err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &v1.Status{
+			Status:  v1.StatusFailure,
+			Message: err.Error(),
+			Reason:  v1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
+
+func (s *Service) review(w http.ResponseWriter, r *http.Request, handle func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("Cannot parse admission review: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	req := review.Request
+	glog.V(1).Infof("Review %s %s %s/%s", r.URL.Path, req.Operation, req.Namespace, req.Name)
+	resp := handle(req)
+	resp.UID = req.UID
+	if !resp.Allowed {
+		glog.V(1).Infof("Denied %s/%s: %s", req.Namespace, req.Name, resp.Result.Message)
+	}
+
+	review.Request = nil
+	review.Response = resp
+	data, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *Service) handleMutate(w http.ResponseWriter, r *http.Request) {
+	s.review(w, r, func(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		patch, err := s.mutate(req)
+		if err != nil {
+			return denied(err)
+		}
+
+		resp := &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+		if patch != nil {
+			patchType := admissionv1.PatchTypeJSONPatch
+			resp.Patch = patch
+			resp.PatchType = &patchType
+		}
+		return resp
+	})
+}
+
+func (s *Service) handleValidate(w http.ResponseWriter, r *http.Request) {
+	s.review(w, r, func(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		if err := s.validate(req); err != nil {
+			return denied(err)
+		}
+
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	})
+}
+
+func (s *Service) Run() error {
+	stop := make(chan struct{})
+	defer close(stop)
+	s.informers.Start(stop)
+	if err := s.informers.WaitForCacheSync(stop); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mutate", s.handleMutate)
+	mux.HandleFunc("/validate", s.handleValidate)
+	mux.HandleFunc("/convert", s.handleConvert)
+
+	server := &http.Server{
+		Addr:      s.addr,
+		Handler:   mux,
+		TLSConfig: s.tlsConfig,
+	}
+
+	glog.V(1).Infof("Running on %s", s.addr)
+	// Certificates are already in the TLS config
+	return server.ListenAndServeTLS("", "")
+}
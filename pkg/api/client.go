@@ -0,0 +1,339 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+var registerConversionsOnce sync.Once
+
+func registerConversions() {
+	registerConversionsOnce.Do(func() {
+		if err := apiv2.RegisterConversions(scheme.Scheme); err != nil {
+			glog.Errorf("Unable to register conversions %s", err)
+		}
+		if err := apiv2.RegisterDefaults(scheme.Scheme); err != nil {
+			glog.Errorf("Unable to register defaults %s", err)
+		}
+	})
+}
+
+func RegisterResourceScheme(group string, version string, obj, objlist runtime.Object) {
+	schemeBuilder := runtime.NewSchemeBuilder(
+		func(scheme *runtime.Scheme) error {
+			scheme.AddKnownTypes(
+				schema.GroupVersion{
+					Group:   group,
+					Version: version,
+				},
+				obj,
+				objlist,
+				&v1.ListOptions{},
+				&v1.DeleteOptions{},
+			)
+			return nil
+		})
+	schemeBuilder.AddToScheme(scheme.Scheme)
+	registerConversions()
+}
+
+// convertObject converts an object decoded from any registered
+// version into the type of out, applying defaults for unset fields
+func convertObject(in, out runtime.Object) error {
+	if reflect.TypeOf(in) == reflect.TypeOf(out) {
+		reflect.ValueOf(out).Elem().Set(reflect.ValueOf(in).Elem())
+	} else {
+		if err := scheme.Scheme.Convert(in, out, nil); err != nil {
+			return err
+		}
+	}
+	scheme.Scheme.Default(out)
+	return nil
+}
+
+// decodeObject decodes an object which may have been stored under
+// an older version, converting it to the type of obj
+func decodeObject(data []byte, obj runtime.Object) error {
+	stored, _, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return err
+	}
+	return convertObject(stored, obj)
+}
+
+func GetResourceClient(config *rest.Config, group string, version string) (*rest.RESTClient, error) {
+	var resconfig rest.Config
+	resconfig = *config
+
+	resconfig.GroupVersion = &schema.GroupVersion{
+		Group:   group,
+		Version: version,
+	}
+	resconfig.APIPath = "/apis"
+	resconfig.ContentType = runtime.ContentTypeJSON
+	resconfig.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+
+	return rest.RESTClientFor(&resconfig)
+}
+
+type ResourceClient struct {
+	ResourceName string
+	Namespace    string
+	Rest         *rest.RESTClient
+}
+
+type ResourceObject interface {
+	runtime.Object
+	v1.ObjectMetaAccessor
+}
+
+type ResourceObjectList interface {
+	runtime.Object
+	v1.ListMetaAccessor
+}
+
+type rawList struct {
+	Metadata v1.ListMeta       `json:"metadata"`
+	Items    []json.RawMessage `json:"items"`
+}
+
+// A not found error callers can check for with errors.IsNotFound
+func (c *ResourceClient) notFound(name string) error {
+	return errors.NewNotFound(schema.GroupResource{
+		Group:    c.Rest.APIVersion().Group,
+		Resource: c.ResourceName,
+	}, c.Namespace+"/"+name)
+}
+
+// Add the selectors and paging parameters to a list or
+// watch request
+func withListOptions(req *rest.Request, opts *v1.ListOptions) *rest.Request {
+	if opts.LabelSelector != "" {
+		req = req.Param("labelSelector", opts.LabelSelector)
+	}
+	if opts.FieldSelector != "" {
+		req = req.Param("fieldSelector", opts.FieldSelector)
+	}
+	if opts.ResourceVersion != "" {
+		req = req.Param("resourceVersion", opts.ResourceVersion)
+	}
+	if opts.TimeoutSeconds != nil {
+		req = req.Param("timeoutSeconds", strconv.FormatInt(*opts.TimeoutSeconds, 10))
+	}
+	if opts.Limit != 0 {
+		req = req.Param("limit", strconv.FormatInt(opts.Limit, 10))
+	}
+	if opts.Continue != "" {
+		req = req.Param("continue", opts.Continue)
+	}
+	return req
+}
+
+// List returns the raw data of every item, since each item
+// may have been stored with a different version
+func (c *ResourceClient) List(opts v1.ListOptions, meta *v1.ListMeta) ([]json.RawMessage, error) {
+	req := c.Rest.Get().Resource(c.ResourceName).Namespace(c.Namespace)
+	res := withListOptions(req, &opts).Do()
+	if err := res.Error(); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("Resource type '%s' namespace '%s' was not found", c.ResourceName, c.Namespace)
+		}
+		return nil, err
+	}
+	data, err := res.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	var list rawList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	*meta = list.Metadata
+	return list.Items, nil
+}
+
+func (c *ResourceClient) Get(name string, obj ResourceObject) error {
+	res := c.Rest.Get().Resource(c.ResourceName).Namespace(c.Namespace).Name(name).Do()
+	if err := res.Error(); err != nil {
+		if errors.IsNotFound(err) {
+			return c.notFound(name)
+		}
+		return err
+	}
+	data, err := res.Raw()
+	if err != nil {
+		return err
+	}
+	return decodeObject(data, obj)
+}
+
+func (c *ResourceClient) Put(obj ResourceObject) error {
+	name := obj.GetObjectMeta().GetName()
+	res := c.Rest.Put().Resource(c.ResourceName).Namespace(c.Namespace).Name(name).Body(obj).Do()
+	if err := res.Error(); err != nil {
+		return err
+	}
+	return res.Into(obj)
+}
+
+// The JSON of just the status of an object
+func statusJSON(obj ResourceObject) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	status, ok := fields["status"]
+	if !ok {
+		return []byte("{}"), nil
+	}
+	return status, nil
+}
+
+// StatusMergePatch returns a merge patch of the changes made to
+// the status of obj since orig was read, or nil if there are none
+func StatusMergePatch(orig, obj ResourceObject) ([]byte, error) {
+	origStatus, err := statusJSON(orig)
+	if err != nil {
+		return nil, err
+	}
+	newStatus, err := statusJSON(obj)
+	if err != nil {
+		return nil, err
+	}
+	delta, err := jsonpatch.CreateMergePatch(origStatus, newStatus)
+	if err != nil {
+		return nil, err
+	}
+	if string(delta) == "{}" {
+		return nil, nil
+	}
+
+	return json.Marshal(map[string]json.RawMessage{"status": delta})
+}
+
+// PatchStatus writes the changes made to the status of obj since
+// orig was read, as a merge patch of the status subresource. The
+// apiserver applies the patch to the latest version of the object,
+// so it can't conflict with other writers, and fields which were
+// not changed are left alone. obj is replaced with the result
+func (c *ResourceClient) PatchStatus(orig, obj ResourceObject) error {
+	patch, err := StatusMergePatch(orig, obj)
+	if err != nil {
+		return err
+	}
+	if patch == nil {
+		// Nothing changed
+		return nil
+	}
+
+	name := obj.GetObjectMeta().GetName()
+	res := c.Rest.Patch(types.MergePatchType).Resource(c.ResourceName).Namespace(c.Namespace).Name(name).SubResource("status").Body(patch).Do()
+	if err := res.Error(); err != nil {
+		if errors.IsNotFound(err) {
+			return c.notFound(name)
+		}
+		return err
+	}
+	data, err := res.Raw()
+	if err != nil {
+		return err
+	}
+	return decodeObject(data, obj)
+}
+
+func (c *ResourceClient) Post(obj ResourceObject) error {
+	res := c.Rest.Post().Resource(c.ResourceName).Namespace(c.Namespace).Body(obj).Do()
+	if err := res.Error(); err != nil {
+		return err
+	}
+	return res.Into(obj)
+}
+
+// Patch applies a JSON, merge or strategic merge patch to
+// the named object, storing the result in obj
+func (c *ResourceClient) Patch(name string, pt types.PatchType, patch []byte, obj ResourceObject) error {
+	res := c.Rest.Patch(pt).Resource(c.ResourceName).Namespace(c.Namespace).Name(name).Body(patch).Do()
+	if err := res.Error(); err != nil {
+		if errors.IsNotFound(err) {
+			return c.notFound(name)
+		}
+		return err
+	}
+	data, err := res.Raw()
+	if err != nil {
+		return err
+	}
+	return decodeObject(data, obj)
+}
+
+// Delete removes the named object. The options, which may be
+// nil, control preconditions, the grace period and whether
+// dependents are deleted in the background, in the
+// foreground, or orphaned
+func (c *ResourceClient) Delete(name string, opts *v1.DeleteOptions) error {
+	req := c.Rest.Delete().Resource(c.ResourceName).Namespace(c.Namespace).Name(name)
+	if opts != nil {
+		data, err := json.Marshal(opts)
+		if err != nil {
+			return err
+		}
+		req = req.Body(data)
+	}
+	err := req.Do().Error()
+	if errors.IsNotFound(err) {
+		return c.notFound(name)
+	}
+	return err
+}
+
+func (c *ResourceClient) watchFrom(opts v1.ListOptions, newObj func() runtime.Object) (watch.Interface, error) {
+	req := c.Rest.Get().Resource(c.ResourceName).Namespace(c.Namespace).Param("watch", "true")
+	w, err := withListOptions(req, &opts).Watch()
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+		if in.Type == watch.Error {
+			return in, true
+		}
+		out := newObj()
+		if err := convertObject(in.Object, out); err != nil {
+			glog.Errorf("Unable to convert %s object %s", c.ResourceName, err)
+			return in, false
+		}
+		in.Object = out
+		return in, true
+	}), nil
+}
+
+// Watch reports changes to objects, converting every object
+// to the type returned by newObj. If the connection to the
+// apiserver drops, the watch is restarted from the last
+// resource version seen, so no events are lost or replayed
+func (c *ResourceClient) Watch(opts v1.ListOptions, newObj func() runtime.Object) (watch.Interface, error) {
+	return newResumableWatch(opts.ResourceVersion, func(resourceVersion string) (watch.Interface, error) {
+		opts.ResourceVersion = resourceVersion
+		return c.watchFrom(opts, newObj)
+	})
+}
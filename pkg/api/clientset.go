@@ -0,0 +1,75 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"k8s.io/client-go/rest"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// Clientset provides clients for every libvirt.org resource,
+// in any namespace, sharing a single REST client. Passing an
+// empty namespace lists & watches across all namespaces
+type Clientset struct {
+	rest *rest.RESTClient
+}
+
+func NewClientset(kubeconfig *rest.Config) (*Clientset, error) {
+	client, err := GetResourceClient(kubeconfig, "libvirt.org", apiv2.SchemeGroupVersion.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &Clientset{
+		rest: client,
+	}, nil
+}
+
+func (c *Clientset) resource(name, namespace string) ResourceClient {
+	return ResourceClient{
+		ResourceName: name,
+		Namespace:    namespace,
+		Rest:         c.rest,
+	}
+}
+
+func (c *Clientset) Virtmachines(namespace string) VirtmachineInterface {
+	return &VirtmachineClient{client: c.resource("virtmachines", namespace)}
+}
+
+func (c *Clientset) Virtmachineclasses() VirtmachineclassInterface {
+	return &VirtmachineclassClient{client: c.resource("virtmachineclasses", "")}
+}
+
+func (c *Clientset) Virtimagefiles(namespace string) VirtimagefileInterface {
+	return &VirtimagefileClient{client: c.resource("virtimagefiles", namespace)}
+}
+
+func (c *Clientset) Virtimagerepos(namespace string) VirtimagerepoInterface {
+	return &VirtimagerepoClient{client: c.resource("virtimagerepos", namespace)}
+}
+
+func (c *Clientset) Virtimagesnapshots(namespace string) VirtimagesnapshotInterface {
+	return &VirtimagesnapshotClient{client: c.resource("virtimagesnapshots", namespace)}
+}
+
+func (c *Clientset) Virtnodes(namespace string) VirtnodeinfoInterface {
+	return &VirtnodeinfoClient{client: c.resource("virtnodes", namespace)}
+}
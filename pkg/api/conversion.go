@@ -0,0 +1,91 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// The types of each kind served at both versions
+var versionedKinds = map[string]map[string]func() runtime.Object{
+	"Virtmachine": {
+		apiv1.SchemeGroupVersion.String(): func() runtime.Object { return &apiv1.Virtmachine{} },
+		apiv2.SchemeGroupVersion.String(): func() runtime.Object { return &apiv2.Virtmachine{} },
+	},
+	"Virtimagefile": {
+		apiv1.SchemeGroupVersion.String(): func() runtime.Object { return &apiv1.Virtimagefile{} },
+		apiv2.SchemeGroupVersion.String(): func() runtime.Object { return &apiv2.Virtimagefile{} },
+	},
+	"Virtimagerepo": {
+		apiv1.SchemeGroupVersion.String(): func() runtime.Object { return &apiv1.Virtimagerepo{} },
+		apiv2.SchemeGroupVersion.String(): func() runtime.Object { return &apiv2.Virtimagerepo{} },
+	},
+	"Virtnode": {
+		apiv1.SchemeGroupVersion.String(): func() runtime.Object { return &apiv1.Virtnode{} },
+		apiv2.SchemeGroupVersion.String(): func() runtime.Object { return &apiv2.Virtnode{} },
+	},
+}
+
+func newVersionedObject(kind, apiVersion string) (runtime.Object, error) {
+	newobj, ok := versionedKinds[kind][apiVersion]
+	if !ok {
+		return nil, fmt.Errorf("Cannot convert %s %s", apiVersion, kind)
+	}
+	return newobj(), nil
+}
+
+// ConvertObject converts the JSON of a resource to another API
+// version, as the conversion webhook asks
+func ConvertObject(data []byte, apiVersion string) ([]byte, error) {
+	registerConversions()
+
+	var meta v1.TypeMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	if meta.APIVersion == apiVersion {
+		return data, nil
+	}
+
+	in, err := newVersionedObject(meta.Kind, meta.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	out, err := newVersionedObject(meta.Kind, apiVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, in); err != nil {
+		return nil, err
+	}
+	if err := scheme.Scheme.Convert(in, out, nil); err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,255 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+const crdPath = "/apis/apiextensions.k8s.io/v1/customresourcedefinitions"
+
+// The webhook converting between versions of a resource, if any
+var conversionWebhook *apiextv1.WebhookClientConfig
+
+// SetConversionWebhook makes resource definitions registered
+// afterwards convert objects to and from the v1alpha2 storage
+// version with the webhook, rather than just relabelling them
+func SetConversionWebhook(config *apiextv1.WebhookClientConfig) {
+	conversionWebhook = config
+}
+
+// ResourceDefinition describes a custom resource, whose
+// validation schema is generated from the type of Object
+type ResourceDefinition struct {
+	Group  string
+	Kind   string
+	Plural string
+	Object interface{}
+	// The v1alpha1 type, if the resource had one, which is
+	// served alongside the current one
+	Legacy interface{}
+	// Defaults to namespaced when empty
+	Scope apiextv1.ResourceScope
+	// Extra columns shown by 'kubectl get'
+	Columns []apiextv1.CustomResourceColumnDefinition
+}
+
+func (def *ResourceDefinition) name() string {
+	return def.Plural + "." + def.Group
+}
+
+func (def *ResourceDefinition) scope() apiextv1.ResourceScope {
+	if def.Scope == "" {
+		return apiextv1.NamespaceScoped
+	}
+	return def.Scope
+}
+
+func (def *ResourceDefinition) version(name string, storage bool, obj interface{}) apiextv1.CustomResourceDefinitionVersion {
+	return apiextv1.CustomResourceDefinitionVersion{
+		Name:    name,
+		Served:  true,
+		Storage: storage,
+		Schema: &apiextv1.CustomResourceValidation{
+			OpenAPIV3Schema: typeSchema(reflect.TypeOf(obj)),
+		},
+		// Status is written separately, so that
+		// daemons don't race with spec edits
+		Subresources: &apiextv1.CustomResourceSubresources{
+			Status: &apiextv1.CustomResourceSubresourceStatus{},
+		},
+		AdditionalPrinterColumns: def.Columns,
+	}
+}
+
+func (def *ResourceDefinition) spec(webhook *apiextv1.WebhookClientConfig) apiextv1.CustomResourceDefinitionSpec {
+	spec := apiextv1.CustomResourceDefinitionSpec{
+		Group: def.Group,
+		Names: apiextv1.CustomResourceDefinitionNames{
+			Plural:   def.Plural,
+			Singular: strings.ToLower(def.Kind),
+			Kind:     def.Kind,
+			ListKind: def.Kind + "List",
+		},
+		Scope: def.scope(),
+		Versions: []apiextv1.CustomResourceDefinitionVersion{
+			def.version(apiv2.SchemeGroupVersion.Version, true, def.Object),
+		},
+	}
+
+	if def.Legacy == nil {
+		return spec
+	}
+
+	legacy := def.version(apiv1.SchemeGroupVersion.Version, false, def.Legacy)
+	if webhook != nil {
+		spec.Conversion = &apiextv1.CustomResourceConversion{
+			Strategy: apiextv1.WebhookConverter,
+			Webhook: &apiextv1.WebhookConversion{
+				ClientConfig:             webhook,
+				ConversionReviewVersions: []string{"v1"},
+			},
+		}
+	} else {
+		// Until virtkubeadmission registers its webhook the
+		// apiserver only rewrites the apiVersion, so v1alpha1
+		// clients keep working, if seeing v1alpha2 field names.
+		// The v1alpha1 schema would prune the fields it lacks
+		preserve := true
+		legacy.Schema.OpenAPIV3Schema = &apiextv1.JSONSchemaProps{
+			Type:                   "object",
+			XPreserveUnknownFields: &preserve,
+		}
+		spec.Conversion = &apiextv1.CustomResourceConversion{
+			Strategy: apiextv1.NoneConverter,
+		}
+	}
+	spec.Versions = append(spec.Versions, legacy)
+	return spec
+}
+
+// The webhook configured by the admission server, which other
+// daemons keep when they bring the definition up to date
+func existingWebhook(crd *apiextv1.CustomResourceDefinition) *apiextv1.WebhookClientConfig {
+	conv := crd.Spec.Conversion
+	if conv == nil || conv.Strategy != apiextv1.WebhookConverter || conv.Webhook == nil {
+		return nil
+	}
+	return conv.Webhook.ClientConfig
+}
+
+func printerColumn(name, typ, path string) apiextv1.CustomResourceColumnDefinition {
+	return apiextv1.CustomResourceColumnDefinition{
+		Name:     name,
+		Type:     typ,
+		JSONPath: path,
+	}
+}
+
+func getResourceDefinition(clientset *kubernetes.Clientset, name string) (*apiextv1.CustomResourceDefinition, error) {
+	data, err := clientset.CoreV1().RESTClient().Get().AbsPath(crdPath, name).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	var crd apiextv1.CustomResourceDefinition
+	if err := json.Unmarshal(data, &crd); err != nil {
+		return nil, err
+	}
+	return &crd, nil
+}
+
+func putResourceDefinition(req *rest.Request, crd *apiextv1.CustomResourceDefinition) error {
+	crd.APIVersion = apiextv1.SchemeGroupVersion.String()
+	crd.Kind = "CustomResourceDefinition"
+
+	data, err := json.Marshal(crd)
+	if err != nil {
+		return err
+	}
+	return req.SetHeader("Content-Type", "application/json").Body(data).Do().Error()
+}
+
+// RegisterResourceDefinition creates the CRD for a resource, or
+// brings an existing one up to date, and waits for the apiserver
+// to start serving it
+func RegisterResourceDefinition(clientset *kubernetes.Clientset, def *ResourceDefinition) error {
+	name := def.name()
+
+	crd, err := getResourceDefinition(clientset, name)
+	if err == nil {
+		glog.V(1).Infof("Updating resource definition %s", name)
+		webhook := conversionWebhook
+		if webhook == nil {
+			webhook = existingWebhook(crd)
+		}
+		crd.Spec = def.spec(webhook)
+		err = putResourceDefinition(clientset.CoreV1().RESTClient().Put().AbsPath(crdPath, name), crd)
+		if err != nil {
+			return err
+		}
+	} else {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		glog.V(1).Infof("Creating resource definition %s", name)
+		crd = &apiextv1.CustomResourceDefinition{
+			ObjectMeta: v1.ObjectMeta{
+				Name: name,
+			},
+			Spec: def.spec(conversionWebhook),
+		}
+		err = putResourceDefinition(clientset.CoreV1().RESTClient().Post().AbsPath(crdPath), crd)
+		// Another daemon may have beaten us to it
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	return waitForResourceEstablished(clientset, name)
+}
+
+func isResourceEstablished(clientset *kubernetes.Clientset, name string) (bool, error) {
+	crd, err := getResourceDefinition(clientset, name)
+	if err != nil {
+		return false, err
+	}
+
+	for _, cond := range crd.Status.Conditions {
+		switch cond.Type {
+		case apiextv1.Established:
+			if cond.Status == apiextv1.ConditionTrue {
+				return true, nil
+			}
+		case apiextv1.NamesAccepted:
+			if cond.Status == apiextv1.ConditionFalse {
+				return false, fmt.Errorf("Resource definition %s names rejected: %s", name, cond.Message)
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func waitForResourceEstablished(clientset *kubernetes.Clientset, name string) error {
+	err := wait.Poll(time.Second, 30*time.Second, func() (bool, error) {
+		return isResourceEstablished(clientset, name)
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("Timed out waiting for resource definition %s to be established", name)
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	kubeapiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+const (
+	EventNormal  = kubeapiv1.EventTypeNormal
+	EventWarning = kubeapiv1.EventTypeWarning
+
+	// Repeats of an event are counted rather than posted
+	// again, for as many events as this
+	eventCacheSize = 1000
+)
+
+// EventRecorder posts Events about objects, so 'kubectl describe'
+// shows what the daemons did with them. Events are posted in the
+// background, so recording never blocks on the apiserver
+type EventRecorder struct {
+	clientset kubernetes.Interface
+	source    kubeapiv1.EventSource
+	pending   chan *kubeapiv1.Event
+	// Events already posted, by object UID, reason
+	// and message
+	posted map[string]*kubeapiv1.Event
+}
+
+// NewEventRecorder creates a recorder for events from the named
+// component, which is running on this host
+func NewEventRecorder(clientset kubernetes.Interface, component string) *EventRecorder {
+	host, _ := os.Hostname()
+	r := &EventRecorder{
+		clientset: clientset,
+		source: kubeapiv1.EventSource{
+			Component: component,
+			Host:      host,
+		},
+		pending: make(chan *kubeapiv1.Event, 100),
+		posted:  make(map[string]*kubeapiv1.Event),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// ObjectReference refers to one of the libvirt.org resources
+func ObjectReference(obj runtime.Object) (*kubeapiv1.ObjectReference, error) {
+	var kind string
+	switch obj.(type) {
+	case *apiv2.Virtmachine:
+		kind = "Virtmachine"
+	case *apiv2.Virtmachineclass:
+		kind = "Virtmachineclass"
+	case *apiv2.Virtimagefile:
+		kind = "Virtimagefile"
+	case *apiv2.Virtimagerepo:
+		kind = "Virtimagerepo"
+	case *apiv2.Virtimagesnapshot:
+		kind = "Virtimagesnapshot"
+	case *apiv2.Virtnode:
+		kind = "Virtnode"
+	default:
+		return nil, fmt.Errorf("Unknown resource type %T", obj)
+	}
+
+	meta := obj.(ResourceObject).GetObjectMeta()
+	return &kubeapiv1.ObjectReference{
+		Kind:            kind,
+		APIVersion:      apiv2.SchemeGroupVersion.String(),
+		Namespace:       meta.GetNamespace(),
+		Name:            meta.GetName(),
+		UID:             meta.GetUID(),
+		ResourceVersion: meta.GetResourceVersion(),
+	}, nil
+}
+
+// Event records an event about a libvirt.org resource
+func (r *EventRecorder) Event(obj runtime.Object, eventtype, reason, message string) {
+	ref, err := ObjectReference(obj)
+	if err != nil {
+		glog.Errorf("Unable to record event %s: %s", reason, err)
+		return
+	}
+	r.EventRef(ref, eventtype, reason, message)
+}
+
+func (r *EventRecorder) Eventf(obj runtime.Object, eventtype, reason, format string, args ...interface{}) {
+	r.Event(obj, eventtype, reason, fmt.Sprintf(format, args...))
+}
+
+// EventRef records an event about any object, such as a pod
+func (r *EventRecorder) EventRef(ref *kubeapiv1.ObjectReference, eventtype, reason, message string) {
+	glog.V(1).Infof("Event %s %s/%s %s: %s", eventtype, ref.Namespace, ref.Name, reason, message)
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	now := metav1.Now()
+	event := &kubeapiv1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", ref.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		Source:         r.source,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventtype,
+	}
+
+	select {
+	case r.pending <- event:
+	default:
+		glog.Errorf("Too many pending events, dropping %s", reason)
+	}
+}
+
+func (r *EventRecorder) post(event *kubeapiv1.Event) {
+	events := r.clientset.CoreV1().Events(event.Namespace)
+	key := fmt.Sprintf("%s/%s/%s", event.InvolvedObject.UID, event.Reason, event.Message)
+
+	if prev, ok := r.posted[key]; ok {
+		update := *prev
+		update.Count++
+		update.LastTimestamp = event.LastTimestamp
+		updated, err := events.Update(&update)
+		if err == nil {
+			r.posted[key] = updated
+			return
+		}
+		// The event may have expired, so post afresh
+		glog.V(1).Infof("Unable to update event %s: %s", prev.Name, err)
+		delete(r.posted, key)
+	}
+
+	created, err := events.Create(event)
+	if err != nil {
+		glog.Errorf("Unable to post event %s: %s", event.Reason, err)
+		return
+	}
+
+	if len(r.posted) >= eventCacheSize {
+		r.posted = make(map[string]*kubeapiv1.Event)
+	}
+	r.posted[key] = created
+}
+
+func (r *EventRecorder) run() {
+	for event := range r.pending {
+		r.post(event)
+		// Don't flood the apiserver when things go badly wrong
+		time.Sleep(10 * time.Millisecond)
+	}
+}
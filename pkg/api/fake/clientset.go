@@ -0,0 +1,238 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+// Package fake provides an in-memory implementation of the
+// libvirt.org resource clients, for exercising the daemons
+// without an apiserver
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// Fills in unset fields, as the real clients do on decode
+var defaults = runtime.NewScheme()
+
+func init() {
+	if err := apiv2.RegisterDefaults(defaults); err != nil {
+		panic(err)
+	}
+}
+
+// Clientset implements api.Interface, keeping every object
+// in its Tracker
+type Clientset struct {
+	tracker *Tracker
+}
+
+var _ api.Interface = &Clientset{}
+
+// NewClientset returns a clientset holding copies of the objects
+func NewClientset(objects ...api.ResourceObject) (*Clientset, error) {
+	c := &Clientset{
+		tracker: NewTracker(apiv2.SchemeGroupVersion.Group),
+	}
+
+	for _, obj := range objects {
+		resource, err := resourceFor(obj)
+		if err != nil {
+			return nil, err
+		}
+		namespace := obj.GetObjectMeta().GetNamespace()
+		if namespace == "" && !clusterScoped(resource) {
+			namespace = v1.NamespaceDefault
+		}
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.tracker.Create(resource, namespace, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func resourceFor(obj api.ResourceObject) (string, error) {
+	switch obj.(type) {
+	case *apiv2.Virtmachine:
+		return "virtmachines", nil
+	case *apiv2.Virtmachineclass:
+		return "virtmachineclasses", nil
+	case *apiv2.Virtimagefile:
+		return "virtimagefiles", nil
+	case *apiv2.Virtimagerepo:
+		return "virtimagerepos", nil
+	case *apiv2.Virtimagesnapshot:
+		return "virtimagesnapshots", nil
+	case *apiv2.Virtnode:
+		return "virtnodes", nil
+	default:
+		return "", fmt.Errorf("Unknown resource type %T", obj)
+	}
+}
+
+func clusterScoped(resource string) bool {
+	return resource == "virtmachineclasses"
+}
+
+// Tracker gives direct access to the stored objects
+func (c *Clientset) Tracker() *Tracker {
+	return c.tracker
+}
+
+func (c *Clientset) resource(name, namespace string) *resourceClient {
+	return &resourceClient{
+		tracker:   c.tracker,
+		resource:  name,
+		namespace: namespace,
+	}
+}
+
+func (c *Clientset) Virtmachines(namespace string) api.VirtmachineInterface {
+	return &VirtmachineClient{client: c.resource("virtmachines", namespace)}
+}
+
+func (c *Clientset) Virtmachineclasses() api.VirtmachineclassInterface {
+	return &VirtmachineclassClient{client: c.resource("virtmachineclasses", "")}
+}
+
+func (c *Clientset) Virtimagefiles(namespace string) api.VirtimagefileInterface {
+	return &VirtimagefileClient{client: c.resource("virtimagefiles", namespace)}
+}
+
+func (c *Clientset) Virtimagerepos(namespace string) api.VirtimagerepoInterface {
+	return &VirtimagerepoClient{client: c.resource("virtimagerepos", namespace)}
+}
+
+func (c *Clientset) Virtimagesnapshots(namespace string) api.VirtimagesnapshotInterface {
+	return &VirtimagesnapshotClient{client: c.resource("virtimagesnapshots", namespace)}
+}
+
+func (c *Clientset) Virtnodes(namespace string) api.VirtnodeinfoInterface {
+	return &VirtnodeinfoClient{client: c.resource("virtnodes", namespace)}
+}
+
+// resourceClient converts between typed objects and the
+// JSON held by the tracker
+type resourceClient struct {
+	tracker   *Tracker
+	resource  string
+	namespace string
+}
+
+func decodeInto(data []byte, obj runtime.Object) error {
+	if err := json.Unmarshal(data, obj); err != nil {
+		return err
+	}
+	defaults.Default(obj)
+	return nil
+}
+
+func (c *resourceClient) list(opts v1.ListOptions, meta *v1.ListMeta) ([][]byte, error) {
+	items, resourceVersion, err := c.tracker.List(c.resource, c.namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	meta.ResourceVersion = resourceVersion
+	return items, nil
+}
+
+func (c *resourceClient) watch(opts v1.ListOptions, newObj func() runtime.Object) (watch.Interface, error) {
+	return c.tracker.Watch(c.resource, c.namespace, opts, func(data []byte) (runtime.Object, error) {
+		obj := newObj()
+		if err := decodeInto(data, obj); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	})
+}
+
+func (c *resourceClient) get(name string, obj runtime.Object) error {
+	data, err := c.tracker.Get(c.resource, c.namespace, name)
+	if err != nil {
+		return err
+	}
+	return decodeInto(data, obj)
+}
+
+func (c *resourceClient) create(in api.ResourceObject, out runtime.Object) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	data, err = c.tracker.Create(c.resource, c.namespace, data)
+	if err != nil {
+		return err
+	}
+	return decodeInto(data, out)
+}
+
+func (c *resourceClient) update(in api.ResourceObject, out runtime.Object) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	data, err = c.tracker.Update(c.resource, c.namespace, data)
+	if err != nil {
+		return err
+	}
+	return decodeInto(data, out)
+}
+
+func (c *resourceClient) patchStatus(orig, in api.ResourceObject, out runtime.Object) error {
+	patch, err := api.StatusMergePatch(orig, in)
+	if err != nil {
+		return err
+	}
+	if patch == nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		return decodeInto(data, out)
+	}
+	data, err := c.tracker.Patch(c.resource, c.namespace, in.GetObjectMeta().GetName(), types.MergePatchType, patch, true)
+	if err != nil {
+		return err
+	}
+	return decodeInto(data, out)
+}
+
+func (c *resourceClient) patch(name string, pt types.PatchType, patch []byte, out runtime.Object) error {
+	data, err := c.tracker.Patch(c.resource, c.namespace, name, pt, patch, false)
+	if err != nil {
+		return err
+	}
+	return decodeInto(data, out)
+}
+
+func (c *resourceClient) delete(name string, opts *v1.DeleteOptions) error {
+	return c.tracker.Delete(c.resource, c.namespace, name, opts)
+}
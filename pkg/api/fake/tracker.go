@@ -0,0 +1,519 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// How many events are kept to replay to watches
+// which start from an older resource version
+const historySize = 1000
+
+// A stored object, as the JSON the apiserver would hold
+type object map[string]json.RawMessage
+
+func decodeObject(data []byte) (object, *v1.ObjectMeta, error) {
+	var obj object
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, nil, err
+	}
+	var meta v1.ObjectMeta
+	if raw, ok := obj["metadata"]; ok {
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, nil, err
+		}
+	}
+	return obj, &meta, nil
+}
+
+func (obj object) encode(meta *v1.ObjectMeta) ([]byte, error) {
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	obj["metadata"] = raw
+	return json.Marshal(obj)
+}
+
+type event struct {
+	resourceVersion uint64
+	namespace       string
+	typ             watch.EventType
+	data            []byte
+}
+
+// Tracker holds the objects of every resource in memory, with
+// the semantics of the apiserver for custom resources with a
+// status subresource: resource versions with conflict detection,
+// finalizers, garbage collection of dependents and watches
+type Tracker struct {
+	lock            sync.Mutex
+	group           string
+	resourceVersion uint64
+	// resource -> namespace/name -> JSON
+	objects map[string]map[string][]byte
+	history map[string][]event
+	// Watches from before this have missed events
+	expired map[string]uint64
+	watches map[string][]*fakeWatch
+}
+
+func NewTracker(group string) *Tracker {
+	return &Tracker{
+		group:   group,
+		objects: make(map[string]map[string][]byte),
+		history: make(map[string][]event),
+		expired: make(map[string]uint64),
+		watches: make(map[string][]*fakeWatch),
+	}
+}
+
+func objectKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func (t *Tracker) groupResource(resource string) schema.GroupResource {
+	return schema.GroupResource{Group: t.group, Resource: resource}
+}
+
+func (t *Tracker) nextResourceVersion() string {
+	t.resourceVersion++
+	return strconv.FormatUint(t.resourceVersion, 10)
+}
+
+// Record a change and tell the watches about it. Must
+// be called with the lock held
+func (t *Tracker) notify(resource, namespace string, typ watch.EventType, data []byte) {
+	ev := event{
+		resourceVersion: t.resourceVersion,
+		namespace:       namespace,
+		typ:             typ,
+		data:            data,
+	}
+	history := append(t.history[resource], ev)
+	if len(history) > historySize {
+		drop := len(history) - historySize
+		t.expired[resource] = history[drop-1].resourceVersion
+		history = history[drop:]
+	}
+	t.history[resource] = history
+
+	var live []*fakeWatch
+	for _, w := range t.watches[resource] {
+		if w.stopped() {
+			continue
+		}
+		w.send(ev)
+		live = append(live, w)
+	}
+	t.watches[resource] = live
+}
+
+func matches(meta *v1.ObjectMeta, opts *v1.ListOptions) (bool, error) {
+	if opts.LabelSelector != "" {
+		selector, err := labels.Parse(opts.LabelSelector)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(labels.Set(meta.Labels)) {
+			return false, nil
+		}
+	}
+	if opts.FieldSelector != "" {
+		selector, err := fields.ParseSelector(opts.FieldSelector)
+		if err != nil {
+			return false, err
+		}
+		set := fields.Set{
+			"metadata.name":      meta.Name,
+			"metadata.namespace": meta.Namespace,
+		}
+		if !selector.Matches(set) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// List returns the objects in the namespace, or in every
+// namespace if it is empty, sorted by name, along with the
+// resource version to watch from
+func (t *Tracker) List(resource, namespace string, opts v1.ListOptions) ([][]byte, string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var keys []string
+	for key := range t.objects[resource] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var items [][]byte
+	for _, key := range keys {
+		data := t.objects[resource][key]
+		_, meta, err := decodeObject(data)
+		if err != nil {
+			return nil, "", err
+		}
+		if namespace != "" && meta.Namespace != namespace {
+			continue
+		}
+		ok, err := matches(meta, &opts)
+		if err != nil {
+			return nil, "", errors.NewBadRequest(err.Error())
+		}
+		if ok {
+			items = append(items, data)
+		}
+	}
+	return items, strconv.FormatUint(t.resourceVersion, 10), nil
+}
+
+func (t *Tracker) Get(resource, namespace, name string) ([]byte, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	data, ok := t.objects[resource][objectKey(namespace, name)]
+	if !ok {
+		return nil, errors.NewNotFound(t.groupResource(resource), name)
+	}
+	return data, nil
+}
+
+func (t *Tracker) Create(resource, namespace string, data []byte) ([]byte, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	obj, meta, err := decodeObject(data)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	if meta.Name == "" && meta.GenerateName != "" {
+		meta.Name = meta.GenerateName + strconv.FormatUint(t.resourceVersion+1, 10)
+	}
+	if meta.Name == "" {
+		return nil, errors.NewBadRequest("name is required")
+	}
+	if meta.Namespace != "" && meta.Namespace != namespace {
+		return nil, errors.NewBadRequest(fmt.Sprintf("namespace '%s' does not match '%s'", meta.Namespace, namespace))
+	}
+
+	if t.objects[resource] == nil {
+		t.objects[resource] = make(map[string][]byte)
+	}
+	key := objectKey(namespace, meta.Name)
+	if _, ok := t.objects[resource][key]; ok {
+		return nil, errors.NewAlreadyExists(t.groupResource(resource), meta.Name)
+	}
+
+	meta.Namespace = namespace
+	meta.UID = uuid.NewUUID()
+	meta.CreationTimestamp = v1.Now()
+	meta.DeletionTimestamp = nil
+	meta.Generation = 1
+	meta.ResourceVersion = t.nextResourceVersion()
+
+	data, err = obj.encode(meta)
+	if err != nil {
+		return nil, err
+	}
+	t.objects[resource][key] = data
+	t.notify(resource, namespace, watch.Added, data)
+	return data, nil
+}
+
+// Store a new version of an existing object, which is removed
+// if it was being deleted and has no finalizers left. Must be
+// called with the lock held
+func (t *Tracker) store(resource string, old *v1.ObjectMeta, obj object, meta *v1.ObjectMeta) ([]byte, error) {
+	// Set by the apiserver, not by clients
+	meta.Namespace = old.Namespace
+	meta.UID = old.UID
+	meta.CreationTimestamp = old.CreationTimestamp
+	meta.DeletionTimestamp = old.DeletionTimestamp
+	meta.Generation = old.Generation
+	meta.ResourceVersion = t.nextResourceVersion()
+
+	data, err := obj.encode(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	key := objectKey(meta.Namespace, meta.Name)
+	if meta.DeletionTimestamp != nil && len(meta.Finalizers) == 0 {
+		t.remove(resource, key, data, meta)
+		return data, nil
+	}
+
+	t.objects[resource][key] = data
+	t.notify(resource, meta.Namespace, watch.Modified, data)
+	return data, nil
+}
+
+// Update replaces an object, except for its status, failing with
+// a conflict if the object was changed since it was read
+func (t *Tracker) Update(resource, namespace string, data []byte) ([]byte, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	obj, meta, err := decodeObject(data)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+
+	olddata, ok := t.objects[resource][objectKey(namespace, meta.Name)]
+	if !ok {
+		return nil, errors.NewNotFound(t.groupResource(resource), meta.Name)
+	}
+	oldobj, oldmeta, err := decodeObject(olddata)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.ResourceVersion != "" && meta.ResourceVersion != oldmeta.ResourceVersion {
+		return nil, errors.NewConflict(t.groupResource(resource), meta.Name,
+			fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+
+	// Status is only written through the subresource
+	if status, ok := oldobj["status"]; ok {
+		obj["status"] = status
+	} else {
+		delete(obj, "status")
+	}
+	if string(obj["spec"]) != string(oldobj["spec"]) {
+		meta.Generation = oldmeta.Generation + 1
+		oldmeta.Generation = meta.Generation
+	}
+
+	return t.store(resource, oldmeta, obj, meta)
+}
+
+func applyPatch(pt types.PatchType, data, patch []byte) ([]byte, error) {
+	switch pt {
+	case types.MergePatchType:
+		return jsonpatch.MergePatch(data, patch)
+	case types.JSONPatchType:
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, err
+		}
+		return ops.Apply(data)
+	default:
+		// As for any custom resource
+		return nil, errors.NewGenericServerResponse(415, "patch", schema.GroupResource{}, "",
+			fmt.Sprintf("patch type %s is not supported", pt), 0, false)
+	}
+}
+
+// Patch applies a patch to the latest version of an object. If
+// status is true, only changes to the status are kept, as for
+// the status subresource, otherwise only changes to the rest
+func (t *Tracker) Patch(resource, namespace, name string, pt types.PatchType, patch []byte, status bool) ([]byte, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	olddata, ok := t.objects[resource][objectKey(namespace, name)]
+	if !ok {
+		return nil, errors.NewNotFound(t.groupResource(resource), name)
+	}
+	oldobj, oldmeta, err := decodeObject(olddata)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := applyPatch(pt, olddata, patch)
+	if err != nil {
+		if _, ok := err.(errors.APIStatus); ok {
+			return nil, err
+		}
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	obj, meta, err := decodeObject(data)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+
+	if status {
+		newstatus := obj["status"]
+		obj = oldobj
+		obj["status"] = newstatus
+		meta = &v1.ObjectMeta{}
+		*meta = *oldmeta
+	} else {
+		if st, ok := oldobj["status"]; ok {
+			obj["status"] = st
+		} else {
+			delete(obj, "status")
+		}
+		if string(obj["spec"]) != string(oldobj["spec"]) {
+			oldmeta.Generation++
+		}
+	}
+	meta.Name = name
+
+	return t.store(resource, oldmeta, obj, meta)
+}
+
+// Remove an object which has gone, and garbage collect
+// its dependents. Must be called with the lock held
+func (t *Tracker) remove(resource, key string, data []byte, meta *v1.ObjectMeta) {
+	delete(t.objects[resource], key)
+	t.notify(resource, meta.Namespace, watch.Deleted, data)
+
+	for depresource, objects := range t.objects {
+		for depkey, depdata := range objects {
+			depobj, depmeta, err := decodeObject(depdata)
+			if err != nil {
+				continue
+			}
+			var owners []v1.OwnerReference
+			owned := false
+			for _, ref := range depmeta.OwnerReferences {
+				if ref.UID == meta.UID {
+					owned = true
+				} else {
+					owners = append(owners, ref)
+				}
+			}
+			if !owned {
+				continue
+			}
+			depmeta.OwnerReferences = owners
+			if len(owners) != 0 {
+				// Still has other owners
+				depmeta.ResourceVersion = t.nextResourceVersion()
+				if depdata, err = depobj.encode(depmeta); err == nil {
+					t.objects[depresource][depkey] = depdata
+					t.notify(depresource, depmeta.Namespace, watch.Modified, depdata)
+				}
+				continue
+			}
+			t.delete(depresource, depkey, depobj, depmeta)
+		}
+	}
+}
+
+// Must be called with the lock held
+func (t *Tracker) delete(resource, key string, obj object, meta *v1.ObjectMeta) error {
+	if len(meta.Finalizers) == 0 {
+		meta.ResourceVersion = t.nextResourceVersion()
+		data, err := obj.encode(meta)
+		if err != nil {
+			return err
+		}
+		t.remove(resource, key, data, meta)
+		return nil
+	}
+
+	if meta.DeletionTimestamp != nil {
+		// Already waiting on finalizers
+		return nil
+	}
+
+	// Wait for the finalizers to be removed
+	now := v1.Now()
+	meta.DeletionTimestamp = &now
+	meta.ResourceVersion = t.nextResourceVersion()
+	data, err := obj.encode(meta)
+	if err != nil {
+		return err
+	}
+	t.objects[resource][key] = data
+	t.notify(resource, meta.Namespace, watch.Modified, data)
+	return nil
+}
+
+// Delete removes an object, or if it has finalizers, marks it
+// as being deleted until they are removed. Any objects it owns
+// are garbage collected once it is removed
+func (t *Tracker) Delete(resource, namespace, name string, opts *v1.DeleteOptions) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := objectKey(namespace, name)
+	data, ok := t.objects[resource][key]
+	if !ok {
+		return errors.NewNotFound(t.groupResource(resource), name)
+	}
+	obj, meta, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+
+	if opts != nil && opts.Preconditions != nil && opts.Preconditions.UID != nil &&
+		*opts.Preconditions.UID != meta.UID {
+		return errors.NewConflict(t.groupResource(resource), name,
+			fmt.Errorf("the UID in the precondition (%s) does not match the UID in record (%s)",
+				*opts.Preconditions.UID, meta.UID))
+	}
+
+	return t.delete(resource, key, obj, meta)
+}
+
+// Watch reports changes to objects in the namespace, or in every
+// namespace if it is empty, after the resource version in opts.
+// Events older than the tracker remembers expire the watch, just
+// as when the apiserver has compacted them away
+func (t *Tracker) Watch(resource, namespace string, opts v1.ListOptions, decode func([]byte) (runtime.Object, error)) (watch.Interface, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, err := matches(&v1.ObjectMeta{}, &opts); err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+
+	w := newFakeWatch(namespace, opts, decode)
+
+	if opts.ResourceVersion != "" && opts.ResourceVersion != "0" {
+		from, err := strconv.ParseUint(opts.ResourceVersion, 10, 64)
+		if err != nil {
+			return nil, errors.NewBadRequest(err.Error())
+		}
+		if from < t.expired[resource] {
+			w.expire()
+			return w, nil
+		}
+		for _, ev := range t.history[resource] {
+			if ev.resourceVersion > from {
+				w.send(ev)
+			}
+		}
+	}
+
+	t.watches[resource] = append(t.watches[resource], w)
+	return w, nil
+}
@@ -0,0 +1,99 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package fake
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+type VirtimagerepoClient struct {
+	client *resourceClient
+}
+
+func (c *VirtimagerepoClient) List(opts v1.ListOptions) (*apiv2.VirtimagerepoList, error) {
+	var obj apiv2.VirtimagerepoList
+	items, err := c.client.list(opts, &obj.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range items {
+		var item apiv2.Virtimagerepo
+		if err := decodeInto(data, &item); err != nil {
+			return nil, err
+		}
+		obj.Items = append(obj.Items, &item)
+	}
+	return &obj, nil
+}
+
+func (c *VirtimagerepoClient) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.client.watch(opts, func() runtime.Object {
+		return &apiv2.Virtimagerepo{}
+	})
+}
+
+func (c *VirtimagerepoClient) Get(name string) (*apiv2.Virtimagerepo, error) {
+	var obj apiv2.Virtimagerepo
+	if err := c.client.get(name, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtimagerepoClient) Create(obj *apiv2.Virtimagerepo) (*apiv2.Virtimagerepo, error) {
+	var newobj apiv2.Virtimagerepo
+	if err := c.client.create(obj, &newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtimagerepoClient) Update(obj *apiv2.Virtimagerepo) (*apiv2.Virtimagerepo, error) {
+	var newobj apiv2.Virtimagerepo
+	if err := c.client.update(obj, &newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtimagerepoClient) PatchStatus(orig, obj *apiv2.Virtimagerepo) (*apiv2.Virtimagerepo, error) {
+	var newobj apiv2.Virtimagerepo
+	if err := c.client.patchStatus(orig, obj, &newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtimagerepoClient) Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtimagerepo, error) {
+	var obj apiv2.Virtimagerepo
+	if err := c.client.patch(name, pt, data, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtimagerepoClient) Delete(name string, opts *v1.DeleteOptions) error {
+	return c.client.delete(name, opts)
+}
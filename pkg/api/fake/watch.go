@@ -0,0 +1,157 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package fake
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// fakeWatch delivers events in order without ever blocking
+// the tracker, however slowly they are consumed
+type fakeWatch struct {
+	namespace string
+	opts      v1.ListOptions
+	decode    func([]byte) (runtime.Object, error)
+
+	lock    sync.Mutex
+	pending []watch.Event
+	closing bool
+	wake    chan struct{}
+
+	result   chan watch.Event
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newFakeWatch(namespace string, opts v1.ListOptions, decode func([]byte) (runtime.Object, error)) *fakeWatch {
+	w := &fakeWatch{
+		namespace: namespace,
+		opts:      opts,
+		decode:    decode,
+		wake:      make(chan struct{}, 1),
+		result:    make(chan watch.Event),
+		stop:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *fakeWatch) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+func (w *fakeWatch) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *fakeWatch) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *fakeWatch) push(ev watch.Event, closing bool) {
+	w.lock.Lock()
+	w.pending = append(w.pending, ev)
+	w.closing = w.closing || closing
+	w.lock.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *fakeWatch) send(ev event) {
+	if w.namespace != "" && ev.namespace != w.namespace {
+		return
+	}
+
+	_, meta, err := decodeObject(ev.data)
+	if err != nil {
+		glog.Errorf("Unable to decode watched object %s", err)
+		return
+	}
+	if ok, _ := matches(meta, &w.opts); !ok {
+		return
+	}
+
+	obj, err := w.decode(ev.data)
+	if err != nil {
+		glog.Errorf("Unable to decode watched object %s", err)
+		return
+	}
+	w.push(watch.Event{Type: ev.typ, Object: obj}, false)
+}
+
+// Report that the resource version asked for is too old,
+// then close the watch
+func (w *fakeWatch) expire() {
+	w.push(watch.Event{
+		Type: watch.Error,
+		Object: &v1.Status{
+			Status:  v1.StatusFailure,
+			Code:    http.StatusGone,
+			Reason:  v1.StatusReasonGone,
+			Message: "too old resource version",
+		},
+	}, true)
+}
+
+func (w *fakeWatch) run() {
+	defer close(w.result)
+
+	for {
+		w.lock.Lock()
+		if len(w.pending) == 0 {
+			closing := w.closing
+			w.lock.Unlock()
+			if closing {
+				return
+			}
+			select {
+			case <-w.wake:
+				continue
+			case <-w.stop:
+				return
+			}
+		}
+		ev := w.pending[0]
+		w.pending = w.pending[1:]
+		w.lock.Unlock()
+
+		select {
+		case w.result <- ev:
+		case <-w.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,214 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package api
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// InformerFactory creates informers for the libvirt.org resources
+// in a namespace, or in all namespaces if it is empty. Each kind
+// of resource has a single informer, shared by all its users
+type InformerFactory struct {
+	clientset Interface
+	namespace string
+	resync    time.Duration
+
+	lock      sync.Mutex
+	informers map[string]cache.SharedIndexInformer
+	started   map[string]bool
+}
+
+func NewInformerFactory(clientset Interface, namespace string, resync time.Duration) *InformerFactory {
+	return &InformerFactory{
+		clientset: clientset,
+		namespace: namespace,
+		resync:    resync,
+		informers: make(map[string]cache.SharedIndexInformer),
+		started:   make(map[string]bool),
+	}
+}
+
+func (f *InformerFactory) informer(resource string, obj runtime.Object,
+	listFunc func(opts v1.ListOptions) (runtime.Object, error),
+	watchFunc func(opts v1.ListOptions) (watch.Interface, error)) cache.SharedIndexInformer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	informer, ok := f.informers[resource]
+	if ok {
+		return informer
+	}
+
+	informer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc:  listFunc,
+			WatchFunc: watchFunc,
+		},
+		obj,
+		f.resync,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+	f.informers[resource] = informer
+	return informer
+}
+
+func (f *InformerFactory) VirtmachineInformer() cache.SharedIndexInformer {
+	client := f.clientset.Virtmachines(f.namespace)
+	return f.informer("virtmachines", &apiv2.Virtmachine{},
+		func(opts v1.ListOptions) (runtime.Object, error) {
+			return client.List(opts)
+		},
+		client.Watch)
+}
+
+func (f *InformerFactory) VirtmachineLister() *VirtmachineLister {
+	return NewVirtmachineLister(f.VirtmachineInformer().GetIndexer())
+}
+
+func (f *InformerFactory) VirtmachineclassInformer() cache.SharedIndexInformer {
+	client := f.clientset.Virtmachineclasses()
+	return f.informer("virtmachineclasses", &apiv2.Virtmachineclass{},
+		func(opts v1.ListOptions) (runtime.Object, error) {
+			return client.List(opts)
+		},
+		client.Watch)
+}
+
+func (f *InformerFactory) VirtmachineclassLister() *VirtmachineclassLister {
+	return NewVirtmachineclassLister(f.VirtmachineclassInformer().GetIndexer())
+}
+
+func (f *InformerFactory) VirtimagefileInformer() cache.SharedIndexInformer {
+	client := f.clientset.Virtimagefiles(f.namespace)
+	return f.informer("virtimagefiles", &apiv2.Virtimagefile{},
+		func(opts v1.ListOptions) (runtime.Object, error) {
+			return client.List(opts)
+		},
+		client.Watch)
+}
+
+func (f *InformerFactory) VirtimagefileLister() *VirtimagefileLister {
+	return NewVirtimagefileLister(f.VirtimagefileInformer().GetIndexer())
+}
+
+func (f *InformerFactory) VirtimagerepoInformer() cache.SharedIndexInformer {
+	client := f.clientset.Virtimagerepos(f.namespace)
+	return f.informer("virtimagerepos", &apiv2.Virtimagerepo{},
+		func(opts v1.ListOptions) (runtime.Object, error) {
+			return client.List(opts)
+		},
+		client.Watch)
+}
+
+func (f *InformerFactory) VirtimagerepoLister() *VirtimagerepoLister {
+	return NewVirtimagerepoLister(f.VirtimagerepoInformer().GetIndexer())
+}
+
+func (f *InformerFactory) VirtimagesnapshotInformer() cache.SharedIndexInformer {
+	client := f.clientset.Virtimagesnapshots(f.namespace)
+	return f.informer("virtimagesnapshots", &apiv2.Virtimagesnapshot{},
+		func(opts v1.ListOptions) (runtime.Object, error) {
+			return client.List(opts)
+		},
+		client.Watch)
+}
+
+func (f *InformerFactory) VirtimagesnapshotLister() *VirtimagesnapshotLister {
+	return NewVirtimagesnapshotLister(f.VirtimagesnapshotInformer().GetIndexer())
+}
+
+func (f *InformerFactory) VirtnodeInformer() cache.SharedIndexInformer {
+	client := f.clientset.Virtnodes(f.namespace)
+	return f.informer("virtnodes", &apiv2.Virtnode{},
+		func(opts v1.ListOptions) (runtime.Object, error) {
+			return client.List(opts)
+		},
+		client.Watch)
+}
+
+func (f *InformerFactory) VirtnodeLister() *VirtnodeLister {
+	return NewVirtnodeLister(f.VirtnodeInformer().GetIndexer())
+}
+
+// Start runs every informer created so far which is
+// not already running, until stop is closed
+func (f *InformerFactory) Start(stop <-chan struct{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for resource, informer := range f.informers {
+		if f.started[resource] {
+			continue
+		}
+		go informer.Run(stop)
+		f.started[resource] = true
+	}
+}
+
+// WaitForCacheSync blocks until every started informer
+// has loaded the initial list of its resources
+func (f *InformerFactory) WaitForCacheSync(stop <-chan struct{}) error {
+	f.lock.Lock()
+	var synced []cache.InformerSynced
+	for resource, informer := range f.informers {
+		if f.started[resource] {
+			synced = append(synced, informer.HasSynced)
+		}
+	}
+	f.lock.Unlock()
+
+	if !cache.WaitForCacheSync(stop, synced...) {
+		return fmt.Errorf("Stopped before informer caches were synced")
+	}
+	return nil
+}
+
+// QueueEventHandler adds the key of any object which is added,
+// updated or deleted to the queue, so that it is reconciled
+// against the latest state in the informer's cache
+func QueueEventHandler(queue workqueue.Interface) cache.ResourceEventHandler {
+	enqueue := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			glog.Errorf("Unable to get key for %T: %s", obj, err)
+			return
+		}
+		queue.Add(key)
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			enqueue(new)
+		},
+		DeleteFunc: enqueue,
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// Interface provides clients for every libvirt.org resource. It
+// is implemented by Clientset, talking to the apiserver, and by
+// the in-memory fake in the api/fake package
+type Interface interface {
+	Virtmachines(namespace string) VirtmachineInterface
+	Virtmachineclasses() VirtmachineclassInterface
+	Virtimagefiles(namespace string) VirtimagefileInterface
+	Virtimagerepos(namespace string) VirtimagerepoInterface
+	Virtimagesnapshots(namespace string) VirtimagesnapshotInterface
+	Virtnodes(namespace string) VirtnodeinfoInterface
+}
+
+type VirtmachineInterface interface {
+	List(opts v1.ListOptions) (*apiv2.VirtmachineList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Get(name string) (*apiv2.Virtmachine, error)
+	Create(obj *apiv2.Virtmachine) (*apiv2.Virtmachine, error)
+	Update(obj *apiv2.Virtmachine) (*apiv2.Virtmachine, error)
+	PatchStatus(orig, obj *apiv2.Virtmachine) (*apiv2.Virtmachine, error)
+	Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtmachine, error)
+	Delete(name string, opts *v1.DeleteOptions) error
+}
+
+type VirtmachineclassInterface interface {
+	List(opts v1.ListOptions) (*apiv2.VirtmachineclassList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Get(name string) (*apiv2.Virtmachineclass, error)
+	Create(obj *apiv2.Virtmachineclass) (*apiv2.Virtmachineclass, error)
+	Update(obj *apiv2.Virtmachineclass) (*apiv2.Virtmachineclass, error)
+	Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtmachineclass, error)
+	Delete(name string, opts *v1.DeleteOptions) error
+}
+
+type VirtimagefileInterface interface {
+	List(opts v1.ListOptions) (*apiv2.VirtimagefileList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Get(name string) (*apiv2.Virtimagefile, error)
+	Create(obj *apiv2.Virtimagefile) (*apiv2.Virtimagefile, error)
+	Update(obj *apiv2.Virtimagefile) (*apiv2.Virtimagefile, error)
+	PatchStatus(orig, obj *apiv2.Virtimagefile) (*apiv2.Virtimagefile, error)
+	Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtimagefile, error)
+	Delete(name string, opts *v1.DeleteOptions) error
+}
+
+type VirtimagerepoInterface interface {
+	List(opts v1.ListOptions) (*apiv2.VirtimagerepoList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Get(name string) (*apiv2.Virtimagerepo, error)
+	Create(obj *apiv2.Virtimagerepo) (*apiv2.Virtimagerepo, error)
+	Update(obj *apiv2.Virtimagerepo) (*apiv2.Virtimagerepo, error)
+	PatchStatus(orig, obj *apiv2.Virtimagerepo) (*apiv2.Virtimagerepo, error)
+	Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtimagerepo, error)
+	Delete(name string, opts *v1.DeleteOptions) error
+}
+
+type VirtimagesnapshotInterface interface {
+	List(opts v1.ListOptions) (*apiv2.VirtimagesnapshotList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Get(name string) (*apiv2.Virtimagesnapshot, error)
+	Create(obj *apiv2.Virtimagesnapshot) (*apiv2.Virtimagesnapshot, error)
+	Update(obj *apiv2.Virtimagesnapshot) (*apiv2.Virtimagesnapshot, error)
+	PatchStatus(orig, obj *apiv2.Virtimagesnapshot) (*apiv2.Virtimagesnapshot, error)
+	Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtimagesnapshot, error)
+	Delete(name string, opts *v1.DeleteOptions) error
+}
+
+type VirtnodeinfoInterface interface {
+	List(opts v1.ListOptions) (*apiv2.VirtnodeList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Get(name string) (*apiv2.Virtnode, error)
+	Create(obj *apiv2.Virtnode) (*apiv2.Virtnode, error)
+	Update(obj *apiv2.Virtnode) (*apiv2.Virtnode, error)
+	PatchStatus(orig, obj *apiv2.Virtnode) (*apiv2.Virtnode, error)
+	Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtnode, error)
+	Delete(name string, opts *v1.DeleteOptions) error
+}
+
+var (
+	_ Interface                  = &Clientset{}
+	_ VirtmachineInterface       = &VirtmachineClient{}
+	_ VirtmachineclassInterface  = &VirtmachineclassClient{}
+	_ VirtimagefileInterface     = &VirtimagefileClient{}
+	_ VirtimagerepoInterface     = &VirtimagerepoClient{}
+	_ VirtimagesnapshotInterface = &VirtimagesnapshotClient{}
+	_ VirtnodeinfoInterface      = &VirtnodeinfoClient{}
+)
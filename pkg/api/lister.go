@@ -0,0 +1,252 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// Objects returned by listers are shared with the informer's
+// cache, so must be copied before they are modified
+func deepCopy(in, out interface{}) {
+	data, err := json.Marshal(in)
+	if err == nil {
+		err = json.Unmarshal(data, out)
+	}
+	if err != nil {
+		// Only possible if the types can't round trip
+		// through JSON, which would break the API too
+		glog.Fatalf("Unable to copy %T: %s", in, err)
+	}
+}
+
+func listerKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+func DeepCopyVirtmachine(in *apiv2.Virtmachine) *apiv2.Virtmachine {
+	var out apiv2.Virtmachine
+	deepCopy(in, &out)
+	return &out
+}
+
+type VirtmachineLister struct {
+	indexer cache.Indexer
+}
+
+func NewVirtmachineLister(indexer cache.Indexer) *VirtmachineLister {
+	return &VirtmachineLister{indexer: indexer}
+}
+
+func (l *VirtmachineLister) List(selector labels.Selector) ([]*apiv2.Virtmachine, error) {
+	var ret []*apiv2.Virtmachine
+	err := cache.ListAll(l.indexer, selector, func(obj interface{}) {
+		ret = append(ret, obj.(*apiv2.Virtmachine))
+	})
+	return ret, err
+}
+
+func (l *VirtmachineLister) Get(namespace, name string) (*apiv2.Virtmachine, error) {
+	obj, exists, err := l.indexer.GetByKey(listerKey(namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: "libvirt.org", Resource: "virtmachines"}, name)
+	}
+	return obj.(*apiv2.Virtmachine), nil
+}
+
+func DeepCopyVirtmachineclass(in *apiv2.Virtmachineclass) *apiv2.Virtmachineclass {
+	var out apiv2.Virtmachineclass
+	deepCopy(in, &out)
+	return &out
+}
+
+type VirtmachineclassLister struct {
+	indexer cache.Indexer
+}
+
+func NewVirtmachineclassLister(indexer cache.Indexer) *VirtmachineclassLister {
+	return &VirtmachineclassLister{indexer: indexer}
+}
+
+func (l *VirtmachineclassLister) List(selector labels.Selector) ([]*apiv2.Virtmachineclass, error) {
+	var ret []*apiv2.Virtmachineclass
+	err := cache.ListAll(l.indexer, selector, func(obj interface{}) {
+		ret = append(ret, obj.(*apiv2.Virtmachineclass))
+	})
+	return ret, err
+}
+
+// Get takes no namespace, as classes are cluster scoped
+func (l *VirtmachineclassLister) Get(name string) (*apiv2.Virtmachineclass, error) {
+	obj, exists, err := l.indexer.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: "libvirt.org", Resource: "virtmachineclasses"}, name)
+	}
+	return obj.(*apiv2.Virtmachineclass), nil
+}
+
+func DeepCopyVirtimagefile(in *apiv2.Virtimagefile) *apiv2.Virtimagefile {
+	var out apiv2.Virtimagefile
+	deepCopy(in, &out)
+	return &out
+}
+
+type VirtimagefileLister struct {
+	indexer cache.Indexer
+}
+
+func NewVirtimagefileLister(indexer cache.Indexer) *VirtimagefileLister {
+	return &VirtimagefileLister{indexer: indexer}
+}
+
+func (l *VirtimagefileLister) List(selector labels.Selector) ([]*apiv2.Virtimagefile, error) {
+	var ret []*apiv2.Virtimagefile
+	err := cache.ListAll(l.indexer, selector, func(obj interface{}) {
+		ret = append(ret, obj.(*apiv2.Virtimagefile))
+	})
+	return ret, err
+}
+
+func (l *VirtimagefileLister) Get(namespace, name string) (*apiv2.Virtimagefile, error) {
+	obj, exists, err := l.indexer.GetByKey(listerKey(namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: "libvirt.org", Resource: "virtimagefiles"}, name)
+	}
+	return obj.(*apiv2.Virtimagefile), nil
+}
+
+func DeepCopyVirtimagerepo(in *apiv2.Virtimagerepo) *apiv2.Virtimagerepo {
+	var out apiv2.Virtimagerepo
+	deepCopy(in, &out)
+	return &out
+}
+
+type VirtimagerepoLister struct {
+	indexer cache.Indexer
+}
+
+func NewVirtimagerepoLister(indexer cache.Indexer) *VirtimagerepoLister {
+	return &VirtimagerepoLister{indexer: indexer}
+}
+
+func (l *VirtimagerepoLister) List(selector labels.Selector) ([]*apiv2.Virtimagerepo, error) {
+	var ret []*apiv2.Virtimagerepo
+	err := cache.ListAll(l.indexer, selector, func(obj interface{}) {
+		ret = append(ret, obj.(*apiv2.Virtimagerepo))
+	})
+	return ret, err
+}
+
+func (l *VirtimagerepoLister) Get(namespace, name string) (*apiv2.Virtimagerepo, error) {
+	obj, exists, err := l.indexer.GetByKey(listerKey(namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: "libvirt.org", Resource: "virtimagerepos"}, name)
+	}
+	return obj.(*apiv2.Virtimagerepo), nil
+}
+
+func DeepCopyVirtimagesnapshot(in *apiv2.Virtimagesnapshot) *apiv2.Virtimagesnapshot {
+	var out apiv2.Virtimagesnapshot
+	deepCopy(in, &out)
+	return &out
+}
+
+type VirtimagesnapshotLister struct {
+	indexer cache.Indexer
+}
+
+func NewVirtimagesnapshotLister(indexer cache.Indexer) *VirtimagesnapshotLister {
+	return &VirtimagesnapshotLister{indexer: indexer}
+}
+
+func (l *VirtimagesnapshotLister) List(selector labels.Selector) ([]*apiv2.Virtimagesnapshot, error) {
+	var ret []*apiv2.Virtimagesnapshot
+	err := cache.ListAll(l.indexer, selector, func(obj interface{}) {
+		ret = append(ret, obj.(*apiv2.Virtimagesnapshot))
+	})
+	return ret, err
+}
+
+func (l *VirtimagesnapshotLister) Get(namespace, name string) (*apiv2.Virtimagesnapshot, error) {
+	obj, exists, err := l.indexer.GetByKey(listerKey(namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: "libvirt.org", Resource: "virtimagesnapshots"}, name)
+	}
+	return obj.(*apiv2.Virtimagesnapshot), nil
+}
+
+func DeepCopyVirtnode(in *apiv2.Virtnode) *apiv2.Virtnode {
+	var out apiv2.Virtnode
+	deepCopy(in, &out)
+	return &out
+}
+
+type VirtnodeLister struct {
+	indexer cache.Indexer
+}
+
+func NewVirtnodeLister(indexer cache.Indexer) *VirtnodeLister {
+	return &VirtnodeLister{indexer: indexer}
+}
+
+func (l *VirtnodeLister) List(selector labels.Selector) ([]*apiv2.Virtnode, error) {
+	var ret []*apiv2.Virtnode
+	err := cache.ListAll(l.indexer, selector, func(obj interface{}) {
+		ret = append(ret, obj.(*apiv2.Virtnode))
+	})
+	return ret, err
+}
+
+func (l *VirtnodeLister) Get(namespace, name string) (*apiv2.Virtnode, error) {
+	obj, exists, err := l.indexer.GetByKey(listerKey(namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: "libvirt.org", Resource: "virtnodes"}, name)
+	}
+	return obj.(*apiv2.Virtnode), nil
+}
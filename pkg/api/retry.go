@@ -0,0 +1,48 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const conflictRetries = 5
+
+// RetryOnConflict calls update until it is not rejected with a
+// conflict, ie until the object it wrote was up to date. Each
+// call must fetch the latest object and reapply its changes,
+// so that edits made by others are never overwritten
+func RetryOnConflict(update func() error) error {
+	delay := 10 * time.Millisecond
+	var err error
+	for i := 0; i < conflictRetries; i++ {
+		err = update()
+		if !errors.IsConflict(err) {
+			return err
+		}
+		glog.V(1).Infof("Update conflicted, retrying: %s", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return err
+}
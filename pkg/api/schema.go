@@ -0,0 +1,149 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"reflect"
+	"strings"
+
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	typeMetaType   = reflect.TypeOf(v1.TypeMeta{})
+	objectMetaType = reflect.TypeOf(v1.ObjectMeta{})
+	listMetaType   = reflect.TypeOf(v1.ListMeta{})
+	timeType       = reflect.TypeOf(v1.Time{})
+)
+
+// Split a json struct tag into the field name and
+// whether it is inlined into the parent
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	opts := strings.Split(tag, ",")
+	for _, opt := range opts[1:] {
+		if opt == "inline" {
+			return "", true
+		}
+	}
+	if opts[0] != "" {
+		return opts[0], false
+	}
+	return field.Name, false
+}
+
+func structSchema(typ reflect.Type, props map[string]apiextv1.JSONSchemaProps) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			// Unexported
+			continue
+		}
+
+		name, inline := jsonFieldName(field)
+		if inline {
+			if field.Type == typeMetaType {
+				// apiVersion & kind are validated by
+				// the apiserver itself
+				continue
+			}
+			structSchema(field.Type, props)
+			continue
+		}
+		if name == "" {
+			continue
+		}
+
+		props[name] = *typeSchema(field.Type)
+	}
+}
+
+// typeSchema generates the OpenAPI v3 schema for a Go type
+// from its json struct tags
+func typeSchema(typ reflect.Type) *apiextv1.JSONSchemaProps {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ {
+	case objectMetaType, listMetaType:
+		// Metadata is validated by the apiserver itself
+		return &apiextv1.JSONSchemaProps{Type: "object"}
+	case timeType:
+		// Marshalled as RFC 3339, not as a struct
+		return &apiextv1.JSONSchemaProps{Type: "string", Format: "date-time"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &apiextv1.JSONSchemaProps{Type: "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &apiextv1.JSONSchemaProps{Type: "integer"}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		min := float64(0)
+		return &apiextv1.JSONSchemaProps{Type: "integer", Minimum: &min}
+
+	case reflect.Float32, reflect.Float64:
+		return &apiextv1.JSONSchemaProps{Type: "number"}
+
+	case reflect.String:
+		return &apiextv1.JSONSchemaProps{Type: "string"}
+
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &apiextv1.JSONSchemaProps{Type: "string", Format: "byte"}
+		}
+		return &apiextv1.JSONSchemaProps{
+			Type: "array",
+			Items: &apiextv1.JSONSchemaPropsOrArray{
+				Schema: typeSchema(typ.Elem()),
+			},
+		}
+
+	case reflect.Map:
+		return &apiextv1.JSONSchemaProps{
+			Type: "object",
+			AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
+				Allows: true,
+				Schema: typeSchema(typ.Elem()),
+			},
+		}
+
+	case reflect.Struct:
+		schema := &apiextv1.JSONSchemaProps{
+			Type:       "object",
+			Properties: make(map[string]apiextv1.JSONSchemaProps),
+		}
+		structSchema(typ, schema.Properties)
+		return schema
+
+	default:
+		// Nothing in our resources should reach here, but
+		// don't let the apiserver prune what we can't describe
+		preserve := true
+		return &apiextv1.JSONSchemaProps{XPreserveUnknownFields: &preserve}
+	}
+}
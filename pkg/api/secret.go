@@ -4,24 +4,35 @@ import (
 	"fmt"
 
 	"github.com/golang/glog"
+	kubeapiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	kubeapiv1 "k8s.io/client-go/pkg/api/v1"
 )
 
-func GetSecretValue(clientset *kubernetes.Clientset, name, namespace, stype, field string) ([]byte, error) {
+// GetSecret fetches a secret, checking it is of the type
+// expected
+func GetSecret(clientset kubernetes.Interface, name, namespace, stype string) (*kubeapiv1.Secret, error) {
 	glog.V(1).Infof("Querying secret %s/%s", namespace, name)
 	options := metav1.GetOptions{}
 	sec, err := clientset.CoreV1().Secrets(namespace).Get(name, options)
 	if err != nil {
-		return []byte{}, err
+		return nil, err
 	}
 
 	if sec.Type != kubeapiv1.SecretType(stype) {
-		return []byte{}, fmt.Errorf("Secret %s/%s type is %s but want %s",
+		return nil, fmt.Errorf("Secret %s/%s type is %s but want %s",
 			namespace, name, sec.Type, stype)
 	}
 
+	return sec, nil
+}
+
+func GetSecretValue(clientset kubernetes.Interface, name, namespace, stype, field string) ([]byte, error) {
+	sec, err := GetSecret(clientset, name, namespace, stype)
+	if err != nil {
+		return []byte{}, err
+	}
+
 	val, ok := sec.Data[field]
 	if !ok {
 		return []byte{}, fmt.Errorf("Secret %s/%s missing field %s", namespace, name, field)
@@ -24,6 +24,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // Virtimagefile defines info about a node able to run KVM guests
 type Virtimagefile struct {
 	v1.TypeMeta `json:",inline"`
@@ -33,6 +35,8 @@ type Virtimagefile struct {
 	Status VirtimagefileStatus `json:"status"`
 }
 
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // VirtimagefileList is a list of Virtimagefiles.
 type VirtimagefileList struct {
 	v1.TypeMeta `json:",inline"`
@@ -127,6 +131,6 @@ func (ni *VirtimagefileList) GetObjectKind() schema.ObjectKind {
 }
 
 // Required to satisfy ListMetaAccessor interface
-func (ni *VirtimagefileList) GetListMeta() v1.List {
+func (ni *VirtimagefileList) GetListMeta() v1.ListInterface {
 	return &ni.Metadata
 }
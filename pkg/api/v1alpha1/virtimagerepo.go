@@ -24,6 +24,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // Virtimagerepo defines a Virtimagerepo deployment.
 type Virtimagerepo struct {
 	v1.TypeMeta `json:",inline"`
@@ -33,6 +35,8 @@ type Virtimagerepo struct {
 	Status VirtimagerepoStatus `json:"status"`
 }
 
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // VirtimagerepoList is a list of Virtimagerepos.
 type VirtimagerepoList struct {
 	v1.TypeMeta `json:",inline"`
@@ -90,6 +94,6 @@ func (ni *VirtimagerepoList) GetObjectKind() schema.ObjectKind {
 }
 
 // Required to satisfy ListMetaAccessor interface
-func (ni *VirtimagerepoList) GetListMeta() v1.List {
+func (ni *VirtimagerepoList) GetListMeta() v1.ListInterface {
 	return &ni.Metadata
 }
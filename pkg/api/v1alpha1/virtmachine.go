@@ -24,6 +24,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // Virtmachine defines a Virtmachine deployment.
 type Virtmachine struct {
 	v1.TypeMeta `json:",inline"`
@@ -32,6 +34,8 @@ type Virtmachine struct {
 	Status      VirtmachineStatus `json:"status"`
 }
 
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // VirtmachineList is a list of Virtmachines.
 type VirtmachineList struct {
 	v1.TypeMeta `json:",inline"`
@@ -183,6 +187,6 @@ func (ni *VirtmachineList) GetObjectKind() schema.ObjectKind {
 }
 
 // Required to satisfy ListMetaAccessor interface
-func (ni *VirtmachineList) GetListMeta() v1.List {
+func (ni *VirtmachineList) GetListMeta() v1.ListInterface {
 	return &ni.Metadata
 }
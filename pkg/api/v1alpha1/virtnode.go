@@ -24,6 +24,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // Virtnode defines info about a node able to run KVM guests
 type Virtnode struct {
 	v1.TypeMeta `json:",inline"`
@@ -33,6 +35,8 @@ type Virtnode struct {
 	Spec   VirtnodeSpec   `json:"spec"`
 }
 
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // VirtnodeList is a list of Virtnodes.
 type VirtnodeList struct {
 	v1.TypeMeta `json:",inline"`
@@ -105,6 +109,6 @@ func (ni *VirtnodeList) GetObjectKind() schema.ObjectKind {
 }
 
 // Required to satisfy ListMetaAccessor interface
-func (ni *VirtnodeList) GetListMeta() v1.List {
+func (ni *VirtnodeList) GetListMeta() v1.ListInterface {
 	return &ni.Metadata
 }
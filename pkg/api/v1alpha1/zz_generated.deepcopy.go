@@ -0,0 +1,876 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+// Code generated by deepcopy-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtimagefile) DeepCopyInto(out *Virtimagefile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	out.Spec = in.Spec
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtimagefile.
+func (in *Virtimagefile) DeepCopy() *Virtimagefile {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtimagefile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtimagefile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileList) DeepCopyInto(out *VirtimagefileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtimagefile, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtimagefile)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileList.
+func (in *VirtimagefileList) DeepCopy() *VirtimagefileList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtimagefileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileSpec) DeepCopyInto(out *VirtimagefileSpec) {
+	*out = *in
+	out.Stream = in.Stream
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileSpec.
+func (in *VirtimagefileSpec) DeepCopy() *VirtimagefileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileStatus) DeepCopyInto(out *VirtimagefileStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileStatus.
+func (in *VirtimagefileStatus) DeepCopy() *VirtimagefileStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileStream) DeepCopyInto(out *VirtimagefileStream) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileStream.
+func (in *VirtimagefileStream) DeepCopy() *VirtimagefileStream {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileStream)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtimagerepo) DeepCopyInto(out *Virtimagerepo) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	out.Spec = in.Spec
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtimagerepo.
+func (in *Virtimagerepo) DeepCopy() *Virtimagerepo {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtimagerepo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtimagerepo) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagerepoList) DeepCopyInto(out *VirtimagerepoList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtimagerepo, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtimagerepo)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagerepoList.
+func (in *VirtimagerepoList) DeepCopy() *VirtimagerepoList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagerepoList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtimagerepoList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagerepoSpec) DeepCopyInto(out *VirtimagerepoSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagerepoSpec.
+func (in *VirtimagerepoSpec) DeepCopy() *VirtimagerepoSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagerepoSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagerepoStatus) DeepCopyInto(out *VirtimagerepoStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagerepoStatus.
+func (in *VirtimagerepoStatus) DeepCopy() *VirtimagerepoStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagerepoStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtmachine) DeepCopyInto(out *Virtmachine) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtmachine.
+func (in *Virtmachine) DeepCopy() *Virtmachine {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtmachine)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtmachine) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineBoot) DeepCopyInto(out *VirtmachineBoot) {
+	*out = *in
+	if in.Kernel != nil {
+		in, out := &in.Kernel, &out.Kernel
+		*out = new(VirtmachineStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ramdisk != nil {
+		in, out := &in.Ramdisk, &out.Ramdisk
+		*out = new(VirtmachineStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Firmware != nil {
+		in, out := &in.Firmware, &out.Firmware
+		*out = new(VirtmachineFirmware)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineBoot.
+func (in *VirtmachineBoot) DeepCopy() *VirtmachineBoot {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineBoot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineCPU) DeepCopyInto(out *VirtmachineCPU) {
+	*out = *in
+	if in.Features != nil {
+		in, out := &in.Features, &out.Features
+		*out = make([]VirtmachineCPUFeature, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineCPU.
+func (in *VirtmachineCPU) DeepCopy() *VirtmachineCPU {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineCPU)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineCPUFeature) DeepCopyInto(out *VirtmachineCPUFeature) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineCPUFeature.
+func (in *VirtmachineCPUFeature) DeepCopy() *VirtmachineCPUFeature {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineCPUFeature)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineConsole) DeepCopyInto(out *VirtmachineConsole) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineConsole.
+func (in *VirtmachineConsole) DeepCopy() *VirtmachineConsole {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineConsole)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineDeviceList) DeepCopyInto(out *VirtmachineDeviceList) {
+	*out = *in
+	if in.Disks != nil {
+		in, out := &in.Disks, &out.Disks
+		*out = make([]*VirtmachineDisk, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(VirtmachineDisk)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.Consoles != nil {
+		in, out := &in.Consoles, &out.Consoles
+		*out = make([]*VirtmachineConsole, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(VirtmachineConsole)
+				**out = **in
+			}
+		}
+	}
+	if in.Video != nil {
+		in, out := &in.Video, &out.Video
+		*out = make([]*VirtmachineVideo, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(VirtmachineVideo)
+				**out = **in
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineDeviceList.
+func (in *VirtmachineDeviceList) DeepCopy() *VirtmachineDeviceList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineDeviceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineDisk) DeepCopyInto(out *VirtmachineDisk) {
+	*out = *in
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(VirtmachineStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Encrypt != nil {
+		in, out := &in.Encrypt, &out.Encrypt
+		*out = new(VirtmachineDiskEncrypt)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineDisk.
+func (in *VirtmachineDisk) DeepCopy() *VirtmachineDisk {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineDisk)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineDiskEncrypt) DeepCopyInto(out *VirtmachineDiskEncrypt) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineDiskEncrypt.
+func (in *VirtmachineDiskEncrypt) DeepCopy() *VirtmachineDiskEncrypt {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineDiskEncrypt)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineDiskSource) DeepCopyInto(out *VirtmachineDiskSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineDiskSource.
+func (in *VirtmachineDiskSource) DeepCopy() *VirtmachineDiskSource {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineDiskSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineFirmware) DeepCopyInto(out *VirtmachineFirmware) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineFirmware.
+func (in *VirtmachineFirmware) DeepCopy() *VirtmachineFirmware {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineFirmware)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineHardware) DeepCopyInto(out *VirtmachineHardware) {
+	*out = *in
+	in.Boot.DeepCopyInto(&out.Boot)
+	out.Memory = in.Memory
+	in.CPU.DeepCopyInto(&out.CPU)
+	out.Topology = in.Topology
+	in.Devices.DeepCopyInto(&out.Devices)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineHardware.
+func (in *VirtmachineHardware) DeepCopy() *VirtmachineHardware {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineHardware)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineList) DeepCopyInto(out *VirtmachineList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtmachine, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtmachine)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineList.
+func (in *VirtmachineList) DeepCopy() *VirtmachineList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtmachineList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineMemory) DeepCopyInto(out *VirtmachineMemory) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineMemory.
+func (in *VirtmachineMemory) DeepCopy() *VirtmachineMemory {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineMemory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineSpec) DeepCopyInto(out *VirtmachineSpec) {
+	*out = *in
+	in.Hardware.DeepCopyInto(&out.Hardware)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineSpec.
+func (in *VirtmachineSpec) DeepCopy() *VirtmachineSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineStatus) DeepCopyInto(out *VirtmachineStatus) {
+	*out = *in
+	in.Hardware.DeepCopyInto(&out.Hardware)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineStatus.
+func (in *VirtmachineStatus) DeepCopy() *VirtmachineStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineStorage) DeepCopyInto(out *VirtmachineStorage) {
+	*out = *in
+	if in.PersistentVolume != nil {
+		in, out := &in.PersistentVolume, &out.PersistentVolume
+		*out = new(VirtmachineStoragePersistentVolume)
+		**out = **in
+	}
+	if in.ImageFile != nil {
+		in, out := &in.ImageFile, &out.ImageFile
+		*out = new(VirtmachineStorageImageFile)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineStorage.
+func (in *VirtmachineStorage) DeepCopy() *VirtmachineStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineStorageImageFile) DeepCopyInto(out *VirtmachineStorageImageFile) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineStorageImageFile.
+func (in *VirtmachineStorageImageFile) DeepCopy() *VirtmachineStorageImageFile {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineStorageImageFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineStoragePersistentVolume) DeepCopyInto(out *VirtmachineStoragePersistentVolume) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineStoragePersistentVolume.
+func (in *VirtmachineStoragePersistentVolume) DeepCopy() *VirtmachineStoragePersistentVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineStoragePersistentVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineTopology) DeepCopyInto(out *VirtmachineTopology) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineTopology.
+func (in *VirtmachineTopology) DeepCopy() *VirtmachineTopology {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineTopology)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineVideo) DeepCopyInto(out *VirtmachineVideo) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineVideo.
+func (in *VirtmachineVideo) DeepCopy() *VirtmachineVideo {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineVideo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtnode) DeepCopyInto(out *Virtnode) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtnode.
+func (in *Virtnode) DeepCopy() *Virtnode {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtnode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtnode) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeCPU) DeepCopyInto(out *VirtnodeCPU) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeCPU.
+func (in *VirtnodeCPU) DeepCopy() *VirtnodeCPU {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeCPU)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeGuest) DeepCopyInto(out *VirtnodeGuest) {
+	*out = *in
+	if in.Machines != nil {
+		in, out := &in.Machines, &out.Machines
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeGuest.
+func (in *VirtnodeGuest) DeepCopy() *VirtnodeGuest {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeGuest)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeList) DeepCopyInto(out *VirtnodeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtnode, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtnode)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeList.
+func (in *VirtnodeList) DeepCopy() *VirtnodeList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtnodeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeMemory) DeepCopyInto(out *VirtnodeMemory) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeMemory.
+func (in *VirtnodeMemory) DeepCopy() *VirtnodeMemory {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeMemory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeNUMACell) DeepCopyInto(out *VirtnodeNUMACell) {
+	*out = *in
+	out.CPU = in.CPU
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		*out = make([]VirtnodeMemory, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeNUMACell.
+func (in *VirtnodeNUMACell) DeepCopy() *VirtnodeNUMACell {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeNUMACell)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeResources) DeepCopyInto(out *VirtnodeResources) {
+	*out = *in
+	if in.NUMACells != nil {
+		in, out := &in.NUMACells, &out.NUMACells
+		*out = make([]VirtnodeNUMACell, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeResources.
+func (in *VirtnodeResources) DeepCopy() *VirtnodeResources {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeSpec) DeepCopyInto(out *VirtnodeSpec) {
+	*out = *in
+	if in.Guests != nil {
+		in, out := &in.Guests, &out.Guests
+		*out = make([]VirtnodeGuest, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeSpec.
+func (in *VirtnodeSpec) DeepCopy() *VirtnodeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeStatus) DeepCopyInto(out *VirtnodeStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeStatus.
+func (in *VirtnodeStatus) DeepCopy() *VirtnodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,89 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package v1alpha2
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type ConditionType string
+
+const (
+	// The image file, image repo, snapshot or node is usable
+	ConditionReady ConditionType = "Ready"
+	// The machine has a running instance
+	ConditionRunning ConditionType = "Running"
+	// The image file's content has been imported from
+	// its source
+	ConditionImported ConditionType = "Imported"
+	// The image file's content has been reverted to the
+	// snapshot its spec asks for
+	ConditionReverted ConditionType = "Reverted"
+)
+
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// Condition reports one aspect of the state of a resource,
+// with the reason for any failure
+type Condition struct {
+	Type   ConditionType   `json:"type"`
+	Status ConditionStatus `json:"status"`
+	// A CamelCase word summarizing why the condition
+	// last changed, eg 'CreateFailed'
+	Reason string `json:"reason,omitempty"`
+	// Details for humans, such as the libvirt error
+	Message string `json:"message,omitempty"`
+	// When the status last changed
+	LastTransitionTime v1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// GetCondition returns the condition of the type,
+// or nil if it has not been reported
+func GetCondition(conds []Condition, typ ConditionType) *Condition {
+	for i := range conds {
+		if conds[i].Type == typ {
+			return &conds[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the type.
+// The transition time is only moved on when the status
+// actually changes
+func SetCondition(conds *[]Condition, typ ConditionType, status ConditionStatus, reason, message string) {
+	cond := GetCondition(*conds, typ)
+	if cond == nil {
+		*conds = append(*conds, Condition{Type: typ})
+		cond = &(*conds)[len(*conds)-1]
+	}
+	if cond.Status != status {
+		cond.Status = status
+		cond.LastTransitionTime = v1.Now()
+	}
+	cond.Reason = reason
+	cond.Message = message
+}
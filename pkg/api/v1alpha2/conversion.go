@@ -0,0 +1,487 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package v1alpha2
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+)
+
+// RegisterConversions adds the functions converting between the
+// v1alpha1 and v1alpha2 representations of every resource
+func RegisterConversions(scheme *runtime.Scheme) error {
+	return scheme.AddConversionFuncs(
+		Convert_v1alpha1_Virtmachine_To_v1alpha2_Virtmachine,
+		Convert_v1alpha2_Virtmachine_To_v1alpha1_Virtmachine,
+		Convert_v1alpha1_Virtimagefile_To_v1alpha2_Virtimagefile,
+		Convert_v1alpha2_Virtimagefile_To_v1alpha1_Virtimagefile,
+		Convert_v1alpha1_Virtimagerepo_To_v1alpha2_Virtimagerepo,
+		Convert_v1alpha2_Virtimagerepo_To_v1alpha1_Virtimagerepo,
+		Convert_v1alpha1_Virtnode_To_v1alpha2_Virtnode,
+		Convert_v1alpha2_Virtnode_To_v1alpha1_Virtnode,
+	)
+}
+
+// The annotation holding the v1alpha2 spec and status of an object
+// while it is represented at v1alpha1, so that the fields v1alpha1
+// has no place for survive a client writing through the old version
+const preservedFieldsAnnotation = "libvirt.org/v1alpha2-fields"
+
+type preservedFields struct {
+	Spec   json.RawMessage `json:"spec"`
+	Status json.RawMessage `json:"status"`
+}
+
+func preserveFields(meta *v1.ObjectMeta, spec, status interface{}) error {
+	var fields preservedFields
+	var err error
+	if fields.Spec, err = json.Marshal(spec); err != nil {
+		return err
+	}
+	if fields.Status, err = json.Marshal(status); err != nil {
+		return err
+	}
+	data, err := json.Marshal(&fields)
+	if err != nil {
+		return err
+	}
+
+	// The map is shared with the object being converted
+	annotations := make(map[string]string, len(meta.Annotations)+1)
+	for key, val := range meta.Annotations {
+		annotations[key] = val
+	}
+	annotations[preservedFieldsAnnotation] = string(data)
+	meta.Annotations = annotations
+	return nil
+}
+
+// restoreFields fills in the spec and status saved by preserveFields,
+// which the v1alpha1 fields are then converted over the top of
+func restoreFields(meta *v1.ObjectMeta, spec, status interface{}) error {
+	data, ok := meta.Annotations[preservedFieldsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var annotations map[string]string
+	for key, val := range meta.Annotations {
+		if key == preservedFieldsAnnotation {
+			continue
+		}
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[key] = val
+	}
+	meta.Annotations = annotations
+
+	var fields preservedFields
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields.Spec, spec); err != nil {
+		return err
+	}
+	return json.Unmarshal(fields.Status, status)
+}
+
+func convertStorageFromV1alpha1(in *v1alpha1.VirtmachineStorage) *VirtmachineStorage {
+	if in == nil {
+		return nil
+	}
+	out := &VirtmachineStorage{}
+	if in.PersistentVolume != nil {
+		out.PersistentVolume = &VirtmachineStoragePersistentVolume{
+			ClaimName: in.PersistentVolume.ClaimName,
+		}
+	}
+	if in.ImageFile != nil {
+		out.ImageFile = &VirtmachineStorageImageFile{
+			FileName: in.ImageFile.FileName,
+		}
+	}
+	return out
+}
+
+func convertStorageToV1alpha1(in *VirtmachineStorage) *v1alpha1.VirtmachineStorage {
+	if in == nil {
+		return nil
+	}
+	out := &v1alpha1.VirtmachineStorage{}
+	if in.PersistentVolume != nil {
+		out.PersistentVolume = &v1alpha1.VirtmachineStoragePersistentVolume{
+			ClaimName: in.PersistentVolume.ClaimName,
+		}
+	}
+	if in.ImageFile != nil {
+		out.ImageFile = &v1alpha1.VirtmachineStorageImageFile{
+			FileName: in.ImageFile.FileName,
+		}
+	}
+	return out
+}
+
+func convertHardwareFromV1alpha1(in *v1alpha1.VirtmachineHardware, out *VirtmachineHardware) {
+	out.Type = in.Type
+	out.Arch = in.Arch
+	out.Machine = in.Machine
+
+	out.Boot = VirtmachineBoot{
+		Type:       in.Boot.Type,
+		Kernel:     convertStorageFromV1alpha1(in.Boot.Kernel),
+		Ramdisk:    convertStorageFromV1alpha1(in.Boot.Ramdisk),
+		KernelArgs: in.Boot.KernelArgs,
+	}
+	if in.Boot.Firmware != nil {
+		out.Boot.Firmware = &VirtmachineFirmware{
+			Type: in.Boot.Firmware.Type,
+		}
+	}
+
+	out.Memory = VirtmachineMemory{
+		Initial: in.Memory.Initial,
+		Maximum: in.Memory.Maximum,
+		Slots:   in.Memory.Slots,
+	}
+
+	// The v1alpha1 mode & model fields shared a JSON key, so
+	// could never be decoded, and any restored values are kept
+	// unless they somehow were
+	out.CPU.Count = in.CPU.Count
+	if in.CPU.Mode != "" {
+		out.CPU.Mode = in.CPU.Mode
+	}
+	if in.CPU.Model != "" {
+		out.CPU.Model = in.CPU.Model
+	}
+	out.CPU.Features = nil
+	for _, feature := range in.CPU.Features {
+		out.CPU.Features = append(out.CPU.Features, VirtmachineCPUFeature{
+			Name:   feature.Name,
+			Policy: feature.Policy,
+		})
+	}
+
+	out.Topology = VirtmachineTopology{
+		Nodes:   in.Topology.Nodes,
+		Sockets: in.Topology.Sockets,
+		Cores:   in.Topology.Cores,
+		Threads: in.Topology.Threads,
+	}
+
+	restored := out.Devices
+	out.Devices = VirtmachineDeviceList{
+		Interfaces: restored.Interfaces,
+	}
+	for idx, disk := range in.Devices.Disks {
+		newdisk := &VirtmachineDisk{
+			Device:    disk.Device,
+			Source:    convertStorageFromV1alpha1(disk.Source),
+			BootIndex: disk.BootIndex,
+		}
+		// Disks can't be told apart beyond their position and
+		// source, so a v1alpha1 client reordering them loses
+		// the settings it couldn't see
+		if idx < len(restored.Disks) && reflect.DeepEqual(restored.Disks[idx].Source, newdisk.Source) {
+			old := restored.Disks[idx]
+			newdisk.Bus = old.Bus
+			newdisk.Transient = old.Transient
+			newdisk.Shareable = old.Shareable
+			newdisk.Reservations = old.Reservations
+		}
+		if disk.Encrypt != nil {
+			newdisk.Encrypt = &VirtmachineDiskEncrypt{
+				LUKS: &VirtmachineDiskEncryptLUKS{
+					Passphrase: disk.Encrypt.Passphrase,
+				},
+			}
+		}
+		out.Devices.Disks = append(out.Devices.Disks, newdisk)
+	}
+	for _, console := range in.Devices.Consoles {
+		out.Devices.Consoles = append(out.Devices.Consoles, &VirtmachineConsole{
+			Type: console.Type,
+		})
+	}
+	for _, video := range in.Devices.Video {
+		out.Devices.Videos = append(out.Devices.Videos, &VirtmachineVideo{
+			Type: video.Type,
+			VRam: video.VRam,
+		})
+	}
+}
+
+func convertHardwareToV1alpha1(in *VirtmachineHardware, out *v1alpha1.VirtmachineHardware) {
+	out.Type = in.Type
+	out.Arch = in.Arch
+	out.Machine = in.Machine
+
+	out.Boot = v1alpha1.VirtmachineBoot{
+		Type:       in.Boot.Type,
+		Kernel:     convertStorageToV1alpha1(in.Boot.Kernel),
+		Ramdisk:    convertStorageToV1alpha1(in.Boot.Ramdisk),
+		KernelArgs: in.Boot.KernelArgs,
+	}
+	if in.Boot.Firmware != nil {
+		out.Boot.Firmware = &v1alpha1.VirtmachineFirmware{
+			Type: in.Boot.Firmware.Type,
+		}
+	}
+
+	out.Memory = v1alpha1.VirtmachineMemory{
+		Initial: in.Memory.Initial,
+		Maximum: in.Memory.Maximum,
+		Slots:   in.Memory.Slots,
+	}
+
+	out.CPU = v1alpha1.VirtmachineCPU{
+		Count: in.CPU.Count,
+		Mode:  in.CPU.Mode,
+		Model: in.CPU.Model,
+	}
+	for _, feature := range in.CPU.Features {
+		out.CPU.Features = append(out.CPU.Features, v1alpha1.VirtmachineCPUFeature{
+			Name:   feature.Name,
+			Policy: feature.Policy,
+		})
+	}
+
+	out.Topology = v1alpha1.VirtmachineTopology{
+		Nodes:   in.Topology.Nodes,
+		Sockets: in.Topology.Sockets,
+		Cores:   in.Topology.Cores,
+		Threads: in.Topology.Threads,
+	}
+
+	out.Devices = v1alpha1.VirtmachineDeviceList{}
+	for _, disk := range in.Devices.Disks {
+		newdisk := &v1alpha1.VirtmachineDisk{
+			Device:    disk.Device,
+			Source:    convertStorageToV1alpha1(disk.Source),
+			BootIndex: disk.BootIndex,
+		}
+		if disk.Encrypt != nil && disk.Encrypt.LUKS != nil {
+			newdisk.Encrypt = &v1alpha1.VirtmachineDiskEncrypt{
+				Passphrase: disk.Encrypt.LUKS.Passphrase,
+			}
+		}
+		out.Devices.Disks = append(out.Devices.Disks, newdisk)
+	}
+	for _, console := range in.Devices.Consoles {
+		out.Devices.Consoles = append(out.Devices.Consoles, &v1alpha1.VirtmachineConsole{
+			Type: console.Type,
+		})
+	}
+	for _, video := range in.Devices.Videos {
+		out.Devices.Video = append(out.Devices.Video, &v1alpha1.VirtmachineVideo{
+			Type: video.Type,
+			VRam: video.VRam,
+		})
+	}
+}
+
+func Convert_v1alpha1_Virtmachine_To_v1alpha2_Virtmachine(in *v1alpha1.Virtmachine, out *Virtmachine, s conversion.Scope) error {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = SchemeGroupVersion.String()
+	out.Metadata = in.Metadata
+	if err := restoreFields(&out.Metadata, &out.Spec, &out.Status); err != nil {
+		return err
+	}
+	convertHardwareFromV1alpha1(&in.Spec.Hardware, &out.Spec.Hardware)
+	convertHardwareFromV1alpha1(&in.Status.Hardware, &out.Status.Hardware)
+	return nil
+}
+
+func Convert_v1alpha2_Virtmachine_To_v1alpha1_Virtmachine(in *Virtmachine, out *v1alpha1.Virtmachine, s conversion.Scope) error {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	out.Metadata = in.Metadata
+	convertHardwareToV1alpha1(&in.Spec.Hardware, &out.Spec.Hardware)
+	convertHardwareToV1alpha1(&in.Status.Hardware, &out.Status.Hardware)
+	return preserveFields(&out.Metadata, &in.Spec, &in.Status)
+}
+
+func Convert_v1alpha1_Virtimagefile_To_v1alpha2_Virtimagefile(in *v1alpha1.Virtimagefile, out *Virtimagefile, s conversion.Scope) error {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = SchemeGroupVersion.String()
+	out.Metadata = in.Metadata
+	if err := restoreFields(&out.Metadata, &out.Spec, &out.Status); err != nil {
+		return err
+	}
+	out.Spec.RepoName = in.Spec.RepoName
+	out.Spec.BackingImageFile = in.Spec.BackingImageFile
+	out.Spec.AccessMode = VirtimagefileAccessMode(in.Spec.AccessMode)
+	out.Spec.Capacity = in.Spec.Capacity
+	out.Spec.Stream = VirtimagefileStream{
+		TokenSecret: in.Spec.Stream.TokenSecret,
+		AccessMode:  VirtimagefileStreamAccessMode(in.Spec.Stream.AccessMode),
+	}
+	out.Status.Phase = VirtimagefilePhase(in.Status.Phase)
+	out.Status.Usage = in.Status.Usage
+	out.Status.Length = in.Status.Length
+	out.Status.Capacity = in.Status.Capacity
+	return nil
+}
+
+func Convert_v1alpha2_Virtimagefile_To_v1alpha1_Virtimagefile(in *Virtimagefile, out *v1alpha1.Virtimagefile, s conversion.Scope) error {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	out.Metadata = in.Metadata
+	out.Spec = v1alpha1.VirtimagefileSpec{
+		RepoName:         in.Spec.RepoName,
+		BackingImageFile: in.Spec.BackingImageFile,
+		AccessMode:       v1alpha1.VirtimagefileAccessMode(in.Spec.AccessMode),
+		Capacity:         in.Spec.Capacity,
+		Stream: v1alpha1.VirtimagefileStream{
+			TokenSecret: in.Spec.Stream.TokenSecret,
+			AccessMode:  v1alpha1.VirtimagefileStreamAccessMode(in.Spec.Stream.AccessMode),
+		},
+	}
+	out.Status = v1alpha1.VirtimagefileStatus{
+		Phase:    v1alpha1.VirtimagefilePhase(in.Status.Phase),
+		Usage:    in.Status.Usage,
+		Length:   in.Status.Length,
+		Capacity: in.Status.Capacity,
+	}
+	return preserveFields(&out.Metadata, &in.Spec, &in.Status)
+}
+
+func Convert_v1alpha1_Virtimagerepo_To_v1alpha2_Virtimagerepo(in *v1alpha1.Virtimagerepo, out *Virtimagerepo, s conversion.Scope) error {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = SchemeGroupVersion.String()
+	out.Metadata = in.Metadata
+	if err := restoreFields(&out.Metadata, &out.Spec, &out.Status); err != nil {
+		return err
+	}
+	out.Spec = VirtimagerepoSpec{
+		ClaimName:   in.Spec.ClaimName,
+		Format:      in.Spec.Format,
+		Preallocate: in.Spec.Preallocate,
+		JobWorkers:  in.Spec.JobWorkers,
+	}
+	out.Status.Phase = VirtimagerepoPhase(in.Status.Phase)
+	out.Status.Capacity = in.Status.Capacity
+	out.Status.Allocation = in.Status.Allocation
+	out.Status.Commitment = in.Status.Commitment
+	return nil
+}
+
+func Convert_v1alpha2_Virtimagerepo_To_v1alpha1_Virtimagerepo(in *Virtimagerepo, out *v1alpha1.Virtimagerepo, s conversion.Scope) error {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	out.Metadata = in.Metadata
+	out.Spec = v1alpha1.VirtimagerepoSpec{
+		ClaimName:   in.Spec.ClaimName,
+		Format:      in.Spec.Format,
+		Preallocate: in.Spec.Preallocate,
+		JobWorkers:  in.Spec.JobWorkers,
+	}
+	out.Status = v1alpha1.VirtimagerepoStatus{
+		Phase:      v1alpha1.VirtimagerepoPhase(in.Status.Phase),
+		Capacity:   in.Status.Capacity,
+		Allocation: in.Status.Allocation,
+		Commitment: in.Status.Commitment,
+	}
+	return preserveFields(&out.Metadata, &in.Spec, &in.Status)
+}
+
+func Convert_v1alpha1_Virtnode_To_v1alpha2_Virtnode(in *v1alpha1.Virtnode, out *Virtnode, s conversion.Scope) error {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = SchemeGroupVersion.String()
+	out.Metadata = in.Metadata
+	if err := restoreFields(&out.Metadata, &out.Spec, &out.Status); err != nil {
+		return err
+	}
+	out.Status.Phase = VirtnodePhase(in.Status.Phase)
+	out.Spec = VirtnodeSpec{
+		UUID: in.Spec.UUID,
+		Arch: in.Spec.Arch,
+	}
+	for _, guest := range in.Spec.Guests {
+		out.Spec.Guests = append(out.Spec.Guests, VirtnodeGuest{
+			Hypervisor: guest.Hypervisor,
+			Arch:       guest.Arch,
+			Type:       guest.Type,
+			Machines:   guest.Machines,
+		})
+	}
+	for _, cell := range in.Spec.Resources.NUMACells {
+		newcell := VirtnodeNUMACell{
+			CPU: VirtnodeCPU{
+				Avail: cell.CPU.Avail,
+				Used:  cell.CPU.Used,
+			},
+		}
+		for _, mem := range cell.Memory {
+			newcell.Memory = append(newcell.Memory, VirtnodeMemory{
+				PageSize: mem.PageSize,
+				Present:  mem.Present,
+				Used:     mem.Used,
+			})
+		}
+		out.Spec.Resources.NUMACells = append(out.Spec.Resources.NUMACells, newcell)
+	}
+	return nil
+}
+
+func Convert_v1alpha2_Virtnode_To_v1alpha1_Virtnode(in *Virtnode, out *v1alpha1.Virtnode, s conversion.Scope) error {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	out.Metadata = in.Metadata
+	out.Status = v1alpha1.VirtnodeStatus{
+		Phase: v1alpha1.VirtnodePhase(in.Status.Phase),
+	}
+	out.Spec = v1alpha1.VirtnodeSpec{
+		UUID: in.Spec.UUID,
+		Arch: in.Spec.Arch,
+	}
+	for _, guest := range in.Spec.Guests {
+		out.Spec.Guests = append(out.Spec.Guests, v1alpha1.VirtnodeGuest{
+			Hypervisor: guest.Hypervisor,
+			Arch:       guest.Arch,
+			Type:       guest.Type,
+			Machines:   guest.Machines,
+		})
+	}
+	for _, cell := range in.Spec.Resources.NUMACells {
+		newcell := v1alpha1.VirtnodeNUMACell{
+			CPU: v1alpha1.VirtnodeCPU{
+				Avail: cell.CPU.Avail,
+				Used:  cell.CPU.Used,
+			},
+		}
+		for _, mem := range cell.Memory {
+			newcell.Memory = append(newcell.Memory, v1alpha1.VirtnodeMemory{
+				PageSize: mem.PageSize,
+				Present:  mem.Present,
+				Used:     mem.Used,
+			})
+		}
+		out.Spec.Resources.NUMACells = append(out.Spec.Resources.NUMACells, newcell)
+	}
+	return preserveFields(&out.Metadata, &in.Spec, &in.Status)
+}
@@ -0,0 +1,643 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package v1alpha2
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+)
+
+func boolPtr(val bool) *bool {
+	return &val
+}
+
+// The apiserver stores what the webhook returns, so objects
+// pass through the v1alpha1 JSON encoding between conversions
+func throughJSON(t *testing.T, in, out interface{}) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testConditions() []Condition {
+	return []Condition{
+		{
+			Type:               ConditionReady,
+			Status:             ConditionFalse,
+			Reason:             "CreateFailed",
+			Message:            "no space left on device",
+			LastTransitionTime: v1.NewTime(time.Unix(1500000000, 0)),
+		},
+	}
+}
+
+func testHardware() VirtmachineHardware {
+	return VirtmachineHardware{
+		Type:    "kvm",
+		Arch:    "x86_64",
+		Machine: "q35",
+		OS:      "fedora25",
+		Preset:  "server",
+		Boot: VirtmachineBoot{
+			Type: "firmware",
+			Firmware: &VirtmachineFirmware{
+				Type: "efi",
+			},
+		},
+		Memory: VirtmachineMemory{
+			Initial: 1024,
+			Maximum: 4096,
+			Slots:   4,
+		},
+		CPU: VirtmachineCPU{
+			Count: 2,
+			Mode:  "host-model",
+			Features: []VirtmachineCPUFeature{
+				{Name: "vmx", Policy: "disable"},
+			},
+		},
+		Features: &VirtmachineFeatures{
+			ACPI: boolPtr(true),
+			HyperV: &VirtmachineHyperV{
+				Relaxed:   true,
+				Spinlocks: 8191,
+			},
+		},
+		Clock: &VirtmachineClock{
+			Offset: "utc",
+			Timers: []VirtmachineTimer{
+				{Name: "rtc", TickPolicy: "catchup"},
+			},
+		},
+		Lifecycle: &VirtmachineLifecycle{
+			OnCrash: "restart",
+		},
+		Devices: VirtmachineDeviceList{
+			Disks: []*VirtmachineDisk{
+				{
+					Device: "disk",
+					Bus:    "virtio",
+					Source: &VirtmachineStorage{
+						ImageFile: &VirtmachineStorageImageFile{
+							FileName: "root",
+						},
+					},
+					BootIndex: 1,
+					Transient: true,
+				},
+				{
+					Device: "disk",
+					Bus:    "scsi",
+					Source: &VirtmachineStorage{
+						ImageFile: &VirtmachineStorageImageFile{
+							FileName: "shared",
+						},
+					},
+					Shareable:    true,
+					Reservations: true,
+				},
+			},
+			Interfaces: []*VirtmachineInterface{
+				{Network: "default", Model: "virtio"},
+			},
+			Consoles: []*VirtmachineConsole{
+				{Type: "serial"},
+			},
+		},
+	}
+}
+
+func testVirtmachine() *Virtmachine {
+	return &Virtmachine{
+		TypeMeta: v1.TypeMeta{
+			Kind:       "Virtmachine",
+			APIVersion: SchemeGroupVersion.String(),
+		},
+		Metadata: v1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"owner": "ops",
+			},
+		},
+		Spec: VirtmachineSpec{
+			Class:    "small",
+			Hardware: testHardware(),
+			Overrides: []VirtmachineOverride{
+				{Name: "pmu", XML: "<domain><features><pmu state='off'/></features></domain>"},
+			},
+		},
+		Status: VirtmachineStatus{
+			Hardware:      testHardware(),
+			Class:         "small",
+			ClassRevision: "42",
+			Overrides:     []string{"pmu"},
+			Pod:           "web-shim",
+			DomainUUID:    "c7a5fdbd-cdaf-9455-926a-d65c16db1809",
+			StopReason:    VirtmachineStopCrashed,
+			Conditions:    testConditions(),
+		},
+	}
+}
+
+func virtmachineToV1alpha1(t *testing.T, in *Virtmachine) *v1alpha1.Virtmachine {
+	var out, stored v1alpha1.Virtmachine
+	if err := Convert_v1alpha2_Virtmachine_To_v1alpha1_Virtmachine(in, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	throughJSON(t, &out, &stored)
+	return &stored
+}
+
+func virtmachineFromV1alpha1(t *testing.T, in *v1alpha1.Virtmachine) *Virtmachine {
+	var out Virtmachine
+	if err := Convert_v1alpha1_Virtmachine_To_v1alpha2_Virtmachine(in, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+func TestVirtmachineRoundTrip(t *testing.T) {
+	orig := testVirtmachine()
+
+	old := virtmachineToV1alpha1(t, orig)
+	if old.Metadata.Annotations[preservedFieldsAnnotation] == "" {
+		t.Fatalf("Expected %s annotation on v1alpha1 object", preservedFieldsAnnotation)
+	}
+	if _, ok := orig.Metadata.Annotations[preservedFieldsAnnotation]; ok {
+		t.Fatalf("Conversion modified the annotations of its input")
+	}
+
+	got := virtmachineFromV1alpha1(t, old)
+	if !reflect.DeepEqual(got, orig) {
+		t.Errorf("Round trip changed machine\n got: %#v\nwant: %#v", got, orig)
+	}
+}
+
+func TestVirtmachineV1alpha1Edit(t *testing.T) {
+	orig := testVirtmachine()
+
+	old := virtmachineToV1alpha1(t, orig)
+	old.Spec.Hardware.Memory.Initial = 2048
+	old.Spec.Hardware.Devices.Disks = append(old.Spec.Hardware.Devices.Disks, &v1alpha1.VirtmachineDisk{
+		Device: "cdrom",
+		Source: &v1alpha1.VirtmachineStorage{
+			ImageFile: &v1alpha1.VirtmachineStorageImageFile{
+				FileName: "install",
+			},
+		},
+	})
+	// Swapping the source makes the disk a different one
+	old.Spec.Hardware.Devices.Disks[1].Source.ImageFile.FileName = "data"
+
+	got := virtmachineFromV1alpha1(t, old)
+
+	want := testVirtmachine()
+	want.Spec.Hardware.Memory.Initial = 2048
+	want.Spec.Hardware.Devices.Disks[1] = &VirtmachineDisk{
+		Device: "disk",
+		Source: &VirtmachineStorage{
+			ImageFile: &VirtmachineStorageImageFile{
+				FileName: "data",
+			},
+		},
+	}
+	want.Spec.Hardware.Devices.Disks = append(want.Spec.Hardware.Devices.Disks, &VirtmachineDisk{
+		Device: "cdrom",
+		Source: &VirtmachineStorage{
+			ImageFile: &VirtmachineStorageImageFile{
+				FileName: "install",
+			},
+		},
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Edited machine\n got: %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestVirtimagefileRoundTrip(t *testing.T) {
+	orig := &Virtimagefile{
+		TypeMeta: v1.TypeMeta{
+			Kind:       "Virtimagefile",
+			APIVersion: SchemeGroupVersion.String(),
+		},
+		Metadata: v1.ObjectMeta{
+			Name:      "root",
+			Namespace: "default",
+		},
+		Spec: VirtimagefileSpec{
+			RepoName:   "images",
+			AccessMode: VirtimagefileReadWriteOnce,
+			Capacity:   10 * 1024 * 1024 * 1024,
+			Format:     "qcow2",
+			Stream: VirtimagefileStream{
+				TokenSecret: "root-token",
+				AccessMode:  VirtimagefileStreamBoth,
+			},
+			Source: &VirtimagefileSource{
+				HTTP: &VirtimagefileSourceHTTP{
+					URL: "https://example.org/fedora.qcow2.xz",
+				},
+			},
+			Revert: &VirtimagefileRevert{
+				Snapshot: "pre-upgrade",
+				ID:       "1",
+			},
+		},
+		Status: VirtimagefileStatus{
+			Phase:        VirtimagefileAvailable,
+			Conditions:   testConditions(),
+			Usage:        4096,
+			Length:       8192,
+			Capacity:     10 * 1024 * 1024 * 1024,
+			UploadOffset: 512,
+			Import: &VirtimagefileImportStatus{
+				Transferred: 100,
+				Total:       200,
+			},
+			Snapshots: []VirtimagefileSnapshotStatus{
+				{
+					Name:         "pre-upgrade",
+					Type:         VirtimagesnapshotInternal,
+					CreationTime: v1.NewTime(time.Unix(1500000000, 0)),
+				},
+			},
+			Revert: &VirtimagefileRevert{
+				Snapshot: "pre-upgrade",
+				ID:       "1",
+			},
+		},
+	}
+
+	var out, old v1alpha1.Virtimagefile
+	if err := Convert_v1alpha2_Virtimagefile_To_v1alpha1_Virtimagefile(orig, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	throughJSON(t, &out, &old)
+
+	var got Virtimagefile
+	if err := Convert_v1alpha1_Virtimagefile_To_v1alpha2_Virtimagefile(&old, &got, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, orig) {
+		t.Errorf("Round trip changed image file\n got: %#v\nwant: %#v", &got, orig)
+	}
+}
+
+func TestVirtimagerepoRoundTrip(t *testing.T) {
+	orig := &Virtimagerepo{
+		TypeMeta: v1.TypeMeta{
+			Kind:       "Virtimagerepo",
+			APIVersion: SchemeGroupVersion.String(),
+		},
+		Metadata: v1.ObjectMeta{
+			Name:      "images",
+			Namespace: "default",
+		},
+		Spec: VirtimagerepoSpec{
+			ClaimName:  "images",
+			Format:     "qcow2",
+			JobWorkers: 2,
+		},
+		Status: VirtimagerepoStatus{
+			Phase:      VirtimagerepoReady,
+			Conditions: testConditions(),
+			Capacity:   1 << 40,
+			Allocation: 1 << 30,
+			Commitment: 1 << 35,
+			StreamURL:  "https://10.0.0.1:8443/stream/images",
+		},
+	}
+
+	var out, old v1alpha1.Virtimagerepo
+	if err := Convert_v1alpha2_Virtimagerepo_To_v1alpha1_Virtimagerepo(orig, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	throughJSON(t, &out, &old)
+
+	var got Virtimagerepo
+	if err := Convert_v1alpha1_Virtimagerepo_To_v1alpha2_Virtimagerepo(&old, &got, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, orig) {
+		t.Errorf("Round trip changed image repo\n got: %#v\nwant: %#v", &got, orig)
+	}
+}
+
+func TestVirtnodeRoundTrip(t *testing.T) {
+	orig := &Virtnode{
+		TypeMeta: v1.TypeMeta{
+			Kind:       "Virtnode",
+			APIVersion: SchemeGroupVersion.String(),
+		},
+		Metadata: v1.ObjectMeta{
+			Name: "node1",
+		},
+		Status: VirtnodeStatus{
+			Phase:      VirtnodeReady,
+			Conditions: testConditions(),
+		},
+		Spec: VirtnodeSpec{
+			UUID: "4c4c4544-0051-3610-8056-b7c04f563232",
+			Arch: "x86_64",
+			Guests: []VirtnodeGuest{
+				{
+					Hypervisor: "kvm",
+					Arch:       "x86_64",
+					Type:       "hvm",
+					Machines:   []string{"pc", "q35"},
+				},
+			},
+			Resources: VirtnodeResources{
+				NUMACells: []VirtnodeNUMACell{
+					{
+						CPU: VirtnodeCPU{Avail: 8, Used: 2},
+						Memory: []VirtnodeMemory{
+							{PageSize: 4, Present: 1 << 20, Used: 1 << 18},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var out, old v1alpha1.Virtnode
+	if err := Convert_v1alpha2_Virtnode_To_v1alpha1_Virtnode(orig, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	throughJSON(t, &out, &old)
+
+	var got Virtnode
+	if err := Convert_v1alpha1_Virtnode_To_v1alpha2_Virtnode(&old, &got, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, orig) {
+		t.Errorf("Round trip changed node\n got: %#v\nwant: %#v", &got, orig)
+	}
+}
+
+// Objects written by v1alpha1 clients come back from the
+// apiserver with the annotation carrying the v1alpha2 fields,
+// which is dropped before they're compared with what was sent
+func dropPreservedFields(t *testing.T, meta *v1.ObjectMeta) {
+	if meta.Annotations[preservedFieldsAnnotation] == "" {
+		t.Fatalf("Expected %s annotation on v1alpha1 object", preservedFieldsAnnotation)
+	}
+	delete(meta.Annotations, preservedFieldsAnnotation)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+}
+
+func TestVirtmachineV1alpha1RoundTrip(t *testing.T) {
+	hardware := v1alpha1.VirtmachineHardware{
+		Type:    "kvm",
+		Arch:    "x86_64",
+		Machine: "pc",
+		Boot: v1alpha1.VirtmachineBoot{
+			Type: "direct",
+			Kernel: &v1alpha1.VirtmachineStorage{
+				ImageFile: &v1alpha1.VirtmachineStorageImageFile{
+					FileName: "vmlinuz",
+				},
+			},
+			Ramdisk: &v1alpha1.VirtmachineStorage{
+				ImageFile: &v1alpha1.VirtmachineStorageImageFile{
+					FileName: "initrd",
+				},
+			},
+			KernelArgs: "console=ttyS0",
+		},
+		Memory: v1alpha1.VirtmachineMemory{
+			Initial: 1024,
+			Maximum: 4096,
+			Slots:   4,
+		},
+		CPU: v1alpha1.VirtmachineCPU{
+			Count: 4,
+			Features: []v1alpha1.VirtmachineCPUFeature{
+				{Name: "vmx", Policy: "require"},
+			},
+		},
+		Topology: v1alpha1.VirtmachineTopology{
+			Sockets: 2,
+			Cores:   2,
+			Threads: 1,
+		},
+		Devices: v1alpha1.VirtmachineDeviceList{
+			Disks: []*v1alpha1.VirtmachineDisk{
+				{
+					Device:    "disk",
+					BootIndex: 1,
+					Source: &v1alpha1.VirtmachineStorage{
+						PersistentVolume: &v1alpha1.VirtmachineStoragePersistentVolume{
+							ClaimName: "root",
+						},
+					},
+					Encrypt: &v1alpha1.VirtmachineDiskEncrypt{
+						Passphrase: "123456",
+					},
+				},
+				{
+					Device: "cdrom",
+					Source: &v1alpha1.VirtmachineStorage{
+						ImageFile: &v1alpha1.VirtmachineStorageImageFile{
+							FileName: "install",
+						},
+					},
+				},
+			},
+			Consoles: []*v1alpha1.VirtmachineConsole{
+				{Type: "serial"},
+			},
+			Video: []*v1alpha1.VirtmachineVideo{
+				{Type: "qxl", VRam: 65536},
+			},
+		},
+	}
+	orig := &v1alpha1.Virtmachine{
+		TypeMeta: v1.TypeMeta{
+			Kind:       "Virtmachine",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+		Metadata: v1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.VirtmachineSpec{
+			Hardware: hardware,
+		},
+		Status: v1alpha1.VirtmachineStatus{
+			Hardware: hardware,
+		},
+	}
+
+	var stored v1alpha1.Virtmachine
+	throughJSON(t, orig, &stored)
+
+	got := virtmachineToV1alpha1(t, virtmachineFromV1alpha1(t, &stored))
+	dropPreservedFields(t, &got.Metadata)
+	if !reflect.DeepEqual(got, &stored) {
+		t.Errorf("Round trip changed v1alpha1 machine\n got: %#v\nwant: %#v", got, &stored)
+	}
+}
+
+func TestVirtimagefileV1alpha1RoundTrip(t *testing.T) {
+	orig := &v1alpha1.Virtimagefile{
+		TypeMeta: v1.TypeMeta{
+			Kind:       "Virtimagefile",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+		Metadata: v1.ObjectMeta{
+			Name:      "root",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.VirtimagefileSpec{
+			RepoName:         "images",
+			BackingImageFile: "fedora",
+			AccessMode:       v1alpha1.VirtimagefileReadWriteOnce,
+			Capacity:         10 * 1024 * 1024 * 1024,
+			Stream: v1alpha1.VirtimagefileStream{
+				TokenSecret: "root-token",
+				AccessMode:  v1alpha1.VirtimagefileStreamBoth,
+			},
+		},
+		Status: v1alpha1.VirtimagefileStatus{
+			Phase:    v1alpha1.VirtimagefileAvailable,
+			Usage:    4096,
+			Length:   8192,
+			Capacity: 10 * 1024 * 1024 * 1024,
+		},
+	}
+
+	var out Virtimagefile
+	if err := Convert_v1alpha1_Virtimagefile_To_v1alpha2_Virtimagefile(orig, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var got v1alpha1.Virtimagefile
+	if err := Convert_v1alpha2_Virtimagefile_To_v1alpha1_Virtimagefile(&out, &got, nil); err != nil {
+		t.Fatal(err)
+	}
+	dropPreservedFields(t, &got.Metadata)
+	if !reflect.DeepEqual(&got, orig) {
+		t.Errorf("Round trip changed v1alpha1 image file\n got: %#v\nwant: %#v", &got, orig)
+	}
+}
+
+func TestVirtimagerepoV1alpha1RoundTrip(t *testing.T) {
+	orig := &v1alpha1.Virtimagerepo{
+		TypeMeta: v1.TypeMeta{
+			Kind:       "Virtimagerepo",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+		Metadata: v1.ObjectMeta{
+			Name:      "images",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.VirtimagerepoSpec{
+			ClaimName:   "images",
+			Format:      "qcow2",
+			Preallocate: true,
+			JobWorkers:  2,
+		},
+		Status: v1alpha1.VirtimagerepoStatus{
+			Phase:      v1alpha1.VirtimagerepoReady,
+			Capacity:   1 << 40,
+			Allocation: 1 << 30,
+			Commitment: 1 << 35,
+		},
+	}
+
+	var out Virtimagerepo
+	if err := Convert_v1alpha1_Virtimagerepo_To_v1alpha2_Virtimagerepo(orig, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var got v1alpha1.Virtimagerepo
+	if err := Convert_v1alpha2_Virtimagerepo_To_v1alpha1_Virtimagerepo(&out, &got, nil); err != nil {
+		t.Fatal(err)
+	}
+	dropPreservedFields(t, &got.Metadata)
+	if !reflect.DeepEqual(&got, orig) {
+		t.Errorf("Round trip changed v1alpha1 image repo\n got: %#v\nwant: %#v", &got, orig)
+	}
+}
+
+func TestVirtnodeV1alpha1RoundTrip(t *testing.T) {
+	orig := &v1alpha1.Virtnode{
+		TypeMeta: v1.TypeMeta{
+			Kind:       "Virtnode",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+		Metadata: v1.ObjectMeta{
+			Name: "node1",
+		},
+		Status: v1alpha1.VirtnodeStatus{
+			Phase: v1alpha1.VirtnodeReady,
+		},
+		Spec: v1alpha1.VirtnodeSpec{
+			UUID: "4c4c4544-0051-3610-8056-b7c04f563232",
+			Arch: "x86_64",
+			Guests: []v1alpha1.VirtnodeGuest{
+				{
+					Hypervisor: "kvm",
+					Arch:       "x86_64",
+					Type:       "hvm",
+					Machines:   []string{"pc", "q35"},
+				},
+			},
+			Resources: v1alpha1.VirtnodeResources{
+				NUMACells: []v1alpha1.VirtnodeNUMACell{
+					{
+						CPU: v1alpha1.VirtnodeCPU{Avail: 8, Used: 2},
+						Memory: []v1alpha1.VirtnodeMemory{
+							{PageSize: 4, Present: 1 << 20, Used: 1 << 18},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var out Virtnode
+	if err := Convert_v1alpha1_Virtnode_To_v1alpha2_Virtnode(orig, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var got v1alpha1.Virtnode
+	if err := Convert_v1alpha2_Virtnode_To_v1alpha1_Virtnode(&out, &got, nil); err != nil {
+		t.Fatal(err)
+	}
+	dropPreservedFields(t, &got.Metadata)
+	if !reflect.DeepEqual(&got, orig) {
+		t.Errorf("Round trip changed v1alpha1 node\n got: %#v\nwant: %#v", &got, orig)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package v1alpha2
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// RegisterDefaults adds the functions filling in unset fields of
+// every resource when it is decoded
+func RegisterDefaults(scheme *runtime.Scheme) error {
+	scheme.AddTypeDefaultingFunc(&Virtmachine{}, func(obj interface{}) { SetDefaults_Virtmachine(obj.(*Virtmachine)) })
+	scheme.AddTypeDefaultingFunc(&Virtimagefile{}, func(obj interface{}) { SetDefaults_Virtimagefile(obj.(*Virtimagefile)) })
+	scheme.AddTypeDefaultingFunc(&Virtimagerepo{}, func(obj interface{}) { SetDefaults_Virtimagerepo(obj.(*Virtimagerepo)) })
+	scheme.AddTypeDefaultingFunc(&Virtimagesnapshot{}, func(obj interface{}) { SetDefaults_Virtimagesnapshot(obj.(*Virtimagesnapshot)) })
+	return nil
+}
+
+func SetDefaults_Virtmachine(obj *Virtmachine) {
+	// Any unset fields must be filled from the class
+	// first, which is done when the machine starts
+	if obj.Spec.Class != "" {
+		return
+	}
+	SetDefaults_VirtmachineHardware(&obj.Spec.Hardware)
+}
+
+func SetDefaults_VirtmachineHardware(hw *VirtmachineHardware) {
+	if hw.Type == "" {
+		hw.Type = "kvm"
+	}
+	if hw.Boot.Type == "" {
+		hw.Boot.Type = "firmware"
+	}
+	if hw.CPU.Count == 0 {
+		hw.CPU.Count = 1
+	}
+	if hw.Memory.Maximum == 0 {
+		hw.Memory.Maximum = hw.Memory.Initial
+	}
+	if hw.Memory.Slots == 0 {
+		hw.Memory.Slots = 1
+	}
+	for _, disk := range hw.Devices.Disks {
+		if disk.Device == "" {
+			disk.Device = "disk"
+		}
+	}
+}
+
+func SetDefaults_Virtimagefile(obj *Virtimagefile) {
+	if obj.Spec.AccessMode == "" {
+		obj.Spec.AccessMode = VirtimagefileReadWriteOnce
+	}
+}
+
+func SetDefaults_Virtimagerepo(obj *Virtimagerepo) {
+	if obj.Spec.Format == "" {
+		obj.Spec.Format = "raw"
+	}
+	if obj.Spec.JobWorkers == 0 {
+		obj.Spec.JobWorkers = 3
+	}
+}
+
+func SetDefaults_Virtimagesnapshot(obj *Virtimagesnapshot) {
+	if obj.Spec.Type == "" {
+		obj.Spec.Type = VirtimagesnapshotInternal
+	}
+}
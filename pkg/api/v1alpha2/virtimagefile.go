@@ -0,0 +1,263 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package v1alpha2
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Virtimagefile defines a disk image file stored in a Virtimagerepo
+type Virtimagefile struct {
+	v1.TypeMeta `json:",inline"`
+	Metadata    v1.ObjectMeta `json:"metadata"`
+
+	Spec   VirtimagefileSpec   `json:"spec"`
+	Status VirtimagefileStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// VirtimagefileList is a list of Virtimagefiles.
+type VirtimagefileList struct {
+	v1.TypeMeta `json:",inline"`
+	Metadata    v1.ListMeta `json:"metadata"`
+
+	Items []*Virtimagefile `json:"items"`
+}
+
+type VirtimagefileStatus struct {
+	Phase      VirtimagefilePhase `json:"phase"`
+	Conditions []Condition        `json:"conditions,omitempty"`
+
+	// Physical usage of the file on underlying storage
+	// - May be less than length if the file is sparse
+	// - May be greater than length if the FS has
+	//   pre-emptively reserved extra blocks for future
+	//   size growth
+	Usage uint64 `json:"usage"`
+
+	// Reported length of the file on underlying storage
+	Length uint64 `json:"length"`
+
+	// Current logical capacity - may different from spec
+	// capacity if a resize is pending
+	Capacity uint64 `json:"capacity"`
+
+	// Progress importing the content from the spec
+	// source, if any
+	Import *VirtimagefileImportStatus `json:"import,omitempty"`
+
+	// Bytes of an upload received so far, from the start
+	// of the image, which the next chunk carries on from
+	// until the upload is finalized
+	UploadOffset uint64 `json:"uploadOffset,omitempty"`
+
+	// The snapshots which have been taken of the file,
+	// oldest first
+	Snapshots []VirtimagefileSnapshotStatus `json:"snapshots,omitempty"`
+
+	// The last revert requested by the spec which was
+	// acted on, whether or not it succeeded
+	Revert *VirtimagefileRevert `json:"revert,omitempty"`
+}
+
+type VirtimagefileSnapshotStatus struct {
+	// Name of the Virtimagesnapshot
+	Name         string                `json:"name"`
+	Type         VirtimagesnapshotType `json:"type"`
+	CreationTime v1.Time               `json:"creationTime"`
+}
+
+type VirtimagefileImportStatus struct {
+	// Bytes fetched from the source so far
+	Transferred uint64 `json:"transferred"`
+
+	// Bytes to fetch in total, or zero if the
+	// source did not say
+	Total uint64 `json:"total,omitempty"`
+}
+
+type VirtimagefilePhase string
+
+const (
+	// The image file does not yet exist
+	VirtimagefilePending VirtimagefilePhase = "Pending"
+	// The image file exists
+	VirtimagefileAvailable VirtimagefilePhase = "Available"
+	// The image file failed to create
+	VirtimagefileFailed VirtimagefilePhase = "Failed"
+)
+
+type VirtimagefileStreamAccessMode string
+
+const (
+	VirtimagefileStreamUpload   VirtimagefileStreamAccessMode = "Upload"
+	VirtimagefileStreamDownload VirtimagefileStreamAccessMode = "Download"
+	VirtimagefileStreamBoth     VirtimagefileStreamAccessMode = "Both"
+)
+
+// VirtimagefileSpec holds specification parameters of a Virtimagefile deployment.
+type VirtimagefileSpec struct {
+	// Name of Virtimagerepo resource that owns this
+	RepoName string `json:"repoName"`
+
+	// Name of Virtimagefile resource that backs this
+	BackingImageFile string `json:"backingImageFile,omitempty"`
+
+	AccessMode VirtimagefileAccessMode `json:"accessMode"`
+
+	// Logical size of disk payload
+	Capacity uint64 `json:"capacity"`
+
+	// Format of the image holding the file, 'raw' or
+	// 'qcow2'. Defaults to the format of the repo
+	Format string `json:"format,omitempty"`
+
+	Stream VirtimagefileStream `json:"stream"`
+
+	// Where to import the initial content from. If
+	// omitted the file starts out empty
+	Source *VirtimagefileSource `json:"source,omitempty"`
+
+	// Set to revert the content of the file to one of its
+	// snapshots, once no running machine uses the file
+	Revert *VirtimagefileRevert `json:"revert,omitempty"`
+}
+
+// VirtimagefileRevert asks for the file to be reverted to
+// a snapshot. The revert is done once, when the request
+// differs from the last one in the status, so reverting
+// to the same snapshot again needs a new ID
+type VirtimagefileRevert struct {
+	// Name of a Virtimagesnapshot of the file
+	Snapshot string `json:"snapshot"`
+
+	// Any value which tells requests apart, such
+	// as the time it was made
+	ID string `json:"id,omitempty"`
+}
+
+// VirtimagefileSource says where to import content from.
+// Exactly one source must be given
+type VirtimagefileSource struct {
+	HTTP      *VirtimagefileSourceHTTP      `json:"http,omitempty"`
+	Registry  *VirtimagefileSourceRegistry  `json:"registry,omitempty"`
+	ImageFile *VirtimagefileSourceImageFile `json:"imageFile,omitempty"`
+	Snapshot  *VirtimagefileSourceSnapshot  `json:"snapshot,omitempty"`
+}
+
+// VirtimagefileSourceHTTP imports a disk image from an
+// HTTP(S) URL. The image may be compressed with xz or gzip,
+// and is converted to the format of the repo
+type VirtimagefileSourceHTTP struct {
+	URL string `json:"url"`
+
+	// Name of a 'secret' object of type
+	// 'libvirt.org/kube/virtimagefile/source'. Its optional
+	// 'ca.crt' field holds PEM certificates to trust in
+	// place of the system ones, and its optional 'headers'
+	// field holds extra request headers, one 'Name: value'
+	// per line, such as 'Authorization'
+	Secret string `json:"secret,omitempty"`
+
+	// Expected hex encoded digest of the content as
+	// downloaded, before decompressing
+	SHA256 string `json:"sha256,omitempty"`
+	SHA512 string `json:"sha512,omitempty"`
+}
+
+// VirtimagefileSourceRegistry imports a disk image published
+// as an OCI or Docker container image. The disk image must be
+// the only file in the image's 'disk/' directory, as for
+// KubeVirt container disks, and may be in any format the
+// HTTP source accepts
+type VirtimagefileSourceRegistry struct {
+	// Reference to the image, such as
+	// 'registry.example.com/images/fedora:26'
+	Image string `json:"image"`
+
+	// Name of a 'secret' object of type
+	// 'kubernetes.io/dockerconfigjson' holding
+	// credentials for the registry
+	PullSecret string `json:"pullSecret,omitempty"`
+
+	// Talk to the registry over plain HTTP, as
+	// for the registry deployed in the cluster
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// VirtimagefileSourceImageFile copies the content of another
+// Virtimagefile, which may be in a different repo. The source
+// is kept from being deleted until the copy completes. A
+// source in another repo must permit downloads, since the
+// copy is streamed from its repo using its token secret
+type VirtimagefileSourceImageFile struct {
+	// Name of the Virtimagefile to copy
+	Name string `json:"name"`
+}
+
+// VirtimagefileSourceSnapshot copies the content of a
+// Virtimagefile as it was when a snapshot was taken. The
+// snapshot must be of a file in the same repo, and is kept
+// from being deleted until the copy completes
+type VirtimagefileSourceSnapshot struct {
+	// Name of the Virtimagesnapshot to copy
+	Name string `json:"name"`
+}
+
+type VirtimagefileStream struct {
+	// Name of a 'secret' object providing an access
+	// control token to grant permission for upload
+	// or download of the content
+	TokenSecret string `json:"tokenSecret"`
+
+	AccessMode VirtimagefileStreamAccessMode `json:"accessMode"`
+}
+
+type VirtimagefileAccessMode string
+
+const (
+	VirtimagefileReadWriteOnce VirtimagefileAccessMode = "ReadWriteOnce"
+	VirtimagefileReadOnlyMany  VirtimagefileAccessMode = "ReadOnlyMany"
+	VirtimagefileReadWriteMany VirtimagefileAccessMode = "ReadWriteMany"
+)
+
+// Required to satisfy Object interface
+func (ni *Virtimagefile) GetObjectKind() schema.ObjectKind {
+	return &ni.TypeMeta
+}
+
+// Required to satisfy ObjectMetaAccessor interface
+func (ni *Virtimagefile) GetObjectMeta() v1.Object {
+	return &ni.Metadata
+}
+
+// Required to satisfy Object interface
+func (ni *VirtimagefileList) GetObjectKind() schema.ObjectKind {
+	return &ni.TypeMeta
+}
+
+// Required to satisfy ListMetaAccessor interface
+func (ni *VirtimagefileList) GetListMeta() v1.ListInterface {
+	return &ni.Metadata
+}
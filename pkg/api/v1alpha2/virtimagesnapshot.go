@@ -0,0 +1,115 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package v1alpha2
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Virtimagesnapshot defines a point-in-time snapshot of the
+// content of a Virtimagefile, taken by the file's repo
+type Virtimagesnapshot struct {
+	v1.TypeMeta `json:",inline"`
+	Metadata    v1.ObjectMeta `json:"metadata"`
+
+	Spec   VirtimagesnapshotSpec   `json:"spec"`
+	Status VirtimagesnapshotStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// VirtimagesnapshotList is a list of Virtimagesnapshots.
+type VirtimagesnapshotList struct {
+	v1.TypeMeta `json:",inline"`
+	Metadata    v1.ListMeta `json:"metadata"`
+
+	Items []*Virtimagesnapshot `json:"items"`
+}
+
+type VirtimagesnapshotType string
+
+const (
+	// The snapshot is kept inside the file's qcow2 image
+	VirtimagesnapshotInternal VirtimagesnapshotType = "Internal"
+	// The file's content is frozen in a volume of its own,
+	// with the file becoming a qcow2 overlay on top of it
+	VirtimagesnapshotExternal VirtimagesnapshotType = "External"
+)
+
+// VirtimagesnapshotSpec holds specification parameters of a Virtimagesnapshot.
+// Snapshots can only be taken in repos using the qcow2 format,
+// and only while no running machine uses the file, since there
+// is no way to snapshot a disk through the VM shim
+type VirtimagesnapshotSpec struct {
+	// Name of the Virtimagefile to snapshot
+	FileName string `json:"fileName"`
+
+	Type VirtimagesnapshotType `json:"type"`
+}
+
+type VirtimagesnapshotStatus struct {
+	Phase      VirtimagesnapshotPhase `json:"phase"`
+	Conditions []Condition            `json:"conditions,omitempty"`
+
+	// When the snapshot was taken
+	CreationTime *v1.Time `json:"creationTime,omitempty"`
+
+	// Logical capacity of the file when the snapshot
+	// was taken
+	Capacity uint64 `json:"capacity"`
+
+	// The repo holding the content of the snapshot,
+	// which cleans it up when the snapshot is deleted
+	RepoName string `json:"repoName,omitempty"`
+}
+
+type VirtimagesnapshotPhase string
+
+const (
+	// The snapshot has not been taken yet
+	VirtimagesnapshotPending VirtimagesnapshotPhase = "Pending"
+	// The snapshot has been taken
+	VirtimagesnapshotReady VirtimagesnapshotPhase = "Ready"
+	// The snapshot could not be taken
+	VirtimagesnapshotFailed VirtimagesnapshotPhase = "Failed"
+)
+
+// Required to satisfy Object interface
+func (ni *Virtimagesnapshot) GetObjectKind() schema.ObjectKind {
+	return &ni.TypeMeta
+}
+
+// Required to satisfy ObjectMetaAccessor interface
+func (ni *Virtimagesnapshot) GetObjectMeta() v1.Object {
+	return &ni.Metadata
+}
+
+// Required to satisfy Object interface
+func (ni *VirtimagesnapshotList) GetObjectKind() schema.ObjectKind {
+	return &ni.TypeMeta
+}
+
+// Required to satisfy ListMetaAccessor interface
+func (ni *VirtimagesnapshotList) GetListMeta() v1.ListInterface {
+	return &ni.Metadata
+}
@@ -0,0 +1,338 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package v1alpha2
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Virtmachine defines a Virtmachine deployment.
+type Virtmachine struct {
+	v1.TypeMeta `json:",inline"`
+	Metadata    v1.ObjectMeta     `json:"metadata"`
+	Spec        VirtmachineSpec   `json:"spec"`
+	Status      VirtmachineStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// VirtmachineList is a list of Virtmachines.
+type VirtmachineList struct {
+	v1.TypeMeta `json:",inline"`
+	Metadata    v1.ListMeta `json:"metadata"`
+
+	Items []*Virtmachine `json:"items"`
+}
+
+// VirtmachineSpec holds specification parameters of a Virtmachine deployment.
+type VirtmachineSpec struct {
+	// Name of a Virtmachineclass providing any hardware
+	// fields left unset here
+	Class string `json:"class,omitempty"`
+
+	// The hardware desired to be applied the running instance
+	Hardware VirtmachineHardware `json:"hardware"`
+
+	// Domain XML fragments merged into the designed
+	// domain, for settings the hardware spec does not
+	// model. Only elements on the node's allowlist
+	// are permitted
+	Overrides []VirtmachineOverride `json:"overrides,omitempty"`
+}
+
+type VirtmachineStatus struct {
+	// The hardware currently applied to the running instance
+	Hardware VirtmachineHardware `json:"hardware"`
+
+	// The class, and its resource version, merged into
+	// the hardware of the running instance
+	Class         string `json:"class,omitempty"`
+	ClassRevision string `json:"classRevision,omitempty"`
+
+	// Names of the overrides applied to the running instance
+	Overrides []string `json:"overrides,omitempty"`
+
+	// The pod the running instance belongs to, and the
+	// UUID of its libvirt domain on the pod's node
+	Pod        string `json:"pod,omitempty"`
+	DomainUUID string `json:"domainUUID,omitempty"`
+
+	// Why the instance last stopped
+	StopReason VirtmachineStopReason `json:"stopReason,omitempty"`
+
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+type VirtmachineStopReason string
+
+const (
+	// The guest powered off, or rebooted with
+	// an 'onReboot' action of 'destroy'
+	VirtmachineStopShutdown VirtmachineStopReason = "shutdown"
+	// The guest crashed
+	VirtmachineStopCrashed VirtmachineStopReason = "crashed"
+	// The guest was killed, eg because its pod quit
+	VirtmachineStopDestroyed VirtmachineStopReason = "destroyed"
+	// The hypervisor failed
+	VirtmachineStopFailed VirtmachineStopReason = "failed"
+)
+
+type VirtmachineOverride struct {
+	Name string `json:"name"`
+	// A fragment rooted at <domain>. Elements and attributes
+	// replace those already set, while repeated elements,
+	// such as devices, are appended
+	XML string `json:"xml"`
+}
+
+type VirtmachineHardware struct {
+	// Hypervisor type (libvirt: /domain/@type)
+	Type    string            `json:"type"`
+	Arch    string            `json:"arch"`
+	Machine string            `json:"machine"`
+	Boot    VirtmachineBoot   `json:"boot"`
+	Memory  VirtmachineMemory `json:"memory"`
+
+	CPU VirtmachineCPU `json:"cpu"`
+
+	Topology VirtmachineTopology `json:"topology"`
+
+	Devices VirtmachineDeviceList `json:"devices"`
+
+	// osinfo-db short ID of the guest OS, eg 'fedora25' or
+	// 'win10', used to pick devices it has drivers for. Only
+	// the subset of osinfo-db built into libvirt-kube is known
+	OS string `json:"os,omitempty"`
+
+	// Set of defaults for features and clock suited
+	// to a class of guest OS - 'windows'
+	Preset string `json:"preset,omitempty"`
+
+	Features *VirtmachineFeatures `json:"features,omitempty"`
+
+	Clock *VirtmachineClock `json:"clock,omitempty"`
+
+	Lifecycle *VirtmachineLifecycle `json:"lifecycle,omitempty"`
+}
+
+// Actions taken when the guest powers off, reboots or
+// crashes. 'destroy' stops the machine, and with it the
+// pod, while 'restart' boots the guest again in place.
+// Crashes may also use 'coredump-destroy' and
+// 'coredump-restart' to save a core dump first
+type VirtmachineLifecycle struct {
+	OnPoweroff string `json:"onPoweroff,omitempty"`
+	OnReboot   string `json:"onReboot,omitempty"`
+	OnCrash    string `json:"onCrash,omitempty"`
+}
+
+// Unset features take the default for the architecture
+type VirtmachineFeatures struct {
+	ACPI *bool `json:"acpi,omitempty"`
+	APIC *bool `json:"apic,omitempty"`
+	// System management mode, required for secure boot
+	SMM *bool `json:"smm,omitempty"`
+
+	HyperV *VirtmachineHyperV `json:"hyperv,omitempty"`
+}
+
+// Hyper-V enlightenments to improve performance
+// of Windows guests
+type VirtmachineHyperV struct {
+	Relaxed bool `json:"relaxed,omitempty"`
+	VAPIC   bool `json:"vapic,omitempty"`
+	// Number of spinlock retries before notifying the
+	// hypervisor, at least 4095, or zero to disable
+	Spinlocks uint `json:"spinlocks,omitempty"`
+	// 'stimer' requires both 'synic' and a 'hypervclock' timer,
+	// while 'synic' requires 'vpindex'
+	Synic   bool `json:"synic,omitempty"`
+	STimer  bool `json:"stimer,omitempty"`
+	VPIndex bool `json:"vpindex,omitempty"`
+}
+
+type VirtmachineClock struct {
+	// 'utc', 'localtime' or 'timezone'
+	Offset string `json:"offset,omitempty"`
+	// Only if Offset == 'timezone', eg 'Europe/London'
+	Timezone string `json:"timezone,omitempty"`
+
+	Timers []VirtmachineTimer `json:"timers,omitempty"`
+}
+
+type VirtmachineTimer struct {
+	// 'rtc', 'pit', 'hpet', 'hypervclock'
+	Name    string `json:"name"`
+	Present *bool  `json:"present,omitempty"`
+	// 'delay', 'catchup', 'merge', 'discard'
+	TickPolicy string `json:"tickPolicy,omitempty"`
+}
+
+type VirtmachineStorage struct {
+	PersistentVolume *VirtmachineStoragePersistentVolume `json:"persistentVolume,omitempty"`
+	ImageFile        *VirtmachineStorageImageFile        `json:"imageFile,omitempty"`
+}
+
+// The guest will be directly connected to the raw persistent storage
+// volume listed, assuming QEMU has a network client for the storage
+// protocol refered to.
+type VirtmachineStoragePersistentVolume struct {
+	ClaimName string `json:"claimName"`
+}
+
+// The guest will use a local image file associated with resource
+// whose k8s name is 'FileName' - nb this is *not* file path on
+// disk - this is the custom resource name
+type VirtmachineStorageImageFile struct {
+	FileName string `json:"fileName"`
+}
+
+type VirtmachineBoot struct {
+	// 'direct' or 'firmware'
+	Type string `json:"type"`
+
+	// Only if Type == 'direct'
+	Kernel     *VirtmachineStorage `json:"kernel,omitempty"`
+	Ramdisk    *VirtmachineStorage `json:"ramdisk,omitempty"`
+	KernelArgs string              `json:"kernelArgs,omitempty"`
+
+	Firmware *VirtmachineFirmware `json:"firmware,omitempty"`
+}
+
+type VirtmachineFirmware struct {
+	// 'efi' or 'bios'
+	Type string `json:"type,omitempty"`
+}
+
+type VirtmachineCPUFeature struct {
+	Name string `json:"name"`
+	// 'force', 'require', 'optional', 'disable', 'forbid'
+	Policy string `json:"policy"`
+}
+
+type VirtmachineCPU struct {
+	Count int `json:"count"`
+	// 'host-passthrough', 'host-model' or 'custom'
+	Mode string `json:"mode,omitempty"`
+	// Only if Mode == 'custom'
+	Model    string                  `json:"model,omitempty"`
+	Features []VirtmachineCPUFeature `json:"features,omitempty"`
+}
+
+type VirtmachineMemory struct {
+	// Size of DIMMs currently plugged in MB
+	Initial int `json:"initial"`
+	// Maximum size to allow hotplug DIMMs in MB
+	Maximum int `json:"maximum"`
+
+	// Total number of DIMM slots - must be a
+	// divisor of both Initial and Maximum
+	Slots int `json:"slots"`
+}
+
+type VirtmachineTopology struct {
+	Nodes   int `json:"nodes,omitempty"`
+	Sockets int `json:"sockets,omitempty"`
+	Cores   int `json:"cores,omitempty"`
+	Threads int `json:"threads,omitempty"`
+}
+
+type VirtmachineDeviceList struct {
+	Disks      []*VirtmachineDisk      `json:"disks,omitempty"`
+	Interfaces []*VirtmachineInterface `json:"interfaces,omitempty"`
+	Consoles   []*VirtmachineConsole   `json:"consoles,omitempty"`
+	Videos     []*VirtmachineVideo     `json:"videos,omitempty"`
+}
+
+type VirtmachineDiskEncryptLUKS struct {
+	Passphrase string `json:"passphrase"`
+}
+
+type VirtmachineDiskEncrypt struct {
+	LUKS *VirtmachineDiskEncryptLUKS `json:"luks,omitempty"`
+}
+
+type VirtmachineDisk struct {
+	// 'disk', 'cdrom', etc
+	Device string `json:"device"`
+	// 'virtio', 'scsi', 'sata' or 'ide'. Defaults to the
+	// best bus the architecture and guest OS support
+	Bus       string                  `json:"bus,omitempty"`
+	Source    *VirtmachineStorage     `json:"source"`
+	BootIndex int                     `json:"bootIndex,omitempty"`
+	Encrypt   *VirtmachineDiskEncrypt `json:"encrypt,omitempty"`
+	// Writes go to a throwaway overlay which is
+	// discarded when the machine stops. Only image
+	// files can be transient: a disk whose source is a
+	// persistent volume is rejected, since the overlay
+	// can't refer to network storage
+	Transient bool `json:"transient,omitempty"`
+	// May be attached read-write to several machines at
+	// once. The source must be a raw ReadWriteMany image
+	// file or a ReadWriteMany persistent volume
+	Shareable bool `json:"shareable,omitempty"`
+	// Pass a shareable iSCSI volume through as a SCSI LUN
+	// so guests can use persistent reservations
+	Reservations bool `json:"reservations,omitempty"`
+}
+
+type VirtmachineConsole struct {
+	// 'serial', 'virtio'
+	Type string `json:"type"`
+}
+
+// VirtmachineInterface connects the guest to a libvirt
+// network on the node
+type VirtmachineInterface struct {
+	// Defaults to the 'default' network
+	Network string `json:"network,omitempty"`
+	// 'virtio', 'e1000', 'e1000e' or 'rtl8139'. Defaults to
+	// the best model the architecture and guest OS support
+	Model string `json:"model,omitempty"`
+}
+
+type VirtmachineVideo struct {
+	// 'vga', 'cirrus', 'qxl', 'virtio', 'vmvga'
+	Type string `json:"type"`
+	VRam int    `json:"vram,omitempty"`
+}
+
+// Required to satisfy Object interface
+func (ni *Virtmachine) GetObjectKind() schema.ObjectKind {
+	return &ni.TypeMeta
+}
+
+// Required to satisfy ObjectMetaAccessor interface
+func (ni *Virtmachine) GetObjectMeta() v1.Object {
+	return &ni.Metadata
+}
+
+// Required to satisfy Object interface
+func (ni *VirtmachineList) GetObjectKind() schema.ObjectKind {
+	return &ni.TypeMeta
+}
+
+// Required to satisfy ListMetaAccessor interface
+func (ni *VirtmachineList) GetListMeta() v1.ListInterface {
+	return &ni.Metadata
+}
@@ -0,0 +1,71 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package v1alpha2
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Virtmachineclass defines a reusable set of hardware which
+// Virtmachines can refer to by name. Classes are cluster
+// scoped, so machines in any namespace can share them
+type Virtmachineclass struct {
+	v1.TypeMeta `json:",inline"`
+	Metadata    v1.ObjectMeta        `json:"metadata"`
+	Spec        VirtmachineclassSpec `json:"spec"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// VirtmachineclassList is a list of Virtmachineclasses.
+type VirtmachineclassList struct {
+	v1.TypeMeta `json:",inline"`
+	Metadata    v1.ListMeta `json:"metadata"`
+
+	Items []*Virtmachineclass `json:"items"`
+}
+
+type VirtmachineclassSpec struct {
+	// Hardware used for any fields a machine leaves unset
+	Hardware VirtmachineHardware `json:"hardware"`
+}
+
+// Required to satisfy Object interface
+func (ni *Virtmachineclass) GetObjectKind() schema.ObjectKind {
+	return &ni.TypeMeta
+}
+
+// Required to satisfy ObjectMetaAccessor interface
+func (ni *Virtmachineclass) GetObjectMeta() v1.Object {
+	return &ni.Metadata
+}
+
+// Required to satisfy Object interface
+func (ni *VirtmachineclassList) GetObjectKind() schema.ObjectKind {
+	return &ni.TypeMeta
+}
+
+// Required to satisfy ListMetaAccessor interface
+func (ni *VirtmachineclassList) GetListMeta() v1.ListInterface {
+	return &ni.Metadata
+}
@@ -0,0 +1,1471 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+// Code generated by deepcopy-gen. DO NOT EDIT.
+
+package v1alpha2
+
+import (
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtimagefile) DeepCopyInto(out *Virtimagefile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtimagefile.
+func (in *Virtimagefile) DeepCopy() *Virtimagefile {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtimagefile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtimagefile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileImportStatus) DeepCopyInto(out *VirtimagefileImportStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileImportStatus.
+func (in *VirtimagefileImportStatus) DeepCopy() *VirtimagefileImportStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileImportStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileList) DeepCopyInto(out *VirtimagefileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtimagefile, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtimagefile)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileList.
+func (in *VirtimagefileList) DeepCopy() *VirtimagefileList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtimagefileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileRevert) DeepCopyInto(out *VirtimagefileRevert) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileRevert.
+func (in *VirtimagefileRevert) DeepCopy() *VirtimagefileRevert {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileRevert)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileSnapshotStatus) DeepCopyInto(out *VirtimagefileSnapshotStatus) {
+	*out = *in
+	in.CreationTime.DeepCopyInto(&out.CreationTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileSnapshotStatus.
+func (in *VirtimagefileSnapshotStatus) DeepCopy() *VirtimagefileSnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileSnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileSource) DeepCopyInto(out *VirtimagefileSource) {
+	*out = *in
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(VirtimagefileSourceHTTP)
+		**out = **in
+	}
+	if in.Registry != nil {
+		in, out := &in.Registry, &out.Registry
+		*out = new(VirtimagefileSourceRegistry)
+		**out = **in
+	}
+	if in.ImageFile != nil {
+		in, out := &in.ImageFile, &out.ImageFile
+		*out = new(VirtimagefileSourceImageFile)
+		**out = **in
+	}
+	if in.Snapshot != nil {
+		in, out := &in.Snapshot, &out.Snapshot
+		*out = new(VirtimagefileSourceSnapshot)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileSource.
+func (in *VirtimagefileSource) DeepCopy() *VirtimagefileSource {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileSourceHTTP) DeepCopyInto(out *VirtimagefileSourceHTTP) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileSourceHTTP.
+func (in *VirtimagefileSourceHTTP) DeepCopy() *VirtimagefileSourceHTTP {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileSourceHTTP)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileSourceImageFile) DeepCopyInto(out *VirtimagefileSourceImageFile) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileSourceImageFile.
+func (in *VirtimagefileSourceImageFile) DeepCopy() *VirtimagefileSourceImageFile {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileSourceImageFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileSourceRegistry) DeepCopyInto(out *VirtimagefileSourceRegistry) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileSourceRegistry.
+func (in *VirtimagefileSourceRegistry) DeepCopy() *VirtimagefileSourceRegistry {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileSourceRegistry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileSourceSnapshot) DeepCopyInto(out *VirtimagefileSourceSnapshot) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileSourceSnapshot.
+func (in *VirtimagefileSourceSnapshot) DeepCopy() *VirtimagefileSourceSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileSourceSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileSpec) DeepCopyInto(out *VirtimagefileSpec) {
+	*out = *in
+	out.Stream = in.Stream
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(VirtimagefileSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Revert != nil {
+		in, out := &in.Revert, &out.Revert
+		*out = new(VirtimagefileRevert)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileSpec.
+func (in *VirtimagefileSpec) DeepCopy() *VirtimagefileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileStatus) DeepCopyInto(out *VirtimagefileStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Import != nil {
+		in, out := &in.Import, &out.Import
+		*out = new(VirtimagefileImportStatus)
+		**out = **in
+	}
+	if in.Snapshots != nil {
+		in, out := &in.Snapshots, &out.Snapshots
+		*out = make([]VirtimagefileSnapshotStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Revert != nil {
+		in, out := &in.Revert, &out.Revert
+		*out = new(VirtimagefileRevert)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileStatus.
+func (in *VirtimagefileStatus) DeepCopy() *VirtimagefileStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagefileStream) DeepCopyInto(out *VirtimagefileStream) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagefileStream.
+func (in *VirtimagefileStream) DeepCopy() *VirtimagefileStream {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagefileStream)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtimagerepo) DeepCopyInto(out *Virtimagerepo) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtimagerepo.
+func (in *Virtimagerepo) DeepCopy() *Virtimagerepo {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtimagerepo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtimagerepo) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagerepoList) DeepCopyInto(out *VirtimagerepoList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtimagerepo, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtimagerepo)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagerepoList.
+func (in *VirtimagerepoList) DeepCopy() *VirtimagerepoList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagerepoList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtimagerepoList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagerepoSpec) DeepCopyInto(out *VirtimagerepoSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagerepoSpec.
+func (in *VirtimagerepoSpec) DeepCopy() *VirtimagerepoSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagerepoSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagerepoStatus) DeepCopyInto(out *VirtimagerepoStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagerepoStatus.
+func (in *VirtimagerepoStatus) DeepCopy() *VirtimagerepoStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagerepoStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtimagesnapshot) DeepCopyInto(out *Virtimagesnapshot) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtimagesnapshot.
+func (in *Virtimagesnapshot) DeepCopy() *Virtimagesnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtimagesnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtimagesnapshot) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagesnapshotList) DeepCopyInto(out *VirtimagesnapshotList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtimagesnapshot, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtimagesnapshot)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagesnapshotList.
+func (in *VirtimagesnapshotList) DeepCopy() *VirtimagesnapshotList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagesnapshotList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtimagesnapshotList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagesnapshotSpec) DeepCopyInto(out *VirtimagesnapshotSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagesnapshotSpec.
+func (in *VirtimagesnapshotSpec) DeepCopy() *VirtimagesnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagesnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtimagesnapshotStatus) DeepCopyInto(out *VirtimagesnapshotStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CreationTime != nil {
+		in, out := &in.CreationTime, &out.CreationTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtimagesnapshotStatus.
+func (in *VirtimagesnapshotStatus) DeepCopy() *VirtimagesnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtimagesnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtmachine) DeepCopyInto(out *Virtmachine) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtmachine.
+func (in *Virtmachine) DeepCopy() *Virtmachine {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtmachine)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtmachine) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineBoot) DeepCopyInto(out *VirtmachineBoot) {
+	*out = *in
+	if in.Kernel != nil {
+		in, out := &in.Kernel, &out.Kernel
+		*out = new(VirtmachineStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ramdisk != nil {
+		in, out := &in.Ramdisk, &out.Ramdisk
+		*out = new(VirtmachineStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Firmware != nil {
+		in, out := &in.Firmware, &out.Firmware
+		*out = new(VirtmachineFirmware)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineBoot.
+func (in *VirtmachineBoot) DeepCopy() *VirtmachineBoot {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineBoot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineCPU) DeepCopyInto(out *VirtmachineCPU) {
+	*out = *in
+	if in.Features != nil {
+		in, out := &in.Features, &out.Features
+		*out = make([]VirtmachineCPUFeature, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineCPU.
+func (in *VirtmachineCPU) DeepCopy() *VirtmachineCPU {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineCPU)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineCPUFeature) DeepCopyInto(out *VirtmachineCPUFeature) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineCPUFeature.
+func (in *VirtmachineCPUFeature) DeepCopy() *VirtmachineCPUFeature {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineCPUFeature)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineClock) DeepCopyInto(out *VirtmachineClock) {
+	*out = *in
+	if in.Timers != nil {
+		in, out := &in.Timers, &out.Timers
+		*out = make([]VirtmachineTimer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineClock.
+func (in *VirtmachineClock) DeepCopy() *VirtmachineClock {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineClock)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineConsole) DeepCopyInto(out *VirtmachineConsole) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineConsole.
+func (in *VirtmachineConsole) DeepCopy() *VirtmachineConsole {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineConsole)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineDeviceList) DeepCopyInto(out *VirtmachineDeviceList) {
+	*out = *in
+	if in.Disks != nil {
+		in, out := &in.Disks, &out.Disks
+		*out = make([]*VirtmachineDisk, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(VirtmachineDisk)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]*VirtmachineInterface, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(VirtmachineInterface)
+				**out = **in
+			}
+		}
+	}
+	if in.Consoles != nil {
+		in, out := &in.Consoles, &out.Consoles
+		*out = make([]*VirtmachineConsole, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(VirtmachineConsole)
+				**out = **in
+			}
+		}
+	}
+	if in.Videos != nil {
+		in, out := &in.Videos, &out.Videos
+		*out = make([]*VirtmachineVideo, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(VirtmachineVideo)
+				**out = **in
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineDeviceList.
+func (in *VirtmachineDeviceList) DeepCopy() *VirtmachineDeviceList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineDeviceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineDisk) DeepCopyInto(out *VirtmachineDisk) {
+	*out = *in
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(VirtmachineStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Encrypt != nil {
+		in, out := &in.Encrypt, &out.Encrypt
+		*out = new(VirtmachineDiskEncrypt)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineDisk.
+func (in *VirtmachineDisk) DeepCopy() *VirtmachineDisk {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineDisk)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineDiskEncrypt) DeepCopyInto(out *VirtmachineDiskEncrypt) {
+	*out = *in
+	if in.LUKS != nil {
+		in, out := &in.LUKS, &out.LUKS
+		*out = new(VirtmachineDiskEncryptLUKS)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineDiskEncrypt.
+func (in *VirtmachineDiskEncrypt) DeepCopy() *VirtmachineDiskEncrypt {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineDiskEncrypt)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineDiskEncryptLUKS) DeepCopyInto(out *VirtmachineDiskEncryptLUKS) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineDiskEncryptLUKS.
+func (in *VirtmachineDiskEncryptLUKS) DeepCopy() *VirtmachineDiskEncryptLUKS {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineDiskEncryptLUKS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineFeatures) DeepCopyInto(out *VirtmachineFeatures) {
+	*out = *in
+	if in.ACPI != nil {
+		in, out := &in.ACPI, &out.ACPI
+		*out = new(bool)
+		**out = **in
+	}
+	if in.APIC != nil {
+		in, out := &in.APIC, &out.APIC
+		*out = new(bool)
+		**out = **in
+	}
+	if in.SMM != nil {
+		in, out := &in.SMM, &out.SMM
+		*out = new(bool)
+		**out = **in
+	}
+	if in.HyperV != nil {
+		in, out := &in.HyperV, &out.HyperV
+		*out = new(VirtmachineHyperV)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineFeatures.
+func (in *VirtmachineFeatures) DeepCopy() *VirtmachineFeatures {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineFeatures)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineFirmware) DeepCopyInto(out *VirtmachineFirmware) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineFirmware.
+func (in *VirtmachineFirmware) DeepCopy() *VirtmachineFirmware {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineFirmware)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineHardware) DeepCopyInto(out *VirtmachineHardware) {
+	*out = *in
+	in.Boot.DeepCopyInto(&out.Boot)
+	out.Memory = in.Memory
+	in.CPU.DeepCopyInto(&out.CPU)
+	out.Topology = in.Topology
+	in.Devices.DeepCopyInto(&out.Devices)
+	if in.Features != nil {
+		in, out := &in.Features, &out.Features
+		*out = new(VirtmachineFeatures)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Clock != nil {
+		in, out := &in.Clock, &out.Clock
+		*out = new(VirtmachineClock)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Lifecycle != nil {
+		in, out := &in.Lifecycle, &out.Lifecycle
+		*out = new(VirtmachineLifecycle)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineHardware.
+func (in *VirtmachineHardware) DeepCopy() *VirtmachineHardware {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineHardware)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineHyperV) DeepCopyInto(out *VirtmachineHyperV) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineHyperV.
+func (in *VirtmachineHyperV) DeepCopy() *VirtmachineHyperV {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineHyperV)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineInterface) DeepCopyInto(out *VirtmachineInterface) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineInterface.
+func (in *VirtmachineInterface) DeepCopy() *VirtmachineInterface {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineInterface)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineLifecycle) DeepCopyInto(out *VirtmachineLifecycle) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineLifecycle.
+func (in *VirtmachineLifecycle) DeepCopy() *VirtmachineLifecycle {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineLifecycle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineList) DeepCopyInto(out *VirtmachineList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtmachine, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtmachine)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineList.
+func (in *VirtmachineList) DeepCopy() *VirtmachineList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtmachineList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineMemory) DeepCopyInto(out *VirtmachineMemory) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineMemory.
+func (in *VirtmachineMemory) DeepCopy() *VirtmachineMemory {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineMemory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineOverride) DeepCopyInto(out *VirtmachineOverride) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineOverride.
+func (in *VirtmachineOverride) DeepCopy() *VirtmachineOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineSpec) DeepCopyInto(out *VirtmachineSpec) {
+	*out = *in
+	in.Hardware.DeepCopyInto(&out.Hardware)
+	if in.Overrides != nil {
+		in, out := &in.Overrides, &out.Overrides
+		*out = make([]VirtmachineOverride, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineSpec.
+func (in *VirtmachineSpec) DeepCopy() *VirtmachineSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineStatus) DeepCopyInto(out *VirtmachineStatus) {
+	*out = *in
+	in.Hardware.DeepCopyInto(&out.Hardware)
+	if in.Overrides != nil {
+		in, out := &in.Overrides, &out.Overrides
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineStatus.
+func (in *VirtmachineStatus) DeepCopy() *VirtmachineStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineStorage) DeepCopyInto(out *VirtmachineStorage) {
+	*out = *in
+	if in.PersistentVolume != nil {
+		in, out := &in.PersistentVolume, &out.PersistentVolume
+		*out = new(VirtmachineStoragePersistentVolume)
+		**out = **in
+	}
+	if in.ImageFile != nil {
+		in, out := &in.ImageFile, &out.ImageFile
+		*out = new(VirtmachineStorageImageFile)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineStorage.
+func (in *VirtmachineStorage) DeepCopy() *VirtmachineStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineStorageImageFile) DeepCopyInto(out *VirtmachineStorageImageFile) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineStorageImageFile.
+func (in *VirtmachineStorageImageFile) DeepCopy() *VirtmachineStorageImageFile {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineStorageImageFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineStoragePersistentVolume) DeepCopyInto(out *VirtmachineStoragePersistentVolume) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineStoragePersistentVolume.
+func (in *VirtmachineStoragePersistentVolume) DeepCopy() *VirtmachineStoragePersistentVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineStoragePersistentVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineTimer) DeepCopyInto(out *VirtmachineTimer) {
+	*out = *in
+	if in.Present != nil {
+		in, out := &in.Present, &out.Present
+		*out = new(bool)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineTimer.
+func (in *VirtmachineTimer) DeepCopy() *VirtmachineTimer {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineTimer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineTopology) DeepCopyInto(out *VirtmachineTopology) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineTopology.
+func (in *VirtmachineTopology) DeepCopy() *VirtmachineTopology {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineTopology)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineVideo) DeepCopyInto(out *VirtmachineVideo) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineVideo.
+func (in *VirtmachineVideo) DeepCopy() *VirtmachineVideo {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineVideo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtmachineclass) DeepCopyInto(out *Virtmachineclass) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtmachineclass.
+func (in *Virtmachineclass) DeepCopy() *Virtmachineclass {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtmachineclass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtmachineclass) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineclassList) DeepCopyInto(out *VirtmachineclassList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtmachineclass, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtmachineclass)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineclassList.
+func (in *VirtmachineclassList) DeepCopy() *VirtmachineclassList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineclassList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtmachineclassList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtmachineclassSpec) DeepCopyInto(out *VirtmachineclassSpec) {
+	*out = *in
+	in.Hardware.DeepCopyInto(&out.Hardware)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtmachineclassSpec.
+func (in *VirtmachineclassSpec) DeepCopy() *VirtmachineclassSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtmachineclassSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Virtnode) DeepCopyInto(out *Virtnode) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	in.Status.DeepCopyInto(&out.Status)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Virtnode.
+func (in *Virtnode) DeepCopy() *Virtnode {
+	if in == nil {
+		return nil
+	}
+	out := new(Virtnode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Virtnode) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeCPU) DeepCopyInto(out *VirtnodeCPU) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeCPU.
+func (in *VirtnodeCPU) DeepCopy() *VirtnodeCPU {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeCPU)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeGuest) DeepCopyInto(out *VirtnodeGuest) {
+	*out = *in
+	if in.Machines != nil {
+		in, out := &in.Machines, &out.Machines
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeGuest.
+func (in *VirtnodeGuest) DeepCopy() *VirtnodeGuest {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeGuest)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeList) DeepCopyInto(out *VirtnodeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]*Virtnode, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Virtnode)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeList.
+func (in *VirtnodeList) DeepCopy() *VirtnodeList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtnodeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeMemory) DeepCopyInto(out *VirtnodeMemory) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeMemory.
+func (in *VirtnodeMemory) DeepCopy() *VirtnodeMemory {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeMemory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeNUMACell) DeepCopyInto(out *VirtnodeNUMACell) {
+	*out = *in
+	out.CPU = in.CPU
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		*out = make([]VirtnodeMemory, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeNUMACell.
+func (in *VirtnodeNUMACell) DeepCopy() *VirtnodeNUMACell {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeNUMACell)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeResources) DeepCopyInto(out *VirtnodeResources) {
+	*out = *in
+	if in.NUMACells != nil {
+		in, out := &in.NUMACells, &out.NUMACells
+		*out = make([]VirtnodeNUMACell, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeResources.
+func (in *VirtnodeResources) DeepCopy() *VirtnodeResources {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeSpec) DeepCopyInto(out *VirtnodeSpec) {
+	*out = *in
+	if in.Guests != nil {
+		in, out := &in.Guests, &out.Guests
+		*out = make([]VirtnodeGuest, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeSpec.
+func (in *VirtnodeSpec) DeepCopy() *VirtnodeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtnodeStatus) DeepCopyInto(out *VirtnodeStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtnodeStatus.
+func (in *VirtnodeStatus) DeepCopy() *VirtnodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtnodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -1,35 +1,54 @@
 package api
 
 import (
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
 )
 
 type VirtimagefileClient struct {
-	tpr TPRClient
+	client ResourceClient
 }
 
 func RegisterVirtimagefile(clientset *kubernetes.Clientset) error {
-	err := RegisterResourceExtension(clientset, "virtimagefile.libvirt.org", "libvirt.org", "virtimagefiles", "v1alpha1", "Virt image files")
+	err := RegisterResourceDefinition(clientset, &ResourceDefinition{
+		Group:  "libvirt.org",
+		Kind:   "Virtimagefile",
+		Plural: "virtimagefiles",
+		Object: apiv2.Virtimagefile{},
+		Legacy: apiv1.Virtimagefile{},
+		Columns: []apiextv1.CustomResourceColumnDefinition{
+			printerColumn("Repo", "string", ".spec.repoName"),
+			printerColumn("Phase", "string", ".status.phase"),
+			printerColumn("Ready", "string", `.status.conditions[?(@.type=="Ready")].status`),
+			printerColumn("Capacity", "integer", ".status.capacity"),
+			printerColumn("Usage", "integer", ".status.usage"),
+		},
+	})
 	if err != nil {
 		return err
 	}
 
 	RegisterResourceScheme("libvirt.org", "v1alpha1", &apiv1.Virtimagefile{}, &apiv1.VirtimagefileList{})
+	RegisterResourceScheme("libvirt.org", "v1alpha2", &apiv2.Virtimagefile{}, &apiv2.VirtimagefileList{})
 
 	return nil
 }
 
 func NewVirtimagefileClient(namespace string, kubeconfig *rest.Config) (*VirtimagefileClient, error) {
-	client, err := GetResourceClient(kubeconfig, "libvirt.org", "v1alpha1")
+	client, err := GetResourceClient(kubeconfig, "libvirt.org", apiv2.SchemeGroupVersion.Version)
 	if err != nil {
 		return nil, err
 	}
 	return &VirtimagefileClient{
-		tpr: TPRClient{
+		client: ResourceClient{
 			ResourceName: "virtimagefiles",
 			Namespace:    namespace,
 			Rest:         client,
@@ -37,42 +56,70 @@ func NewVirtimagefileClient(namespace string, kubeconfig *rest.Config) (*Virtima
 	}, nil
 }
 
-func (c *VirtimagefileClient) List() (*apiv1.VirtimagefileList, error) {
-	var obj apiv1.VirtimagefileList
-	if err := c.tpr.List(&obj); err != nil {
+func (c *VirtimagefileClient) List(opts v1.ListOptions) (*apiv2.VirtimagefileList, error) {
+	var obj apiv2.VirtimagefileList
+	items, err := c.client.List(opts, &obj.Metadata)
+	if err != nil {
 		return nil, err
 	}
+	for _, data := range items {
+		var item apiv2.Virtimagefile
+		if err := decodeObject(data, &item); err != nil {
+			return nil, err
+		}
+		obj.Items = append(obj.Items, &item)
+	}
 	return &obj, nil
 }
 
-func (c *VirtimagefileClient) Watch() (watch.Interface, error) {
-	return c.tpr.Watch()
+func (c *VirtimagefileClient) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.client.Watch(opts, func() runtime.Object {
+		return &apiv2.Virtimagefile{}
+	})
 }
 
-func (c *VirtimagefileClient) Get(name string) (*apiv1.Virtimagefile, error) {
-	var obj apiv1.Virtimagefile
-	if err := c.tpr.Get(name, &obj); err != nil {
+func (c *VirtimagefileClient) Get(name string) (*apiv2.Virtimagefile, error) {
+	var obj apiv2.Virtimagefile
+	if err := c.client.Get(name, &obj); err != nil {
 		return nil, err
 	}
 	return &obj, nil
 }
 
-func (c *VirtimagefileClient) Create(obj *apiv1.Virtimagefile) (*apiv1.Virtimagefile, error) {
-	var newobj apiv1.Virtimagefile = *obj
-	if err := c.tpr.Post(&newobj); err != nil {
+func (c *VirtimagefileClient) Create(obj *apiv2.Virtimagefile) (*apiv2.Virtimagefile, error) {
+	var newobj apiv2.Virtimagefile = *obj
+	if err := c.client.Post(&newobj); err != nil {
 		return nil, err
 	}
 	return &newobj, nil
 }
 
-func (c *VirtimagefileClient) Update(obj *apiv1.Virtimagefile) (*apiv1.Virtimagefile, error) {
-	var newobj apiv1.Virtimagefile = *obj
-	if err := c.tpr.Put(&newobj); err != nil {
+func (c *VirtimagefileClient) Update(obj *apiv2.Virtimagefile) (*apiv2.Virtimagefile, error) {
+	var newobj apiv2.Virtimagefile = *obj
+	if err := c.client.Put(&newobj); err != nil {
 		return nil, err
 	}
 	return &newobj, nil
 }
 
-func (c *VirtimagefileClient) Delete(obj *apiv1.Virtimagefile) error {
-	return c.tpr.Delete(obj.Metadata.Name)
+// PatchStatus writes the changes made to the status of obj
+// since orig was read, without risk of conflicts
+func (c *VirtimagefileClient) PatchStatus(orig, obj *apiv2.Virtimagefile) (*apiv2.Virtimagefile, error) {
+	var newobj apiv2.Virtimagefile = *obj
+	if err := c.client.PatchStatus(orig, &newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtimagefileClient) Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtimagefile, error) {
+	var obj apiv2.Virtimagefile
+	if err := c.client.Patch(name, pt, data, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtimagefileClient) Delete(name string, opts *v1.DeleteOptions) error {
+	return c.client.Delete(name, opts)
 }
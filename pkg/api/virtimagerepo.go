@@ -1,35 +1,52 @@
 package api
 
 import (
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
 )
 
 type VirtimagerepoClient struct {
-	tpr TPRClient
+	client ResourceClient
 }
 
 func RegisterVirtimagerepo(clientset *kubernetes.Clientset) error {
-	err := RegisterResourceExtension(clientset, "virtimagerepo.libvirt.org", "libvirt.org", "virtimagerepos", "v1alpha1", "Virt image repositories")
+	err := RegisterResourceDefinition(clientset, &ResourceDefinition{
+		Group:  "libvirt.org",
+		Kind:   "Virtimagerepo",
+		Plural: "virtimagerepos",
+		Object: apiv2.Virtimagerepo{},
+		Legacy: apiv1.Virtimagerepo{},
+		Columns: []apiextv1.CustomResourceColumnDefinition{
+			printerColumn("Phase", "string", ".status.phase"),
+			printerColumn("Ready", "string", `.status.conditions[?(@.type=="Ready")].status`),
+			printerColumn("Capacity", "integer", ".status.capacity"),
+		},
+	})
 	if err != nil {
 		return err
 	}
 
 	RegisterResourceScheme("libvirt.org", "v1alpha1", &apiv1.Virtimagerepo{}, &apiv1.VirtimagerepoList{})
+	RegisterResourceScheme("libvirt.org", "v1alpha2", &apiv2.Virtimagerepo{}, &apiv2.VirtimagerepoList{})
 
 	return nil
 }
 
 func NewVirtimagerepoClient(namespace string, kubeconfig *rest.Config) (*VirtimagerepoClient, error) {
-	client, err := GetResourceClient(kubeconfig, "libvirt.org", "v1alpha1")
+	client, err := GetResourceClient(kubeconfig, "libvirt.org", apiv2.SchemeGroupVersion.Version)
 	if err != nil {
 		return nil, err
 	}
 	return &VirtimagerepoClient{
-		tpr: TPRClient{
+		client: ResourceClient{
 			ResourceName: "virtimagerepos",
 			Namespace:    namespace,
 			Rest:         client,
@@ -37,42 +54,70 @@ func NewVirtimagerepoClient(namespace string, kubeconfig *rest.Config) (*Virtima
 	}, nil
 }
 
-func (c *VirtimagerepoClient) List() (*apiv1.VirtimagerepoList, error) {
-	var obj apiv1.VirtimagerepoList
-	if err := c.tpr.List(&obj); err != nil {
+func (c *VirtimagerepoClient) List(opts v1.ListOptions) (*apiv2.VirtimagerepoList, error) {
+	var obj apiv2.VirtimagerepoList
+	items, err := c.client.List(opts, &obj.Metadata)
+	if err != nil {
 		return nil, err
 	}
+	for _, data := range items {
+		var item apiv2.Virtimagerepo
+		if err := decodeObject(data, &item); err != nil {
+			return nil, err
+		}
+		obj.Items = append(obj.Items, &item)
+	}
 	return &obj, nil
 }
 
-func (c *VirtimagerepoClient) Watch() (watch.Interface, error) {
-	return c.tpr.Watch()
+func (c *VirtimagerepoClient) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.client.Watch(opts, func() runtime.Object {
+		return &apiv2.Virtimagerepo{}
+	})
 }
 
-func (c *VirtimagerepoClient) Get(name string) (*apiv1.Virtimagerepo, error) {
-	var obj apiv1.Virtimagerepo
-	if err := c.tpr.Get(name, &obj); err != nil {
+func (c *VirtimagerepoClient) Get(name string) (*apiv2.Virtimagerepo, error) {
+	var obj apiv2.Virtimagerepo
+	if err := c.client.Get(name, &obj); err != nil {
 		return nil, err
 	}
 	return &obj, nil
 }
 
-func (c *VirtimagerepoClient) Create(obj *apiv1.Virtimagerepo) (*apiv1.Virtimagerepo, error) {
-	var newobj apiv1.Virtimagerepo = *obj
-	if err := c.tpr.Post(&newobj); err != nil {
+func (c *VirtimagerepoClient) Create(obj *apiv2.Virtimagerepo) (*apiv2.Virtimagerepo, error) {
+	var newobj apiv2.Virtimagerepo = *obj
+	if err := c.client.Post(&newobj); err != nil {
 		return nil, err
 	}
 	return &newobj, nil
 }
 
-func (c *VirtimagerepoClient) Update(obj *apiv1.Virtimagerepo) (*apiv1.Virtimagerepo, error) {
-	var newobj apiv1.Virtimagerepo = *obj
-	if err := c.tpr.Put(&newobj); err != nil {
+func (c *VirtimagerepoClient) Update(obj *apiv2.Virtimagerepo) (*apiv2.Virtimagerepo, error) {
+	var newobj apiv2.Virtimagerepo = *obj
+	if err := c.client.Put(&newobj); err != nil {
 		return nil, err
 	}
 	return &newobj, nil
 }
 
-func (c *VirtimagerepoClient) Delete(obj *apiv1.Virtimagerepo) error {
-	return c.tpr.Delete(obj.Metadata.Name)
+// PatchStatus writes the changes made to the status of obj
+// since orig was read, without risk of conflicts
+func (c *VirtimagerepoClient) PatchStatus(orig, obj *apiv2.Virtimagerepo) (*apiv2.Virtimagerepo, error) {
+	var newobj apiv2.Virtimagerepo = *obj
+	if err := c.client.PatchStatus(orig, &newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtimagerepoClient) Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtimagerepo, error) {
+	var obj apiv2.Virtimagerepo
+	if err := c.client.Patch(name, pt, data, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtimagerepoClient) Delete(name string, opts *v1.DeleteOptions) error {
+	return c.client.Delete(name, opts)
 }
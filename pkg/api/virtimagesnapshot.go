@@ -0,0 +1,122 @@
+package api
+
+import (
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+type VirtimagesnapshotClient struct {
+	client ResourceClient
+}
+
+func RegisterVirtimagesnapshot(clientset *kubernetes.Clientset) error {
+	err := RegisterResourceDefinition(clientset, &ResourceDefinition{
+		Group:  "libvirt.org",
+		Kind:   "Virtimagesnapshot",
+		Plural: "virtimagesnapshots",
+		Object: apiv2.Virtimagesnapshot{},
+		Columns: []apiextv1.CustomResourceColumnDefinition{
+			printerColumn("File", "string", ".spec.fileName"),
+			printerColumn("Type", "string", ".spec.type"),
+			printerColumn("Phase", "string", ".status.phase"),
+			printerColumn("Ready", "string", `.status.conditions[?(@.type=="Ready")].status`),
+			printerColumn("Capacity", "integer", ".status.capacity"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	RegisterResourceScheme("libvirt.org", "v1alpha2", &apiv2.Virtimagesnapshot{}, &apiv2.VirtimagesnapshotList{})
+
+	return nil
+}
+
+func NewVirtimagesnapshotClient(namespace string, kubeconfig *rest.Config) (*VirtimagesnapshotClient, error) {
+	client, err := GetResourceClient(kubeconfig, "libvirt.org", apiv2.SchemeGroupVersion.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &VirtimagesnapshotClient{
+		client: ResourceClient{
+			ResourceName: "virtimagesnapshots",
+			Namespace:    namespace,
+			Rest:         client,
+		},
+	}, nil
+}
+
+func (c *VirtimagesnapshotClient) List(opts v1.ListOptions) (*apiv2.VirtimagesnapshotList, error) {
+	var obj apiv2.VirtimagesnapshotList
+	items, err := c.client.List(opts, &obj.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range items {
+		var item apiv2.Virtimagesnapshot
+		if err := decodeObject(data, &item); err != nil {
+			return nil, err
+		}
+		obj.Items = append(obj.Items, &item)
+	}
+	return &obj, nil
+}
+
+func (c *VirtimagesnapshotClient) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.client.Watch(opts, func() runtime.Object {
+		return &apiv2.Virtimagesnapshot{}
+	})
+}
+
+func (c *VirtimagesnapshotClient) Get(name string) (*apiv2.Virtimagesnapshot, error) {
+	var obj apiv2.Virtimagesnapshot
+	if err := c.client.Get(name, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtimagesnapshotClient) Create(obj *apiv2.Virtimagesnapshot) (*apiv2.Virtimagesnapshot, error) {
+	var newobj apiv2.Virtimagesnapshot = *obj
+	if err := c.client.Post(&newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtimagesnapshotClient) Update(obj *apiv2.Virtimagesnapshot) (*apiv2.Virtimagesnapshot, error) {
+	var newobj apiv2.Virtimagesnapshot = *obj
+	if err := c.client.Put(&newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+// PatchStatus writes the changes made to the status of obj
+// since orig was read, without risk of conflicts
+func (c *VirtimagesnapshotClient) PatchStatus(orig, obj *apiv2.Virtimagesnapshot) (*apiv2.Virtimagesnapshot, error) {
+	var newobj apiv2.Virtimagesnapshot = *obj
+	if err := c.client.PatchStatus(orig, &newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtimagesnapshotClient) Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtimagesnapshot, error) {
+	var obj apiv2.Virtimagesnapshot
+	if err := c.client.Patch(name, pt, data, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtimagesnapshotClient) Delete(name string, opts *v1.DeleteOptions) error {
+	return c.client.Delete(name, opts)
+}
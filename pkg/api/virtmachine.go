@@ -1,35 +1,52 @@
 package api
 
 import (
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
 )
 
 type VirtmachineClient struct {
-	tpr TPRClient
+	client ResourceClient
 }
 
 func RegisterVirtmachine(clientset *kubernetes.Clientset) error {
-	err := RegisterResourceExtension(clientset, "virtmachine.libvirt.org", "libvirt.org", "virtmachines", "v1alpha1", "Virt machines")
+	err := RegisterResourceDefinition(clientset, &ResourceDefinition{
+		Group:  "libvirt.org",
+		Kind:   "Virtmachine",
+		Plural: "virtmachines",
+		Object: apiv2.Virtmachine{},
+		Legacy: apiv1.Virtmachine{},
+		Columns: []apiextv1.CustomResourceColumnDefinition{
+			printerColumn("Class", "string", ".spec.class"),
+			printerColumn("Running", "string", `.status.conditions[?(@.type=="Running")].status`),
+			printerColumn("Stop Reason", "string", ".status.stopReason"),
+		},
+	})
 	if err != nil {
 		return err
 	}
 
 	RegisterResourceScheme("libvirt.org", "v1alpha1", &apiv1.Virtmachine{}, &apiv1.VirtmachineList{})
+	RegisterResourceScheme("libvirt.org", "v1alpha2", &apiv2.Virtmachine{}, &apiv2.VirtmachineList{})
 
 	return nil
 }
 
 func NewVirtmachineClient(namespace string, kubeconfig *rest.Config) (*VirtmachineClient, error) {
-	client, err := GetResourceClient(kubeconfig, "libvirt.org", "v1alpha1")
+	client, err := GetResourceClient(kubeconfig, "libvirt.org", apiv2.SchemeGroupVersion.Version)
 	if err != nil {
 		return nil, err
 	}
 	return &VirtmachineClient{
-		tpr: TPRClient{
+		client: ResourceClient{
 			ResourceName: "virtmachines",
 			Namespace:    namespace,
 			Rest:         client,
@@ -37,42 +54,70 @@ func NewVirtmachineClient(namespace string, kubeconfig *rest.Config) (*Virtmachi
 	}, nil
 }
 
-func (c *VirtmachineClient) List() (*apiv1.VirtmachineList, error) {
-	var obj apiv1.VirtmachineList
-	if err := c.tpr.List(&obj); err != nil {
+func (c *VirtmachineClient) List(opts v1.ListOptions) (*apiv2.VirtmachineList, error) {
+	var obj apiv2.VirtmachineList
+	items, err := c.client.List(opts, &obj.Metadata)
+	if err != nil {
 		return nil, err
 	}
+	for _, data := range items {
+		var item apiv2.Virtmachine
+		if err := decodeObject(data, &item); err != nil {
+			return nil, err
+		}
+		obj.Items = append(obj.Items, &item)
+	}
 	return &obj, nil
 }
 
-func (c *VirtmachineClient) Watch() (watch.Interface, error) {
-	return c.tpr.Watch()
+func (c *VirtmachineClient) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.client.Watch(opts, func() runtime.Object {
+		return &apiv2.Virtmachine{}
+	})
 }
 
-func (c *VirtmachineClient) Get(name string) (*apiv1.Virtmachine, error) {
-	var obj apiv1.Virtmachine
-	if err := c.tpr.Get(name, &obj); err != nil {
+func (c *VirtmachineClient) Get(name string) (*apiv2.Virtmachine, error) {
+	var obj apiv2.Virtmachine
+	if err := c.client.Get(name, &obj); err != nil {
 		return nil, err
 	}
 	return &obj, nil
 }
 
-func (c *VirtmachineClient) Create(obj *apiv1.Virtmachine) (*apiv1.Virtmachine, error) {
-	var newobj apiv1.Virtmachine = *obj
-	if err := c.tpr.Post(&newobj); err != nil {
+func (c *VirtmachineClient) Create(obj *apiv2.Virtmachine) (*apiv2.Virtmachine, error) {
+	var newobj apiv2.Virtmachine = *obj
+	if err := c.client.Post(&newobj); err != nil {
 		return nil, err
 	}
 	return &newobj, nil
 }
 
-func (c *VirtmachineClient) Update(obj *apiv1.Virtmachine) (*apiv1.Virtmachine, error) {
-	var newobj apiv1.Virtmachine = *obj
-	if err := c.tpr.Put(&newobj); err != nil {
+func (c *VirtmachineClient) Update(obj *apiv2.Virtmachine) (*apiv2.Virtmachine, error) {
+	var newobj apiv2.Virtmachine = *obj
+	if err := c.client.Put(&newobj); err != nil {
 		return nil, err
 	}
 	return &newobj, nil
 }
 
-func (c *VirtmachineClient) Delete(obj *apiv1.Virtmachine) error {
-	return c.tpr.Delete(obj.Metadata.Name)
+// PatchStatus writes the changes made to the status of obj
+// since orig was read, without risk of conflicts
+func (c *VirtmachineClient) PatchStatus(orig, obj *apiv2.Virtmachine) (*apiv2.Virtmachine, error) {
+	var newobj apiv2.Virtmachine = *obj
+	if err := c.client.PatchStatus(orig, &newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtmachineClient) Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtmachine, error) {
+	var obj apiv2.Virtmachine
+	if err := c.client.Patch(name, pt, data, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtmachineClient) Delete(name string, opts *v1.DeleteOptions) error {
+	return c.client.Delete(name, opts)
 }
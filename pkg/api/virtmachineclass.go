@@ -0,0 +1,111 @@
+package api
+
+import (
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+type VirtmachineclassClient struct {
+	client ResourceClient
+}
+
+func RegisterVirtmachineclass(clientset *kubernetes.Clientset) error {
+	err := RegisterResourceDefinition(clientset, &ResourceDefinition{
+		Group:  "libvirt.org",
+		Kind:   "Virtmachineclass",
+		Plural: "virtmachineclasses",
+		Object: apiv2.Virtmachineclass{},
+		// Classes are shared by machines in every namespace
+		Scope: apiextv1.ClusterScoped,
+		Columns: []apiextv1.CustomResourceColumnDefinition{
+			printerColumn("Arch", "string", ".spec.hardware.arch"),
+			printerColumn("CPUs", "integer", ".spec.hardware.cpu.count"),
+			printerColumn("Memory", "integer", ".spec.hardware.memory.initial"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	RegisterResourceScheme("libvirt.org", "v1alpha2", &apiv2.Virtmachineclass{}, &apiv2.VirtmachineclassList{})
+
+	return nil
+}
+
+func NewVirtmachineclassClient(kubeconfig *rest.Config) (*VirtmachineclassClient, error) {
+	client, err := GetResourceClient(kubeconfig, "libvirt.org", apiv2.SchemeGroupVersion.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &VirtmachineclassClient{
+		client: ResourceClient{
+			ResourceName: "virtmachineclasses",
+			Rest:         client,
+		},
+	}, nil
+}
+
+func (c *VirtmachineclassClient) List(opts v1.ListOptions) (*apiv2.VirtmachineclassList, error) {
+	var obj apiv2.VirtmachineclassList
+	items, err := c.client.List(opts, &obj.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range items {
+		var item apiv2.Virtmachineclass
+		if err := decodeObject(data, &item); err != nil {
+			return nil, err
+		}
+		obj.Items = append(obj.Items, &item)
+	}
+	return &obj, nil
+}
+
+func (c *VirtmachineclassClient) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.client.Watch(opts, func() runtime.Object {
+		return &apiv2.Virtmachineclass{}
+	})
+}
+
+func (c *VirtmachineclassClient) Get(name string) (*apiv2.Virtmachineclass, error) {
+	var obj apiv2.Virtmachineclass
+	if err := c.client.Get(name, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtmachineclassClient) Create(obj *apiv2.Virtmachineclass) (*apiv2.Virtmachineclass, error) {
+	var newobj apiv2.Virtmachineclass = *obj
+	if err := c.client.Post(&newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtmachineclassClient) Update(obj *apiv2.Virtmachineclass) (*apiv2.Virtmachineclass, error) {
+	var newobj apiv2.Virtmachineclass = *obj
+	if err := c.client.Put(&newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtmachineclassClient) Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtmachineclass, error) {
+	var obj apiv2.Virtmachineclass
+	if err := c.client.Patch(name, pt, data, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtmachineclassClient) Delete(name string, opts *v1.DeleteOptions) error {
+	return c.client.Delete(name, opts)
+}
@@ -1,35 +1,51 @@
 package api
 
 import (
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
 )
 
 type VirtnodeinfoClient struct {
-	tpr TPRClient
+	client ResourceClient
 }
 
 func RegisterVirtnodeinfo(clientset *kubernetes.Clientset) error {
-	err := RegisterResourceExtension(clientset, "virtnode.libvirt.org", "libvirt.org", "virtnodes", "v1alpha1", "Virt nodes")
+	err := RegisterResourceDefinition(clientset, &ResourceDefinition{
+		Group:  "libvirt.org",
+		Kind:   "Virtnode",
+		Plural: "virtnodes",
+		Object: apiv2.Virtnode{},
+		Legacy: apiv1.Virtnode{},
+		Columns: []apiextv1.CustomResourceColumnDefinition{
+			printerColumn("Phase", "string", ".status.phase"),
+			printerColumn("Ready", "string", `.status.conditions[?(@.type=="Ready")].status`),
+		},
+	})
 	if err != nil {
 		return err
 	}
 
 	RegisterResourceScheme("libvirt.org", "v1alpha1", &apiv1.Virtnode{}, &apiv1.VirtnodeList{})
+	RegisterResourceScheme("libvirt.org", "v1alpha2", &apiv2.Virtnode{}, &apiv2.VirtnodeList{})
 
 	return nil
 }
 
 func NewVirtnodeinfoClient(namespace string, kubeconfig *rest.Config) (*VirtnodeinfoClient, error) {
-	client, err := GetResourceClient(kubeconfig, "libvirt.org", "v1alpha1")
+	client, err := GetResourceClient(kubeconfig, "libvirt.org", apiv2.SchemeGroupVersion.Version)
 	if err != nil {
 		return nil, err
 	}
 	return &VirtnodeinfoClient{
-		tpr: TPRClient{
+		client: ResourceClient{
 			ResourceName: "virtnodes",
 			Namespace:    namespace,
 			Rest:         client,
@@ -37,42 +53,70 @@ func NewVirtnodeinfoClient(namespace string, kubeconfig *rest.Config) (*Virtnode
 	}, nil
 }
 
-func (c *VirtnodeinfoClient) List() (*apiv1.VirtnodeList, error) {
-	var obj apiv1.VirtnodeList
-	if err := c.tpr.List(&obj); err != nil {
+func (c *VirtnodeinfoClient) List(opts v1.ListOptions) (*apiv2.VirtnodeList, error) {
+	var obj apiv2.VirtnodeList
+	items, err := c.client.List(opts, &obj.Metadata)
+	if err != nil {
 		return nil, err
 	}
+	for _, data := range items {
+		var item apiv2.Virtnode
+		if err := decodeObject(data, &item); err != nil {
+			return nil, err
+		}
+		obj.Items = append(obj.Items, &item)
+	}
 	return &obj, nil
 }
 
-func (c *VirtnodeinfoClient) Watch() (watch.Interface, error) {
-	return c.tpr.Watch()
+func (c *VirtnodeinfoClient) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.client.Watch(opts, func() runtime.Object {
+		return &apiv2.Virtnode{}
+	})
 }
 
-func (c *VirtnodeinfoClient) Get(name string) (*apiv1.Virtnode, error) {
-	var obj apiv1.Virtnode
-	if err := c.tpr.Get(name, &obj); err != nil {
+func (c *VirtnodeinfoClient) Get(name string) (*apiv2.Virtnode, error) {
+	var obj apiv2.Virtnode
+	if err := c.client.Get(name, &obj); err != nil {
 		return nil, err
 	}
 	return &obj, nil
 }
 
-func (c *VirtnodeinfoClient) Create(obj *apiv1.Virtnode) (*apiv1.Virtnode, error) {
-	var newobj apiv1.Virtnode = *obj
-	if err := c.tpr.Post(&newobj); err != nil {
+func (c *VirtnodeinfoClient) Create(obj *apiv2.Virtnode) (*apiv2.Virtnode, error) {
+	var newobj apiv2.Virtnode = *obj
+	if err := c.client.Post(&newobj); err != nil {
 		return nil, err
 	}
 	return &newobj, nil
 }
 
-func (c *VirtnodeinfoClient) Update(obj *apiv1.Virtnode) (*apiv1.Virtnode, error) {
-	var newobj apiv1.Virtnode = *obj
-	if err := c.tpr.Put(&newobj); err != nil {
+func (c *VirtnodeinfoClient) Update(obj *apiv2.Virtnode) (*apiv2.Virtnode, error) {
+	var newobj apiv2.Virtnode = *obj
+	if err := c.client.Put(&newobj); err != nil {
 		return nil, err
 	}
 	return &newobj, nil
 }
 
-func (c *VirtnodeinfoClient) Delete(obj *apiv1.Virtnode) error {
-	return c.tpr.Delete(obj.Metadata.Name)
+// PatchStatus writes the changes made to the status of obj
+// since orig was read, without risk of conflicts
+func (c *VirtnodeinfoClient) PatchStatus(orig, obj *apiv2.Virtnode) (*apiv2.Virtnode, error) {
+	var newobj apiv2.Virtnode = *obj
+	if err := c.client.PatchStatus(orig, &newobj); err != nil {
+		return nil, err
+	}
+	return &newobj, nil
+}
+
+func (c *VirtnodeinfoClient) Patch(name string, pt types.PatchType, data []byte) (*apiv2.Virtnode, error) {
+	var obj apiv2.Virtnode
+	if err := c.client.Patch(name, pt, data, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *VirtnodeinfoClient) Delete(name string, opts *v1.DeleteOptions) error {
+	return c.client.Delete(name, opts)
 }
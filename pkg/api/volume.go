@@ -5,12 +5,23 @@ import (
 	"fmt"
 
 	"github.com/golang/glog"
+	kubeapiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	kubeapiv1 "k8s.io/client-go/pkg/api/v1"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
 )
 
-func getVolumeClaimVolumeName(clientset *kubernetes.Clientset, name, namespace string) (string, error) {
+// ImageFileFormat is the format of the image holding a file,
+// which is that of its repo unless the file picks its own
+func ImageFileFormat(file *apiv2.Virtimagefile, repo *apiv2.Virtimagerepo) string {
+	if file.Spec.Format != "" {
+		return file.Spec.Format
+	}
+	return repo.Spec.Format
+}
+
+func getVolumeClaimVolumeName(clientset kubernetes.Interface, name, namespace string) (string, error) {
 	options := metav1.GetOptions{}
 	glog.V(1).Infof("Querying PVC %s/%s", namespace, name)
 	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(name, options)
@@ -21,7 +32,7 @@ func getVolumeClaimVolumeName(clientset *kubernetes.Clientset, name, namespace s
 	return pvc.Spec.VolumeName, nil
 }
 
-func GetVolumeSpec(clientset *kubernetes.Clientset, name, namespace string) (string, *kubeapiv1.PersistentVolumeSpec, error) {
+func GetVolumeSpec(clientset kubernetes.Interface, name, namespace string) (string, *kubeapiv1.PersistentVolumeSpec, error) {
 	volname, err := getVolumeClaimVolumeName(clientset, name, namespace)
 	if err != nil {
 		return "", nil, err
@@ -37,8 +48,13 @@ func GetVolumeSpec(clientset *kubernetes.Clientset, name, namespace string) (str
 	return volname, &pv.Spec, nil
 }
 
-func GetVolumeRBDKey(clientset *kubernetes.Clientset, namespace string, src *kubeapiv1.RBDVolumeSource) ([]byte, error) {
+func GetVolumeRBDKey(clientset kubernetes.Interface, namespace string, src *kubeapiv1.RBDPersistentVolumeSource) ([]byte, error) {
 	if src.SecretRef != nil {
+		// Volumes aren't namespaced, so the secret may say
+		// where it lives
+		if src.SecretRef.Namespace != "" {
+			namespace = src.SecretRef.Namespace
+		}
 		key64, err := GetSecretValue(clientset, src.SecretRef.Name, namespace, "kubernetes.io/rbd", "key")
 		if err != nil {
 			return []byte{}, err
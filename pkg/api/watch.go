@@ -0,0 +1,135 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// resumableWatch restarts a watch whenever the apiserver closes
+// it, asking only for events after the last resource version
+// that was seen. The result channel is closed only when the
+// watch is stopped, or when the resource version has been
+// compacted away, in which case the caller must list again
+type resumableWatch struct {
+	start           func(resourceVersion string) (watch.Interface, error)
+	resourceVersion string
+	result          chan watch.Event
+	stop            chan struct{}
+	stopOnce        sync.Once
+}
+
+func newResumableWatch(resourceVersion string, start func(resourceVersion string) (watch.Interface, error)) (watch.Interface, error) {
+	w, err := start(resourceVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &resumableWatch{
+		start:           start,
+		resourceVersion: resourceVersion,
+		result:          make(chan watch.Event),
+		stop:            make(chan struct{}),
+	}
+	go rw.run(w)
+
+	return rw, nil
+}
+
+func (rw *resumableWatch) Stop() {
+	rw.stopOnce.Do(func() {
+		close(rw.stop)
+	})
+}
+
+func (rw *resumableWatch) ResultChan() <-chan watch.Event {
+	return rw.result
+}
+
+func isWatchExpired(ev watch.Event) bool {
+	if ev.Type != watch.Error {
+		return false
+	}
+	status, ok := ev.Object.(*v1.Status)
+	return ok && status.Code == http.StatusGone
+}
+
+// Pass on events from w until it closes, returning false
+// if the caller should give up rather than restart
+func (rw *resumableWatch) forward(w watch.Interface) bool {
+	defer w.Stop()
+
+	for {
+		select {
+		case <-rw.stop:
+			return false
+		case ev, more := <-w.ResultChan():
+			if !more {
+				return true
+			}
+
+			if meta, ok := ev.Object.(v1.ObjectMetaAccessor); ok && ev.Type != watch.Error {
+				rw.resourceVersion = meta.GetObjectMeta().GetResourceVersion()
+			}
+
+			select {
+			case <-rw.stop:
+				return false
+			case rw.result <- ev:
+			}
+
+			if isWatchExpired(ev) {
+				return false
+			}
+		}
+	}
+}
+
+func (rw *resumableWatch) run(w watch.Interface) {
+	defer close(rw.result)
+
+	for {
+		if !rw.forward(w) {
+			return
+		}
+
+		for {
+			glog.V(1).Infof("Restarting watch from resource version '%s'", rw.resourceVersion)
+			var err error
+			w, err = rw.start(rw.resourceVersion)
+			if err == nil {
+				break
+			}
+			glog.Errorf("Unable to restart watch: %s", err)
+
+			select {
+			case <-rw.stop:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
@@ -26,12 +26,19 @@ import (
 	"os"
 	"syscall"
 
+	"github.com/golang/glog"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	kubeapiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 
 	"k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 
 	"github.com/libvirt/libvirt-go"
+
+	"libvirt.org/libvirt-kube/pkg/api"
 )
 
 const (
@@ -47,9 +54,28 @@ type LibvirtKubeletService struct {
 	kubeletAddr       string
 	hypervisor        *libvirt.Connect
 	hypervisorVersion uint32
+	recorder          *api.EventRecorder
 }
 
-func NewService(kubeletAddr string, libvirtURI string) (*LibvirtKubeletService, error) {
+// NewService creates the runtime service. Events about pods are
+// only posted if a kube config is given, since the kubelet's
+// runtime isn't usually run inside the cluster
+func NewService(kubeletAddr string, libvirtURI string, kubeconfigfile string) (*LibvirtKubeletService, error) {
+
+	var recorder *api.EventRecorder
+	if kubeconfigfile != "" {
+		kubeconfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigfile)
+		if err != nil {
+			return nil, err
+		}
+
+		clientset, err := kubernetes.NewForConfig(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+
+		recorder = api.NewEventRecorder(clientset, "virtkubecri")
+	}
 
 	hypervisor, err := libvirt.NewConnect(libvirtURI)
 	if err != nil {
@@ -67,6 +93,7 @@ func NewService(kubeletAddr string, libvirtURI string) (*LibvirtKubeletService,
 		kubeletAddr:       kubeletAddr,
 		hypervisor:        hypervisor,
 		hypervisorVersion: ver,
+		recorder:          recorder,
 	}
 
 	runtime.RegisterRuntimeServiceServer(svc.server, svc)
@@ -92,6 +119,23 @@ func (s *LibvirtKubeletService) Run() error {
 	return s.server.Serve(sock)
 }
 
+// Report a problem with the pod a sandbox belongs to
+func (s *LibvirtKubeletService) podWarning(config *runtime.PodSandboxConfig, reason string, err error) {
+	meta := config.GetMetadata()
+	glog.Errorf("Pod %s/%s %s: %s", meta.GetNamespace(), meta.GetName(), reason, err)
+	if s.recorder == nil || meta == nil {
+		return
+	}
+
+	ref := &kubeapiv1.ObjectReference{
+		Kind:      "Pod",
+		Namespace: meta.GetNamespace(),
+		Name:      meta.GetName(),
+		UID:       types.UID(meta.GetUid()),
+	}
+	s.recorder.EventRef(ref, api.EventWarning, reason, err.Error())
+}
+
 // Version returns the runtime name, runtime version, and runtime API version.
 func (s *LibvirtKubeletService) Version(ctx context.Context, req *runtime.VersionRequest) (*runtime.VersionResponse, error) {
 	apiVersion := fmt.Sprintf("%d.%d.%d",
@@ -113,7 +157,9 @@ func (s *LibvirtKubeletService) Version(ctx context.Context, req *runtime.Versio
 // RunPodSandbox creates and starts a pod-level sandbox. Runtimes must ensure
 // the sandbox is in the ready state on success.
 func (s *LibvirtKubeletService) RunPodSandbox(ctx context.Context, req *runtime.RunPodSandboxRequest) (*runtime.RunPodSandboxResponse, error) {
-	return nil, errors.New("not implemented")
+	err := errors.New("not implemented")
+	s.podWarning(req.GetConfig(), "SandboxFailed", err)
+	return nil, err
 }
 
 // StopPodSandbox stops any running process that is part of the sandbox and
@@ -150,7 +196,9 @@ func (s *LibvirtKubeletService) ListPodSandbox(ctx context.Context, req *runtime
 
 // CreateContainer creates a new container in specified PodSandbox
 func (s *LibvirtKubeletService) CreateContainer(ctx context.Context, req *runtime.CreateContainerRequest) (*runtime.CreateContainerResponse, error) {
-	return nil, errors.New("not implemented")
+	err := errors.New("not implemented")
+	s.podWarning(req.GetSandboxConfig(), "CreateFailed", err)
+	return nil, err
 }
 
 // StartContainer starts the container.
@@ -0,0 +1,170 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package designer
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// ArchDefaults describes the settings applied to a guest
+// of a given architecture when the Virtmachine leaves
+// them unset
+type ArchDefaults struct {
+	Name    string
+	OSType  string
+	Machine string
+	// The machine types a Virtmachine may choose, each
+	// also matching its versioned variants
+	Machines []string
+
+	// 'bios' or 'efi', or empty if the firmware
+	// is not selectable
+	Firmware string
+	// Whether the firmware types are permitted
+	BIOS bool
+	EFI  bool
+	// Path to the UEFI firmware code
+	EFILoader string
+
+	// Only for ARM, 'host' to match the host GIC
+	GICVersion string
+
+	// Target type for consoles of type 'serial'
+	SerialConsole string
+	// Empty if the architecture has no video devices
+	Video string
+
+	DiskBus string
+	// Address type for virtio devices, 'pci' or 'ccw'
+	Address string
+
+	// Whether ACPI, APIC, SMM & Hyper-V features are usable
+	X86 bool
+	// Whether the ACPI feature is usable
+	ACPI bool
+}
+
+var archDefaults = map[string]*ArchDefaults{
+	"x86_64": {
+		Name:          "x86_64",
+		OSType:        "hvm",
+		Machine:       "pc",
+		Machines:      []string{"pc", "q35"},
+		Firmware:      "bios",
+		BIOS:          true,
+		EFI:           true,
+		EFILoader:     "/usr/share/OVMF/OVMF_CODE.fd",
+		SerialConsole: "serial",
+		Video:         "vga",
+		DiskBus:       "virtio",
+		Address:       "pci",
+		X86:           true,
+		ACPI:          true,
+	},
+	"i686": {
+		Name:          "i686",
+		OSType:        "hvm",
+		Machine:       "pc",
+		Machines:      []string{"pc", "q35"},
+		Firmware:      "bios",
+		BIOS:          true,
+		SerialConsole: "serial",
+		Video:         "vga",
+		DiskBus:       "virtio",
+		Address:       "pci",
+		X86:           true,
+		ACPI:          true,
+	},
+	"aarch64": {
+		Name:     "aarch64",
+		OSType:   "hvm",
+		Machine:  "virt",
+		Machines: []string{"virt"},
+		// There is no BIOS on ARM, so UEFI is mandatory
+		Firmware:      "efi",
+		EFI:           true,
+		EFILoader:     "/usr/share/AAVMF/AAVMF_CODE.fd",
+		GICVersion:    "host",
+		SerialConsole: "serial",
+		Video:         "virtio",
+		DiskBus:       "virtio",
+		Address:       "pci",
+		ACPI:          true,
+	},
+	"ppc64le": {
+		Name:     "ppc64le",
+		OSType:   "hvm",
+		Machine:  "pseries",
+		Machines: []string{"pseries"},
+		// SLOF is the only firmware, so can't be chosen
+		SerialConsole: "serial",
+		Video:         "vga",
+		DiskBus:       "virtio",
+		Address:       "pci",
+	},
+	"s390x": {
+		Name:          "s390x",
+		OSType:        "hvm",
+		Machine:       "s390-ccw-virtio",
+		Machines:      []string{"s390-ccw-virtio"},
+		SerialConsole: "sclp",
+		DiskBus:       "virtio",
+		Address:       "ccw",
+	},
+}
+
+// Whether the machine type is one the architecture offers,
+// or a versioned variant of one such as 'pc-i440fx-2.9'
+func (a *ArchDefaults) supportsMachine(machine string) bool {
+	for _, name := range a.Machines {
+		if machine == name || strings.HasPrefix(machine, name+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+var goArchNames = map[string]string{
+	"amd64":   "x86_64",
+	"386":     "i686",
+	"arm64":   "aarch64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+// GetArchDefaults returns the defaults for the named architecture,
+// or for the architecture of the host if the name is empty
+func GetArchDefaults(arch string) (*ArchDefaults, error) {
+	if arch == "" {
+		name, ok := goArchNames[runtime.GOARCH]
+		if !ok {
+			return nil, fmt.Errorf("Host architecture '%s' is not supported", runtime.GOARCH)
+		}
+		arch = name
+	}
+
+	defaults, ok := archDefaults[arch]
+	if !ok {
+		return nil, fmt.Errorf("Architecture '%s' is not supported", arch)
+	}
+	return defaults, nil
+}
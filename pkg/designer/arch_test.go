@@ -0,0 +1,319 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package designer
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/libvirt/libvirt-go-xml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden domain XML files")
+
+func newIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// A designer whose listers hold a raw image file 'disk' in
+// the repo 'images', along with any image files given, as
+// though the informers had seen them. Other objects, such
+// as volumes, are served by a fake clientset
+func newTestDesigner(t *testing.T, objects ...interface{}) *DomainDesigner {
+	repo := &apiv2.Virtimagerepo{
+		Metadata: v1.ObjectMeta{
+			Name:      "images",
+			Namespace: v1.NamespaceDefault,
+		},
+		Spec: apiv2.VirtimagerepoSpec{
+			ClaimName: "images",
+			Format:    "raw",
+		},
+	}
+	objects = append([]interface{}{repo, testImageFile("disk", "", apiv2.VirtimagefileReadWriteOnce)}, objects...)
+
+	repos, files := newIndexer(), newIndexer()
+	var kubeobjs []runtime.Object
+	for _, obj := range objects {
+		var err error
+		switch obj := obj.(type) {
+		case *apiv2.Virtimagerepo:
+			err = repos.Add(obj)
+		case *apiv2.Virtimagefile:
+			err = files.Add(obj)
+		case runtime.Object:
+			kubeobjs = append(kubeobjs, obj)
+		default:
+			t.Fatalf("No lister or clientset for %T", obj)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewDomainDesigner(kubefake.NewSimpleClientset(kubeobjs...), "/srv/images",
+		api.NewVirtimagerepoLister(repos), api.NewVirtimagefileLister(files))
+}
+
+// An image file in the repo 'images', in the repo's
+// format unless one is given
+func testImageFile(name, format string, mode apiv2.VirtimagefileAccessMode) *apiv2.Virtimagefile {
+	return &apiv2.Virtimagefile{
+		Metadata: v1.ObjectMeta{
+			Name:      name,
+			Namespace: v1.NamespaceDefault,
+		},
+		Spec: apiv2.VirtimagefileSpec{
+			RepoName:   "images",
+			AccessMode: mode,
+			Capacity:   1024 * 1024 * 1024,
+			Format:     format,
+		},
+	}
+}
+
+// A machine with one of each device the architecture can have
+func archHardware(arch string, video bool) *apiv2.VirtmachineHardware {
+	hw := &apiv2.VirtmachineHardware{
+		Arch: arch,
+		Memory: apiv2.VirtmachineMemory{
+			Initial: 1024,
+		},
+		Devices: apiv2.VirtmachineDeviceList{
+			Disks: []*apiv2.VirtmachineDisk{
+				{
+					Source: &apiv2.VirtmachineStorage{
+						ImageFile: &apiv2.VirtmachineStorageImageFile{
+							FileName: "disk",
+						},
+					},
+				},
+			},
+			Interfaces: []*apiv2.VirtmachineInterface{
+				{},
+			},
+			Consoles: []*apiv2.VirtmachineConsole{
+				{Type: "serial"},
+			},
+		},
+	}
+	if video {
+		hw.Devices.Videos = []*apiv2.VirtmachineVideo{
+			{},
+		}
+	}
+	apiv2.SetDefaults_VirtmachineHardware(hw)
+	return hw
+}
+
+// Round trip through the XML, so that the comparison doesn't
+// depend on how the designer left unset fields
+func parseDomain(t *testing.T, data string) *libvirtxml.Domain {
+	dom := &libvirtxml.Domain{}
+	if err := dom.Unmarshal(data); err != nil {
+		t.Fatalf("Unable to parse domain XML: %s", err)
+	}
+	return dom
+}
+
+func TestArchGolden(t *testing.T) {
+	tests := []struct {
+		arch  string
+		video bool
+	}{
+		{"x86_64", true},
+		{"aarch64", true},
+		{"ppc64le", true},
+		{"s390x", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.arch, func(t *testing.T) {
+			d := newTestDesigner(t)
+			d.Domain.UUID = "7c2b6a30-33b6-4f2a-9d2f-1f3d1d5fb2a4"
+			d.Domain.Name = "kube-" + test.arch
+			if err := d.ApplyVirtMachine(archHardware(test.arch, test.video)); err != nil {
+				t.Fatalf("Unable to design domain: %s", err)
+			}
+
+			got, err := d.Domain.Marshal()
+			if err != nil {
+				t.Fatalf("Unable to format domain XML: %s", err)
+			}
+
+			golden := filepath.Join("testdata", "arch-"+test.arch+".xml")
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(parseDomain(t, got), parseDomain(t, string(want))) {
+				t.Errorf("Domain differs from %s, got:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestArchRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		arch   string
+		modify func(hw *apiv2.VirtmachineHardware)
+		err    string
+	}{
+		{
+			name: "aarch64 bios",
+			arch: "aarch64",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Boot.Firmware = &apiv2.VirtmachineFirmware{Type: "bios"}
+			},
+			err: "does not support 'bios' firmware",
+		},
+		{
+			name: "ppc64le efi",
+			arch: "ppc64le",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Boot.Firmware = &apiv2.VirtmachineFirmware{Type: "efi"}
+			},
+			err: "does not support 'efi' firmware",
+		},
+		{
+			name: "s390x video",
+			arch: "s390x",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Devices.Videos = []*apiv2.VirtmachineVideo{{}}
+			},
+			err: "does not support video devices",
+		},
+		{
+			name: "aarch64 apic",
+			arch: "aarch64",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				apic := true
+				hw.Features = &apiv2.VirtmachineFeatures{APIC: &apic}
+			},
+			err: "does not support 'apic'",
+		},
+		{
+			name: "s390x e1000",
+			arch: "s390x",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Devices.Interfaces[0].Model = "e1000"
+			},
+			err: "does not support 'e1000' NICs",
+		},
+		{
+			name: "aarch64 sata",
+			arch: "aarch64",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Devices.Disks[0].Bus = "sata"
+			},
+			err: "does not support 'sata' disk bus",
+		},
+		{
+			name: "s390x q35",
+			arch: "s390x",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Machine = "q35"
+			},
+			err: "does not support machine type 'q35'",
+		},
+		{
+			name: "x86_64 versioned virt",
+			arch: "x86_64",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Machine = "virt-2.9"
+			},
+			err: "does not support machine type 'virt-2.9'",
+		},
+		{
+			name: "ppc64le prefixed pseries",
+			arch: "ppc64le",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Machine = "pseriesx"
+			},
+			err: "does not support machine type 'pseriesx'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hw := archHardware(test.arch, false)
+			test.modify(hw)
+
+			d := newTestDesigner(t)
+			err := d.ApplyVirtMachine(hw)
+			if err == nil {
+				t.Fatalf("Expected error containing '%s'", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error containing '%s', got '%s'", test.err, err)
+			}
+		})
+	}
+}
+
+func TestArchMachines(t *testing.T) {
+	tests := []struct {
+		arch    string
+		machine string
+	}{
+		{"x86_64", "pc"},
+		{"x86_64", "pc-i440fx-2.9"},
+		{"x86_64", "pc-q35-2.9"},
+		{"x86_64", "q35"},
+		{"i686", "pc"},
+		{"aarch64", "virt-2.9"},
+		{"ppc64le", "pseries-2.9"},
+		{"s390x", "s390-ccw-virtio-2.9"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.arch+" "+test.machine, func(t *testing.T) {
+			hw := archHardware(test.arch, false)
+			hw.Machine = test.machine
+
+			d := newTestDesigner(t)
+			if err := d.ApplyVirtMachine(hw); err != nil {
+				t.Fatalf("Unable to design domain: %s", err)
+			}
+			if d.Domain.OS.Type.Machine != test.machine {
+				t.Errorf("Expected machine type '%s', got '%s'", test.machine, d.Domain.OS.Type.Machine)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package designer
+
+import (
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+func mergeString(class, machine string) string {
+	if machine != "" {
+		return machine
+	}
+	return class
+}
+
+func mergeInt(class, machine int) int {
+	if machine != 0 {
+		return machine
+	}
+	return class
+}
+
+// MergeHardware returns the hardware of a machine, with any
+// fields it leaves unset taken from its class. Lists, such
+// as devices, are taken whole from the class only if the
+// machine has none of its own
+func MergeHardware(class, machine *apiv2.VirtmachineHardware) apiv2.VirtmachineHardware {
+	hw := apiv2.VirtmachineHardware{
+		Type:    mergeString(class.Type, machine.Type),
+		Arch:    mergeString(class.Arch, machine.Arch),
+		Machine: mergeString(class.Machine, machine.Machine),
+		Preset:  mergeString(class.Preset, machine.Preset),
+		OS:      mergeString(class.OS, machine.OS),
+
+		Boot: apiv2.VirtmachineBoot{
+			Type:       mergeString(class.Boot.Type, machine.Boot.Type),
+			Kernel:     machine.Boot.Kernel,
+			Ramdisk:    machine.Boot.Ramdisk,
+			KernelArgs: mergeString(class.Boot.KernelArgs, machine.Boot.KernelArgs),
+			Firmware:   machine.Boot.Firmware,
+		},
+
+		Memory: apiv2.VirtmachineMemory{
+			Initial: mergeInt(class.Memory.Initial, machine.Memory.Initial),
+			Maximum: mergeInt(class.Memory.Maximum, machine.Memory.Maximum),
+			Slots:   mergeInt(class.Memory.Slots, machine.Memory.Slots),
+		},
+
+		CPU: apiv2.VirtmachineCPU{
+			Count:    mergeInt(class.CPU.Count, machine.CPU.Count),
+			Mode:     mergeString(class.CPU.Mode, machine.CPU.Mode),
+			Model:    mergeString(class.CPU.Model, machine.CPU.Model),
+			Features: machine.CPU.Features,
+		},
+
+		Topology: apiv2.VirtmachineTopology{
+			Nodes:   mergeInt(class.Topology.Nodes, machine.Topology.Nodes),
+			Sockets: mergeInt(class.Topology.Sockets, machine.Topology.Sockets),
+			Cores:   mergeInt(class.Topology.Cores, machine.Topology.Cores),
+			Threads: mergeInt(class.Topology.Threads, machine.Topology.Threads),
+		},
+
+		Devices:  machine.Devices,
+		Features: machine.Features,
+		Clock:    machine.Clock,
+
+		Lifecycle: machine.Lifecycle,
+	}
+
+	if hw.Boot.Kernel == nil {
+		hw.Boot.Kernel = class.Boot.Kernel
+	}
+	if hw.Boot.Ramdisk == nil {
+		hw.Boot.Ramdisk = class.Boot.Ramdisk
+	}
+	if hw.Boot.Firmware == nil {
+		hw.Boot.Firmware = class.Boot.Firmware
+	}
+	if len(hw.CPU.Features) == 0 {
+		hw.CPU.Features = class.CPU.Features
+	}
+	if len(hw.Devices.Disks) == 0 {
+		hw.Devices.Disks = class.Devices.Disks
+	}
+	if len(hw.Devices.Interfaces) == 0 {
+		hw.Devices.Interfaces = class.Devices.Interfaces
+	}
+	if len(hw.Devices.Consoles) == 0 {
+		hw.Devices.Consoles = class.Devices.Consoles
+	}
+	if len(hw.Devices.Videos) == 0 {
+		hw.Devices.Videos = class.Devices.Videos
+	}
+	if hw.Features == nil {
+		hw.Features = class.Features
+	}
+	if hw.Clock == nil {
+		hw.Clock = class.Clock
+	}
+	if hw.Lifecycle == nil {
+		hw.Lifecycle = class.Lifecycle
+	}
+
+	apiv2.SetDefaults_VirtmachineHardware(&hw)
+
+	return hw
+}
@@ -9,12 +9,13 @@ import (
 	"github.com/golang/glog"
 	"github.com/libvirt/libvirt-go-xml"
 	"github.com/twinj/uuid"
+	kubeapiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	kubeapi "k8s.io/client-go/pkg/api"
-	kubeapiv1 "k8s.io/client-go/pkg/api/v1"
 
 	"libvirt.org/libvirt-kube/pkg/api"
-	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+	"libvirt.org/libvirt-kube/pkg/libvirtutil"
 )
 
 type DomainDesignerSecret struct {
@@ -22,24 +23,47 @@ type DomainDesignerSecret struct {
 	Value  []byte
 }
 
+// DomainDesignerTransientDisk describes a disk whose writes must
+// go to a throwaway overlay, created in ScratchDir, rather than
+// to the disk's source
+type DomainDesignerTransientDisk struct {
+	// Index into Domain.Devices.Disks
+	Index      int
+	ScratchDir string
+	Capacity   uint64
+}
+
 type DomainDesigner struct {
-	clientset       *kubernetes.Clientset
+	clientset       kubernetes.Interface
 	imageRepoPath   string
-	imageRepoClient *api.VirtimagerepoClient
-	imageFileClient *api.VirtimagefileClient
+	imageRepoLister *api.VirtimagerepoLister
+	imageFileLister *api.VirtimagefileLister
+	arch            *ArchDefaults
+	osinfo          *OSInfo
+	diskBus         string
 	Domain          *libvirtxml.Domain
 	Secrets         []DomainDesignerSecret
+	TransientDisks  []DomainDesignerTransientDisk
+	// Problems which don't stop the domain running, such
+	// as devices the guest OS has no drivers for
+	Warnings []string
 }
 
-func NewDomainDesigner(clientset *kubernetes.Clientset, imageRepoPath string, imageRepoClient *api.VirtimagerepoClient, imageFileClient *api.VirtimagefileClient) *DomainDesigner {
+func (d *DomainDesigner) warnf(format string, args ...interface{}) {
+	warning := fmt.Sprintf(format, args...)
+	glog.V(1).Infof("Design warning: %s", warning)
+	d.Warnings = append(d.Warnings, warning)
+}
+
+func NewDomainDesigner(clientset kubernetes.Interface, imageRepoPath string, imageRepoLister *api.VirtimagerepoLister, imageFileLister *api.VirtimagefileLister) *DomainDesigner {
 	uuid := uuid.NewV4().String()
 	name := fmt.Sprintf("kube-%s", uuid)
 
 	return &DomainDesigner{
 		clientset:       clientset,
 		imageRepoPath:   imageRepoPath,
-		imageRepoClient: imageRepoClient,
-		imageFileClient: imageFileClient,
+		imageRepoLister: imageRepoLister,
+		imageFileLister: imageFileLister,
 		Domain: &libvirtxml.Domain{
 			UUID: uuid,
 			Name: name,
@@ -47,24 +71,32 @@ func NewDomainDesigner(clientset *kubernetes.Clientset, imageRepoPath string, im
 	}
 }
 
-func (d *DomainDesigner) getVolumeLocalPath(etype string, src *apiv1.VirtmachineStorage) (string, error) {
+func (d *DomainDesigner) getVolumeLocalPath(etype string, src *apiv2.VirtmachineStorage) (string, error) {
 	return "", fmt.Errorf("Cannot setup volume")
 }
 
-func (d *DomainDesigner) setOSConfig(tmpl *apiv1.VirtmachineHardware) error {
+func (d *DomainDesigner) setOSConfig(tmpl *apiv2.VirtmachineHardware) error {
 	d.Domain.OS = &libvirtxml.DomainOS{
 		Type: &libvirtxml.DomainOSType{
-			Arch: tmpl.Arch,
-			Type: "hvm",
+			Arch:    d.arch.Name,
+			Type:    d.arch.OSType,
+			Machine: d.arch.Machine,
 		},
 	}
 
 	if tmpl.Machine != "" {
+		if !d.arch.supportsMachine(tmpl.Machine) {
+			return fmt.Errorf("Architecture '%s' does not support machine type '%s'",
+				d.arch.Name, tmpl.Machine)
+		}
 		d.Domain.OS.Type.Machine = tmpl.Machine
 	}
 
 	switch tmpl.Boot.Type {
 	case "direct":
+		if tmpl.Boot.Kernel == nil {
+			return fmt.Errorf("Boot type 'direct' requires a kernel")
+		}
 		kpath, err := d.getVolumeLocalPath("kernel", tmpl.Boot.Kernel)
 		if err != nil {
 			return err
@@ -85,39 +117,63 @@ func (d *DomainDesigner) setOSConfig(tmpl *apiv1.VirtmachineHardware) error {
 		return fmt.Errorf("Unknown boot type '%s'", tmpl.Boot.Type)
 	}
 
-	if tmpl.Boot.Firmware != nil {
-		switch tmpl.Boot.Firmware.Type {
-		case "efi":
-			switch tmpl.Arch {
-			case "x86_64":
-				d.Domain.OS.Loader = &libvirtxml.DomainLoader{
-					Path: "/usr/share/OVMF/OVMF_CODE.fd",
-				}
-			case "aarch64":
-				d.Domain.OS.Loader = &libvirtxml.DomainLoader{
-					Path: "/usr/share/AAVMF/AAVMF_CODE.fd",
-				}
-			default:
-				return fmt.Errorf("Architecture '%s' does not support 'efi' firmware", tmpl.Arch)
-			}
-		case "bios":
-			switch tmpl.Arch {
-			case "x86_64":
-				// nada, its the default
-			case "i686":
-				// nada, its the default
-			default:
-				return fmt.Errorf("Architecture '%s' does not support 'bios' firmware", tmpl.Arch)
-			}
-		default:
-			return fmt.Errorf("Unknown firmware type '%s'", tmpl.Boot.Firmware.Type)
+	var firmware string
+	if tmpl.Boot.Firmware != nil && tmpl.Boot.Firmware.Type != "" {
+		firmware = tmpl.Boot.Firmware.Type
+		if d.osinfo != nil && !osInfoSupports(d.osinfo.Firmwares, firmware) {
+			d.warnf("Guest OS '%s' does not support '%s' firmware", d.osinfo.ShortID, firmware)
 		}
+	} else {
+		firmware = firmwareFor(d.arch, d.osinfo)
+	}
+
+	switch firmware {
+	case "":
+		// nada, not selectable on this arch
+	case "efi":
+		if !d.arch.EFI {
+			return fmt.Errorf("Architecture '%s' does not support 'efi' firmware", d.arch.Name)
+		}
+		d.Domain.OS.Loader = &libvirtxml.DomainLoader{
+			Path:     d.arch.EFILoader,
+			Readonly: "yes",
+			Type:     "pflash",
+		}
+	case "bios":
+		if !d.arch.BIOS {
+			return fmt.Errorf("Architecture '%s' does not support 'bios' firmware", d.arch.Name)
+		}
+		// nada, its the default
+	default:
+		return fmt.Errorf("Unknown firmware type '%s'", firmware)
 	}
 
 	return nil
 }
 
-func (d *DomainDesigner) setMemoryConfig(tmpl *apiv1.VirtmachineHardware) error {
+// The firmware to use when the machine doesn't pick one,
+// preferring whichever the guest OS supports
+func firmwareFor(arch *ArchDefaults, osinfo *OSInfo) string {
+	firmware := arch.Firmware
+	if osinfo != nil && firmware != "" {
+		pref := osInfoPrefer(osinfo.Firmwares, func(fw string) bool {
+			return (fw == "bios" && arch.BIOS) || (fw == "efi" && arch.EFI)
+		})
+		if pref != "" {
+			firmware = pref
+		}
+	}
+	return firmware
+}
+
+func (d *DomainDesigner) setMemoryConfig(tmpl *apiv2.VirtmachineHardware) error {
+	if tmpl.Memory.Slots <= 0 {
+		return fmt.Errorf("Memory slots %d must be at least 1", tmpl.Memory.Slots)
+	}
+	if tmpl.Memory.Initial > tmpl.Memory.Maximum {
+		return fmt.Errorf("Memory present %d must not exceed maximum %d",
+			tmpl.Memory.Initial, tmpl.Memory.Maximum)
+	}
 	if (tmpl.Memory.Initial%tmpl.Memory.Slots) != 0 ||
 		(tmpl.Memory.Maximum%tmpl.Memory.Slots) != 0 {
 		return fmt.Errorf("Memory present %d and maximum %d must be multiple of slots %d",
@@ -145,15 +201,212 @@ func (d *DomainDesigner) setMemoryConfig(tmpl *apiv1.VirtmachineHardware) error
 	return nil
 }
 
-func (d *DomainDesigner) setCPUConfig(tmpl *apiv1.VirtmachineHardware) error {
+func (d *DomainDesigner) setCPUConfig(tmpl *apiv2.VirtmachineHardware) error {
 	// TODO
 	return nil
 }
 
-func (d *DomainDesigner) setDiskConfigRBD(src *kubeapiv1.RBDVolumeSource, disk *libvirtxml.DomainDisk) error {
+func boolDefault(val *bool, def bool) bool {
+	if val == nil {
+		return def
+	}
+	return *val
+}
+
+// Fill in features and clock for the preset, leaving anything
+// explicitly set by the user untouched
+func applyPreset(tmpl *apiv2.VirtmachineHardware) (*apiv2.VirtmachineFeatures, *apiv2.VirtmachineClock, error) {
+	var features apiv2.VirtmachineFeatures
+	var clock apiv2.VirtmachineClock
+	if tmpl.Features != nil {
+		features = *tmpl.Features
+	}
+	if tmpl.Clock != nil {
+		clock = *tmpl.Clock
+	}
+
+	switch tmpl.Preset {
+	case "":
+		// nada
+
+	case "windows":
+		if features.HyperV == nil {
+			features.HyperV = &apiv2.VirtmachineHyperV{
+				Relaxed:   true,
+				VAPIC:     true,
+				Spinlocks: 8191,
+				Synic:     true,
+				STimer:    true,
+				VPIndex:   true,
+			}
+		}
+		if clock.Offset == "" {
+			clock.Offset = "localtime"
+		}
+		if clock.Timers == nil {
+			present := true
+			absent := false
+			clock.Timers = []apiv2.VirtmachineTimer{
+				{Name: "rtc", TickPolicy: "catchup"},
+				{Name: "pit", TickPolicy: "delay"},
+				{Name: "hpet", Present: &absent},
+				{Name: "hypervclock", Present: &present},
+			}
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("Unknown hardware preset '%s'", tmpl.Preset)
+	}
+
+	return &features, &clock, nil
+}
+
+func featureState(enabled bool) *libvirtxml.DomainFeatureState {
+	if !enabled {
+		return nil
+	}
+	return &libvirtxml.DomainFeatureState{
+		State: "on",
+	}
+}
+
+func (d *DomainDesigner) setHyperVConfig(hyperv *apiv2.VirtmachineHyperV, clock *apiv2.VirtmachineClock) error {
+	if hyperv.Spinlocks != 0 && hyperv.Spinlocks < 4095 {
+		return fmt.Errorf("Hyper-V spinlock retries %d must be at least 4095", hyperv.Spinlocks)
+	}
+	if hyperv.Synic && !hyperv.VPIndex {
+		return fmt.Errorf("Hyper-V 'synic' requires 'vpindex'")
+	}
+	if hyperv.STimer {
+		if !hyperv.Synic {
+			return fmt.Errorf("Hyper-V 'stimer' requires 'synic'")
+		}
+		haveClock := false
+		for _, timer := range clock.Timers {
+			if timer.Name == "hypervclock" && boolDefault(timer.Present, true) {
+				haveClock = true
+			}
+		}
+		if !haveClock {
+			return fmt.Errorf("Hyper-V 'stimer' requires a 'hypervclock' timer")
+		}
+	}
+
+	d.Domain.Features.HyperV = &libvirtxml.DomainFeatureHyperV{
+		Relaxed: featureState(hyperv.Relaxed),
+		VAPIC:   featureState(hyperv.VAPIC),
+		Synic:   featureState(hyperv.Synic),
+		STimer:  featureState(hyperv.STimer),
+		VPIndex: featureState(hyperv.VPIndex),
+	}
+	if hyperv.Spinlocks != 0 {
+		d.Domain.Features.HyperV.Spinlocks = &libvirtxml.DomainFeatureHyperVSpinlocks{
+			DomainFeatureState: libvirtxml.DomainFeatureState{
+				State: "on",
+			},
+			Retries: hyperv.Spinlocks,
+		}
+	}
+
+	return nil
+}
+
+func (d *DomainDesigner) setFeatureConfig(tmpl *apiv2.VirtmachineHardware, features *apiv2.VirtmachineFeatures, clock *apiv2.VirtmachineClock) error {
+	x86 := d.arch.X86
+	d.Domain.Features = &libvirtxml.DomainFeatureList{}
+
+	if boolDefault(features.ACPI, d.arch.ACPI) {
+		if !d.arch.ACPI {
+			return fmt.Errorf("Architecture '%s' does not support 'acpi'", d.arch.Name)
+		}
+		d.Domain.Features.ACPI = &libvirtxml.DomainFeature{}
+	}
+	if boolDefault(features.APIC, x86) {
+		if !x86 {
+			return fmt.Errorf("Architecture '%s' does not support 'apic'", d.arch.Name)
+		}
+		d.Domain.Features.APIC = &libvirtxml.DomainFeatureAPIC{}
+	}
+	if d.arch.GICVersion != "" {
+		d.Domain.Features.GIC = &libvirtxml.DomainFeatureGIC{
+			Version: d.arch.GICVersion,
+		}
+	}
+	if boolDefault(features.SMM, false) {
+		if !x86 {
+			return fmt.Errorf("Architecture '%s' does not support 'smm'", d.arch.Name)
+		}
+		d.Domain.Features.SMM = &libvirtxml.DomainFeatureSMM{
+			State: "on",
+		}
+	}
+
+	if features.HyperV != nil {
+		if !x86 {
+			return fmt.Errorf("Architecture '%s' does not support Hyper-V enlightenments", d.arch.Name)
+		}
+		if err := d.setHyperVConfig(features.HyperV, clock); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DomainDesigner) setClockConfig(tmpl *apiv2.VirtmachineHardware, clock *apiv2.VirtmachineClock) error {
+	d.Domain.Clock = &libvirtxml.DomainClock{}
+
+	switch clock.Offset {
+	case "", "utc":
+		d.Domain.Clock.Offset = "utc"
+	case "localtime":
+		d.Domain.Clock.Offset = "localtime"
+	case "timezone":
+		if clock.Timezone == "" {
+			return fmt.Errorf("Clock offset 'timezone' requires a timezone name")
+		}
+		d.Domain.Clock.Offset = "timezone"
+		d.Domain.Clock.TimeZone = clock.Timezone
+	default:
+		return fmt.Errorf("Unknown clock offset '%s'", clock.Offset)
+	}
+
+	for _, timer := range clock.Timers {
+		switch timer.Name {
+		case "rtc", "pit", "hpet", "hypervclock":
+			// nada
+		default:
+			return fmt.Errorf("Unknown clock timer '%s'", timer.Name)
+		}
+
+		switch timer.TickPolicy {
+		case "", "delay", "catchup", "merge", "discard":
+			// nada
+		default:
+			return fmt.Errorf("Unknown tick policy '%s' for timer '%s'", timer.TickPolicy, timer.Name)
+		}
+
+		timerConfig := libvirtxml.DomainTimer{
+			Name:       timer.Name,
+			TickPolicy: timer.TickPolicy,
+		}
+		if timer.Present != nil {
+			if *timer.Present {
+				timerConfig.Present = "yes"
+			} else {
+				timerConfig.Present = "no"
+			}
+		}
+		d.Domain.Clock.Timer = append(d.Domain.Clock.Timer, timerConfig)
+	}
+
+	return nil
+}
+
+func (d *DomainDesigner) setDiskConfigRBD(src *kubeapiv1.RBDPersistentVolumeSource, disk *libvirtxml.DomainDisk) error {
 	disk.Type = "network"
 
-	key, err := api.GetVolumeRBDKey(d.clientset, kubeapi.NamespaceDefault, src)
+	key, err := api.GetVolumeRBDKey(d.clientset, v1.NamespaceDefault, src)
 	if err != nil {
 		return err
 	}
@@ -207,11 +460,11 @@ func (d *DomainDesigner) setDiskConfigRBD(src *kubeapiv1.RBDVolumeSource, disk *
 	return nil
 }
 
-func (d *DomainDesigner) setDiskConfigISCSI(src *kubeapiv1.ISCSIVolumeSource, disk *libvirtxml.DomainDisk) error {
+func (d *DomainDesigner) setDiskConfigISCSI(src *kubeapiv1.ISCSIPersistentVolumeSource, disk *libvirtxml.DomainDisk) error {
 	disk.Type = "network"
 
 	disk.Source = &libvirtxml.DomainDiskSource{
-		Protocol: "rbd",
+		Protocol: "iscsi",
 		Name:     fmt.Sprintf("%s/%d", src.IQN, src.Lun),
 	}
 
@@ -229,21 +482,63 @@ func (d *DomainDesigner) setDiskConfigISCSI(src *kubeapiv1.ISCSIVolumeSource, di
 	return nil
 }
 
-func (d *DomainDesigner) setDiskConfigPersistentVolume(pv *apiv1.VirtmachineStoragePersistentVolume, diskConfig *libvirtxml.DomainDisk) error {
-	pvname, pvspec, err := api.GetVolumeSpec(d.clientset, pv.ClaimName, kubeapi.NamespaceDefault)
+// Properties of a disk source which determine how
+// the disk may be configured
+type diskSourceInfo struct {
+	// Where an overlay for a transient disk is created
+	// and how large it must be
+	scratchDir string
+	capacity   uint64
+
+	// Why the source can't be attached read-write to
+	// several guests at once, or empty if it can
+	notShareable string
+
+	// Whether the source is a SCSI LUN, which can be
+	// passed through to honour persistent reservations
+	scsiLUN bool
+}
+
+func pvAccessModeAllowed(modes []kubeapiv1.PersistentVolumeAccessMode, want kubeapiv1.PersistentVolumeAccessMode) bool {
+	for _, mode := range modes {
+		if mode == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DomainDesigner) setDiskConfigPersistentVolume(pv *apiv2.VirtmachineStoragePersistentVolume, diskConfig *libvirtxml.DomainDisk) (*diskSourceInfo, error) {
+	pvname, pvspec, err := api.GetVolumeSpec(d.clientset, pv.ClaimName, v1.NamespaceDefault)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	src := pvspec.PersistentVolumeSource
 
+	// No scratchDir, since setDiskConfig refuses to make
+	// a transient disk from a PV
+	info := &diskSourceInfo{}
+
 	if src.RBD != nil {
-		return d.setDiskConfigRBD(src.RBD, diskConfig)
+		err = d.setDiskConfigRBD(src.RBD, diskConfig)
 	} else if src.ISCSI != nil {
-		return d.setDiskConfigISCSI(src.ISCSI, diskConfig)
+		err = d.setDiskConfigISCSI(src.ISCSI, diskConfig)
+		info.scsiLUN = true
 	} else {
-		return fmt.Errorf("Unsupported persistent volume source on %s", pvname)
+		err = fmt.Errorf("Unsupported persistent volume source on %s", pvname)
+	}
+	if err != nil {
+		return nil, err
 	}
+
+	if size, ok := pvspec.Capacity[kubeapiv1.ResourceStorage]; ok {
+		info.capacity = uint64(size.Value())
+	}
+	if !pvAccessModeAllowed(pvspec.AccessModes, kubeapiv1.ReadWriteMany) {
+		info.notShareable = fmt.Sprintf("persistent volume %s does not permit ReadWriteMany access", pvname)
+	}
+	return info, nil
 }
 
 func escapeObjname(path string) string {
@@ -255,54 +550,192 @@ func makeVolName(path, format string) string {
 	return fmt.Sprintf("%s.%s", base, format)
 }
 
-func (d *DomainDesigner) setDiskConfigImageFile(storage *apiv1.VirtmachineStorageImageFile, diskConfig *libvirtxml.DomainDisk) error {
-	imagefile, err := d.imageFileClient.Get(storage.FileName)
+func (d *DomainDesigner) setDiskConfigImageFile(storage *apiv2.VirtmachineStorageImageFile, diskConfig *libvirtxml.DomainDisk) (*diskSourceInfo, error) {
+	imagefile, err := d.imageFileLister.Get(v1.NamespaceDefault, storage.FileName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	imagerepo, err := d.imageRepoClient.Get(imagefile.Spec.RepoName)
+	imagerepo, err := d.imageRepoLister.Get(v1.NamespaceDefault, imagefile.Spec.RepoName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	path := path.Join(d.imageRepoPath, imagerepo.Metadata.Name, makeVolName(imagefile.Metadata.Name, imagerepo.Spec.Format))
-	glog.V(1).Infof("Disk image file %s -> repo %s ->path %s", storage.FileName, imagerepo.Metadata.Name, path)
+	format := api.ImageFileFormat(imagefile, imagerepo)
+	volpath := path.Join(d.imageRepoPath, imagerepo.Metadata.Name, makeVolName(imagefile.Metadata.Name, format))
+	glog.V(1).Infof("Disk image file %s -> repo %s ->path %s", storage.FileName, imagerepo.Metadata.Name, volpath)
 
 	diskConfig.Type = "file"
 	diskConfig.Source = &libvirtxml.DomainDiskSource{
-		File: path,
+		File: volpath,
 	}
 	diskConfig.Driver = &libvirtxml.DomainDiskDriver{
 		Name: "qemu",
-		Type: imagerepo.Spec.Format,
+		Type: format,
 	}
 
-	return nil
+	info := &diskSourceInfo{
+		scratchDir: path.Join(d.imageRepoPath, imagerepo.Metadata.Name, libvirtutil.ScratchDirName),
+		capacity:   imagefile.Spec.Capacity,
+	}
+	if imagefile.Spec.AccessMode != apiv2.VirtimagefileReadWriteMany {
+		info.notShareable = fmt.Sprintf("image file %s access mode is %s, not %s",
+			imagefile.Metadata.Name, imagefile.Spec.AccessMode, apiv2.VirtimagefileReadWriteMany)
+	} else if format != "raw" {
+		// qcow2 metadata would be corrupted by concurrent writers
+		info.notShareable = fmt.Sprintf("image file %s format is %s, not raw",
+			imagefile.Metadata.Name, format)
+	}
+	return info, nil
+}
+
+// All LUNs with persistent reservations share a single
+// virtio-scsi controller
+func (d *DomainDesigner) addSCSIController(devs *libvirtxml.DomainDeviceList) {
+	for _, controller := range devs.Controllers {
+		if controller.Type == "scsi" {
+			return
+		}
+	}
+
+	controller := libvirtxml.DomainController{
+		Type:  "scsi",
+		Model: "virtio-scsi",
+	}
+	if d.arch.Address != "pci" {
+		controller.Address = &libvirtxml.DomainAddress{
+			Type: d.arch.Address,
+		}
+	}
+	devs.Controllers = append(devs.Controllers, controller)
+}
+
+func diskDevPrefix(bus string) string {
+	switch bus {
+	case "virtio":
+		return "vd"
+	case "ide":
+		return "hd"
+	default:
+		return "sd"
+	}
 }
 
-func (d *DomainDesigner) setDiskConfig(disk *apiv1.VirtmachineDisk, devs *libvirtxml.DomainDeviceList) error {
+func (d *DomainDesigner) setDiskConfig(disk *apiv2.VirtmachineDisk, devs *libvirtxml.DomainDeviceList) error {
 	diskConfig := libvirtxml.DomainDisk{
 		Device: disk.Device,
 	}
 
+	var info *diskSourceInfo
+	var err error
 	if disk.Source.PersistentVolume != nil {
-		if err := d.setDiskConfigPersistentVolume(disk.Source.PersistentVolume, &diskConfig); err != nil {
-			return err
+		if disk.Transient {
+			// The overlay would need the volume's host
+			// and credentials in its header. Checked
+			// first, so admission says so even while
+			// the claim is unbound
+			return fmt.Errorf("Persistent volume claim %s cannot back a transient disk",
+				disk.Source.PersistentVolume.ClaimName)
 		}
+		info, err = d.setDiskConfigPersistentVolume(disk.Source.PersistentVolume, &diskConfig)
 	} else if disk.Source.ImageFile != nil {
-		if err := d.setDiskConfigImageFile(disk.Source.ImageFile, &diskConfig); err != nil {
-			return err
-		}
+		info, err = d.setDiskConfigImageFile(disk.Source.ImageFile, &diskConfig)
 	} else {
-		return fmt.Errorf("Missing persistentVolume/imageFile info in disk source")
+		err = fmt.Errorf("Missing persistentVolume/imageFile info in disk source")
+	}
+	if err != nil {
+		return err
+	}
+
+	bus := disk.Bus
+	if bus == "" {
+		bus = d.diskBus
+	}
+	switch bus {
+	case "virtio":
+		// nada
+	case "scsi", "sata", "ide":
+		if !d.arch.X86 {
+			return fmt.Errorf("Architecture '%s' does not support '%s' disk bus", d.arch.Name, bus)
+		}
+		if bus == "scsi" {
+			d.addSCSIController(devs)
+		}
+	default:
+		return fmt.Errorf("Unknown disk bus '%s'", bus)
+	}
+	if disk.Bus != "" && d.osinfo != nil && !osInfoSupports(d.osinfo.DiskBuses, bus) {
+		d.warnf("Guest OS '%s' does not support '%s' disk bus", d.osinfo.ShortID, bus)
 	}
 
-	devname := fmt.Sprintf("vd%c", int('a')+len(devs.Disks))
+	devname := fmt.Sprintf("%s%c", diskDevPrefix(bus), int('a')+len(devs.Disks))
 
 	diskConfig.Target = &libvirtxml.DomainDiskTarget{
 		Dev: devname,
-		Bus: "virtio",
+		Bus: bus,
+	}
+	if bus == "virtio" && d.arch.Address != "pci" {
+		diskConfig.Address = &libvirtxml.DomainAddress{
+			Type: d.arch.Address,
+		}
+	}
+
+	if disk.Shareable {
+		if disk.Device != "disk" {
+			return fmt.Errorf("Only devices of type 'disk' can be shareable, not '%s'", disk.Device)
+		}
+		if disk.Transient {
+			return fmt.Errorf("Disk %s cannot be both shareable and transient", devname)
+		}
+		if info.notShareable != "" {
+			return fmt.Errorf("Disk %s cannot be shareable: %s", devname, info.notShareable)
+		}
+
+		diskConfig.Shareable = &libvirtxml.DomainDiskShareable{}
+		if diskConfig.Driver == nil {
+			diskConfig.Driver = &libvirtxml.DomainDiskDriver{
+				Name: "qemu",
+				Type: "raw",
+			}
+		}
+		// Host page cache is not coherent across guests
+		diskConfig.Driver.Cache = "none"
+
+		if disk.Reservations {
+			if !info.scsiLUN {
+				return fmt.Errorf("Disk %s source is not a SCSI LUN, so cannot use persistent reservations", devname)
+			}
+
+			d.addSCSIController(devs)
+
+			// Pass the LUN through so the guest's SCSI
+			// commands reach the storage directly
+			diskConfig.Device = "lun"
+			diskConfig.Target = &libvirtxml.DomainDiskTarget{
+				Dev: fmt.Sprintf("sd%c", int('a')+len(devs.Disks)),
+				Bus: "scsi",
+			}
+			diskConfig.Address = nil
+			diskConfig.Source.Reservations = &libvirtxml.DomainDiskReservations{
+				Managed: "yes",
+			}
+		}
+	} else if disk.Reservations {
+		return fmt.Errorf("Disk %s must be shareable to use persistent reservations", devname)
+	}
+
+	if disk.Transient {
+		if disk.Device != "disk" {
+			return fmt.Errorf("Only devices of type 'disk' can be transient, not '%s'", disk.Device)
+		}
+		if info.capacity == 0 {
+			return fmt.Errorf("Unable to determine capacity for transient disk %s", devname)
+		}
+		d.TransientDisks = append(d.TransientDisks, DomainDesignerTransientDisk{
+			Index:      len(devs.Disks),
+			ScratchDir: info.scratchDir,
+			Capacity:   info.capacity,
+		})
 	}
 
 	devs.Disks = append(devs.Disks, diskConfig)
@@ -310,7 +743,7 @@ func (d *DomainDesigner) setDiskConfig(disk *apiv1.VirtmachineDisk, devs *libvir
 	return nil
 }
 
-func (d *DomainDesigner) setDeviceConfig(tmpl *apiv1.VirtmachineHardware) error {
+func (d *DomainDesigner) setDeviceConfig(tmpl *apiv2.VirtmachineHardware) error {
 	d.Domain.Devices = &libvirtxml.DomainDeviceList{}
 
 	for _, disk := range tmpl.Devices.Disks {
@@ -319,6 +752,162 @@ func (d *DomainDesigner) setDeviceConfig(tmpl *apiv1.VirtmachineHardware) error
 		}
 	}
 
+	for _, iface := range tmpl.Devices.Interfaces {
+		if err := d.setInterfaceConfig(iface, d.Domain.Devices); err != nil {
+			return err
+		}
+	}
+
+	for _, console := range tmpl.Devices.Consoles {
+		if err := d.setConsoleConfig(console, d.Domain.Devices); err != nil {
+			return err
+		}
+	}
+
+	for _, video := range tmpl.Devices.Videos {
+		if err := d.setVideoConfig(video, d.Domain.Devices); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DomainDesigner) setInterfaceConfig(iface *apiv2.VirtmachineInterface, devs *libvirtxml.DomainDeviceList) error {
+	model := iface.Model
+	if model == "" {
+		model = nicModelFor(d.arch, d.osinfo)
+	} else if d.osinfo != nil && !osInfoSupports(d.osinfo.NICModels, model) {
+		d.warnf("Guest OS '%s' does not support '%s' NICs", d.osinfo.ShortID, model)
+	}
+	switch model {
+	case "virtio":
+		// nada
+	case "e1000", "e1000e", "rtl8139":
+		if !d.arch.X86 {
+			return fmt.Errorf("Architecture '%s' does not support '%s' NICs", d.arch.Name, model)
+		}
+	default:
+		return fmt.Errorf("Unknown NIC model '%s'", model)
+	}
+
+	network := iface.Network
+	if network == "" {
+		network = "default"
+	}
+
+	ifaceConfig := libvirtxml.DomainInterface{
+		Type: "network",
+		Source: &libvirtxml.DomainInterfaceSource{
+			Network: network,
+		},
+		Model: &libvirtxml.DomainInterfaceModel{
+			Type: model,
+		},
+	}
+	if model == "virtio" && d.arch.Address != "pci" {
+		ifaceConfig.Address = &libvirtxml.DomainAddress{
+			Type: d.arch.Address,
+		}
+	}
+	devs.Interfaces = append(devs.Interfaces, ifaceConfig)
+
+	return nil
+}
+
+func (d *DomainDesigner) setConsoleConfig(console *apiv2.VirtmachineConsole, devs *libvirtxml.DomainDeviceList) error {
+	var target string
+	switch console.Type {
+	case "", "serial":
+		target = d.arch.SerialConsole
+	case "virtio":
+		target = "virtio"
+	default:
+		return fmt.Errorf("Unknown console type '%s'", console.Type)
+	}
+
+	devs.Consoles = append(devs.Consoles, libvirtxml.DomainConsole{
+		Type: "pty",
+		Target: &libvirtxml.DomainConsoleTarget{
+			Type: target,
+		},
+	})
+
+	return nil
+}
+
+func (d *DomainDesigner) setVideoConfig(video *apiv2.VirtmachineVideo, devs *libvirtxml.DomainDeviceList) error {
+	if d.arch.Video == "" {
+		return fmt.Errorf("Architecture '%s' does not support video devices", d.arch.Name)
+	}
+
+	model := video.Type
+	if model == "" {
+		model = d.arch.Video
+		// Other archs only have a single usable model
+		if d.osinfo != nil && d.arch.X86 {
+			model = d.osinfo.Videos[0]
+		}
+	} else if d.osinfo != nil && !osInfoSupports(d.osinfo.Videos, model) {
+		d.warnf("Guest OS '%s' does not support '%s' video", d.osinfo.ShortID, model)
+	}
+	switch model {
+	case "vga", "cirrus", "qxl", "virtio", "vmvga":
+		// nada
+	default:
+		return fmt.Errorf("Unknown video type '%s'", model)
+	}
+
+	videoConfig := libvirtxml.DomainVideo{
+		Model: libvirtxml.DomainVideoModel{
+			Type: model,
+		},
+	}
+	if video.VRam != 0 {
+		videoConfig.Model.VRam = uint(video.VRam)
+	}
+	devs.Videos = append(devs.Videos, videoConfig)
+
+	return nil
+}
+
+func lifecycleAction(event, action string, allowed ...string) (string, error) {
+	if action == "" {
+		return "", nil
+	}
+	for _, want := range allowed {
+		if action == want {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("Unsupported %s action '%s'", event, action)
+}
+
+// Actions such as 'preserve' and 'rename-restart' are not
+// permitted, since they would leave a domain behind which
+// the shim no longer tracks
+func (d *DomainDesigner) setLifecycleConfig(tmpl *apiv2.VirtmachineHardware) error {
+	if tmpl.Lifecycle == nil {
+		return nil
+	}
+
+	var err error
+	d.Domain.OnPoweroff, err = lifecycleAction("poweroff", tmpl.Lifecycle.OnPoweroff,
+		"destroy", "restart")
+	if err != nil {
+		return err
+	}
+	d.Domain.OnReboot, err = lifecycleAction("reboot", tmpl.Lifecycle.OnReboot,
+		"destroy", "restart")
+	if err != nil {
+		return err
+	}
+	d.Domain.OnCrash, err = lifecycleAction("crash", tmpl.Lifecycle.OnCrash,
+		"destroy", "restart", "coredump-destroy", "coredump-restart")
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -328,7 +917,56 @@ func (d *DomainDesigner) SetResourcePartition(partition string) {
 	}
 }
 
-func (d *DomainDesigner) ApplyVirtMachine(tmpl *apiv1.VirtmachineHardware) error {
+// The disk bus to use when a disk doesn't pick one
+func diskBusFor(arch *ArchDefaults, osinfo *OSInfo) string {
+	// The alternatives to virtio are only emulated on x86
+	if osinfo != nil && arch.X86 && !osInfoSupports(osinfo.DiskBuses, arch.DiskBus) {
+		return osinfo.DiskBuses[0]
+	}
+	return arch.DiskBus
+}
+
+// The NIC model to use when an interface doesn't pick one
+func nicModelFor(arch *ArchDefaults, osinfo *OSInfo) string {
+	// As with disks, the alternatives are x86 only
+	if osinfo != nil && arch.X86 && !osInfoSupports(osinfo.NICModels, "virtio") {
+		return osinfo.NICModels[0]
+	}
+	return "virtio"
+}
+
+// Pick devices the guest OS can drive, and warn about
+// resources too small for it to run
+func (d *DomainDesigner) applyOSInfo(tmpl *apiv2.VirtmachineHardware) {
+	d.diskBus = diskBusFor(d.arch, d.osinfo)
+	if d.osinfo == nil {
+		return
+	}
+
+	if tmpl.CPU.Count < d.osinfo.MinCPUs {
+		d.warnf("Guest OS '%s' needs at least %d CPUs, but only %d are configured",
+			d.osinfo.ShortID, d.osinfo.MinCPUs, tmpl.CPU.Count)
+	}
+	if tmpl.Memory.Initial < d.osinfo.MinMemory {
+		d.warnf("Guest OS '%s' needs at least %d MB memory, but only %d MB is configured",
+			d.osinfo.ShortID, d.osinfo.MinMemory, tmpl.Memory.Initial)
+	}
+}
+
+func (d *DomainDesigner) ApplyVirtMachine(tmpl *apiv2.VirtmachineHardware) error {
+	arch, err := GetArchDefaults(tmpl.Arch)
+	if err != nil {
+		return err
+	}
+	d.arch = arch
+
+	osinfo, err := GetOSInfo(tmpl.OS)
+	if err != nil {
+		return err
+	}
+	d.osinfo = osinfo
+	d.applyOSInfo(tmpl)
+
 	d.Domain.Type = tmpl.Type
 
 	if err := d.setOSConfig(tmpl); err != nil {
@@ -343,9 +981,67 @@ func (d *DomainDesigner) ApplyVirtMachine(tmpl *apiv1.VirtmachineHardware) error
 		return err
 	}
 
+	features, clock, err := applyPreset(tmpl)
+	if err != nil {
+		return err
+	}
+
+	if err := d.setFeatureConfig(tmpl, features, clock); err != nil {
+		return err
+	}
+
+	if err := d.setClockConfig(tmpl, clock); err != nil {
+		return err
+	}
+
+	if err := d.setLifecycleConfig(tmpl); err != nil {
+		return err
+	}
+
 	if err := d.setDeviceConfig(tmpl); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// DefaultHardware fills in the firmware, disk buses and NIC
+// models that ApplyVirtMachine would otherwise pick for the
+// architecture and guest OS, so they are recorded in the
+// resource
+func DefaultHardware(tmpl *apiv2.VirtmachineHardware) error {
+	arch, err := GetArchDefaults(tmpl.Arch)
+	if err != nil {
+		return err
+	}
+
+	osinfo, err := GetOSInfo(tmpl.OS)
+	if err != nil {
+		return err
+	}
+
+	if tmpl.Boot.Type == "firmware" &&
+		(tmpl.Boot.Firmware == nil || tmpl.Boot.Firmware.Type == "") {
+		if firmware := firmwareFor(arch, osinfo); firmware != "" {
+			tmpl.Boot.Firmware = &apiv2.VirtmachineFirmware{
+				Type: firmware,
+			}
+		}
+	}
+
+	bus := diskBusFor(arch, osinfo)
+	for _, disk := range tmpl.Devices.Disks {
+		if disk.Bus == "" && !disk.Reservations {
+			disk.Bus = bus
+		}
+	}
+
+	model := nicModelFor(arch, osinfo)
+	for _, iface := range tmpl.Devices.Interfaces {
+		if iface.Model == "" {
+			iface.Model = model
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,368 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package designer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/libvirt/libvirt-go-xml"
+	kubeapiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// A claim bound to a volume with the source, which the
+// designer finds through the clientset
+func testVolume(name string, src kubeapiv1.PersistentVolumeSource, modes ...kubeapiv1.PersistentVolumeAccessMode) []interface{} {
+	return []interface{}{
+		&kubeapiv1.PersistentVolumeClaim{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      name,
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: kubeapiv1.PersistentVolumeClaimSpec{
+				VolumeName: name + "-pv",
+			},
+		},
+		&kubeapiv1.PersistentVolume{
+			ObjectMeta: v1.ObjectMeta{
+				Name: name + "-pv",
+			},
+			Spec: kubeapiv1.PersistentVolumeSpec{
+				PersistentVolumeSource: src,
+				AccessModes:            modes,
+				Capacity: kubeapiv1.ResourceList{
+					kubeapiv1.ResourceStorage: resource.MustParse("10Gi"),
+				},
+			},
+		},
+	}
+}
+
+func testISCSIVolume(name string, modes ...kubeapiv1.PersistentVolumeAccessMode) []interface{} {
+	return testVolume(name, kubeapiv1.PersistentVolumeSource{
+		ISCSI: &kubeapiv1.ISCSIPersistentVolumeSource{
+			TargetPortal: "10.0.0.1:3260",
+			IQN:          "iqn.2017-01.org.example:" + name,
+			Lun:          1,
+		},
+	}, modes...)
+}
+
+func testRBDVolume(name string, modes ...kubeapiv1.PersistentVolumeAccessMode) []interface{} {
+	objects := testVolume(name, kubeapiv1.PersistentVolumeSource{
+		RBD: &kubeapiv1.RBDPersistentVolumeSource{
+			CephMonitors: []string{"10.0.0.2:6789"},
+			RBDPool:      "rbd",
+			RBDImage:     name,
+			RadosUser:    "admin",
+			SecretRef: &kubeapiv1.SecretReference{
+				Name: "ceph",
+			},
+		},
+	}, modes...)
+	return append(objects, &kubeapiv1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "ceph",
+			Namespace: v1.NamespaceDefault,
+		},
+		Type: "kubernetes.io/rbd",
+		Data: map[string][]byte{
+			"key": []byte("QVFBTWdYaFZ3QkNlRGhBQTlubFBhRnlmVVNhdEdENGRyRldEdlE9PQ=="),
+		},
+	})
+}
+
+// Everything the shareable disk tests may refer to
+func shareableTestObjects() []interface{} {
+	objects := []interface{}{
+		testImageFile("shared", "", apiv2.VirtimagefileReadWriteMany),
+		testImageFile("sharedqcow", "qcow2", apiv2.VirtimagefileReadWriteMany),
+	}
+	objects = append(objects, testISCSIVolume("lun", kubeapiv1.ReadWriteMany)...)
+	objects = append(objects, testISCSIVolume("lunonce", kubeapiv1.ReadWriteOnce)...)
+	objects = append(objects, testRBDVolume("ceph", kubeapiv1.ReadWriteMany)...)
+	return objects
+}
+
+func imageFileDisk(name string) *apiv2.VirtmachineDisk {
+	return &apiv2.VirtmachineDisk{
+		Device: "disk",
+		Source: &apiv2.VirtmachineStorage{
+			ImageFile: &apiv2.VirtmachineStorageImageFile{
+				FileName: name,
+			},
+		},
+	}
+}
+
+func volumeDisk(claim string) *apiv2.VirtmachineDisk {
+	return &apiv2.VirtmachineDisk{
+		Device: "disk",
+		Source: &apiv2.VirtmachineStorage{
+			PersistentVolume: &apiv2.VirtmachineStoragePersistentVolume{
+				ClaimName: claim,
+			},
+		},
+	}
+}
+
+func TestDiskShareableRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		disk   *apiv2.VirtmachineDisk
+		modify func(disk *apiv2.VirtmachineDisk)
+		err    string
+	}{
+		{
+			name: "read write once image file",
+			disk: imageFileDisk("disk"),
+			modify: func(disk *apiv2.VirtmachineDisk) {
+				disk.Shareable = true
+			},
+			err: "image file disk access mode is ReadWriteOnce, not ReadWriteMany",
+		},
+		{
+			name: "qcow2 image file",
+			disk: imageFileDisk("sharedqcow"),
+			modify: func(disk *apiv2.VirtmachineDisk) {
+				disk.Shareable = true
+			},
+			err: "image file sharedqcow format is qcow2, not raw",
+		},
+		{
+			name: "read write once volume",
+			disk: volumeDisk("lunonce"),
+			modify: func(disk *apiv2.VirtmachineDisk) {
+				disk.Shareable = true
+			},
+			err: "persistent volume lunonce-pv does not permit ReadWriteMany access",
+		},
+		{
+			name: "cdrom",
+			disk: imageFileDisk("shared"),
+			modify: func(disk *apiv2.VirtmachineDisk) {
+				disk.Device = "cdrom"
+				disk.Shareable = true
+			},
+			err: "Only devices of type 'disk' can be shareable, not 'cdrom'",
+		},
+		{
+			name: "transient",
+			disk: imageFileDisk("shared"),
+			modify: func(disk *apiv2.VirtmachineDisk) {
+				disk.Shareable = true
+				disk.Transient = true
+			},
+			err: "cannot be both shareable and transient",
+		},
+		{
+			name: "reservations unshared",
+			disk: volumeDisk("lun"),
+			modify: func(disk *apiv2.VirtmachineDisk) {
+				disk.Reservations = true
+			},
+			err: "must be shareable to use persistent reservations",
+		},
+		{
+			name: "reservations image file",
+			disk: imageFileDisk("shared"),
+			modify: func(disk *apiv2.VirtmachineDisk) {
+				disk.Shareable = true
+				disk.Reservations = true
+			},
+			err: "source is not a SCSI LUN",
+		},
+		{
+			name: "reservations rbd",
+			disk: volumeDisk("ceph"),
+			modify: func(disk *apiv2.VirtmachineDisk) {
+				disk.Shareable = true
+				disk.Reservations = true
+			},
+			err: "source is not a SCSI LUN",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hw := archHardware("x86_64", false)
+			test.modify(test.disk)
+			hw.Devices.Disks = []*apiv2.VirtmachineDisk{test.disk}
+
+			d := newTestDesigner(t, shareableTestObjects()...)
+			err := d.ApplyVirtMachine(hw)
+			if err == nil {
+				t.Fatalf("Expected error containing '%s'", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error containing '%s', got '%s'", test.err, err)
+			}
+		})
+	}
+}
+
+func iscsiSource(name string) *libvirtxml.DomainDiskSource {
+	return &libvirtxml.DomainDiskSource{
+		Protocol: "iscsi",
+		Name:     "iqn.2017-01.org.example:" + name + "/1",
+		Hosts: []libvirtxml.DomainDiskSourceHost{
+			{
+				Transport: "tcp",
+				Name:      "10.0.0.1",
+				Port:      "3260",
+			},
+		},
+	}
+}
+
+func TestDiskShareable(t *testing.T) {
+	sharedDriver := &libvirtxml.DomainDiskDriver{
+		Name:  "qemu",
+		Type:  "raw",
+		Cache: "none",
+	}
+	lunSource := iscsiSource("lun")
+	lunSource.Reservations = &libvirtxml.DomainDiskReservations{
+		Managed: "yes",
+	}
+
+	tests := []struct {
+		name         string
+		arch         string
+		disks        []*apiv2.VirtmachineDisk
+		reservations bool
+		want         []libvirtxml.DomainDisk
+		controllers  []libvirtxml.DomainController
+	}{
+		{
+			name:  "image file",
+			arch:  "x86_64",
+			disks: []*apiv2.VirtmachineDisk{imageFileDisk("shared")},
+			want: []libvirtxml.DomainDisk{
+				{
+					Type:   "file",
+					Device: "disk",
+					Source: &libvirtxml.DomainDiskSource{
+						File: "/srv/images/images/shared.raw",
+					},
+					Driver:    sharedDriver,
+					Target:    &libvirtxml.DomainDiskTarget{Dev: "vda", Bus: "virtio"},
+					Shareable: &libvirtxml.DomainDiskShareable{},
+				},
+			},
+		},
+		{
+			name:  "volume",
+			arch:  "x86_64",
+			disks: []*apiv2.VirtmachineDisk{volumeDisk("lun")},
+			want: []libvirtxml.DomainDisk{
+				{
+					Type:      "network",
+					Device:    "disk",
+					Source:    iscsiSource("lun"),
+					Driver:    sharedDriver,
+					Target:    &libvirtxml.DomainDiskTarget{Dev: "vda", Bus: "virtio"},
+					Shareable: &libvirtxml.DomainDiskShareable{},
+				},
+			},
+		},
+		{
+			// Both LUNs share the one controller
+			name:         "reservations",
+			arch:         "x86_64",
+			disks:        []*apiv2.VirtmachineDisk{volumeDisk("lun"), volumeDisk("lun")},
+			reservations: true,
+			want: []libvirtxml.DomainDisk{
+				{
+					Type:      "network",
+					Device:    "lun",
+					Source:    lunSource,
+					Driver:    sharedDriver,
+					Target:    &libvirtxml.DomainDiskTarget{Dev: "sda", Bus: "scsi"},
+					Shareable: &libvirtxml.DomainDiskShareable{},
+				},
+				{
+					Type:      "network",
+					Device:    "lun",
+					Source:    lunSource,
+					Driver:    sharedDriver,
+					Target:    &libvirtxml.DomainDiskTarget{Dev: "sdb", Bus: "scsi"},
+					Shareable: &libvirtxml.DomainDiskShareable{},
+				},
+			},
+			controllers: []libvirtxml.DomainController{
+				{Type: "scsi", Model: "virtio-scsi"},
+			},
+		},
+		{
+			// The LUN sits on the controller, so loses the
+			// ccw address the virtio disk would have had
+			name:         "reservations s390x",
+			arch:         "s390x",
+			disks:        []*apiv2.VirtmachineDisk{volumeDisk("lun")},
+			reservations: true,
+			want: []libvirtxml.DomainDisk{
+				{
+					Type:      "network",
+					Device:    "lun",
+					Source:    lunSource,
+					Driver:    sharedDriver,
+					Target:    &libvirtxml.DomainDiskTarget{Dev: "sda", Bus: "scsi"},
+					Shareable: &libvirtxml.DomainDiskShareable{},
+				},
+			},
+			controllers: []libvirtxml.DomainController{
+				{
+					Type:    "scsi",
+					Model:   "virtio-scsi",
+					Address: &libvirtxml.DomainAddress{Type: "ccw"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hw := archHardware(test.arch, false)
+			for _, disk := range test.disks {
+				disk.Shareable = true
+				disk.Reservations = test.reservations
+			}
+			hw.Devices.Disks = test.disks
+
+			d := newTestDesigner(t, shareableTestObjects()...)
+			if err := d.ApplyVirtMachine(hw); err != nil {
+				t.Fatalf("Unable to design domain: %s", err)
+			}
+
+			if !reflect.DeepEqual(d.Domain.Devices.Disks, test.want) {
+				t.Errorf("Expected disks\n%#v\ngot\n%#v", test.want, d.Domain.Devices.Disks)
+			}
+			if !reflect.DeepEqual(d.Domain.Devices.Controllers, test.controllers) {
+				t.Errorf("Expected controllers\n%#v\ngot\n%#v", test.controllers, d.Domain.Devices.Controllers)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package designer
+
+import (
+	"fmt"
+)
+
+// OSInfo describes the virtual hardware a guest OS can drive
+// out of the box, ie without installing extra drivers
+type OSInfo struct {
+	// The osinfo-db short ID, eg 'fedora25'
+	ShortID string
+	Name    string
+
+	// Supported devices, most preferred first
+	DiskBuses []string
+	NICModels []string
+	Videos    []string
+	Firmwares []string
+
+	// Minimum resources needed to run the OS, with
+	// memory in MB
+	MinCPUs   int
+	MinMemory int
+}
+
+// A hand maintained subset of osinfo-db, rather than the
+// database itself, since the shim and admission webhook run
+// without it installed. Only the OS listed here may be named
+// by a Virtmachine, and only the devices, firmware and
+// minimum resources the designer acts on are recorded.
+// Entries follow the osinfo-db short IDs and data, so more
+// can be added by copying them from there
+var osInfoDB = map[string]*OSInfo{}
+
+func addOSInfo(info *OSInfo) {
+	osInfoDB[info.ShortID] = info
+}
+
+func init() {
+	linuxNICModels := []string{"virtio", "e1000", "rtl8139"}
+	linuxVideos := []string{"qxl", "virtio", "vga", "cirrus"}
+	linuxFirmwares := []string{"bios", "efi"}
+	// Windows has no virtio or qxl drivers until the
+	// virtio-win drivers are installed
+	windowsDiskBuses := []string{"sata", "ide"}
+	windowsNICModels := []string{"e1000", "rtl8139"}
+	windowsVideos := []string{"vga", "cirrus", "qxl"}
+
+	addOSInfo(&OSInfo{
+		ShortID:   "rhel5.11",
+		Name:      "Red Hat Enterprise Linux 5.11",
+		DiskBuses: []string{"virtio", "ide"},
+		NICModels: linuxNICModels,
+		Videos:    []string{"cirrus", "vga"},
+		Firmwares: []string{"bios"},
+		MinCPUs:   1,
+		MinMemory: 512,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "rhel6.9",
+		Name:      "Red Hat Enterprise Linux 6.9",
+		DiskBuses: []string{"virtio", "sata", "ide"},
+		NICModels: linuxNICModels,
+		Videos:    []string{"qxl", "vga", "cirrus"},
+		Firmwares: linuxFirmwares,
+		MinCPUs:   1,
+		MinMemory: 512,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "rhel7.3",
+		Name:      "Red Hat Enterprise Linux 7.3",
+		DiskBuses: []string{"virtio", "sata", "ide"},
+		NICModels: linuxNICModels,
+		Videos:    []string{"qxl", "vga", "cirrus"},
+		Firmwares: linuxFirmwares,
+		MinCPUs:   1,
+		MinMemory: 1024,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "centos7.0",
+		Name:      "CentOS 7.0",
+		DiskBuses: []string{"virtio", "sata", "ide"},
+		NICModels: linuxNICModels,
+		Videos:    []string{"qxl", "vga", "cirrus"},
+		Firmwares: linuxFirmwares,
+		MinCPUs:   1,
+		MinMemory: 1024,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "fedora25",
+		Name:      "Fedora 25",
+		DiskBuses: []string{"virtio", "sata", "ide"},
+		NICModels: linuxNICModels,
+		Videos:    linuxVideos,
+		Firmwares: linuxFirmwares,
+		MinCPUs:   1,
+		MinMemory: 1024,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "fedora26",
+		Name:      "Fedora 26",
+		DiskBuses: []string{"virtio", "sata", "ide"},
+		NICModels: linuxNICModels,
+		Videos:    linuxVideos,
+		Firmwares: linuxFirmwares,
+		MinCPUs:   1,
+		MinMemory: 1024,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "ubuntu16.04",
+		Name:      "Ubuntu 16.04 LTS",
+		DiskBuses: []string{"virtio", "sata", "ide"},
+		NICModels: linuxNICModels,
+		Videos:    linuxVideos,
+		Firmwares: linuxFirmwares,
+		MinCPUs:   1,
+		MinMemory: 512,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "win7",
+		Name:      "Microsoft Windows 7",
+		DiskBuses: windowsDiskBuses,
+		NICModels: windowsNICModels,
+		Videos:    windowsVideos,
+		// UEFI boot needs a CSM, which OVMF lacks
+		Firmwares: []string{"bios"},
+		MinCPUs:   1,
+		MinMemory: 1024,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "win8.1",
+		Name:      "Microsoft Windows 8.1",
+		DiskBuses: windowsDiskBuses,
+		NICModels: windowsNICModels,
+		Videos:    windowsVideos,
+		Firmwares: []string{"bios", "efi"},
+		MinCPUs:   1,
+		MinMemory: 1024,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "win10",
+		Name:      "Microsoft Windows 10",
+		DiskBuses: windowsDiskBuses,
+		NICModels: windowsNICModels,
+		Videos:    windowsVideos,
+		Firmwares: []string{"bios", "efi"},
+		MinCPUs:   1,
+		MinMemory: 2048,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "win2k12r2",
+		Name:      "Microsoft Windows Server 2012 R2",
+		DiskBuses: windowsDiskBuses,
+		NICModels: windowsNICModels,
+		Videos:    windowsVideos,
+		Firmwares: []string{"bios", "efi"},
+		MinCPUs:   1,
+		MinMemory: 512,
+	})
+	addOSInfo(&OSInfo{
+		ShortID:   "win2k16",
+		Name:      "Microsoft Windows Server 2016",
+		DiskBuses: windowsDiskBuses,
+		NICModels: windowsNICModels,
+		Videos:    windowsVideos,
+		Firmwares: []string{"bios", "efi"},
+		MinCPUs:   1,
+		MinMemory: 2048,
+	})
+}
+
+// GetOSInfo returns the info for the OS with the short ID,
+// or nil if no OS was named
+func GetOSInfo(shortID string) (*OSInfo, error) {
+	if shortID == "" {
+		return nil, nil
+	}
+
+	info, ok := osInfoDB[shortID]
+	if !ok {
+		return nil, fmt.Errorf("Unknown guest OS '%s'", shortID)
+	}
+	return info, nil
+}
+
+func osInfoSupports(supported []string, want string) bool {
+	for _, have := range supported {
+		if have == want {
+			return true
+		}
+	}
+	return false
+}
+
+// The first of the OS's preferred devices which is also
+// usable with the architecture, if any are
+func osInfoPrefer(supported []string, usable func(string) bool) string {
+	for _, have := range supported {
+		if usable(have) {
+			return have
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package designer
+
+import (
+	"strings"
+	"testing"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// A machine running the guest OS, with memory enough for any
+func osHardware(arch, os string) *apiv2.VirtmachineHardware {
+	hw := archHardware(arch, archDefaults[arch].Video != "")
+	hw.OS = os
+	hw.Memory.Initial = 4096
+	hw.Memory.Maximum = 4096
+	return hw
+}
+
+func TestOSInfoDefaults(t *testing.T) {
+	tests := []struct {
+		arch     string
+		os       string
+		firmware string
+		bus      string
+		nic      string
+		video    string
+	}{
+		{"x86_64", "", "bios", "virtio", "virtio", "vga"},
+		{"x86_64", "fedora25", "bios", "virtio", "virtio", "qxl"},
+		{"x86_64", "rhel5.11", "bios", "virtio", "virtio", "cirrus"},
+		{"x86_64", "win10", "bios", "sata", "e1000", "vga"},
+		{"x86_64", "win7", "bios", "sata", "e1000", "vga"},
+		// Only x86 emulates the devices Windows has drivers
+		// for, and ARM has no BIOS
+		{"aarch64", "win10", "efi", "virtio", "virtio", "virtio"},
+		{"ppc64le", "fedora25", "", "virtio", "virtio", "vga"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.arch+" "+test.os, func(t *testing.T) {
+			hw := osHardware(test.arch, test.os)
+			if err := DefaultHardware(hw); err != nil {
+				t.Fatalf("Unable to default hardware: %s", err)
+			}
+			var firmware string
+			if hw.Boot.Firmware != nil {
+				firmware = hw.Boot.Firmware.Type
+			}
+			if firmware != test.firmware {
+				t.Errorf("Expected firmware '%s', got '%s'", test.firmware, firmware)
+			}
+			if hw.Devices.Disks[0].Bus != test.bus {
+				t.Errorf("Expected disk bus '%s', got '%s'", test.bus, hw.Devices.Disks[0].Bus)
+			}
+			if hw.Devices.Interfaces[0].Model != test.nic {
+				t.Errorf("Expected NIC model '%s', got '%s'", test.nic, hw.Devices.Interfaces[0].Model)
+			}
+
+			// The designer picks the same devices when the
+			// hardware was never defaulted
+			d := newTestDesigner(t)
+			if err := d.ApplyVirtMachine(osHardware(test.arch, test.os)); err != nil {
+				t.Fatalf("Unable to design domain: %s", err)
+			}
+			if len(d.Warnings) != 0 {
+				t.Errorf("Unexpected warnings %v", d.Warnings)
+			}
+			devs := d.Domain.Devices
+			if devs.Disks[0].Target.Bus != test.bus {
+				t.Errorf("Expected domain disk bus '%s', got '%s'", test.bus, devs.Disks[0].Target.Bus)
+			}
+			if devs.Interfaces[0].Model.Type != test.nic {
+				t.Errorf("Expected domain NIC model '%s', got '%s'", test.nic, devs.Interfaces[0].Model.Type)
+			}
+			if devs.Videos[0].Model.Type != test.video {
+				t.Errorf("Expected domain video '%s', got '%s'", test.video, devs.Videos[0].Model.Type)
+			}
+		})
+	}
+}
+
+func TestOSInfoWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		arch    string
+		os      string
+		modify  func(hw *apiv2.VirtmachineHardware)
+		warning string
+	}{
+		{
+			name: "win7 efi",
+			arch: "x86_64",
+			os:   "win7",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Boot.Firmware = &apiv2.VirtmachineFirmware{Type: "efi"}
+			},
+			warning: "Guest OS 'win7' does not support 'efi' firmware",
+		},
+		{
+			name: "win10 virtio disk",
+			arch: "x86_64",
+			os:   "win10",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Devices.Disks[0].Bus = "virtio"
+			},
+			warning: "Guest OS 'win10' does not support 'virtio' disk bus",
+		},
+		{
+			name: "win10 virtio nic",
+			arch: "x86_64",
+			os:   "win10",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Devices.Interfaces[0].Model = "virtio"
+			},
+			warning: "Guest OS 'win10' does not support 'virtio' NICs",
+		},
+		{
+			name: "rhel5.11 qxl",
+			arch: "x86_64",
+			os:   "rhel5.11",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Devices.Videos[0].Type = "qxl"
+			},
+			warning: "Guest OS 'rhel5.11' does not support 'qxl' video",
+		},
+		{
+			name: "win10 memory",
+			arch: "x86_64",
+			os:   "win10",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Memory.Initial = 1024
+				hw.Memory.Maximum = 1024
+			},
+			warning: "Guest OS 'win10' needs at least 2048 MB memory, but only 1024 MB is configured",
+		},
+		{
+			name: "fedora25 cpus",
+			arch: "x86_64",
+			os:   "fedora25",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.CPU.Count = 0
+			},
+			warning: "Guest OS 'fedora25' needs at least 1 CPUs, but only 0 are configured",
+		},
+		{
+			// Defaults are never warned about
+			name: "win10 defaults",
+			arch: "x86_64",
+			os:   "win10",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+			},
+		},
+		{
+			name: "no os",
+			arch: "x86_64",
+			modify: func(hw *apiv2.VirtmachineHardware) {
+				hw.Memory.Initial = 256
+				hw.Memory.Maximum = 256
+				hw.Devices.Disks[0].Bus = "ide"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hw := osHardware(test.arch, test.os)
+			test.modify(hw)
+
+			d := newTestDesigner(t)
+			if err := d.ApplyVirtMachine(hw); err != nil {
+				t.Fatalf("Unable to design domain: %s", err)
+			}
+			if test.warning == "" {
+				if len(d.Warnings) != 0 {
+					t.Errorf("Unexpected warnings %v", d.Warnings)
+				}
+				return
+			}
+			if len(d.Warnings) != 1 || !strings.Contains(d.Warnings[0], test.warning) {
+				t.Errorf("Expected warning '%s', got %v", test.warning, d.Warnings)
+			}
+		})
+	}
+}
+
+func TestOSInfoUnknown(t *testing.T) {
+	hw := osHardware("x86_64", "fedora99")
+
+	if err := DefaultHardware(hw); err == nil || !strings.Contains(err.Error(), "Unknown guest OS 'fedora99'") {
+		t.Errorf("Expected unknown guest OS error from defaults, got '%v'", err)
+	}
+
+	d := newTestDesigner(t)
+	if err := d.ApplyVirtMachine(hw); err == nil || !strings.Contains(err.Error(), "Unknown guest OS 'fedora99'") {
+		t.Errorf("Expected unknown guest OS error from designer, got '%v'", err)
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package designer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golang/glog"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// Elements which an override may never touch, whatever the
+// allowlist says. The shim tracks domains by name & UUID, the
+// emulator, host devices & file backed memory escape the
+// node's confinement, and seclabel would lift it altogether
+var overrideForbidden = []string{
+	"/domain/name",
+	"/domain/uuid",
+	"/domain/seclabel",
+	"/domain/memoryBacking/source",
+	"/domain/devices/emulator",
+	"/domain/devices/hostdev",
+}
+
+// Elements whose text is a path on the host
+var overrideForbiddenText = []string{
+	"/domain/os/loader",
+	"/domain/os/nvram",
+	"/domain/os/kernel",
+	"/domain/os/initrd",
+	"/domain/os/dtb",
+	"/domain/devices/rng/backend",
+}
+
+// Device types an override may never choose on any element,
+// since they hand host devices or storage to the guest
+var overrideForbiddenTypes = []string{
+	"hostdev",
+	"block",
+	"dir",
+	"nvme",
+	"passthrough",
+}
+
+// Elements whose attributes may name paths on the host, such
+// as a disk's <source> or its unix socket <host>, a TPM's
+// <device> or a shmem <server>
+var overrideHostPathElems = []string{
+	"source",
+	"host",
+	"device",
+	"server",
+}
+
+// Attributes of those elements which name paths on the host
+var overrideHostPathAttrs = []string{
+	"file",
+	"dev",
+	"dir",
+	"path",
+	"socket",
+	"evdev",
+}
+
+func stringIn(s string, list []string) bool {
+	for _, item := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Check attributes which are forbidden wherever they appear,
+// whatever the allowlist says
+func checkForbiddenAttrs(elem string, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		// Namespace declarations are only useful for
+		// elements outside libvirt's schema
+		if attr.Name.Space != "" || attr.Name.Local == "xmlns" {
+			return fmt.Errorf("Namespaced attribute %s on element %s is not permitted in overrides",
+				attr.Name.Local, elem)
+		}
+		if attr.Name.Local == "type" && stringIn(attr.Value, overrideForbiddenTypes) {
+			return fmt.Errorf("Element %s of type '%s' is not permitted in overrides",
+				elem, attr.Value)
+		}
+		if stringIn(start.Name.Local, overrideHostPathElems) && stringIn(attr.Name.Local, overrideHostPathAttrs) {
+			return fmt.Errorf("Host path attribute %s on element %s is not permitted in overrides",
+				attr.Name.Local, elem)
+		}
+	}
+	return nil
+}
+
+// OverridePolicy controls which parts of the domain XML
+// a Virtmachine override is permitted to set
+type OverridePolicy struct {
+	allowed []string
+}
+
+// NewOverridePolicy creates a policy permitting the elements
+// listed, along with everything beneath them, eg
+// '/domain/features/pmu'. With an empty list no overrides
+// are permitted at all
+func NewOverridePolicy(allowed []string) *OverridePolicy {
+	policy := &OverridePolicy{}
+	for _, elem := range allowed {
+		elem = strings.TrimRight(strings.TrimSpace(elem), "/")
+		if elem != "" {
+			policy.allowed = append(policy.allowed, elem)
+		}
+	}
+	return policy
+}
+
+func pathWithin(elem, parent string) bool {
+	return elem == parent || strings.HasPrefix(elem, parent+"/")
+}
+
+// Whether the element is allowed, or is merely a container
+// on the way to an element that is allowed
+func (p *OverridePolicy) check(elem string) (allowed bool, container bool) {
+	for _, forbid := range overrideForbidden {
+		if pathWithin(elem, forbid) {
+			return false, false
+		}
+	}
+	for _, allow := range p.allowed {
+		if pathWithin(elem, allow) {
+			return true, false
+		}
+		if pathWithin(allow, elem) {
+			container = true
+		}
+	}
+	return false, container
+}
+
+// Walk the fragment making sure everything it sets is
+// permitted by the policy
+func (p *OverridePolicy) validate(fragment string) error {
+	decoder := xml.NewDecoder(strings.NewReader(fragment))
+
+	var stack []string
+	var allowed []bool
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			// Name.Local alone would let eg <qemu:commandline>
+			// pass for a <commandline> element
+			if t.Name.Space != "" {
+				return fmt.Errorf("Element <%s> in namespace '%s' is not permitted in overrides",
+					t.Name.Local, t.Name.Space)
+			}
+			if len(stack) == 0 && t.Name.Local != "domain" {
+				return fmt.Errorf("Override must be rooted at <domain>, not <%s>", t.Name.Local)
+			}
+			elem := "/" + t.Name.Local
+			if len(stack) != 0 {
+				elem = stack[len(stack)-1] + elem
+			}
+			if err := checkForbiddenAttrs(elem, t); err != nil {
+				return err
+			}
+
+			ok, container := p.check(elem)
+			if !ok {
+				if !container {
+					return fmt.Errorf("Element %s is not permitted in overrides", elem)
+				}
+				if len(t.Attr) != 0 {
+					return fmt.Errorf("Attributes on element %s are not permitted in overrides", elem)
+				}
+			}
+			stack = append(stack, elem)
+			allowed = append(allowed, ok)
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			allowed = allowed[:len(allowed)-1]
+
+		case xml.CharData:
+			if len(stack) == 0 || strings.TrimSpace(string(t)) == "" {
+				break
+			}
+			elem := stack[len(stack)-1]
+			if !allowed[len(allowed)-1] || stringIn(elem, overrideForbiddenText) {
+				return fmt.Errorf("Text in element %s is not permitted in overrides", elem)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ApplyOverrides merges the override fragments into the
+// domain designed by ApplyVirtMachine, returning the names
+// of those applied. Nothing is applied unless every
+// override is permitted by the policy
+func (d *DomainDesigner) ApplyOverrides(overrides []apiv2.VirtmachineOverride, policy *OverridePolicy) ([]string, error) {
+	for _, override := range overrides {
+		if override.Name == "" {
+			return nil, fmt.Errorf("Override name must not be empty")
+		}
+		if err := policy.validate(override.XML); err != nil {
+			return nil, fmt.Errorf("Override '%s' rejected: %s", override.Name, err)
+		}
+	}
+
+	var applied []string
+	for _, override := range overrides {
+		glog.V(1).Infof("Applying domain override '%s'", override.Name)
+		// Unmarshalling onto the populated domain replaces
+		// only the fields that the fragment sets
+		err := xml.Unmarshal([]byte(override.XML), d.Domain)
+		if err != nil {
+			return nil, fmt.Errorf("Override '%s' could not be applied: %s", override.Name, err)
+		}
+		applied = append(applied, override.Name)
+	}
+
+	return applied, nil
+}
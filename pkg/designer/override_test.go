@@ -0,0 +1,256 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package designer
+
+import (
+	"strings"
+	"testing"
+)
+
+// Allows every area holding something an override must not
+// set, so that only the forbidden lists can reject them
+var testOverridePolicy = NewOverridePolicy([]string{
+	"/domain/os",
+	"/domain/features",
+	"/domain/memoryBacking",
+	"/domain/seclabel",
+	"/domain/devices",
+})
+
+func TestOverrideAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+	}{
+		{
+			name: "feature",
+			xml:  `<domain><features><pmu state="off"/></features></domain>`,
+		},
+		{
+			name: "loader attributes",
+			xml:  `<domain><os><loader secure="yes"/></os></domain>`,
+		},
+		{
+			name: "hugepages",
+			xml:  `<domain><memoryBacking><hugepages/></memoryBacking></domain>`,
+		},
+		{
+			name: "network disk",
+			xml: `<domain><devices><disk type="network" device="disk">` +
+				`<source protocol="nbd" name="export"><host name="10.0.0.1" port="10809"/></source>` +
+				`<target dev="vdb" bus="virtio"/></disk></devices></domain>`,
+		},
+		{
+			name: "egd rng",
+			xml: `<domain><devices><rng model="virtio"><backend model="egd" type="tcp">` +
+				`<source mode="connect" host="10.0.0.1" service="1234"/>` +
+				`</backend></rng></devices></domain>`,
+		},
+		{
+			name: "emulated tpm",
+			xml:  `<domain><devices><tpm model="tpm-crb"><backend type="emulator" version="2.0"/></tpm></devices></domain>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := testOverridePolicy.validate(test.xml); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestOverrideForbidden(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		err  string
+	}{
+		{
+			name: "not allowlisted",
+			xml:  `<domain><clock offset="utc"/></domain>`,
+			err:  "Element /domain/clock is not permitted",
+		},
+		{
+			name: "container attributes",
+			xml:  `<domain type="qemu"><features><pmu state="off"/></features></domain>`,
+			err:  "Attributes on element /domain are not permitted",
+		},
+		{
+			name: "container text",
+			xml:  `<domain>text<features/></domain>`,
+			err:  "Text in element /domain is not permitted",
+		},
+		{
+			name: "not rooted at domain",
+			xml:  `<features><pmu state="off"/></features>`,
+			err:  "must be rooted at <domain>",
+		},
+		{
+			name: "name",
+			xml:  `<domain><name>other</name></domain>`,
+			err:  "Element /domain/name is not permitted",
+		},
+		{
+			name: "seclabel",
+			xml:  `<domain><seclabel type="none"/></domain>`,
+			err:  "Element /domain/seclabel is not permitted",
+		},
+		{
+			name: "emulator",
+			xml:  `<domain><devices><emulator>/bin/sh</emulator></devices></domain>`,
+			err:  "Element /domain/devices/emulator is not permitted",
+		},
+		{
+			name: "hostdev element",
+			xml:  `<domain><devices><hostdev mode="subsystem" type="pci"/></devices></domain>`,
+			err:  "Element /domain/devices/hostdev is not permitted",
+		},
+		{
+			name: "file backed memory",
+			xml:  `<domain><memoryBacking><source type="file"/></memoryBacking></domain>`,
+			err:  "Element /domain/memoryBacking/source is not permitted",
+		},
+		{
+			name: "hostdev interface",
+			xml:  `<domain><devices><interface type="hostdev"/></devices></domain>`,
+			err:  "of type 'hostdev' is not permitted",
+		},
+		{
+			name: "block disk",
+			xml:  `<domain><devices><disk type="block" device="disk"/></devices></domain>`,
+			err:  "of type 'block' is not permitted",
+		},
+		{
+			name: "dir filesystem",
+			xml:  `<domain><devices><filesystem type="dir"/></devices></domain>`,
+			err:  "of type 'dir' is not permitted",
+		},
+		{
+			name: "nvme disk",
+			xml:  `<domain><devices><disk type="nvme" device="disk"/></devices></domain>`,
+			err:  "of type 'nvme' is not permitted",
+		},
+		{
+			name: "passthrough tpm",
+			xml:  `<domain><devices><tpm model="tpm-tis"><backend type="passthrough"/></tpm></devices></domain>`,
+			err:  "of type 'passthrough' is not permitted",
+		},
+		{
+			name: "passthrough input",
+			xml:  `<domain><devices><input type="passthrough" bus="virtio"/></devices></domain>`,
+			err:  "of type 'passthrough' is not permitted",
+		},
+		{
+			name: "source file",
+			xml:  `<domain><devices><disk type="file"><source file="/etc/shadow"/></disk></devices></domain>`,
+			err:  "Host path attribute file",
+		},
+		{
+			name: "source dev",
+			xml:  `<domain><devices><interface type="direct"><source dev="eth0" mode="bridge"/></interface></devices></domain>`,
+			err:  "Host path attribute dev",
+		},
+		{
+			name: "source dir",
+			xml:  `<domain><devices><filesystem type="mount"><source dir="/"/></filesystem></devices></domain>`,
+			err:  "Host path attribute dir",
+		},
+		{
+			name: "source path",
+			xml:  `<domain><devices><serial type="pty"><source path="/dev/ttyS0"/></serial></devices></domain>`,
+			err:  "Host path attribute path",
+		},
+		{
+			name: "source socket",
+			xml:  `<domain><devices><disk type="network"><source protocol="nbd"><host transport="unix" socket="/run/x.sock"/></source></disk></devices></domain>`,
+			err:  "Host path attribute socket on element /domain/devices/disk/source/host",
+		},
+		{
+			name: "input evdev",
+			xml:  `<domain><devices><input type="evdev"><source evdev="/dev/input/event0"/></input></devices></domain>`,
+			err:  "Host path attribute evdev",
+		},
+		{
+			name: "tpm device path",
+			xml:  `<domain><devices><tpm model="tpm-tis"><backend type="emulator"><device path="/dev/tpm0"/></backend></tpm></devices></domain>`,
+			err:  "Host path attribute path on element /domain/devices/tpm/backend/device",
+		},
+		{
+			name: "shmem server path",
+			xml:  `<domain><devices><shmem name="x"><server path="/run/ivshmem.sock"/></shmem></devices></domain>`,
+			err:  "Host path attribute path",
+		},
+		{
+			name: "random rng",
+			xml:  `<domain><devices><rng model="virtio"><backend model="random">/dev/mem</backend></rng></devices></domain>`,
+			err:  "Text in element /domain/devices/rng/backend is not permitted",
+		},
+		{
+			name: "loader path",
+			xml:  `<domain><os><loader readonly="yes" type="pflash">/etc/shadow</loader></os></domain>`,
+			err:  "Text in element /domain/os/loader is not permitted",
+		},
+		{
+			name: "kernel path",
+			xml:  `<domain><os><kernel>/boot/vmlinuz</kernel></os></domain>`,
+			err:  "Text in element /domain/os/kernel is not permitted",
+		},
+		{
+			name: "namespace declaration",
+			xml: `<domain xmlns:qemu="http://libvirt.org/schemas/domain/qemu/1.0">` +
+				`<qemu:commandline><qemu:arg value="-S"/></qemu:commandline></domain>`,
+			err: "Namespaced attribute qemu on element /domain",
+		},
+		{
+			name: "namespaced element",
+			xml:  `<domain><devices><qemu:commandline><qemu:arg value="-S"/></qemu:commandline></devices></domain>`,
+			err:  "Element <commandline> in namespace 'qemu' is not permitted",
+		},
+		{
+			name: "declared namespaced element",
+			xml:  `<domain><devices><x:disk xmlns:x="urn:x"/></devices></domain>`,
+			err:  "Element <disk> in namespace 'urn:x' is not permitted",
+		},
+		{
+			name: "default namespace",
+			xml:  `<domain><features><pmu xmlns="urn:x" state="off"/></features></domain>`,
+			err:  "Element <pmu> in namespace 'urn:x' is not permitted",
+		},
+		{
+			name: "namespaced attribute",
+			xml:  `<domain><features><pmu xmlns:x="urn:x" x:state="off"/></features></domain>`,
+			err:  "Namespaced attribute",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := testOverridePolicy.validate(test.xml)
+			if err == nil {
+				t.Fatalf("Expected error containing '%s'", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error containing '%s', got '%s'", test.err, err)
+			}
+		})
+	}
+}
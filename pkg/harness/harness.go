@@ -0,0 +1,179 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+// Package harness runs the libvirt-kube services against
+// libvirt's test driver and in-memory API clients, so their
+// flows can be driven without a cluster or a real hypervisor.
+//
+// Machines started through the shim must use the "test"
+// hardware type, as that's the only domain type the test
+// driver accepts. The services have no way to be stopped,
+// so their goroutines run until the process exits; use a
+// fresh repopath and shim socket for each harness.
+package harness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	"libvirt.org/libvirt-kube/pkg/api/fake"
+	"libvirt.org/libvirt-kube/pkg/imagerepo"
+	"libvirt.org/libvirt-kube/pkg/nodeinfo"
+	"libvirt.org/libvirt-kube/pkg/vmshim"
+	"libvirt.org/libvirt-kube/pkg/vmshim/rpc"
+)
+
+const TestLibvirtURI = "test:///default"
+
+type Harness struct {
+	LibvirtURI string
+	Kube       kubernetes.Interface
+	API        *fake.Clientset
+}
+
+// New returns a harness whose API clients start out holding
+// the objects
+func New(objects ...api.ResourceObject) (*Harness, error) {
+	apiclientset, err := fake.NewClientset(objects...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Harness{
+		LibvirtURI: TestLibvirtURI,
+		Kube:       kubefake.NewSimpleClientset(),
+		API:        apiclientset,
+	}, nil
+}
+
+func run(name string, fn func() error) {
+	go func() {
+		if err := fn(); err != nil {
+			glog.Errorf("%s exited: %s", name, err)
+		}
+	}()
+}
+
+// StartImageRepo runs the image repo service for reponame,
+// storing files under repopath. The upload/download stream
+// server listens without TLS on streamAddr.
+func (h *Harness) StartImageRepo(reponame, repopath, streamAddr string) (*imagerepo.Service, error) {
+	svc, err := imagerepo.NewServiceWithClients(h.LibvirtURI, streamAddr, "http://"+streamAddr, true, nil,
+		h.Kube, h.API, reponame, repopath)
+	if err != nil {
+		return nil, err
+	}
+
+	run("imagerepo", svc.Run)
+	return svc, nil
+}
+
+// StartNodeInfo runs the node info service reporting nodename
+// into namespace
+func (h *Harness) StartNodeInfo(nodename, namespace string) (*nodeinfo.Service, error) {
+	svc, err := nodeinfo.NewServiceWithClients(h.LibvirtURI, h.Kube, h.API, nodename, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	run("nodeinfo", svc.Run)
+	return svc, nil
+}
+
+// StartShim runs the machine shim listening on the UNIX socket
+// shimAddr. Clients aren't validated, since the harness isn't
+// running inside a pod.
+func (h *Harness) StartShim(shimAddr, imageRepoPath string, overrideAllow []string) (*vmshim.Shim, error) {
+	shim, err := vmshim.NewShimWithClients(shimAddr, true, h.LibvirtURI, imageRepoPath,
+		h.Kube, h.API, overrideAllow)
+	if err != nil {
+		return nil, err
+	}
+
+	run("vmshim", shim.Run)
+	return shim, nil
+}
+
+// Machine is a guest started through the shim, which keeps
+// running for as long as the connection stays open
+type Machine struct {
+	conn *net.UnixConn
+}
+
+// StartMachine asks the shim on shimAddr to start the machine,
+// the same way the in-pod angel does
+func (h *Harness) StartMachine(shimAddr, namespace, name string) (*Machine, error) {
+	conn, err := net.DialTimeout("unix", shimAddr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &rpc.MachineStartInfo{
+		Pod:       name,
+		Machine:   name,
+		Namespace: namespace,
+	}
+	infobuf, err := yaml.Marshal(info)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := conn.Write(infobuf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Machine{conn: conn.(*net.UnixConn)}, nil
+}
+
+// Stop tells the shim to kill the guest and returns the
+// message it replied with
+func (m *Machine) Stop() (string, error) {
+	defer m.conn.Close()
+
+	if err := m.conn.CloseWrite(); err != nil {
+		return "", err
+	}
+
+	resp, err := ioutil.ReadAll(m.conn)
+	if err != nil {
+		return "", err
+	}
+	return string(resp), nil
+}
+
+// WaitFor polls cond until it reports true or the timeout
+// passes
+func (h *Harness) WaitFor(timeout time.Duration, cond func() (bool, error)) error {
+	err := wait.Poll(100*time.Millisecond, timeout, cond)
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("Condition not met within %s", timeout)
+	}
+	return err
+}
@@ -0,0 +1,326 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kubeapiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+const (
+	testNamespace = "default"
+	testTimeout   = 30 * time.Second
+	mebibyte      = 1024 * 1024
+)
+
+// A local address nothing is listening on yet
+func freeAddr(t *testing.T) string {
+	sock, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sock.Close()
+	return sock.Addr().String()
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "libvirt-kube-harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// Repos must have a name no other test uses, since the
+// test driver's pools outlive each harness
+func testRepo(name string) *apiv2.Virtimagerepo {
+	return &apiv2.Virtimagerepo{
+		Metadata: v1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+		},
+		Spec: apiv2.VirtimagerepoSpec{
+			ClaimName:  name,
+			Format:     "raw",
+			JobWorkers: 1,
+		},
+	}
+}
+
+func testFile(capacity uint64) *apiv2.Virtimagefile {
+	return &apiv2.Virtimagefile{
+		Metadata: v1.ObjectMeta{
+			Name:      "disk",
+			Namespace: testNamespace,
+		},
+		Spec: apiv2.VirtimagefileSpec{
+			RepoName:   "repo",
+			AccessMode: apiv2.VirtimagefileReadWriteOnce,
+			Capacity:   capacity,
+			Stream: apiv2.VirtimagefileStream{
+				TokenSecret: "disk-token",
+				AccessMode:  apiv2.VirtimagefileStreamBoth,
+			},
+		},
+	}
+}
+
+func (h *Harness) waitForFile(t *testing.T, name, what string, cond func(file *apiv2.Virtimagefile) bool) {
+	err := h.WaitFor(testTimeout, func() (bool, error) {
+		file, err := h.API.Virtimagefiles(testNamespace).Get(name)
+		if err != nil {
+			return false, nil
+		}
+		return cond(file), nil
+	})
+	if err != nil {
+		t.Fatalf("Waiting for image file %s %s: %s", name, what, err)
+	}
+}
+
+func TestImageFileLifecycle(t *testing.T) {
+	h, err := New(testRepo("repo"), testFile(mebibyte))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = h.Kube.CoreV1().Secrets(testNamespace).Create(&kubeapiv1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "disk-token",
+			Namespace: testNamespace,
+		},
+		Type: "libvirt.org/kube/virtimagefile/stream",
+		Data: map[string][]byte{
+			"token": []byte("secret"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repopath := tempDir(t)
+	defer os.RemoveAll(repopath)
+	addr := freeAddr(t)
+	if _, err := h.StartImageRepo("repo", repopath, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	h.waitForFile(t, "disk", "to be created", func(file *apiv2.Virtimagefile) bool {
+		return file.Status.Phase == apiv2.VirtimagefileAvailable &&
+			file.Status.Capacity == mebibyte
+	})
+
+	// The repo updates the status at the same time
+	err = api.RetryOnConflict(func() error {
+		file, err := h.API.Virtimagefiles(testNamespace).Get("disk")
+		if err != nil {
+			return err
+		}
+		file.Spec.Capacity = 2 * mebibyte
+		_, err = h.API.Virtimagefiles(testNamespace).Update(file)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.waitForFile(t, "disk", "to be resized", func(file *apiv2.Virtimagefile) bool {
+		return file.Status.Capacity == 2*mebibyte
+	})
+
+	streamURL := fmt.Sprintf("http://%s/stream/repo/disk/secret", addr)
+	content := bytes.Repeat([]byte("libvirt-kube"), mebibyte/8)
+	req, err := http.NewRequest(http.MethodPut, streamURL, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Upload failed with status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(streamURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Download failed with status %d", resp.StatusCode)
+	}
+	// The rest of the volume is left as it was
+	if !bytes.Equal(got[:len(content)], content) {
+		t.Errorf("Downloaded content differs from the upload")
+	}
+
+	resp, err = http.Get(fmt.Sprintf("http://%s/stream/repo/disk/wrong", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Download with the wrong token got status %d", resp.StatusCode)
+	}
+
+	if err := h.API.Virtimagefiles(testNamespace).Delete("disk", nil); err != nil {
+		t.Fatal(err)
+	}
+	err = h.WaitFor(testTimeout, func() (bool, error) {
+		_, err := h.API.Virtimagefiles(testNamespace).Get("disk")
+		return errors.IsNotFound(err), nil
+	})
+	if err != nil {
+		t.Fatalf("Waiting for image file to be deleted: %s", err)
+	}
+}
+
+func TestNodeInfoReport(t *testing.T) {
+	h, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.StartNodeInfo("node1", testNamespace); err != nil {
+		t.Fatal(err)
+	}
+
+	var node *apiv2.Virtnode
+	err = h.WaitFor(testTimeout, func() (bool, error) {
+		node, err = h.API.Virtnodes(testNamespace).Get("node1")
+		if err != nil {
+			return false, nil
+		}
+		return node.Status.Phase == apiv2.VirtnodeReady, nil
+	})
+	if err != nil {
+		t.Fatalf("Waiting for node to be reported: %s", err)
+	}
+
+	if node.Spec.Arch == "" {
+		t.Errorf("Node reported no architecture")
+	}
+	if len(node.Spec.Guests) == 0 {
+		t.Errorf("Node reported no guest types")
+	}
+}
+
+func machineCondition(h *Harness, name string) (*apiv2.Virtmachine, *apiv2.Condition) {
+	machine, err := h.API.Virtmachines(testNamespace).Get(name)
+	if err != nil {
+		return nil, nil
+	}
+	return machine, apiv2.GetCondition(machine.Status.Conditions, apiv2.ConditionRunning)
+}
+
+func TestMachineStartStop(t *testing.T) {
+	h, err := New(&apiv2.Virtmachine{
+		Metadata: v1.ObjectMeta{
+			Name:      "vm",
+			Namespace: testNamespace,
+		},
+		Spec: apiv2.VirtmachineSpec{
+			Hardware: apiv2.VirtmachineHardware{
+				// The only domain type the test driver runs
+				Type: "test",
+				Arch: "x86_64",
+				Memory: apiv2.VirtmachineMemory{
+					Initial: 128,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	shimAddr := filepath.Join(dir, "shim.sock")
+	if _, err := h.StartShim(shimAddr, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The shim may not have its libvirt connection yet, in
+	// which case the start fails and is tried again
+	var machine *Machine
+	err = h.WaitFor(testTimeout, func() (bool, error) {
+		if machine == nil {
+			machine, err = h.StartMachine(shimAddr, testNamespace, "vm")
+			if err != nil {
+				return false, nil
+			}
+		}
+		_, cond := machineCondition(h, "vm")
+		if cond == nil {
+			return false, nil
+		}
+		if cond.Status == apiv2.ConditionFalse && cond.Reason == "StartFailed" {
+			machine.Stop()
+			machine = nil
+			return false, nil
+		}
+		return cond.Status == apiv2.ConditionTrue, nil
+	})
+	if err != nil {
+		t.Fatalf("Waiting for machine to run: %s", err)
+	}
+
+	vm, _ := machineCondition(h, "vm")
+	if vm.Status.DomainUUID == "" {
+		t.Errorf("Running machine has no domain UUID")
+	}
+
+	if _, err := machine.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = h.WaitFor(testTimeout, func() (bool, error) {
+		_, cond := machineCondition(h, "vm")
+		return cond != nil && cond.Status == apiv2.ConditionFalse, nil
+	})
+	if err != nil {
+		t.Fatalf("Waiting for machine to stop: %s", err)
+	}
+
+	vm, _ = machineCondition(h, "vm")
+	if vm.Status.StopReason != apiv2.VirtmachineStopDestroyed {
+		t.Errorf("Expected stop reason '%s', got '%s'", apiv2.VirtmachineStopDestroyed, vm.Status.StopReason)
+	}
+}
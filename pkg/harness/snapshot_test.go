@@ -0,0 +1,310 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+func requireQemuImg(t *testing.T) {
+	if _, err := exec.LookPath("qemu-img"); err != nil {
+		t.Skip("qemu-img is not installed")
+	}
+}
+
+func qemuImg(t *testing.T, args ...string) {
+	if out, err := exec.Command("qemu-img", args...).CombinedOutput(); err != nil {
+		t.Fatalf("qemu-img %s failed: %s %s", strings.Join(args, " "), err, out)
+	}
+}
+
+// The test driver doesn't back volumes with files, so images
+// are made where the repo's pool says its volumes are
+func makeVolumeImage(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	qemuImg(t, "create", "-q", "-f", "qcow2", path, "1M")
+}
+
+// Write content at the start of a qcow2 image, as a machine
+// using it would
+func writeImage(t *testing.T, path string, content []byte) {
+	raw := path + ".raw"
+	data := make([]byte, mebibyte)
+	copy(data, content)
+	if err := ioutil.WriteFile(raw, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(raw)
+	qemuImg(t, "convert", "-n", "-f", "raw", "-O", "qcow2", raw, path)
+}
+
+// Whether a qcow2 image, with any backing chain, starts
+// with the content
+func imageHasContent(t *testing.T, path string, content []byte) bool {
+	raw := path + ".raw"
+	qemuImg(t, "convert", "-f", "qcow2", "-O", "raw", path, raw)
+	defer os.Remove(raw)
+	data, err := ioutil.ReadFile(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.HasPrefix(data, content)
+}
+
+func snapshotFile(reponame, name string) *apiv2.Virtimagefile {
+	return &apiv2.Virtimagefile{
+		Metadata: v1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+		},
+		Spec: apiv2.VirtimagefileSpec{
+			RepoName:   reponame,
+			AccessMode: apiv2.VirtimagefileReadWriteOnce,
+			Capacity:   mebibyte,
+			Format:     "qcow2",
+		},
+	}
+}
+
+func testSnapshot(name string, typ apiv2.VirtimagesnapshotType) *apiv2.Virtimagesnapshot {
+	return &apiv2.Virtimagesnapshot{
+		Metadata: v1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+		},
+		Spec: apiv2.VirtimagesnapshotSpec{
+			FileName: "disk",
+			Type:     typ,
+		},
+	}
+}
+
+func (h *Harness) waitForSnapshot(t *testing.T, name, what string, cond func(snapshot *apiv2.Virtimagesnapshot) bool) {
+	err := h.WaitFor(testTimeout, func() (bool, error) {
+		snapshot, err := h.API.Virtimagesnapshots(testNamespace).Get(name)
+		if err != nil {
+			return false, nil
+		}
+		return cond(snapshot), nil
+	})
+	if err != nil {
+		t.Fatalf("Waiting for image snapshot %s %s: %s", name, what, err)
+	}
+}
+
+func (h *Harness) revertFile(t *testing.T, snapshot, id string) {
+	// The repo updates the status at the same time
+	err := api.RetryOnConflict(func() error {
+		file, err := h.API.Virtimagefiles(testNamespace).Get("disk")
+		if err != nil {
+			return err
+		}
+		file.Spec.Revert = &apiv2.VirtimagefileRevert{
+			Snapshot: snapshot,
+			ID:       id,
+		}
+		_, err = h.API.Virtimagefiles(testNamespace).Update(file)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func revertCondition(file *apiv2.Virtimagefile) *apiv2.Condition {
+	return apiv2.GetCondition(file.Status.Conditions, apiv2.ConditionReverted)
+}
+
+// Whether the revert with the ID has been done
+func reverted(file *apiv2.Virtimagefile, id string) bool {
+	cond := revertCondition(file)
+	return file.Status.Revert != nil && file.Status.Revert.ID == id &&
+		cond != nil && cond.Status == apiv2.ConditionTrue
+}
+
+// A machine the repo sees running with the file as a disk
+func runningMachine() *apiv2.Virtmachine {
+	return &apiv2.Virtmachine{
+		Metadata: v1.ObjectMeta{
+			Name:      "vm",
+			Namespace: testNamespace,
+		},
+		Status: apiv2.VirtmachineStatus{
+			Conditions: []apiv2.Condition{
+				{
+					Type:   apiv2.ConditionRunning,
+					Status: apiv2.ConditionTrue,
+				},
+			},
+			Hardware: apiv2.VirtmachineHardware{
+				Devices: apiv2.VirtmachineDeviceList{
+					Disks: []*apiv2.VirtmachineDisk{
+						{
+							Source: &apiv2.VirtmachineStorage{
+								ImageFile: &apiv2.VirtmachineStorageImageFile{
+									FileName: "disk",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestImageSnapshots(t *testing.T) {
+	requireQemuImg(t)
+
+	tests := []struct {
+		reponame string
+		typ      apiv2.VirtimagesnapshotType
+	}{
+		{
+			reponame: "snapint",
+			typ:      apiv2.VirtimagesnapshotInternal,
+		},
+		{
+			reponame: "snapext",
+			typ:      apiv2.VirtimagesnapshotExternal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.typ), func(t *testing.T) {
+			testImageSnapshots(t, test.reponame, test.typ)
+		})
+	}
+}
+
+func testImageSnapshots(t *testing.T, reponame string, typ apiv2.VirtimagesnapshotType) {
+	before := []byte("libvirt-kube before snapshot")
+	after := []byte("libvirt-kube after snapshot!")
+
+	h, err := New(testRepo(reponame), snapshotFile(reponame, "disk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repopath := tempDir(t)
+	defer os.RemoveAll(repopath)
+	diskpath := filepath.Join(repopath, reponame, "disk.qcow2")
+	makeVolumeImage(t, diskpath)
+	writeImage(t, diskpath, before)
+
+	if _, err := h.StartImageRepo(reponame, repopath, freeAddr(t)); err != nil {
+		t.Fatal(err)
+	}
+	h.waitForFile(t, "disk", "to be created", func(file *apiv2.Virtimagefile) bool {
+		return file.Status.Phase == apiv2.VirtimagefileAvailable
+	})
+
+	// Create
+	if _, err := h.API.Virtimagesnapshots(testNamespace).Create(testSnapshot("snap", typ)); err != nil {
+		t.Fatal(err)
+	}
+	h.waitForSnapshot(t, "snap", "to be taken", func(snapshot *apiv2.Virtimagesnapshot) bool {
+		return snapshot.Status.Phase == apiv2.VirtimagesnapshotReady
+	})
+	h.waitForFile(t, "disk", "to list the snapshot", func(file *apiv2.Virtimagefile) bool {
+		return len(file.Status.Snapshots) == 1 && file.Status.Snapshots[0].Name == "snap" &&
+			file.Status.Snapshots[0].Type == typ
+	})
+	if !imageHasContent(t, diskpath, before) {
+		t.Fatalf("Taking the snapshot changed the file's content")
+	}
+
+	// Revert a stopped file
+	writeImage(t, diskpath, after)
+	h.revertFile(t, "snap", "1")
+	h.waitForFile(t, "disk", "to be reverted", func(file *apiv2.Virtimagefile) bool {
+		return reverted(file, "1")
+	})
+	if !imageHasContent(t, diskpath, before) {
+		t.Errorf("Reverted file doesn't have the snapshot's content")
+	}
+
+	// Create a file from the snapshot
+	copypath := filepath.Join(repopath, reponame, "copy.qcow2")
+	makeVolumeImage(t, copypath)
+	copyfile := snapshotFile(reponame, "copy")
+	copyfile.Spec.Source = &apiv2.VirtimagefileSource{
+		Snapshot: &apiv2.VirtimagefileSourceSnapshot{
+			Name: "snap",
+		},
+	}
+	if _, err := h.API.Virtimagefiles(testNamespace).Create(copyfile); err != nil {
+		t.Fatal(err)
+	}
+	h.waitForFile(t, "copy", "to be created from the snapshot", func(file *apiv2.Virtimagefile) bool {
+		return file.Status.Phase == apiv2.VirtimagefileAvailable
+	})
+	if !imageHasContent(t, copypath, before) {
+		t.Errorf("File created from the snapshot doesn't have its content")
+	}
+
+	// Rejected while a machine uses the file, as the disk
+	// can't be snapshotted through the VM shim
+	if _, err := h.API.Virtmachines(testNamespace).Create(runningMachine()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.API.Virtimagesnapshots(testNamespace).Create(testSnapshot("live", typ)); err != nil {
+		t.Fatal(err)
+	}
+	h.waitForSnapshot(t, "live", "to be rejected", func(snapshot *apiv2.Virtimagesnapshot) bool {
+		ready := apiv2.GetCondition(snapshot.Status.Conditions, apiv2.ConditionReady)
+		return snapshot.Status.Phase == apiv2.VirtimagesnapshotFailed &&
+			ready != nil && ready.Reason == "FileInUse"
+	})
+
+	// Reverts wait for the machine to stop
+	writeImage(t, diskpath, after)
+	h.revertFile(t, "snap", "2")
+	h.waitForFile(t, "disk", "to wait for the machine", func(file *apiv2.Virtimagefile) bool {
+		cond := revertCondition(file)
+		return cond != nil && cond.Reason == "WaitingForStop"
+	})
+	if !imageHasContent(t, diskpath, after) {
+		t.Errorf("File was reverted while a machine used it")
+	}
+
+	if err := h.API.Virtmachines(testNamespace).Delete("vm", nil); err != nil {
+		t.Fatal(err)
+	}
+	h.waitForFile(t, "disk", "to be reverted once stopped", func(file *apiv2.Virtimagefile) bool {
+		return reverted(file, "2")
+	})
+	if !imageHasContent(t, diskpath, before) {
+		t.Errorf("Reverted file doesn't have the snapshot's content")
+	}
+}
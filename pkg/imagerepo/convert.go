@@ -0,0 +1,153 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package imagerepo
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+)
+
+// The formats images may be streamed in, with their
+// content types
+var streamFormats = map[string]string{
+	"raw":   "application/octet-stream",
+	"qcow2": "application/x-qemu-disk",
+	"vmdk":  "application/x-vmdk-disk",
+	"vhdx":  "application/x-vhdx-disk",
+}
+
+func isStreamFormat(format string) bool {
+	_, ok := streamFormats[format]
+	return ok
+}
+
+// The content type to send an image in the format as
+func imageContentType(format string) string {
+	if ctype, ok := streamFormats[format]; ok {
+		return ctype
+	}
+	return "application/octet-stream"
+}
+
+// An upload in a format other than that of the volume,
+// which is staged in full and then converted into the
+// volume when closed
+type convertWriter struct {
+	staged    *os.File
+	format    string
+	volpath   string
+	volformat string
+	capacity  uint64
+}
+
+func newConvertWriter(stagedir, format, volpath, volformat string, capacity uint64) (*convertWriter, error) {
+	staged, err := ioutil.TempFile(stagedir, ".convert-")
+	if err != nil {
+		return nil, err
+	}
+	return &convertWriter{
+		staged:    staged,
+		format:    format,
+		volpath:   volpath,
+		volformat: volformat,
+		capacity:  capacity,
+	}, nil
+}
+
+func (w *convertWriter) Write(p []byte) (int, error) {
+	return w.staged.Write(p)
+}
+
+func (w *convertWriter) Close() error {
+	defer os.Remove(w.staged.Name())
+	if err := w.staged.Close(); err != nil {
+		return err
+	}
+
+	// The content came from outside, so is only trusted
+	// once qemu-img agrees with what it claims to be
+	if _, err := checkForeignImage(w.staged.Name(), w.format, w.capacity); err != nil {
+		return fmt.Errorf("Unable to convert uploaded image: %s", err)
+	}
+
+	glog.V(1).Infof("Converting upload to %s from %s to %s", w.volpath, w.format, w.volformat)
+	return convertImage(w.staged.Name(), w.format, w.volpath, w.volformat)
+}
+
+// Abort discards an upload which didn't all arrive, leaving
+// the volume as it was
+func (w *convertWriter) Abort() error {
+	defer os.Remove(w.staged.Name())
+	return w.staged.Close()
+}
+
+// A download in a format other than that of the volume,
+// which is staged in full first since its length must be
+// known before it is sent
+type convertedDownload struct {
+	stagedir  string
+	volpath   string
+	volformat string
+	format    string
+}
+
+// A staged image, removed once it has been sent
+type stagedReader struct {
+	*os.File
+}
+
+func (s *stagedReader) Close() error {
+	defer os.Remove(s.Name())
+	return s.File.Close()
+}
+
+// Convert the volume, giving the image to send and
+// its length
+func (d *convertedDownload) open() (io.ReadCloser, uint64, error) {
+	staged, err := ioutil.TempFile(d.stagedir, ".convert-")
+	if err != nil {
+		return nil, 0, err
+	}
+	name := staged.Name()
+	staged.Close()
+
+	glog.V(1).Infof("Converting download of %s from %s to %s", d.volpath, d.volformat, d.format)
+	if err := exportImage(d.volpath, d.volformat, name, d.format); err != nil {
+		os.Remove(name)
+		return nil, 0, err
+	}
+
+	in, err := os.Open(name)
+	if err != nil {
+		os.Remove(name)
+		return nil, 0, err
+	}
+	st, err := in.Stat()
+	if err != nil {
+		in.Close()
+		os.Remove(name)
+		return nil, 0, err
+	}
+	return &stagedReader{in}, uint64(st.Size()), nil
+}
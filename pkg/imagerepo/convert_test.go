@@ -0,0 +1,465 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package imagerepo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	libvirt "github.com/libvirt/libvirt-go"
+	kubeapiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+const convertCapacity = 1024 * 1024
+
+func runQemuImg(t *testing.T, args ...string) {
+	if out, err := exec.Command("qemu-img", args...).CombinedOutput(); err != nil {
+		t.Fatalf("qemu-img %s failed: %s %s", strings.Join(args, " "), err, out)
+	}
+}
+
+// Create an image in the format holding testContent, as
+// a client would upload it
+func makeContentImage(t *testing.T, dir, format string) string {
+	raw := filepath.Join(dir, "content.raw")
+	data := make([]byte, convertCapacity)
+	copy(data, testContent)
+	if err := ioutil.WriteFile(raw, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if format == "raw" {
+		return raw
+	}
+	path := filepath.Join(dir, "content."+format)
+	runQemuImg(t, "convert", "-f", "raw", "-O", format, raw, path)
+	return path
+}
+
+// Create an empty volume in the format, as the repo would
+func makeVolume(t *testing.T, dir, format string) string {
+	path := filepath.Join(dir, "vol."+format)
+	runQemuImg(t, "create", "-q", "-f", format, path, "1M")
+	return path
+}
+
+// The content of an image, read as raw
+func readImage(t *testing.T, path, format string) []byte {
+	raw := path + ".export"
+	runQemuImg(t, "convert", "-f", format, "-O", "raw", path, raw)
+	defer os.Remove(raw)
+	data, err := ioutil.ReadFile(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Staged conversions must never be left behind
+func checkStagingEmpty(t *testing.T, dir string) {
+	staged, err := filepath.Glob(filepath.Join(dir, ".convert-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 0 {
+		t.Errorf("Staged conversions left behind: %s", strings.Join(staged, ", "))
+	}
+}
+
+func TestConvertWriter(t *testing.T) {
+	requireQemuImg(t)
+
+	for _, volformat := range []string{"raw", "qcow2"} {
+		for _, format := range []string{"raw", "qcow2", "vmdk", "vhdx"} {
+			t.Run(format+" to "+volformat, func(t *testing.T) {
+				dir := tempDir(t)
+				defer os.RemoveAll(dir)
+				image, err := ioutil.ReadFile(makeContentImage(t, dir, format))
+				if err != nil {
+					t.Fatal(err)
+				}
+				volpath := makeVolume(t, dir, volformat)
+
+				w, err := newConvertWriter(dir, format, volpath, volformat, convertCapacity)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write(image); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("Unable to convert: %s", err)
+				}
+
+				if got := readImage(t, volpath, volformat); !bytes.HasPrefix(got, testContent) {
+					t.Errorf("Converted volume content differs from the upload")
+				}
+				checkStagingEmpty(t, dir)
+			})
+		}
+	}
+}
+
+func TestConvertWriterRejects(t *testing.T) {
+	requireQemuImg(t)
+
+	tests := []struct {
+		name   string
+		format string
+		create []string
+		err    string
+	}{
+		{
+			name:   "backing file",
+			format: "qcow2",
+			create: []string{"-f", "qcow2", "-u", "-b", "/etc/passwd", "-F", "raw", "1M"},
+			err:    "must not have a backing file",
+		},
+		{
+			name:   "capacity overflow",
+			format: "qcow2",
+			create: []string{"-f", "qcow2", "2M"},
+			err:    "larger than capacity",
+		},
+		{
+			name:   "vmdk flat extent",
+			format: "vmdk",
+			create: []string{"-f", "vmdk", "-o", "subformat=monolithicFlat", "1M"},
+			err:    "Unsupported vmdk type",
+		},
+		{
+			name:   "raw claimed as qcow2",
+			format: "qcow2",
+			create: []string{"-f", "raw", "1M"},
+			err:    "Unable to convert uploaded image",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			image := makeImage(t, dir, test.create...)
+			volpath := makeVolume(t, dir, "raw")
+			if err := ioutil.WriteFile(volpath, testContent, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := newConvertWriter(dir, test.format, volpath, "raw", convertCapacity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(image); err != nil {
+				t.Fatal(err)
+			}
+			err = w.Close()
+			if err == nil {
+				t.Fatalf("Expected error containing '%s'", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error containing '%s', got '%s'", test.err, err)
+			}
+
+			if got, _ := ioutil.ReadFile(volpath); !bytes.Equal(got, testContent) {
+				t.Errorf("Rejected upload changed the volume")
+			}
+			checkStagingEmpty(t, dir)
+		})
+	}
+}
+
+func TestConvertWriterAbort(t *testing.T) {
+	requireQemuImg(t)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	image, err := ioutil.ReadFile(makeContentImage(t, dir, "qcow2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	volpath := makeVolume(t, dir, "qcow2")
+
+	w, err := newConvertWriter(dir, "qcow2", volpath, "qcow2", convertCapacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(image[:len(image)/2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readImage(t, volpath, "qcow2"); bytes.HasPrefix(got, testContent[:16]) {
+		t.Errorf("Aborted upload was converted into the volume")
+	}
+	checkStagingEmpty(t, dir)
+}
+
+func TestConvertedDownload(t *testing.T) {
+	requireQemuImg(t)
+
+	for _, format := range []string{"raw", "qcow2", "vmdk", "vhdx"} {
+		t.Run(format, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			volpath := makeContentImage(t, dir, "qcow2")
+
+			d := &convertedDownload{
+				stagedir:  dir,
+				volpath:   volpath,
+				volformat: "qcow2",
+				format:    format,
+			}
+			r, length, err := d.open()
+			if err != nil {
+				t.Fatalf("Unable to convert: %s", err)
+			}
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if uint64(len(data)) != length {
+				t.Errorf("Expected %d bytes, got %d", length, len(data))
+			}
+			checkStagingEmpty(t, dir)
+
+			// Must be accepted as an upload again
+			path := filepath.Join(dir, "download."+format)
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := checkForeignImage(path, format, convertCapacity); err != nil {
+				t.Errorf("Downloaded image rejected: %s", err)
+			}
+			if got := readImage(t, path, format); !bytes.HasPrefix(got, testContent) {
+				t.Errorf("Downloaded content differs from the volume")
+			}
+		})
+	}
+}
+
+func newIndexer(objects ...interface{}) cache.Indexer {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, obj := range objects {
+		indexer.Add(obj)
+	}
+	return indexer
+}
+
+// A repo holding the file "disk", which a stream may access
+// with the token "secret". The file's volume is never looked
+// at before the checks made of the stream
+func newConvertTestRepo(t *testing.T, machines ...interface{}) (*Repository, *RepositoryFile) {
+	clientset := kubefake.NewSimpleClientset(&kubeapiv1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "disk-token",
+			Namespace: v1.NamespaceDefault,
+		},
+		Type: streamSecretType,
+		Data: map[string][]byte{
+			"token": []byte("secret"),
+		},
+	})
+
+	file := &apiv2.Virtimagefile{
+		Metadata: v1.ObjectMeta{
+			Name:      "disk",
+			Namespace: v1.NamespaceDefault,
+		},
+		Spec: apiv2.VirtimagefileSpec{
+			RepoName: "repo",
+			Capacity: convertCapacity,
+			Stream: apiv2.VirtimagefileStream{
+				TokenSecret: "disk-token",
+				AccessMode:  apiv2.VirtimagefileStreamBoth,
+			},
+		},
+	}
+
+	repo := CreateRepository(clientset, nil, nil, nil,
+		api.NewVirtimagerepoLister(newIndexer()),
+		api.NewVirtimagefileLister(newIndexer(file)),
+		api.NewVirtimagesnapshotLister(newIndexer()),
+		api.NewVirtmachineLister(newIndexer(machines...)),
+		nil,
+		&apiv2.Virtimagerepo{
+			Metadata: v1.ObjectMeta{
+				Name:      "repo",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: apiv2.VirtimagerepoSpec{
+				Format:     "raw",
+				JobWorkers: 1,
+			},
+		},
+		tempDir(t), "", nil)
+
+	repofile := &RepositoryFile{
+		resource: file,
+		vol:      &libvirt.StorageVol{},
+	}
+	repo.files = map[string]*RepositoryFile{
+		"disk.raw": repofile,
+	}
+	return repo, repofile
+}
+
+func runningMachine() *apiv2.Virtmachine {
+	return &apiv2.Virtmachine{
+		Metadata: v1.ObjectMeta{
+			Name:      "vm",
+			Namespace: v1.NamespaceDefault,
+		},
+		Status: apiv2.VirtmachineStatus{
+			Conditions: []apiv2.Condition{
+				{
+					Type:   apiv2.ConditionRunning,
+					Status: apiv2.ConditionTrue,
+				},
+			},
+			Hardware: apiv2.VirtmachineHardware{
+				Devices: apiv2.VirtmachineDeviceList{
+					Disks: []*apiv2.VirtmachineDisk{
+						{
+							Source: &apiv2.VirtmachineStorage{
+								ImageFile: &apiv2.VirtmachineStorageImageFile{
+									FileName: "disk",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Converted streams are refused before anything reads or
+// writes the file's volume
+func TestConvertedStreamRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		format   string
+		machines []interface{}
+		setup    func(r *Repository, file *RepositoryFile)
+		upload   int
+		download int
+		err      string
+	}{
+		{
+			name:     "wrong token",
+			token:    "wrong",
+			format:   "qcow2",
+			upload:   http.StatusUnauthorized,
+			download: http.StatusUnauthorized,
+			err:      "Access token required",
+		},
+		{
+			name:     "unsupported format",
+			token:    "secret",
+			format:   "vdi",
+			upload:   http.StatusBadRequest,
+			download: http.StatusBadRequest,
+			err:      "Unsupported image format vdi",
+		},
+		{
+			name:     "used by a running machine",
+			token:    "secret",
+			format:   "qcow2",
+			machines: []interface{}{runningMachine()},
+			upload:   http.StatusConflict,
+			download: http.StatusConflict,
+			err:      "used by virtmachine default/vm",
+		},
+		{
+			name:   "being imported",
+			token:  "secret",
+			format: "qcow2",
+			setup: func(r *Repository, file *RepositoryFile) {
+				file.importJob = newTestImport()
+			},
+			upload: http.StatusConflict,
+			err:    "being imported",
+		},
+		{
+			name:   "external snapshots",
+			token:  "secret",
+			format: "qcow2",
+			setup: func(r *Repository, file *RepositoryFile) {
+				r.snapshots["snap"] = &RepositorySnapshot{
+					resource: &apiv2.Virtimagesnapshot{
+						Spec: apiv2.VirtimagesnapshotSpec{
+							FileName: "disk",
+							Type:     apiv2.VirtimagesnapshotExternal,
+						},
+					},
+				}
+			},
+			upload: http.StatusConflict,
+			err:    "external snapshots",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, file := newConvertTestRepo(t, test.machines...)
+			defer os.RemoveAll(filepath.Dir(r.path))
+			if test.setup != nil {
+				test.setup(r, file)
+			}
+
+			_, code, err := r.UploadConvertedVolume("repo", "disk", test.token, test.format)
+			if code != test.upload {
+				t.Errorf("Expected upload status %d, got %d", test.upload, code)
+			}
+			if test.upload != 0 && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Expected upload error containing '%s', got '%v'", test.err, err)
+			}
+
+			if test.download == 0 {
+				return
+			}
+			_, _, code, err = r.DownloadConvertedVolume("repo", "disk", test.token, test.format)
+			if code != test.download {
+				t.Errorf("Expected download status %d, got %d", test.download, code)
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected download error containing '%s', got '%v'", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,691 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package imagerepo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	"github.com/libvirt/libvirt-go"
+	"github.com/ulikunitz/xz"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+	"libvirt.org/libvirt-kube/pkg/libvirtutil"
+	"libvirt.org/libvirt-kube/pkg/registry"
+)
+
+const (
+	// The type of secret holding credentials for a source
+	sourceSecretType = "libvirt.org/kube/virtimagefile/source"
+	// The type of secret holding a file's stream token
+	streamSecretType = "libvirt.org/kube/virtimagefile/stream"
+
+	// Where container images keep the disk image
+	registryDiskDir = "disk"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// Another repo's streamer, to clone a file from
+type clonePeer struct {
+	url         string
+	repo        string
+	file        string
+	namespace   string
+	tokenSecret string
+	tls         *tls.Config
+	// The format the file is held in, which its
+	// content is taken to be rather than probed
+	format string
+}
+
+type RepositoryJobImport struct {
+	// Progress, updated by the worker as it
+	// fetches. Kept first for atomic access
+	transferred uint64
+	total       uint64
+
+	file      *RepositoryFile
+	name      string
+	clientset kubernetes.Interface
+	namespace string
+	source    apiv2.VirtimagefileSource
+	vol       *libvirt.StorageVol
+	format    string
+	capacity  uint64
+	// Where to stage the content before converting it
+	stagedir string
+
+	// Where a clone comes from, either a volume in the
+	// same pool, in the format of its file, or another repo
+	from       *libvirt.StorageVol
+	fromFormat string
+	peer       *clonePeer
+
+	// The snapshot a file is created from, as the image
+	// holding it and, for internal snapshots, its name
+	// in the image. The file it is of stays busy until
+	// the copy is done
+	snapshotPath string
+	snapshotTag  string
+	snapshotFile *RepositoryFile
+
+	// Closed to give up on the import
+	abort   chan struct{}
+	aborted bool
+
+	// output var
+	err error
+}
+
+// Counts bytes as they are read, for reporting progress
+type progressReader struct {
+	in    io.Reader
+	count *uint64
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.in.Read(buf)
+	atomic.AddUint64(p.count, uint64(n))
+	return n, err
+}
+
+// An expected digest of the content of a source
+type digest struct {
+	name string
+	want string
+	hash hash.Hash
+}
+
+func sourceDigests(src *apiv2.VirtimagefileSourceHTTP) []*digest {
+	var digests []*digest
+	if src.SHA256 != "" {
+		digests = append(digests, &digest{"sha256", src.SHA256, sha256.New()})
+	}
+	if src.SHA512 != "" {
+		digests = append(digests, &digest{"sha512", src.SHA512, sha512.New()})
+	}
+	return digests
+}
+
+func verifyDigests(digests []*digest) error {
+	for _, d := range digests {
+		got := hex.EncodeToString(d.hash.Sum(nil))
+		if !strings.EqualFold(got, d.want) {
+			return fmt.Errorf("Content %s digest is %s, expected %s", d.name, got, d.want)
+		}
+	}
+	return nil
+}
+
+// Undo any compression, going by the content rather
+// than trusting the URL to say
+func decompress(in *bufio.Reader) (io.Reader, error) {
+	magic, _ := in.Peek(len(xzMagic))
+	switch {
+	case bytes.HasPrefix(magic, xzMagic):
+		return xz.NewReader(in)
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(in)
+	}
+	return in, nil
+}
+
+// The HTTP client and extra headers to fetch a source
+// with, as given by its secret
+func (j *RepositoryJobImport) httpClient(src *apiv2.VirtimagefileSourceHTTP) (*http.Client, http.Header, error) {
+	headers := http.Header{}
+	tlsConfig := &tls.Config{}
+
+	if src.Secret != "" {
+		sec, err := api.GetSecret(j.clientset, src.Secret, j.namespace, sourceSecretType)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if ca, ok := sec.Data["ca.crt"]; ok {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, nil, fmt.Errorf("No certificates in secret %s field ca.crt", src.Secret)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		if lines, ok := sec.Data["headers"]; ok {
+			// The blank line ends the header block
+			block := append(append([]byte{}, lines...), '\n', '\n')
+			reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(block)))
+			mime, err := reader.ReadMIMEHeader()
+			if err != nil {
+				return nil, nil, fmt.Errorf("Unable to parse secret %s field headers: %s", src.Secret, err)
+			}
+			headers = http.Header(mime)
+		}
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	return client, headers, nil
+}
+
+// Write fetched content to the staging file
+func saveStaged(staged string, content io.Reader) error {
+	out, err := os.Create(staged)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, content)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Download the content of a URL to a local file, undoing
+// any compression and checking its digests
+func (j *RepositoryJobImport) fetchHTTP(src *apiv2.VirtimagefileSourceHTTP, staged string) error {
+	client, headers, err := j.httpClient(src)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, src.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = headers
+	req.Cancel = j.abort
+
+	glog.V(1).Infof("Fetching %s", src.URL)
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to fetch %s: %s", src.URL, res.Status)
+	}
+	if res.ContentLength > 0 {
+		atomic.StoreUint64(&j.total, uint64(res.ContentLength))
+	}
+
+	digests := sourceDigests(src)
+	hashes := make([]io.Writer, len(digests))
+	for i, d := range digests {
+		hashes[i] = d.hash
+	}
+	body := io.TeeReader(&progressReader{res.Body, &j.transferred}, io.MultiWriter(hashes...))
+
+	content, err := decompress(bufio.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Unable to decompress %s: %s", src.URL, err)
+	}
+
+	if err = saveStaged(staged, content); err != nil {
+		return err
+	}
+
+	// The digests cover anything after the end
+	// of the compressed stream too
+	if _, err = io.Copy(ioutil.Discard, body); err != nil {
+		return err
+	}
+
+	return verifyDigests(digests)
+}
+
+// Extract the disk image from a layer, if it has one
+func (j *RepositoryJobImport) extractDisk(client *registry.Client, layer *registry.Descriptor, staged string) (bool, error) {
+	blob, err := client.Blob(layer)
+	if err != nil {
+		return false, err
+	}
+	defer blob.Close()
+
+	atomic.AddUint64(&j.total, uint64(layer.Size))
+	body := &progressReader{blob, &j.transferred}
+	content, err := decompress(bufio.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("Unable to decompress layer %s: %s", layer.Digest, err)
+	}
+
+	found := ""
+	archive := tar.NewReader(content)
+	for {
+		hdr, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, fmt.Errorf("Unable to read layer %s: %s", layer.Digest, err)
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if hdr.Typeflag != tar.TypeReg || path.Dir(name) != registryDiskDir {
+			continue
+		}
+		if found != "" {
+			return false, fmt.Errorf("Layer %s has more than one disk image, %s and %s", layer.Digest, found, name)
+		}
+		found = name
+
+		glog.V(1).Infof("Extracting %s from layer %s", name, layer.Digest)
+		if err = saveStaged(staged, archive); err != nil {
+			return false, err
+		}
+	}
+
+	// The digest is only checked once the
+	// whole blob has been read
+	if _, err = io.Copy(ioutil.Discard, body); err != nil {
+		return false, err
+	}
+
+	return found != "", nil
+}
+
+// Pull a container image, taking the disk image from the
+// topmost layer which has one, so lower layers are only
+// fetched when needed
+func (j *RepositoryJobImport) fetchRegistry(src *apiv2.VirtimagefileSourceRegistry, staged string) error {
+	ref, err := registry.ParseReference(src.Image)
+	if err != nil {
+		return err
+	}
+
+	var creds *registry.Credentials
+	if src.PullSecret != "" {
+		sec, err := j.clientset.CoreV1().Secrets(j.namespace).Get(src.PullSecret, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		creds, err = registry.CredentialsFromSecret(sec, ref.Registry)
+		if err != nil {
+			return err
+		}
+	}
+
+	glog.V(1).Infof("Pulling %s", ref)
+	client := registry.NewClient(ref, creds, src.Insecure, j.abort)
+	layers, err := client.Layers(runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+
+	for i := len(layers) - 1; i >= 0; i-- {
+		found, err := j.extractDisk(client, &layers[i], staged)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+	}
+	return fmt.Errorf("Image %s has no disk image in '%s/'", ref, registryDiskDir)
+}
+
+// Stream a file from another repo, keeping any holes
+func (j *RepositoryJobImport) fetchPeer(peer *clonePeer, staged string) error {
+	token, err := api.GetSecretValue(j.clientset, peer.tokenSecret, peer.namespace, streamSecretType, "token")
+	if err != nil {
+		return err
+	}
+
+	target := fmt.Sprintf("%s/stream/%s/%s/%s", strings.TrimRight(peer.url, "/"), peer.repo, peer.file, token)
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", libvirtutil.SparseContentType)
+	req.Cancel = j.abort
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: peer.tls,
+		},
+	}
+
+	glog.V(1).Infof("Cloning %s from repo %s at %s", peer.file, peer.repo, peer.url)
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to clone %s from repo %s: %s", peer.file, peer.repo, res.Status)
+	}
+	if res.Header.Get("Content-Type") != libvirtutil.SparseContentType {
+		return fmt.Errorf("Repo %s did not stream %s sparsely", peer.repo, peer.file)
+	}
+
+	out, err := os.Create(staged)
+	if err != nil {
+		return err
+	}
+	_, err = libvirtutil.CopySparse(out, &progressReader{res.Body, &j.transferred})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (j *RepositoryJobImport) Process() error {
+	glog.V(1).Infof("Job import %s", j.name)
+
+	j.err = j.process()
+	return j.err
+}
+
+func (j *RepositoryJobImport) process() error {
+	defer j.vol.Free()
+	if j.from != nil {
+		defer j.from.Free()
+	}
+
+	volpath, err := j.vol.GetPath()
+	if err != nil {
+		return err
+	}
+
+	if j.from != nil {
+		// Made by this repo, so nothing to check
+		frompath, err := j.from.GetPath()
+		if err != nil {
+			return err
+		}
+		glog.V(1).Infof("Copying %s from %s", j.name, frompath)
+		return convertImage(frompath, j.fromFormat, volpath, j.format)
+	}
+
+	if j.snapshotPath != "" {
+		glog.V(1).Infof("Copying %s from snapshot in %s", j.name, j.snapshotPath)
+		if j.snapshotTag != "" {
+			return convertSnapshot(j.snapshotPath, j.snapshotTag, volpath, j.format)
+		}
+		return convertImage(j.snapshotPath, "qcow2", volpath, j.format)
+	}
+
+	// Leftovers of an import which was interrupted are
+	// unknown volumes, so deleted when the pool is next
+	// loaded
+	staged := filepath.Join(j.stagedir, ".import-"+j.name)
+	defer os.Remove(staged)
+
+	switch {
+	case j.source.HTTP != nil:
+		err = j.fetchHTTP(j.source.HTTP, staged)
+	case j.source.Registry != nil:
+		err = j.fetchRegistry(j.source.Registry, staged)
+	case j.peer != nil:
+		err = j.fetchPeer(j.peer, staged)
+	default:
+		err = fmt.Errorf("No supported source to import from")
+	}
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-j.abort:
+		return fmt.Errorf("Import was aborted")
+	default:
+	}
+
+	// A clone is in the format its file is held in.
+	// Probing it would let content uploaded to a raw
+	// file pass as another format
+	format := ""
+	if j.peer != nil {
+		format = j.peer.format
+	} else {
+		probed, err := queryImage(staged)
+		if err != nil {
+			return err
+		}
+		format = probed.Format
+	}
+	if _, err := checkForeignImage(staged, format, j.capacity); err != nil {
+		return fmt.Errorf("Unable to import image: %s", err)
+	}
+
+	glog.V(1).Infof("Converting %s from %s to %s", j.name, format, j.format)
+	return convertImage(staged, format, volpath, j.format)
+}
+
+// Abort gives up on an import which is no longer wanted
+func (j *RepositoryJobImport) Abort() {
+	if !j.aborted {
+		close(j.abort)
+		j.aborted = true
+	}
+}
+
+func (j *RepositoryJobImport) updateStatus(file *apiv2.Virtimagefile) {
+	file.Status.Import = &apiv2.VirtimagefileImportStatus{
+		Transferred: atomic.LoadUint64(&j.transferred),
+		Total:       atomic.LoadUint64(&j.total),
+	}
+}
+
+func (j *RepositoryJobImport) Finish(r *Repository) error {
+	glog.V(1).Infof("Finishing import %s", j.name)
+	if j.file.importJob == j {
+		j.file.importJob = nil
+	}
+	if r.files[j.name] != j.file || j.file.deleting {
+		// Deleted meanwhile, which is handled
+		// when deletions are next processed
+		return nil
+	}
+
+	file := j.file.resource
+	j.updateStatus(file)
+	if j.err != nil {
+		apiv2.SetCondition(&file.Status.Conditions, apiv2.ConditionImported, apiv2.ConditionFalse, "ImportFailed", j.err.Error())
+		r.setFilePhase(file, apiv2.VirtimagefileFailed, "ImportFailed", j.err)
+	} else {
+		apiv2.SetCondition(&file.Status.Conditions, apiv2.ConditionImported, apiv2.ConditionTrue, "Imported", "")
+		r.setFilePhase(file, apiv2.VirtimagefileAvailable, "Imported", nil)
+	}
+	r.saveFile(j.file)
+	return nil
+}
+
+// Whether a file still needs its content importing
+func needsImport(file *apiv2.Virtimagefile) bool {
+	if file.Spec.Source == nil {
+		return false
+	}
+	cond := apiv2.GetCondition(file.Status.Conditions, apiv2.ConditionImported)
+	return cond == nil || cond.Status != apiv2.ConditionTrue
+}
+
+// The name of the file a file is cloned from, if any
+func cloneSource(file *apiv2.Virtimagefile) string {
+	if file.Spec.Source == nil || file.Spec.Source.ImageFile == nil {
+		return ""
+	}
+	return file.Spec.Source.ImageFile.Name
+}
+
+// Whether a file is cloned from another in this repo
+func (r *Repository) isLocalClone(file *apiv2.Virtimagefile) bool {
+	name := cloneSource(file)
+	if name == "" {
+		return false
+	}
+	_, src := r.lookupFile(name)
+	return src != nil
+}
+
+// The volume of the file a local clone copies, if it is
+// ready to be copied
+func (r *Repository) localSource(file *apiv2.Virtimagefile) (*libvirt.StorageVol, error) {
+	name := cloneSource(file)
+	_, src := r.lookupFile(name)
+	if src.vol == nil || src.importJob != nil ||
+		src.resource.Status.Phase != apiv2.VirtimagefileAvailable || needsImport(src.resource) {
+		return nil, fmt.Errorf("Source image file %s is not yet available", name)
+	}
+	return src.vol, nil
+}
+
+// Say where the job clones the file from
+func (r *Repository) cloneFrom(job *RepositoryJobImport, file *apiv2.Virtimagefile) error {
+	if r.isLocalClone(file) {
+		// libvirt copies the volume as it creates it,
+		// so this is only reached if that was
+		// interrupted
+		vol, err := r.localSource(file)
+		if err != nil {
+			return err
+		}
+		vol.Ref()
+		job.from = vol
+		_, src := r.lookupFile(cloneSource(file))
+		job.fromFormat = r.fileFormat(src.resource)
+		return nil
+	}
+
+	name := cloneSource(file)
+	src, err := r.filelister.Get(file.Metadata.Namespace, name)
+	if err != nil {
+		return err
+	}
+	// A source being deleted is kept until clones
+	// of it are done, so may still be copied
+	if src.Status.Phase != apiv2.VirtimagefileAvailable || needsImport(src) {
+		return fmt.Errorf("Source image file %s is not yet available", name)
+	}
+
+	repo, err := r.repolister.Get(r.resource.Metadata.Namespace, src.Spec.RepoName)
+	if err != nil {
+		return err
+	}
+	if repo.Status.StreamURL == "" {
+		return fmt.Errorf("Image repo %s does not publish a stream URL", repo.Metadata.Name)
+	}
+
+	job.peer = &clonePeer{
+		url:         repo.Status.StreamURL,
+		repo:        repo.Metadata.Name,
+		file:        name,
+		namespace:   src.Metadata.Namespace,
+		tokenSecret: src.Spec.Stream.TokenSecret,
+		tls:         r.peerTLS,
+		format:      api.ImageFileFormat(src, repo),
+	}
+	return nil
+}
+
+// Hold off copying a file until its source is ready, which
+// is checked again when the repo is next refreshed
+func (r *Repository) waitForSource(file *RepositoryFile, err error) {
+	glog.V(1).Infof("Image file %s waiting for its source: %s", file.resource.Metadata.Name, err)
+	file.waitingSource = true
+	apiv2.SetCondition(&file.resource.Status.Conditions, apiv2.ConditionImported, apiv2.ConditionFalse, "WaitingForSource", err.Error())
+	r.setFilePhase(file.resource, apiv2.VirtimagefilePending, "WaitingForSource", nil)
+}
+
+func (r *Repository) retryWaitingSources() {
+	for name, file := range r.files {
+		if !file.waitingSource || file.deleting {
+			continue
+		}
+		if file.vol == nil {
+			r.createFileVolume(name)
+		} else {
+			r.importFile(name, file)
+			r.saveFile(file)
+		}
+	}
+}
+
+// Queue fetching the content of a file from its source,
+// once its volume exists. The caller saves the file
+func (r *Repository) importFile(name string, file *RepositoryFile) {
+	job := &RepositoryJobImport{
+		file:      file,
+		name:      name,
+		clientset: r.clientset,
+		namespace: file.resource.Metadata.Namespace,
+		source:    *file.resource.Spec.Source,
+		format:    r.fileFormat(file.resource),
+		capacity:  file.resource.Spec.Capacity,
+		stagedir:  r.path,
+		abort:     make(chan struct{}),
+	}
+	if cloneSource(file.resource) != "" {
+		if err := r.cloneFrom(job, file.resource); err != nil {
+			r.waitForSource(file, err)
+			return
+		}
+	}
+	if snapshotSource(file.resource) != "" {
+		if err := r.snapshotFrom(job, file.resource); err != nil {
+			r.waitForSource(file, err)
+			return
+		}
+	}
+	file.waitingSource = false
+
+	file.vol.Ref()
+	job.vol = file.vol
+	file.importJob = job
+
+	file.resource.Status.Import = &apiv2.VirtimagefileImportStatus{}
+	apiv2.SetCondition(&file.resource.Status.Conditions, apiv2.ConditionImported, apiv2.ConditionFalse, "Importing", "")
+	r.setFilePhase(file.resource, apiv2.VirtimagefilePending, "Importing", nil)
+
+	glog.V(1).Infof("Queueing import for %s", name)
+	r.pendingJobs <- job
+}
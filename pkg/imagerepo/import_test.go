@@ -0,0 +1,301 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package imagerepo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+var testContent = bytes.Repeat([]byte("libvirt-kube import\n"), 4096)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func xzed(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func serveContent(data []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+}
+
+func newTestImport() *RepositoryJobImport {
+	return &RepositoryJobImport{
+		abort: make(chan struct{}),
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "libvirt-kube-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// Fetch the source into dir, returning the staged file
+func fetchTest(t *testing.T, dir string, src *apiv2.VirtimagefileSourceHTTP) (string, error) {
+	staged := filepath.Join(dir, "staged")
+	return staged, newTestImport().fetchHTTP(src, staged)
+}
+
+func TestFetchDecompress(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"plain", testContent},
+		{"gzip", gzipped(t, testContent)},
+		{"xz", xzed(t, testContent)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := serveContent(test.data)
+			defer server.Close()
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+
+			// Digests are of the content as downloaded
+			sum := sha256.Sum256(test.data)
+			staged, err := fetchTest(t, dir, &apiv2.VirtimagefileSourceHTTP{
+				URL:    server.URL + "/disk.img",
+				SHA256: hex.EncodeToString(sum[:]),
+			})
+			if err != nil {
+				t.Fatalf("Unable to fetch: %s", err)
+			}
+
+			got, err := ioutil.ReadFile(staged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, testContent) {
+				t.Errorf("Staged content differs after decompressing")
+			}
+		})
+	}
+}
+
+func TestFetchDigestMismatch(t *testing.T) {
+	server := serveContent(testContent)
+	defer server.Close()
+
+	sum256 := sha256.Sum256(testContent)
+	sum512 := sha512.Sum512(testContent)
+	wrong := strings.Repeat("00", sha512.Size)
+	tests := []struct {
+		name string
+		src  apiv2.VirtimagefileSourceHTTP
+		err  string
+	}{
+		{
+			name: "sha256",
+			src: apiv2.VirtimagefileSourceHTTP{
+				SHA256: wrong[:sha256.Size*2],
+				SHA512: hex.EncodeToString(sum512[:]),
+			},
+			err: "sha256 digest",
+		},
+		{
+			name: "sha512",
+			src: apiv2.VirtimagefileSourceHTTP{
+				SHA256: hex.EncodeToString(sum256[:]),
+				SHA512: wrong,
+			},
+			err: "sha512 digest",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+
+			test.src.URL = server.URL
+			_, err := fetchTest(t, dir, &test.src)
+			if err == nil {
+				t.Fatalf("Expected error containing '%s'", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error containing '%s', got '%s'", test.err, err)
+			}
+		})
+	}
+}
+
+func TestFetchNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := fetchTest(t, dir, &apiv2.VirtimagefileSourceHTTP{URL: server.URL}); err == nil {
+		t.Errorf("Expected fetching a missing source to fail")
+	}
+}
+
+func requireQemuImg(t *testing.T) {
+	if _, err := exec.LookPath("qemu-img"); err != nil {
+		t.Skip("qemu-img is not installed")
+	}
+}
+
+// Create an image with qemu-img and return its content. The
+// last option is the size, which follows the path
+func makeImage(t *testing.T, dir string, opts ...string) []byte {
+	path := filepath.Join(dir, "made")
+	size := opts[len(opts)-1]
+	args := append([]string{"create", "-q"}, opts[:len(opts)-1]...)
+	args = append(args, path, size)
+	if out, err := exec.Command("qemu-img", args...).CombinedOutput(); err != nil {
+		t.Fatalf("qemu-img %s failed: %s %s", strings.Join(args, " "), err, out)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Images are fetched, then probed and checked the way an
+// import does before converting them
+func TestImportChecksImage(t *testing.T) {
+	requireQemuImg(t)
+
+	const capacity = 1024 * 1024
+	tests := []struct {
+		name   string
+		create []string
+		err    string
+	}{
+		{
+			name:   "raw",
+			create: []string{"-f", "raw", "1M"},
+		},
+		{
+			name:   "qcow2",
+			create: []string{"-f", "qcow2", "1M"},
+		},
+		{
+			name:   "backing file",
+			create: []string{"-f", "qcow2", "-u", "-b", "/etc/passwd", "-F", "raw", "1M"},
+			err:    "must not have a backing file",
+		},
+		{
+			name:   "capacity overflow",
+			create: []string{"-f", "qcow2", "2M"},
+			err:    "larger than capacity",
+		},
+		{
+			name:   "vmdk flat extent",
+			create: []string{"-f", "vmdk", "-o", "subformat=monolithicFlat", "1M"},
+			err:    "Unsupported vmdk type",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+
+			server := serveContent(gzipped(t, makeImage(t, dir, test.create...)))
+			defer server.Close()
+
+			staged, err := fetchTest(t, dir, &apiv2.VirtimagefileSourceHTTP{URL: server.URL})
+			if err != nil {
+				t.Fatalf("Unable to fetch: %s", err)
+			}
+
+			probed, err := queryImage(staged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = checkForeignImage(staged, probed.Format, capacity)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("Image rejected: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected error containing '%s'", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error containing '%s', got '%s'", test.err, err)
+			}
+		})
+	}
+}
+
+// Raw content must not be taken for another format because
+// the client claimed it was
+func TestCheckImageFormatMismatch(t *testing.T) {
+	requireQemuImg(t)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "disk.raw")
+	if err := ioutil.WriteFile(path, testContent, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := checkForeignImage(path, "qcow2", 1024*1024); err == nil {
+		t.Errorf("Expected raw content to be rejected as qcow2")
+	}
+}
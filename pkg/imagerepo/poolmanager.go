@@ -29,17 +29,24 @@ import (
 	"libvirt.org/libvirt-kube/pkg/libvirtutil"
 )
 
+// PoolEvent reports the outcome of loading the pool,
+// with Pool nil if it failed
+type PoolEvent struct {
+	Pool *libvirt.StoragePool
+	Err  error
+}
+
 type PoolManager struct {
 	Name   string
 	Path   string
-	Notify chan *libvirt.StoragePool
+	Notify chan PoolEvent
 }
 
 func NewPoolManager(name, path string) *PoolManager {
 	return &PoolManager{
 		Name:   name,
 		Path:   path,
-		Notify: make(chan *libvirt.StoragePool),
+		Notify: make(chan PoolEvent),
 	}
 }
 
@@ -83,13 +90,14 @@ func (m *PoolManager) load(conn *libvirt.Connect) {
 			glog.V(1).Infof("Failed to fetch pool %s", err)
 		}
 	} else {
-		active, err := pool.IsActive()
+		var active bool
+		active, err = pool.IsActive()
 		if err != nil {
 			glog.V(1).Infof("Failed to check pool state %s", err)
 			pool.Free()
 			pool = nil
 		} else if !active {
-			err := pool.Create(libvirt.STORAGE_POOL_CREATE_WITH_BUILD)
+			err = pool.Create(libvirt.STORAGE_POOL_CREATE_WITH_BUILD)
 			if err != nil {
 				glog.V(1).Infof("Failed to start pool %s", err)
 				pool.Free()
@@ -102,7 +110,7 @@ func (m *PoolManager) load(conn *libvirt.Connect) {
 
 	// pool may be nil if we had an error
 	glog.V(1).Infof("Notify storage pool %v", pool)
-	m.Notify <- pool
+	m.Notify <- PoolEvent{Pool: pool, Err: err}
 }
 
 func (m *PoolManager) Load(conn *libvirt.Connect) {
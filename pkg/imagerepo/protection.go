@@ -0,0 +1,373 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package imagerepo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+const (
+	// Held on an image file until its volume is deleted
+	fileFinalizer = "libvirt.org/virtimagefile-volume"
+	// Held on an image repo until all its files are deleted
+	repoFinalizer = "libvirt.org/virtimagerepo-files"
+)
+
+func hasFinalizer(meta *v1.ObjectMeta, finalizer string) bool {
+	for _, f := range meta.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(meta *v1.ObjectMeta, finalizer string) {
+	var keep []string
+	for _, f := range meta.Finalizers {
+		if f != finalizer {
+			keep = append(keep, f)
+		}
+	}
+	meta.Finalizers = keep
+}
+
+func isDeleting(meta *v1.ObjectMeta) bool {
+	return meta.DeletionTimestamp != nil
+}
+
+func (r *Repository) ownerReference() v1.OwnerReference {
+	controller := true
+	block := true
+	return v1.OwnerReference{
+		APIVersion:         apiv2.SchemeGroupVersion.String(),
+		Kind:               "Virtimagerepo",
+		Name:               r.resource.Metadata.Name,
+		UID:                r.resource.Metadata.UID,
+		Controller:         &controller,
+		BlockOwnerDeletion: &block,
+	}
+}
+
+func (r *Repository) isOwner(file *apiv2.Virtimagefile) bool {
+	for _, ref := range file.Metadata.OwnerReferences {
+		if ref.UID == r.resource.Metadata.UID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repository) isClaimed(file *apiv2.Virtimagefile) bool {
+	return isDeleting(&file.Metadata) ||
+		(r.isOwner(file) && hasFinalizer(&file.Metadata, fileFinalizer))
+}
+
+// claimFile makes the repo the owner of a file, so the file is
+// garbage collected along with the repo, and adds the finalizer
+// which holds on to the file until its volume is deleted
+func (r *Repository) claimFile(file *apiv2.Virtimagefile) *apiv2.Virtimagefile {
+	if r.isClaimed(file) {
+		return file
+	}
+
+	glog.V(1).Infof("Claiming image file %s", file.Metadata.Name)
+	err := api.RetryOnConflict(func() error {
+		latest, err := r.fileclient.Get(file.Metadata.Name)
+		if err != nil {
+			return err
+		}
+		if r.isClaimed(latest) {
+			file = latest
+			return nil
+		}
+
+		if !r.isOwner(latest) {
+			latest.Metadata.OwnerReferences = append(latest.Metadata.OwnerReferences, r.ownerReference())
+		}
+		if !hasFinalizer(&latest.Metadata, fileFinalizer) {
+			latest.Metadata.Finalizers = append(latest.Metadata.Finalizers, fileFinalizer)
+		}
+
+		obj, err := r.fileclient.Update(latest)
+		if err != nil {
+			return err
+		}
+		file = obj
+		return nil
+	})
+	if err != nil {
+		// The next sync of the file will try again
+		glog.Errorf("Unable to claim image file %s: %s", file.Metadata.Name, err)
+	}
+	return file
+}
+
+// ClaimRepo adds the finalizer which holds on to the repo
+// until all its files are deleted
+func (r *Repository) ClaimRepo() error {
+	if isDeleting(&r.resource.Metadata) || hasFinalizer(&r.resource.Metadata, repoFinalizer) {
+		return nil
+	}
+
+	return api.RetryOnConflict(func() error {
+		latest, err := r.repoclient.Get(r.resource.Metadata.Name)
+		if err != nil {
+			return err
+		}
+		if !isDeleting(&latest.Metadata) && !hasFinalizer(&latest.Metadata, repoFinalizer) {
+			latest.Metadata.Finalizers = append(latest.Metadata.Finalizers, repoFinalizer)
+			latest, err = r.repoclient.Update(latest)
+			if err != nil {
+				return err
+			}
+		}
+		r.setResource(latest)
+		return nil
+	})
+}
+
+// Whether a machine's disk is the file, or is layered on it
+// through backing image files. Files are matched on their repo
+// and namespace as well as their name
+func (r *Repository) diskUsesFile(disk *apiv2.VirtmachineStorageImageFile, file *apiv2.Virtimagefile) bool {
+	name := disk.FileName
+	seen := make(map[string]bool)
+	for name != "" && !seen[name] {
+		seen[name] = true
+		// Machines name files in the namespace the
+		// designer looks them up in
+		other, err := r.filelister.Get(v1.NamespaceDefault, name)
+		if err != nil {
+			// Only the file itself may have gone
+			// from the cache, and then it is safer
+			// to assume it is used
+			return len(seen) == 1 && name == file.Metadata.Name &&
+				file.Metadata.Namespace == v1.NamespaceDefault
+		}
+		if other.Metadata.Name == file.Metadata.Name &&
+			other.Metadata.Namespace == file.Metadata.Namespace &&
+			other.Spec.RepoName == file.Spec.RepoName {
+			return true
+		}
+		name = other.Spec.BackingImageFile
+	}
+	return false
+}
+
+// The running machines with a disk backed by the file
+func (r *Repository) machineUsers(file *apiv2.Virtimagefile) ([]string, error) {
+	machines, err := r.machinelister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var users []string
+	for _, machine := range machines {
+		running := apiv2.GetCondition(machine.Status.Conditions, apiv2.ConditionRunning)
+		if running == nil || running.Status != apiv2.ConditionTrue {
+			continue
+		}
+		for _, disk := range machine.Status.Hardware.Devices.Disks {
+			if disk.Source == nil || disk.Source.ImageFile == nil {
+				continue
+			}
+			if r.diskUsesFile(disk.Source.ImageFile, file) {
+				users = append(users, "virtmachine "+machine.Metadata.Namespace+"/"+machine.Metadata.Name)
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+// The running machines using the file, the files layered on
+// it, and the files in any repo still being cloned from it or
+// its snapshots
+func (r *Repository) fileUsers(file *apiv2.Virtimagefile) ([]string, error) {
+	users, err := r.machineUsers(file)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := r.filelister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range files {
+		if other.Spec.BackingImageFile == file.Metadata.Name &&
+			other.Spec.RepoName == file.Spec.RepoName && !isDeleting(&other.Metadata) {
+			users = append(users, "virtimagefile "+other.Metadata.Namespace+"/"+other.Metadata.Name)
+			continue
+		}
+		if !needsImport(other) || other.Status.Phase == apiv2.VirtimagefileFailed || isDeleting(&other.Metadata) {
+			continue
+		}
+		if cloneSource(other) != file.Metadata.Name {
+			name := snapshotSource(other)
+			if name == "" {
+				continue
+			}
+			snapshot, err := r.snapshotlister.Get(other.Metadata.Namespace, name)
+			if err != nil || snapshot.Spec.FileName != file.Metadata.Name {
+				continue
+			}
+		}
+		users = append(users, "virtimagefile "+other.Metadata.Namespace+"/"+other.Metadata.Name)
+	}
+	return users, nil
+}
+
+// Drop the finalizer of a file whose volume is gone,
+// letting the apiserver finish deleting it
+func (r *Repository) releaseFile(name string, file *RepositoryFile) {
+	err := api.RetryOnConflict(func() error {
+		latest, err := r.fileclient.Get(file.resource.Metadata.Name)
+		if err != nil {
+			return err
+		}
+		if !hasFinalizer(&latest.Metadata, fileFinalizer) {
+			return nil
+		}
+		removeFinalizer(&latest.Metadata, fileFinalizer)
+		_, err = r.fileclient.Update(latest)
+		return err
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		// Retried when deletions are next processed
+		glog.Errorf("Unable to release image file %s: %s", file.resource.Metadata.Name, err)
+		r.recorder.Eventf(file.resource, api.EventWarning, "ReleaseFailed",
+			"Unable to remove finalizer: %s", err)
+		return
+	}
+
+	glog.V(1).Infof("Released image file %s", file.resource.Metadata.Name)
+	delete(r.files, name)
+}
+
+// ProcessDeletions deletes the volumes of files which are being
+// deleted, unless a running machine or a clone still uses them,
+// in which case they are deleted once those finish
+func (r *Repository) ProcessDeletions() {
+	for name, file := range r.files {
+		if !file.deleting || file.deleteQueued {
+			continue
+		}
+
+		if file.importJob != nil {
+			// The volume is deleted once the
+			// import has given up
+			glog.V(1).Infof("Aborting import of %s", name)
+			file.importJob.Abort()
+			continue
+		}
+		if file.snapshotJob != nil {
+			continue
+		}
+
+		users, err := r.fileUsers(file.resource)
+		if err != nil {
+			glog.Errorf("Unable to check users of image file %s: %s", file.resource.Metadata.Name, err)
+			continue
+		}
+		if len(users) != 0 {
+			glog.V(1).Infof("Image file %s in use by %s, deferring delete", file.resource.Metadata.Name, users)
+			inUse := fmt.Errorf("Used by %s", strings.Join(users, ", "))
+			ready := apiv2.GetCondition(file.resource.Status.Conditions, apiv2.ConditionReady)
+			if ready == nil || ready.Reason != "InUse" || ready.Message != inUse.Error() {
+				r.setFilePhase(file.resource, file.resource.Status.Phase, "InUse", inUse)
+				r.saveFile(file)
+			}
+			continue
+		}
+
+		if file.vol == nil {
+			if r.pool == nil || (file.resource.Status.Phase == apiv2.VirtimagefilePending && !file.waitingSource) {
+				// The volume may exist, but we can't
+				// see it yet
+				continue
+			}
+			r.releaseFile(name, file)
+			continue
+		}
+
+		glog.V(1).Infof("Queue delete for %s %v", name, file.vol)
+		r.pendingJobs <- &RepositoryJobDelete{
+			file: file,
+			name: name,
+			vol:  file.vol,
+		}
+		file.vol = nil
+		file.deleteQueued = true
+	}
+
+	r.finalizeRepo()
+}
+
+// Once the repo is being deleted, delete all its files,
+// then drop the finalizer holding on to the repo
+func (r *Repository) finalizeRepo() {
+	if !isDeleting(&r.resource.Metadata) || !hasFinalizer(&r.resource.Metadata, repoFinalizer) {
+		return
+	}
+
+	if len(r.files) != 0 {
+		for _, file := range r.files {
+			if file.deleting {
+				continue
+			}
+			glog.V(1).Infof("Deleting image file %s of deleted repo", file.resource.Metadata.Name)
+			err := r.fileclient.Delete(file.resource.Metadata.Name, nil)
+			if err != nil {
+				glog.Errorf("Unable to delete image file %s: %s", file.resource.Metadata.Name, err)
+				r.recorder.Eventf(r.resource, api.EventWarning, "DeleteFilesFailed",
+					"Unable to delete image file %s: %s", file.resource.Metadata.Name, err)
+			}
+		}
+		return
+	}
+
+	glog.V(1).Infof("All image files deleted, releasing repo")
+	err := api.RetryOnConflict(func() error {
+		latest, err := r.repoclient.Get(r.resource.Metadata.Name)
+		if err != nil {
+			return err
+		}
+		removeFinalizer(&latest.Metadata, repoFinalizer)
+		latest, err = r.repoclient.Update(latest)
+		if err != nil {
+			return err
+		}
+		r.setResource(latest)
+		return nil
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		glog.Errorf("Unable to release image repo %s", err)
+	}
+}
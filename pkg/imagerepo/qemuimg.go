@@ -0,0 +1,203 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package imagerepo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The parts of 'qemu-img info' output we care about
+type qemuImgInfo struct {
+	Format          string `json:"format"`
+	VirtualSize     uint64 `json:"virtual-size"`
+	BackingFilename string `json:"backing-filename"`
+	BackingFormat   string `json:"backing-filename-format"`
+	Snapshots       []struct {
+		Name string `json:"name"`
+	} `json:"snapshots"`
+	FormatSpecific *struct {
+		Data struct {
+			// qcow2
+			DataFile string `json:"data-file"`
+			// vmdk
+			CreateType string `json:"create-type"`
+			Extents    []struct {
+				Filename string `json:"filename"`
+			} `json:"extents"`
+		} `json:"data"`
+	} `json:"format-specific"`
+}
+
+// Whether the image holds an internal snapshot of the name
+func (i *qemuImgInfo) hasSnapshot(name string) bool {
+	for _, snap := range i.Snapshots {
+		if snap.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func qemuImg(args ...string) ([]byte, error) {
+	cmd := exec.Command("qemu-img", args...)
+	out, err := cmd.Output()
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("qemu-img %s failed: %s", args[0], strings.TrimSpace(string(exiterr.Stderr)))
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// Probe the format of an image which came from outside, so
+// it can't be trusted to say what it is
+func queryImage(path string) (*qemuImgInfo, error) {
+	return queryImageFormat(path, "")
+}
+
+// Query an image in the format given, or probe its format
+// if none is
+func queryImageFormat(path, format string) (*qemuImgInfo, error) {
+	args := []string{"info", "--output=json"}
+	if format != "" {
+		args = append(args, "-f", format)
+	}
+	out, err := qemuImg(append(args, path)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var info qemuImgInfo
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("Unable to parse qemu-img info: %s", err)
+	}
+	return &info, nil
+}
+
+// Check an image which came from outside holds nothing but
+// its own content, once its format has been decided. It is
+// queried again as that format, rather than relying on what
+// a probe made of it. A backing file, qcow2 data file or vmdk
+// extent could name any file on the node, which converting
+// the image would copy into a volume the tenant can read
+func checkForeignImage(path, format string, capacity uint64) (*qemuImgInfo, error) {
+	switch format {
+	case "raw", "qcow2", "vmdk", "vhdx":
+		// nada
+	default:
+		return nil, fmt.Errorf("Unsupported image format '%s'", format)
+	}
+
+	info, err := queryImageFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	if info.Format != format {
+		return nil, fmt.Errorf("Image is %s, not %s", info.Format, format)
+	}
+	if info.BackingFilename != "" {
+		return nil, fmt.Errorf("Image must not have a backing file")
+	}
+	if spec := info.FormatSpecific; spec != nil {
+		if spec.Data.DataFile != "" {
+			return nil, fmt.Errorf("Image must not have an external data file")
+		}
+		if format == "vmdk" {
+			// Other types are descriptors naming
+			// their extents as separate files
+			switch spec.Data.CreateType {
+			case "monolithicSparse", "streamOptimized":
+				// nada
+			default:
+				return nil, fmt.Errorf("Unsupported vmdk type '%s'", spec.Data.CreateType)
+			}
+			for _, extent := range spec.Data.Extents {
+				if filepath.Clean(extent.Filename) != filepath.Clean(path) {
+					return nil, fmt.Errorf("Image must not have extents in other files")
+				}
+			}
+		}
+	} else if format == "vmdk" {
+		return nil, fmt.Errorf("Unable to tell the vmdk type")
+	}
+	if info.VirtualSize > capacity {
+		return nil, fmt.Errorf("Image size %d is larger than capacity %d", info.VirtualSize, capacity)
+	}
+	return info, nil
+}
+
+// Copy the content of an image into an existing volume,
+// converting its format. The volume must be at least as
+// large as the image
+func convertImage(src, srcformat, dst, dstformat string) error {
+	_, err := qemuImg("convert", "-n", "-f", srcformat, "-O", dstformat, src, dst)
+	return err
+}
+
+// Copy the content of an internal snapshot of a qcow2
+// image into an existing volume
+func convertSnapshot(src, name, dst, dstformat string) error {
+	_, err := qemuImg("convert", "-n", "-f", "qcow2", "-l", "snapshot.name="+name, "-O", dstformat, src, dst)
+	return err
+}
+
+// Create a qcow2 overlay on top of backing, which need not
+// exist yet if the size is given
+func createOverlay(backing, backingformat, dst string, size uint64) error {
+	args := []string{"create", "-f", "qcow2", "-F", backingformat, "-b", backing}
+	if size != 0 {
+		args = append(args, "-u", dst, fmt.Sprintf("%d", size))
+	} else {
+		args = append(args, dst)
+	}
+	_, err := qemuImg(args...)
+	return err
+}
+
+// Point a qcow2 overlay at a different backing image, or at
+// none, copying whatever data differs so its content stays
+// the same
+func rebaseImage(path, backing, backingformat string) error {
+	args := []string{"rebase", "-f", "qcow2"}
+	if backing != "" {
+		args = append(args, "-F", backingformat)
+	}
+	args = append(args, "-b", backing, path)
+	_, err := qemuImg(args...)
+	return err
+}
+
+// Grow an image to the size given
+func resizeImage(path, format string, size uint64) error {
+	_, err := qemuImg("resize", "-f", format, path, fmt.Sprintf("%d", size))
+	return err
+}
+
+// Write the content of an image out as a new image in the
+// format given, following any backing chain
+func exportImage(src, srcformat, dst, dstformat string) error {
+	_, err := qemuImg("convert", "-f", srcformat, "-O", dstformat, src, dst)
+	return err
+}
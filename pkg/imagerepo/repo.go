@@ -20,18 +20,25 @@
 package imagerepo
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"path"
 	"regexp"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/libvirt/libvirt-go"
 	"github.com/libvirt/libvirt-go-xml"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 
 	"libvirt.org/libvirt-kube/pkg/api"
-	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+	"libvirt.org/libvirt-kube/pkg/libvirtutil"
 )
 
 type RepositoryJobAction string
@@ -47,18 +54,33 @@ type RepositoryJobCreate struct {
 	capacity   uint64
 	format     string
 
-	// output var
+	// A volume in the same pool to copy, if any
+	from *libvirt.StorageVol
+
+	// output vars
 	vol *libvirt.StorageVol
+	err error
 }
 
 type RepositoryJobDelete struct {
-	vol *libvirt.StorageVol
+	// The file being deleted, or nil for
+	// a volume which has no file
+	file *RepositoryFile
+	name string
+	vol  *libvirt.StorageVol
+
+	// output var
+	err error
 }
 
 type RepositoryJobResize struct {
+	file     *RepositoryFile
 	vol      *libvirt.StorageVol
 	size     uint64
 	allocate bool
+
+	// output var
+	err error
 }
 
 type RepositoryJob interface {
@@ -67,17 +89,51 @@ type RepositoryJob interface {
 }
 
 type RepositoryFile struct {
-	resource *apiv1.Virtimagefile
-	vol      *libvirt.StorageVol
+	resource *apiv2.Virtimagefile
+	// The file as the apiserver last gave it, which
+	// changes to the status are patched against
+	saved *apiv2.Virtimagefile
+	vol   *libvirt.StorageVol
+
+	// The file is being deleted, and whether the
+	// volume delete has been queued yet
+	deleting     bool
+	deleteQueued bool
+
+	// The file is to be cloned from one which
+	// isn't ready yet
+	waitingSource bool
+
+	// The import of the file's content, while
+	// it is running
+	importJob *RepositoryJobImport
+
+	// The snapshot job changing the file's volume, while
+	// it is running, and the last revert it was asked
+	// to do
+	snapshotJob *RepositoryJobSnapshot
+	lastRevert  *apiv2.VirtimagefileRevert
 }
 
 type Repository struct {
-	clientset  *kubernetes.Clientset
-	repoclient *api.VirtimagerepoClient
-	fileclient *api.VirtimagefileClient
+	clientset  kubernetes.Interface
+	repoclient api.VirtimagerepoInterface
+	fileclient api.VirtimagefileInterface
+	repolister *api.VirtimagerepoLister
+	filelister *api.VirtimagefileLister
+	recorder   *api.EventRecorder
+	// Machines in any namespace, to find which
+	// files are still in use
+	machinelister *api.VirtmachineLister
+
+	snapshotclient api.VirtimagesnapshotInterface
+	snapshotlister *api.VirtimagesnapshotLister
 
 	// API representation of resource
-	resource *apiv1.Virtimagerepo
+	resource *apiv2.Virtimagerepo
+	// The repo as the apiserver last gave it, which
+	// changes to the status are patched against
+	saved *apiv2.Virtimagerepo
 
 	pendingJobs   chan RepositoryJob
 	completedJobs chan RepositoryJob
@@ -90,6 +146,56 @@ type Repository struct {
 	pool *libvirt.StoragePool
 
 	files map[string]*RepositoryFile
+
+	// Snapshots of the files, by name
+	snapshots map[string]*RepositorySnapshot
+
+	// For cloning files from other repos' streamers
+	peerTLS *tls.Config
+}
+
+// Set the ready condition, posting an event if it changed.
+// Failures are warnings, anything else is normal
+func (r *Repository) setReady(obj runtime.Object, conds *[]apiv2.Condition, status apiv2.ConditionStatus, reason string, err error, normal string) {
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+
+	prev := apiv2.GetCondition(*conds, apiv2.ConditionReady)
+	changed := prev == nil || prev.Status != status || prev.Reason != reason || prev.Message != message
+	apiv2.SetCondition(conds, apiv2.ConditionReady, status, reason, message)
+	if !changed {
+		return
+	}
+
+	if err != nil {
+		r.recorder.Event(obj, api.EventWarning, reason, message)
+	} else {
+		r.recorder.Event(obj, api.EventNormal, reason, normal)
+	}
+}
+
+// Record the phase of a file, along with the reason
+// it is, or is not, ready for use
+func (r *Repository) setFilePhase(file *apiv2.Virtimagefile, phase apiv2.VirtimagefilePhase, reason string, err error) {
+	file.Status.Phase = phase
+	status := apiv2.ConditionFalse
+	if phase == apiv2.VirtimagefileAvailable {
+		status = apiv2.ConditionTrue
+	}
+	r.setReady(file, &file.Status.Conditions, status, reason, err,
+		fmt.Sprintf("Image file is %s in repo %s", phase, r.resource.Metadata.Name))
+}
+
+func (r *Repository) setRepoPhase(repo *apiv2.Virtimagerepo, phase apiv2.VirtimagerepoPhase, reason string, err error) {
+	repo.Status.Phase = phase
+	status := apiv2.ConditionFalse
+	if phase == apiv2.VirtimagerepoReady {
+		status = apiv2.ConditionTrue
+	}
+	r.setReady(repo, &repo.Status.Conditions, status, reason, err,
+		fmt.Sprintf("Image repo is %s", phase))
 }
 
 func escapeFilename(name string) string {
@@ -106,6 +212,27 @@ func makeVolName(path, format string) string {
 	return fmt.Sprintf("%s.%s", base, format)
 }
 
+// The format of the image holding a file
+func (r *Repository) fileFormat(file *apiv2.Virtimagefile) string {
+	return api.ImageFileFormat(file, r.resource)
+}
+
+// The name of the volume holding a file
+func (r *Repository) volName(file *apiv2.Virtimagefile) string {
+	return makeVolName(file.Metadata.Name, r.fileFormat(file))
+}
+
+// Find a file by the name of its resource, along with the
+// name of its volume, which depends on the file's format
+func (r *Repository) lookupFile(name string) (string, *RepositoryFile) {
+	for volname, file := range r.files {
+		if file.resource != nil && file.resource.Metadata.Name == name {
+			return volname, file
+		}
+	}
+	return "", nil
+}
+
 func (j *RepositoryJobCreate) Process() error {
 	glog.V(1).Infof("Job create %s %s %d %d", j.name, j.format, j.capacity, j.allocation)
 
@@ -127,18 +254,29 @@ func (j *RepositoryJobCreate) Process() error {
 		},
 	}
 
+	defer j.pool.Free()
+	if j.from != nil {
+		defer j.from.Free()
+	}
+
 	volXML, err := volCFG.Marshal()
 	if err != nil {
+		j.err = err
 		return err
 	}
 
-	vol, err := j.pool.StorageVolCreateXML(volXML, 0)
+	var vol *libvirt.StorageVol
+	if j.from != nil {
+		vol, err = j.pool.StorageVolCreateXMLFrom(volXML, j.from, 0)
+	} else {
+		vol, err = j.pool.StorageVolCreateXML(volXML, 0)
+	}
 	if err != nil {
+		j.err = err
 		return err
 	}
 
 	j.vol = vol
-	j.pool.Free()
 
 	return nil
 }
@@ -149,11 +287,21 @@ func (j *RepositoryJobCreate) Finish(r *Repository) error {
 		if file == j.file {
 			if file.vol == nil {
 				if j.vol == nil {
-					file.resource.Status.Phase = apiv1.VirtimagefileFailed
+					r.setFilePhase(file.resource, apiv2.VirtimagefileFailed, "CreateFailed", j.err)
 				} else {
-					file.resource.Status.Phase = apiv1.VirtimagefileAvailable
 					file.vol = j.vol
+					if j.from != nil {
+						apiv2.SetCondition(&file.resource.Status.Conditions, apiv2.ConditionImported, apiv2.ConditionTrue, "Cloned", "")
+						r.setFilePhase(file.resource, apiv2.VirtimagefileAvailable, "Cloned", nil)
+					} else if needsImport(file.resource) {
+						r.importFile(j.name, file)
+					} else {
+						r.setFilePhase(file.resource, apiv2.VirtimagefileAvailable, "Created", nil)
+					}
 				}
+				// Files without a volume are skipped when
+				// refreshing, so report the outcome now
+				r.saveFile(file)
 			}
 			return nil
 		}
@@ -172,12 +320,19 @@ func (j *RepositoryJobResize) Process() error {
 	if j.allocate {
 		flags |= libvirt.STORAGE_VOL_RESIZE_ALLOCATE
 	}
-	err := j.vol.Resize(j.size, flags)
+	j.err = j.vol.Resize(j.size, flags)
 	j.vol.Free()
-	return err
+	return j.err
 }
 
 func (j *RepositoryJobResize) Finish(r *Repository) error {
+	if j.err != nil {
+		r.recorder.Eventf(j.file.resource, api.EventWarning, "ResizeFailed",
+			"Unable to resize to %d bytes: %s", j.size, j.err)
+	} else {
+		r.recorder.Eventf(j.file.resource, api.EventNormal, "Resized",
+			"Resized to %d bytes", j.size)
+	}
 	return nil
 }
 
@@ -185,11 +340,33 @@ func (j *RepositoryJobDelete) Process() error {
 	glog.V(1).Infof("Job delete %s", j.vol)
 
 	err := j.vol.Delete(0)
+	if err != nil {
+		// Kept so the delete can be retried
+		j.err = err
+		return err
+	}
 	j.vol.Free()
-	return err
+	return nil
 }
 
 func (j *RepositoryJobDelete) Finish(r *Repository) error {
+	if j.file == nil || r.files[j.name] != j.file {
+		if j.err != nil {
+			j.vol.Free()
+		}
+		return nil
+	}
+
+	if j.err != nil {
+		glog.V(1).Infof("Delete of %s failed, will retry", j.name)
+		j.file.vol = j.vol
+		j.file.deleteQueued = false
+		r.setFilePhase(j.file.resource, apiv2.VirtimagefileFailed, "DeleteFailed", j.err)
+		r.saveFile(j.file)
+		return nil
+	}
+
+	r.releaseFile(j.name, j.file)
 	return nil
 }
 
@@ -211,7 +388,7 @@ func jobWorker(pendingJobs chan RepositoryJob, completedJobs chan RepositoryJob)
 	glog.V(1).Info("Job worker exiting")
 }
 
-func CreateRepository(clientset *kubernetes.Clientset, repoclient *api.VirtimagerepoClient, fileclient *api.VirtimagefileClient, resource *apiv1.Virtimagerepo, repopath string) *Repository {
+func CreateRepository(clientset kubernetes.Interface, repoclient api.VirtimagerepoInterface, fileclient api.VirtimagefileInterface, snapshotclient api.VirtimagesnapshotInterface, repolister *api.VirtimagerepoLister, filelister *api.VirtimagefileLister, snapshotlister *api.VirtimagesnapshotLister, machinelister *api.VirtmachineLister, recorder *api.EventRecorder, resource *apiv2.Virtimagerepo, repopath string, streamURL string, peerTLS *tls.Config) *Repository {
 	pendingJobs := make(chan RepositoryJob, 100)
 	completedJobs := make(chan RepositoryJob, 100)
 
@@ -227,19 +404,32 @@ func CreateRepository(clientset *kubernetes.Clientset, repoclient *api.Virtimage
 
 	fullpath := path.Join(repopath, name)
 
+	saved := api.DeepCopyVirtimagerepo(resource)
+	// Published so other repos can clone our files
+	resource.Status.StreamURL = streamURL
+
 	return &Repository{
-		clientset:     clientset,
-		repoclient:    repoclient,
-		fileclient:    fileclient,
-		resource:      resource,
-		path:          fullpath,
-		poolname:      escapeObjname(name),
-		pendingJobs:   pendingJobs,
-		completedJobs: completedJobs,
+		clientset:      clientset,
+		repoclient:     repoclient,
+		fileclient:     fileclient,
+		snapshotclient: snapshotclient,
+		repolister:     repolister,
+		filelister:     filelister,
+		snapshotlister: snapshotlister,
+		machinelister:  machinelister,
+		recorder:       recorder,
+		resource:       resource,
+		saved:          saved,
+		path:           fullpath,
+		poolname:       escapeObjname(name),
+		pendingJobs:    pendingJobs,
+		completedJobs:  completedJobs,
+		snapshots:      make(map[string]*RepositorySnapshot),
+		peerTLS:        peerTLS,
 	}
 }
 
-func (r *Repository) volRepoMatches(file *apiv1.Virtimagefile) bool {
+func (r *Repository) volRepoMatches(file *apiv2.Virtimagefile) bool {
 	if file.Spec.RepoName != r.resource.Metadata.Name {
 		glog.V(1).Infof("Ignoring vol '%s' for repo '%s'", file.Metadata.Name, file.Spec.RepoName)
 		return false
@@ -248,23 +438,26 @@ func (r *Repository) volRepoMatches(file *apiv1.Virtimagefile) bool {
 }
 
 func (r *Repository) loadFileResources() error {
-	files, err := r.fileclient.List()
+	files, err := r.filelister.List(labels.Everything())
 	if err != nil {
 		return err
 	}
 
 	r.files = make(map[string]*RepositoryFile)
 
-	for _, file := range files.Items {
+	for _, file := range files {
 		if !r.volRepoMatches(file) {
 			continue
 		}
-		name := makeVolName(file.Metadata.Name, r.resource.Spec.Format)
+		file = r.claimFile(api.DeepCopyVirtimagefile(file))
+		name := r.volName(file)
 
 		glog.V(1).Infof("Loaded file resource %s (%s)", file, file.Metadata.Name)
-		r.files[name] = &RepositoryFile{
-			resource: file,
+		fileState := &RepositoryFile{
+			deleting: isDeleting(&file.Metadata),
 		}
+		fileState.setResource(file)
+		r.files[name] = fileState
 	}
 
 	return nil
@@ -272,14 +465,31 @@ func (r *Repository) loadFileResources() error {
 
 func (r *Repository) createFileVolume(name string) {
 	file := r.files[name]
-	file.resource.Status.Phase = apiv1.VirtimagefilePending
+
+	// Files in the same pool are copied by libvirt
+	// as the volume is created
+	var from *libvirt.StorageVol
+	if needsImport(file.resource) && r.isLocalClone(file.resource) {
+		src, err := r.localSource(file.resource)
+		if err != nil {
+			r.waitForSource(file, err)
+			r.saveFile(file)
+			return
+		}
+		src.Ref()
+		from = src
+	}
+	file.waitingSource = false
+
+	r.setFilePhase(file.resource, apiv2.VirtimagefilePending, "Creating", nil)
 	r.pool.Ref()
 	job := &RepositoryJobCreate{
 		file:     file,
 		pool:     r.pool,
+		from:     from,
 		name:     name,
 		capacity: file.resource.Spec.Capacity,
-		format:   r.resource.Spec.Format,
+		format:   r.fileFormat(file.resource),
 	}
 	if r.resource.Spec.Preallocate {
 		job.allocation = job.capacity
@@ -288,12 +498,7 @@ func (r *Repository) createFileVolume(name string) {
 	glog.V(1).Infof("Queueing create for %s", name)
 	r.pendingJobs <- job
 
-	obj, err := r.fileclient.Update(file.resource)
-	if err != nil {
-		glog.V(1).Infof("Unable to update file status %s", err)
-		return
-	}
-	file.resource = obj
+	r.saveFile(file)
 }
 
 func (r *Repository) loadVolumes() error {
@@ -310,29 +515,54 @@ func (r *Repository) loadVolumes() error {
 			continue
 		}
 
+		if name == libvirtutil.ScratchDirName {
+			// Overlays for transient disks are owned by the VM shim
+			vol.Free()
+			continue
+		}
+
 		glog.V(1).Infof("Stash %s %v", name, vol)
 		volNames[name] = &vols[i]
 	}
 
+	// External snapshots of files still known are kept,
+	// even if their snapshot has vanished, since the
+	// file may be an overlay of them
+	for name, vol := range volNames {
+		at := strings.Index(name, "@")
+		if at == -1 {
+			continue
+		}
+		for _, file := range r.files {
+			if escapeObjname(file.resource.Metadata.Name) == name[:at] {
+				glog.V(1).Infof("Keeping snapshot volume %s", name)
+				vol.Free()
+				delete(volNames, name)
+				break
+			}
+		}
+	}
+
 	for _, file := range r.files {
-		name := makeVolName(file.resource.Metadata.Name, r.resource.Spec.Format)
+		name := r.volName(file.resource)
 
 		vol, ok := volNames[name]
 
 		if ok {
 			delete(volNames, name)
 			file.vol = vol
-			file.resource.Status.Phase = apiv1.VirtimagefileAvailable
+			if needsImport(file.resource) {
+				// The import was interrupted, so
+				// start it over
+				r.importFile(name, file)
+			} else {
+				r.setFilePhase(file.resource, apiv2.VirtimagefileAvailable, "Loaded", nil)
+			}
 
 			// XXX might need to resize the vol
 
-			obj, err := r.fileclient.Update(file.resource)
-			if err != nil {
-				glog.V(1).Infof("Unable to update file status %s", err)
-				continue
-			}
-			file.resource = obj
-		} else {
+			r.saveFile(file)
+		} else if !file.deleting {
 			r.createFileVolume(name)
 		}
 	}
@@ -394,31 +624,69 @@ func (r *Repository) refreshSizes() error {
 			glog.Errorf("Unable to refresh vol info %s", err)
 			file.vol.Free()
 			file.vol = nil
-			file.resource.Status.Phase = apiv1.VirtimagefileFailed
+			r.setFilePhase(file.resource, apiv2.VirtimagefileFailed, "RefreshFailed", err)
 		}
-
-		obj, err := r.fileclient.Update(file.resource)
-		if err != nil {
-			glog.Errorf("Unable to update image file info %s", err)
-			// XXX deal with fact it might be been deleted ?
+		if file.importJob != nil {
+			file.importJob.updateStatus(file.resource)
 		}
 
-		file.resource = obj
+		// XXX deal with fact it might be been deleted ?
+		r.saveFile(file)
 	}
 
 	return nil
 }
 
+// Take on the file as the apiserver gave it
+func (f *RepositoryFile) setResource(file *apiv2.Virtimagefile) {
+	f.resource = file
+	f.saved = api.DeepCopyVirtimagefile(file)
+}
+
+// Write the status of a file as a patch against the file as
+// last saved, so only the changes made since are sent and
+// status written by others is left alone. Since only the
+// status is written, and the file already holds it, a
+// failure leaves the file as it was, to be sent again
+func (r *Repository) saveFile(file *RepositoryFile) error {
+	file.resource.Status.Snapshots = r.fileSnapshots(file.resource)
+
+	obj, err := r.fileclient.PatchStatus(file.saved, file.resource)
+	if err != nil {
+		glog.Errorf("Unable to update image file status %s", err)
+		return err
+	}
+
+	// Any spec change is handled when the informer reports
+	// it, so only the status is kept from the result
+	file.saved = api.DeepCopyVirtimagefile(obj)
+	return nil
+}
+
+// Take on the repo as the apiserver gave it
+func (r *Repository) setResource(repo *apiv2.Virtimagerepo) {
+	r.resource = repo
+	r.saved = api.DeepCopyVirtimagerepo(repo)
+}
+
+// Write the status of the repo, as for files
 func (r *Repository) saveRepo() error {
-	obj, err := r.repoclient.Update(r.resource)
+	if latest, err := r.repolister.Get(r.resource.Metadata.Namespace, r.resource.Metadata.Name); err == nil {
+		// Pick up changes made by others, such as
+		// deletion, keeping just our status
+		latest = api.DeepCopyVirtimagerepo(latest)
+		latest.Status = r.resource.Status
+		r.resource = latest
+	}
 
+	obj, err := r.repoclient.PatchStatus(r.saved, r.resource)
 	if err != nil {
 		glog.Errorf("Unable to update image repo info %s", err)
 		return err
 	}
 
 	glog.V(1).Infof("Repo origianalk %s %d", r.resource, r.resource.Metadata.ResourceVersion)
-	r.resource = obj
+	r.setResource(obj)
 
 	glog.V(1).Infof("Repo Result %s %d", obj, obj.Metadata.ResourceVersion)
 	return nil
@@ -440,18 +708,23 @@ func (r *Repository) Refresh() error {
 		return nil
 	}
 
+	r.retryWaitingSources()
+
 	err := r.refreshSizes()
 	if err != nil {
 		glog.V(1).Infof("Failed refreshing sizes %s", err)
-		r.resource.Status.Phase = apiv1.VirtimagerepoFailed
+		r.setRepoPhase(r.resource, apiv2.VirtimagerepoFailed, "RefreshFailed", err)
 	} else {
-		r.resource.Status.Phase = apiv1.VirtimagerepoReady
+		r.setRepoPhase(r.resource, apiv2.VirtimagerepoReady, "PoolActive", nil)
 	}
 
 	if err = r.saveRepo(); err != nil {
 		return err
 	}
 
+	r.ProcessDeletions()
+	r.ProcessSnapshots()
+
 	return nil
 }
 
@@ -463,9 +736,9 @@ func (r *Repository) SetPool(pool *libvirt.StoragePool) error {
 	err := r.loadVolumes()
 	if err != nil {
 		glog.V(1).Infof("Failed loading volumes %s", err)
-		r.resource.Status.Phase = apiv1.VirtimagerepoFailed
+		r.setRepoPhase(r.resource, apiv2.VirtimagerepoFailed, "LoadFailed", err)
 	} else {
-		r.resource.Status.Phase = apiv1.VirtimagerepoReady
+		r.setRepoPhase(r.resource, apiv2.VirtimagerepoReady, "PoolActive", nil)
 	}
 
 	if err := r.saveRepo(); err != nil {
@@ -474,7 +747,22 @@ func (r *Repository) SetPool(pool *libvirt.StoragePool) error {
 	return nil
 }
 
-func (r *Repository) UnsetPool() error {
+// PoolFailed records why the pool backing the repo
+// could not be loaded
+func (r *Repository) PoolFailed(err error) error {
+	r.setRepoPhase(r.resource, apiv2.VirtimagerepoFailed, "PoolFailed", err)
+
+	return r.saveRepo()
+}
+
+// ConnectError reports a failed attempt to connect to libvirt
+func (r *Repository) ConnectError(err error) {
+	r.recorder.Event(r.resource, api.EventWarning, "ConnectFailed", err.Error())
+}
+
+// UnsetPool takes the repo offline after the connection to
+// libvirt closed, for the reason given
+func (r *Repository) UnsetPool(err error) error {
 	glog.V(1).Infof("Unsetting pool %v", r.pool)
 	r.pool.Free()
 	r.pool = nil
@@ -486,7 +774,7 @@ func (r *Repository) UnsetPool() error {
 		}
 	}
 
-	r.resource.Status.Phase = apiv1.VirtimagerepoOffline
+	r.setRepoPhase(r.resource, apiv2.VirtimagerepoOffline, "Disconnected", err)
 
 	if err := r.saveRepo(); err != nil {
 		return err
@@ -494,12 +782,12 @@ func (r *Repository) UnsetPool() error {
 	return nil
 }
 
-func (r *Repository) AddFile(file *apiv1.Virtimagefile) {
+func (r *Repository) AddFile(file *apiv2.Virtimagefile) {
 	if !r.volRepoMatches(file) {
 		return
 	}
 
-	name := makeVolName(file.Metadata.Name, r.resource.Spec.Format)
+	name := r.volName(file)
 
 	_, ok := r.files[name]
 
@@ -507,19 +795,19 @@ func (r *Repository) AddFile(file *apiv1.Virtimagefile) {
 		return
 	}
 
-	r.files[name] = &RepositoryFile{
-		resource: file,
-	}
+	fileState := &RepositoryFile{}
+	fileState.setResource(file)
+	r.files[name] = fileState
 
 	r.createFileVolume(name)
 }
 
-func (r *Repository) ModifyFile(file *apiv1.Virtimagefile) {
+func (r *Repository) ModifyFile(file *apiv2.Virtimagefile) {
 	if !r.volRepoMatches(file) {
 		return
 	}
 
-	name := makeVolName(file.Metadata.Name, r.resource.Spec.Format)
+	name := r.volName(file)
 
 	fileState, ok := r.files[name]
 
@@ -536,6 +824,7 @@ func (r *Repository) ModifyFile(file *apiv1.Virtimagefile) {
 		glog.V(1).Infof("Queue resize for %s %v", name, fileState.vol)
 		fileState.vol.Ref()
 		job := &RepositoryJobResize{
+			file: fileState,
 			vol:  fileState.vol,
 			size: file.Spec.Capacity,
 		}
@@ -546,116 +835,261 @@ func (r *Repository) ModifyFile(file *apiv1.Virtimagefile) {
 	}
 
 	glog.V(1).Infof("Updated image file version %s", file.Metadata.ResourceVersion)
-	fileState.resource = file
+	fileState.setResource(file)
 }
 
-func (r *Repository) DeleteFile(file *apiv1.Virtimagefile) {
+// SyncFile brings the volume for a file up to date with
+// its resource, whether or not the file is already known
+func (r *Repository) SyncFile(file *apiv2.Virtimagefile) {
 	if !r.volRepoMatches(file) {
 		return
 	}
 
-	name := makeVolName(file.Metadata.Name, r.resource.Spec.Format)
-
+	name := r.volName(file)
 	fileState, ok := r.files[name]
 
-	if !ok {
+	if isDeleting(&file.Metadata) {
+		if !ok {
+			fileState = &RepositoryFile{}
+			r.files[name] = fileState
+		}
+		glog.V(1).Infof("Image file %s is being deleted", file.Metadata.Name)
+		fileState.setResource(file)
+		fileState.deleting = true
+		r.ProcessDeletions()
 		return
 	}
 
-	if fileState.vol != nil {
-		glog.V(1).Infof("Queue delete for %s %v", name, fileState.vol)
-		job := &RepositoryJobDelete{
-			vol: fileState.vol,
-		}
-		r.pendingJobs <- job
-		fileState.vol = nil
+	file = r.claimFile(file)
+	if ok {
+		r.ModifyFile(file)
+	} else {
+		r.AddFile(file)
+	}
+	r.ProcessSnapshots()
+}
+
+// DeleteFile handles a file which has vanished without
+// waiting for its finalizer. The volume is still only
+// deleted once no running machine uses it
+func (r *Repository) DeleteFile(filename string) {
+	_, fileState := r.lookupFile(filename)
+
+	if fileState == nil {
+		return
 	}
-	delete(r.files, name)
+
+	fileState.deleting = true
+	r.ProcessDeletions()
 }
 
-func (r *Repository) UploadVolume(stream *libvirt.Stream, length uint64, imagerepo, imagefile, token string) (uint64, int, error) {
+// Find the file a stream request is for, checking the
+// request may access it in the given mode
+func (r *Repository) streamFile(imagerepo, imagefile, token string, mode apiv2.VirtimagefileStreamAccessMode) (*RepositoryFile, int, error) {
 	if imagerepo != r.resource.Metadata.Name {
-		return 0, http.StatusNotFound, fmt.Errorf("Repo %s does not match %s", imagerepo, r.resource.Metadata.Name)
+		return nil, http.StatusNotFound, fmt.Errorf("Repo %s does not match %s", imagerepo, r.resource.Metadata.Name)
 	}
 
-	name := makeVolName(imagefile, r.resource.Spec.Format)
-	file, ok := r.files[name]
-	if !ok {
-		return 0, http.StatusNotFound, fmt.Errorf("No volume %s in repo", imagefile)
+	_, file := r.lookupFile(imagefile)
+	if file == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("No volume %s in repo", imagefile)
+	}
+
+	verb := "uploading"
+	if mode == apiv2.VirtimagefileStreamDownload {
+		verb = "downloading"
 	}
 
-	if file.resource.Spec.Stream.AccessMode != apiv1.VirtimagefileStreamUpload && file.resource.Spec.Stream.AccessMode != apiv1.VirtimagefileStreamBoth {
-		return 0, http.StatusForbidden, fmt.Errorf("Volume does not permit uploading")
+	if file.resource.Spec.Stream.AccessMode != mode && file.resource.Spec.Stream.AccessMode != apiv2.VirtimagefileStreamBoth {
+		return nil, http.StatusForbidden, fmt.Errorf("Volume does not permit %s", verb)
 	}
 
 	if file.resource.Spec.Stream.TokenSecret == "" {
-		return 0, http.StatusForbidden, fmt.Errorf("Volume does not permit uploading")
+		return nil, http.StatusForbidden, fmt.Errorf("Volume does not permit %s", verb)
 	}
 
-	wantToken, err := api.GetSecretValue(r.clientset, file.resource.Spec.Stream.TokenSecret, file.resource.Metadata.Namespace, "libvirt.org/kube/virtimagefile/stream", "token")
+	wantToken, err := api.GetSecretValue(r.clientset, file.resource.Spec.Stream.TokenSecret, file.resource.Metadata.Namespace, streamSecretType, "token")
 	if err != nil {
-		return 0, http.StatusForbidden, fmt.Errorf("Volume does not permit uploading")
+		return nil, http.StatusForbidden, fmt.Errorf("Volume does not permit %s", verb)
 	}
 
 	if len(wantToken) == 0 {
-		return 0, http.StatusForbidden, fmt.Errorf("Access token must be non-zero length")
+		return nil, http.StatusForbidden, fmt.Errorf("Access token must be non-zero length")
 	}
 
 	if string(wantToken) != token {
-		return 0, http.StatusUnauthorized, fmt.Errorf("Access token requird")
+		return nil, http.StatusUnauthorized, fmt.Errorf("Access token required")
 	}
 
 	if file.vol == nil {
-		return 0, http.StatusNotFound, fmt.Errorf("Volume is not yet created")
+		return nil, http.StatusNotFound, fmt.Errorf("Volume is not yet created")
 	}
 
-	info, err := file.vol.GetInfoFlags(libvirt.STORAGE_VOL_GET_PHYSICAL)
+	if file.snapshotJob != nil {
+		return nil, http.StatusConflict, fmt.Errorf("Volume is being snapshotted")
+	}
+
+	return file, 0, nil
+}
+
+// Check an upload of length bytes at the offset fits in the file
+func checkUploadSize(file *RepositoryFile, offset, length uint64) error {
+	capacity := file.resource.Spec.Capacity
+	if offset > capacity || length > capacity-offset {
+		return fmt.Errorf("Upload of %d bytes at offset %d ends at %d, beyond the capacity %d of image file %s",
+			length, offset, offset+length, capacity, file.resource.Metadata.Name)
+	}
+	return nil
+}
+
+// UploadVolume writes length bytes at the offset in the file's
+// volume, leaving the rest of the volume as it was
+func (r *Repository) UploadVolume(stream *libvirt.Stream, imagerepo, imagefile, token string, offset, length uint64) (int, error) {
+	file, status, err := r.streamFile(imagerepo, imagefile, token, apiv2.VirtimagefileStreamUpload)
 	if err != nil {
-		return 0, http.StatusInternalServerError, err
+		return status, err
+	}
+
+	if file.importJob != nil {
+		return http.StatusConflict, fmt.Errorf("Volume content is being imported")
 	}
 
-	err = file.vol.Upload(stream, 0, info.Allocation, 0)
+	// The bytes would replace the overlay, breaking
+	// the chain of snapshots under it
+	if r.hasExternalSnapshots(file.resource) {
+		return http.StatusConflict, fmt.Errorf("Volume has external snapshots, so cannot be uploaded to")
+	}
+
+	if err := checkUploadSize(file, offset, length); err != nil {
+		return http.StatusRequestEntityTooLarge, err
+	}
+
+	// Chunks carry on from what was received, apart
+	// from one at the start, which begins a new upload
+	received := file.resource.Status.UploadOffset
+	if offset > received {
+		return http.StatusConflict, fmt.Errorf("Upload must carry on from offset %d, not %d", received, offset)
+	}
+	if offset == 0 && received != 0 {
+		file.resource.Status.UploadOffset = 0
+		r.saveFile(file)
+	}
+
+	err = file.vol.Upload(stream, offset, length, 0)
 	if err != nil {
-		return 0, http.StatusInternalServerError, err
+		return http.StatusInternalServerError, err
 	}
 
-	return info.Allocation, 0, nil
+	return 0, nil
 }
 
-func (r *Repository) DownloadVolume(stream *libvirt.Stream, imagerepo, imagefile, token string) (uint64, string, int, error) {
-	if imagerepo != r.resource.Metadata.Name {
-		return 0, "", http.StatusNotFound, fmt.Errorf("Repo %s does not match %s", imagerepo, r.resource.Metadata.Name)
+// CommitUpload records that a chunk of an upload has been
+// saved, so the upload carries on from its end
+func (r *Repository) CommitUpload(imagefile string, offset, length uint64) {
+	_, file := r.lookupFile(imagefile)
+	if file == nil || file.deleting {
+		return
 	}
 
-	name := makeVolName(imagefile, r.resource.Spec.Format)
-	file, ok := r.files[name]
-	if !ok {
-		return 0, "", http.StatusNotFound, fmt.Errorf("No volume %s in repo", imagefile)
+	received := file.resource.Status.UploadOffset
+	if offset > received || offset+length <= received {
+		// Sent again, or overtaken by a new upload
+		return
 	}
+	file.resource.Status.UploadOffset = offset + length
+	r.saveFile(file)
+}
 
-	if file.resource.Spec.Stream.AccessMode != apiv1.VirtimagefileStreamDownload && file.resource.Spec.Stream.AccessMode != apiv1.VirtimagefileStreamBoth {
-		return 0, "", http.StatusForbidden, fmt.Errorf("Volume does not permit downloading")
+// UploadOffset says where an upload to the file carries on from
+func (r *Repository) UploadOffset(imagerepo, imagefile, token string) (uint64, int, error) {
+	file, status, err := r.streamFile(imagerepo, imagefile, token, apiv2.VirtimagefileStreamUpload)
+	if err != nil {
+		return 0, status, err
 	}
+	return file.resource.Status.UploadOffset, 0, nil
+}
 
-	if file.resource.Spec.Stream.TokenSecret == "" {
-		return 0, "", http.StatusForbidden, fmt.Errorf("Volume does not permit downloading")
+// FinalizeUpload records the size of the image uploaded to
+// the file, once all of it has been sent
+func (r *Repository) FinalizeUpload(imagerepo, imagefile, token string, size uint64) (int, error) {
+	file, status, err := r.streamFile(imagerepo, imagefile, token, apiv2.VirtimagefileStreamUpload)
+	if err != nil {
+		return status, err
+	}
+
+	if err := checkUploadSize(file, 0, size); err != nil {
+		return http.StatusRequestEntityTooLarge, err
+	}
+
+	if received := file.resource.Status.UploadOffset; received != size {
+		return http.StatusConflict, fmt.Errorf("Upload has %d bytes, not %d", received, size)
 	}
 
-	wantToken, err := api.GetSecretValue(r.clientset, file.resource.Spec.Stream.TokenSecret, file.resource.Metadata.Namespace, "libvirt.org/kube/virtimagefile/stream", "token")
+	glog.V(1).Infof("Upload to %s finished with %d bytes", imagefile, size)
+	file.resource.Status.Length = size
+	file.resource.Status.UploadOffset = 0
+	r.recorder.Eventf(file.resource, api.EventNormal, "Uploaded", "Uploaded %d bytes", size)
+	r.saveFile(file)
+	return 0, nil
+}
+
+// UploadConvertedVolume takes an upload of an image in the
+// format given, which is converted into the file's own
+// format once it has all arrived
+func (r *Repository) UploadConvertedVolume(imagerepo, imagefile, token, format string) (io.WriteCloser, int, error) {
+	file, status, err := r.streamFile(imagerepo, imagefile, token, apiv2.VirtimagefileStreamUpload)
 	if err != nil {
-		return 0, "", http.StatusForbidden, fmt.Errorf("Volume does not permit downloading")
+		return nil, status, err
 	}
 
-	if len(wantToken) == 0 {
-		return 0, "", http.StatusForbidden, fmt.Errorf("Access token must be non-zero length")
+	if !isStreamFormat(format) {
+		return nil, http.StatusBadRequest, fmt.Errorf("Unsupported image format %s", format)
 	}
 
-	if string(wantToken) != token {
-		return 0, "", http.StatusUnauthorized, fmt.Errorf("Access token required")
+	if file.importJob != nil {
+		return nil, http.StatusConflict, fmt.Errorf("Volume content is being imported")
 	}
 
-	if file.vol == nil {
-		return 0, "", http.StatusNotFound, fmt.Errorf("Volume is not yet created")
+	// Converting into the overlay would hide the
+	// content of the snapshots under it
+	if r.hasExternalSnapshots(file.resource) {
+		return nil, http.StatusConflict, fmt.Errorf("Volume has external snapshots, so cannot be uploaded to")
+	}
+
+	// qemu-img would rewrite the image while machines
+	// have it open
+	users, err := r.machineUsers(file.resource)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if len(users) != 0 {
+		return nil, http.StatusConflict, fmt.Errorf("Volume is used by %s, so cannot be converted", strings.Join(users, ", "))
+	}
+
+	volpath, err := file.vol.GetPath()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	w, err := newConvertWriter(r.path, format, volpath, r.fileFormat(file.resource), file.resource.Spec.Capacity)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return w, 0, nil
+}
+
+// DownloadVolume sends the file's volume as it is held, or just
+// the part of it asked for by a range
+func (r *Repository) DownloadVolume(stream *libvirt.Stream, imagerepo, imagefile, token string, sparse bool, rng *VolumeRange) (uint64, string, int, error) {
+	file, status, err := r.streamFile(imagerepo, imagefile, token, apiv2.VirtimagefileStreamDownload)
+	if err != nil {
+		return 0, "", status, err
+	}
+
+	// Only the changes since the last snapshot
+	// would be sent
+	if r.hasExternalSnapshots(file.resource) {
+		return 0, "", http.StatusConflict, fmt.Errorf("Volume has external snapshots, so can only be streamed converted to a format")
 	}
 
 	info, err := file.vol.GetInfoFlags(libvirt.STORAGE_VOL_GET_PHYSICAL)
@@ -666,10 +1100,72 @@ func (r *Repository) DownloadVolume(stream *libvirt.Stream, imagerepo, imagefile
 
 	glog.V(1).Infof("Vol %d %d", info.Allocation, info.Capacity)
 
-	err = file.vol.Download(stream, 0, info.Allocation, 0)
+	offset, length := uint64(0), info.Allocation
+	if rng != nil {
+		volpath, err := file.vol.GetPath()
+		if err != nil {
+			return 0, "", http.StatusInternalServerError, err
+		}
+		st, err := os.Stat(volpath)
+		if err != nil {
+			return 0, "", http.StatusInternalServerError, err
+		}
+		// Any write to the volume changes its
+		// modification time
+		rng.Size = info.Allocation
+		rng.Modified = st.ModTime()
+		rng.ETag = fmt.Sprintf("\"%x-%x\"", st.ModTime().UnixNano(), info.Allocation)
+		if status, err := rng.resolve(); err != nil {
+			return 0, "", status, err
+		}
+		offset, length = rng.Offset, rng.Length
+	}
+
+	var flags libvirt.StorageVolDownloadFlags
+	if sparse {
+		flags = libvirt.STORAGE_VOL_DOWNLOAD_SPARSE_STREAM
+	}
+	err = file.vol.Download(stream, offset, length, flags)
 	if err != nil {
 		return 0, "", http.StatusInternalServerError, err
 	}
 
-	return info.Allocation, fmt.Sprintf("%s.%s", imagefile, r.resource.Spec.Format), 0, nil
+	return length, fmt.Sprintf("%s.%s", imagefile, r.fileFormat(file.resource)), 0, nil
+}
+
+// DownloadConvertedVolume says how to convert a file into the
+// format given for downloading. The conversion follows any
+// external snapshots, so gives the whole content of the file
+func (r *Repository) DownloadConvertedVolume(imagerepo, imagefile, token, format string) (*convertedDownload, string, int, error) {
+	file, status, err := r.streamFile(imagerepo, imagefile, token, apiv2.VirtimagefileStreamDownload)
+	if err != nil {
+		return nil, "", status, err
+	}
+
+	if !isStreamFormat(format) {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("Unsupported image format %s", format)
+	}
+
+	// qemu-img would read the image while machines
+	// write to it
+	users, err := r.machineUsers(file.resource)
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, err
+	}
+	if len(users) != 0 {
+		return nil, "", http.StatusConflict, fmt.Errorf("Volume is used by %s, so cannot be converted", strings.Join(users, ", "))
+	}
+
+	volpath, err := file.vol.GetPath()
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, err
+	}
+
+	download := &convertedDownload{
+		stagedir:  r.path,
+		volpath:   volpath,
+		volformat: r.fileFormat(file.resource),
+		format:    format,
+	}
+	return download, fmt.Sprintf("%s.%s", imagefile, format), 0, nil
 }
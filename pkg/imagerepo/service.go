@@ -24,33 +24,49 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"reflect"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/libvirt/libvirt-go"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	kubeapi "k8s.io/client-go/pkg/api"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/workqueue"
 
 	"libvirt.org/libvirt-kube/pkg/api"
-	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
 	"libvirt.org/libvirt-kube/pkg/libvirtutil"
 )
 
+// How often every file is reconciled, even if unchanged
+const fileResyncPeriod = 5 * time.Minute
+
 type Service struct {
-	poolManager     *PoolManager
-	fileMonitor     watch.Interface
-	imagefileclient *api.VirtimagefileClient
-	volumeStreamer  *VolumeStreamer
-	conn            *libvirt.Connect
-	connNotify      chan libvirtutil.ConnectEvent
-	clientset       *kubernetes.Clientset
-	repo            *Repository
-	uploadOp        chan *UploadVolumeData
-	downloadOp      chan *DownloadVolumeData
+	poolManager *PoolManager
+	informers   *api.InformerFactory
+	fileLister  *api.VirtimagefileLister
+	fileQueue   workqueue.RateLimitingInterface
+	fileKeys    chan string
+	// Snapshots of the files
+	snapshotLister *api.VirtimagesnapshotLister
+	snapshotQueue  workqueue.RateLimitingInterface
+	snapshotKeys   chan string
+	// Machines may be in any namespace
+	machineInformers *api.InformerFactory
+	machineQueue     workqueue.Interface
+	machineKeys      chan string
+	volumeStreamer   *VolumeStreamer
+	conn             *libvirt.Connect
+	connNotify       chan libvirtutil.ConnectEvent
+	clientset        kubernetes.Interface
+	repo             *Repository
+	uploadOp         chan *UploadVolumeData
+	commitOp         chan *UploadVolumeData
+	uploadOffsetOp   chan *UploadOffsetData
+	finalizeOp       chan *FinalizeUploadData
+	downloadOp       chan *DownloadVolumeData
 }
 
 func getKubeConfig(kubeconfig string) (*rest.Config, error) {
@@ -60,7 +76,9 @@ func getKubeConfig(kubeconfig string) (*rest.Config, error) {
 	return rest.InClusterConfig()
 }
 
-func NewService(libvirtURI string, streamAddr string, streamInsecure bool, streamTLSConfig *tls.Config, kubeconfigfile string, reponame string, repopath string) (*Service, error) {
+// NewService creates the service. The streamer listens on
+// streamAddr, and is reached by others at streamURL, if given
+func NewService(libvirtURI string, streamAddr string, streamURL string, streamInsecure bool, streamTLSConfig *tls.Config, kubeconfigfile string, reponame string, repopath string) (*Service, error) {
 	kubeconfig, err := getKubeConfig(kubeconfigfile)
 	if err != nil {
 		return nil, err
@@ -81,39 +99,84 @@ func NewService(libvirtURI string, streamAddr string, streamInsecure bool, strea
 		return nil, err
 	}
 
-	imagerepoclient, err := api.NewVirtimagerepoClient(kubeapi.NamespaceDefault, kubeconfig)
+	err = api.RegisterVirtimagesnapshot(clientset)
 	if err != nil {
 		return nil, err
 	}
 
-	imagefileclient, err := api.NewVirtimagefileClient(kubeapi.NamespaceDefault, kubeconfig)
+	apiclientset, err := api.NewClientset(kubeconfig)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewServiceWithClients(libvirtURI, streamAddr, streamURL, streamInsecure, streamTLSConfig, clientset, apiclientset, reponame, repopath)
+}
+
+// NewServiceWithClients creates the service using the clients given,
+// which may be fakes. The resource definitions must already be
+// registered
+func NewServiceWithClients(libvirtURI string, streamAddr string, streamURL string, streamInsecure bool, streamTLSConfig *tls.Config, clientset kubernetes.Interface, apiclientset api.Interface, reponame string, repopath string) (*Service, error) {
+	imagerepoclient := apiclientset.Virtimagerepos(v1.NamespaceDefault)
+	imagefileclient := apiclientset.Virtimagefiles(v1.NamespaceDefault)
+	snapshotclient := apiclientset.Virtimagesnapshots(v1.NamespaceDefault)
+
 	imagerepo, err := imagerepoclient.Get(reponame)
 	if err != nil {
 		return nil, err
 	}
 
-	fileMonitor, err := imagefileclient.Watch()
-	if err != nil {
-		return nil, err
-	}
+	informers := api.NewInformerFactory(apiclientset, v1.NamespaceDefault, fileResyncPeriod)
+	fileQueue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	informers.VirtimagefileInformer().AddEventHandler(api.QueueEventHandler(fileQueue))
+	fileLister := informers.VirtimagefileLister()
+	snapshotQueue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	informers.VirtimagesnapshotInformer().AddEventHandler(api.QueueEventHandler(snapshotQueue))
+	snapshotLister := informers.VirtimagesnapshotLister()
+
+	machineInformers := api.NewInformerFactory(apiclientset, v1.NamespaceAll, fileResyncPeriod)
+	machineQueue := workqueue.New()
+	machineInformers.VirtmachineInformer().AddEventHandler(api.QueueEventHandler(machineQueue))
 
 	glog.V(1).Infof("Got repo %s", imagerepo)
 
-	repo := CreateRepository(clientset, imagerepoclient, imagefileclient, imagerepo, repopath)
+	recorder := api.NewEventRecorder(clientset, "virtkubeimagerepo")
+
+	// Other repos' streamers are trusted if signed by
+	// the same CA as ours
+	peerTLS := &tls.Config{}
+	if streamTLSConfig != nil {
+		peerTLS.RootCAs = streamTLSConfig.ClientCAs
+	}
+
+	repo := CreateRepository(clientset, imagerepoclient, imagefileclient, snapshotclient, informers.VirtimagerepoLister(), fileLister,
+		snapshotLister, machineInformers.VirtmachineLister(), recorder, imagerepo, repopath, streamURL, peerTLS)
+	if err := repo.ClaimRepo(); err != nil {
+		return nil, err
+	}
 
 	svc := &Service{
-		poolManager:     NewPoolManager(reponame, repopath),
-		fileMonitor:     fileMonitor,
-		imagefileclient: imagefileclient,
-		connNotify:      make(chan libvirtutil.ConnectEvent, 1),
-		clientset:       clientset,
-		repo:            repo,
-		uploadOp:        make(chan *UploadVolumeData, 1),
-		downloadOp:      make(chan *DownloadVolumeData, 1),
+		poolManager: NewPoolManager(reponame, repopath),
+		informers:   informers,
+		fileLister:  fileLister,
+		fileQueue:   fileQueue,
+		fileKeys:    make(chan string),
+
+		snapshotLister: snapshotLister,
+		snapshotQueue:  snapshotQueue,
+		snapshotKeys:   make(chan string),
+
+		machineInformers: machineInformers,
+		machineQueue:     machineQueue,
+		machineKeys:      make(chan string),
+
+		connNotify:     make(chan libvirtutil.ConnectEvent, 1),
+		clientset:      clientset,
+		repo:           repo,
+		uploadOp:       make(chan *UploadVolumeData, 1),
+		commitOp:       make(chan *UploadVolumeData),
+		uploadOffsetOp: make(chan *UploadOffsetData, 1),
+		finalizeOp:     make(chan *FinalizeUploadData, 1),
+		downloadOp:     make(chan *DownloadVolumeData, 1),
 	}
 	svc.volumeStreamer = NewVolumeStreamer(streamAddr, streamInsecure, streamTLSConfig, svc)
 
@@ -131,9 +194,9 @@ func (s *Service) connectReady(conn *libvirt.Connect) {
 	conn.Close()
 }
 
-func (s *Service) connectFailed() {
+func (s *Service) connectFailed(err error) {
 	glog.V(1).Info("Got connection failed event")
-	s.repo.UnsetPool()
+	s.repo.UnsetPool(err)
 	s.repo.Refresh()
 	s.conn.Close()
 	s.conn = nil
@@ -144,19 +207,24 @@ type UploadVolumeData struct {
 	imagerepo string
 	imagefile string
 	token     string
+	format    string
+	offset    uint64
+	length    uint64
 
 	// Output
-	stream *libvirtutil.StreamIO
-	length uint64
+	stream io.WriteCloser
 	status int
 	done   chan error
 }
 
-func (r *Service) UploadVolume(imagerepo, imagefile, token string) (io.WriteCloser, uint64, int, error) {
+func (r *Service) UploadVolume(imagerepo, imagefile, token, format string, offset, length uint64) (io.WriteCloser, int, error) {
 	data := &UploadVolumeData{
 		imagerepo: imagerepo,
 		imagefile: imagefile,
 		token:     token,
+		format:    format,
+		offset:    offset,
+		length:    length,
 		done:      make(chan error, 1),
 	}
 
@@ -168,7 +236,117 @@ func (r *Service) UploadVolume(imagerepo, imagefile, token string) (io.WriteClos
 
 	glog.V(1).Infof("Upload response %d %s", data.status, err)
 
-	return data.stream, data.length, data.status, err
+	if err == nil && format == "" {
+		return &chunkWriter{WriteCloser: data.stream, svc: r, data: data}, data.status, nil
+	}
+	return data.stream, data.status, err
+}
+
+// Tells the main loop once a chunk of an upload is saved
+type chunkWriter struct {
+	io.WriteCloser
+	svc     *Service
+	data    *UploadVolumeData
+	written uint64
+	failed  bool
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.written += uint64(n)
+	if err != nil {
+		w.failed = true
+	}
+	return n, err
+}
+
+func (w *chunkWriter) Close() error {
+	if w.failed {
+		w.WriteCloser.Close()
+		return fmt.Errorf("Upload stream failed after %d bytes", w.written)
+	}
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	w.commit()
+	return nil
+}
+
+// Abort ends a chunk whose body was cut short. Whatever
+// was written is kept, so the upload carries on after it
+func (w *chunkWriter) Abort() error {
+	if w.failed || w.written == 0 {
+		return abortStream(w.WriteCloser)
+	}
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	w.data.length = w.written
+	w.commit()
+	return nil
+}
+
+func (w *chunkWriter) commit() {
+	// Taken by the main loop before any request
+	// which follows this one
+	w.svc.commitOp <- w.data
+}
+
+type UploadOffsetData struct {
+	// Input
+	imagerepo string
+	imagefile string
+	token     string
+
+	// Output
+	offset uint64
+	status int
+	done   chan error
+}
+
+func (r *Service) UploadOffset(imagerepo, imagefile, token string) (uint64, int, error) {
+	data := &UploadOffsetData{
+		imagerepo: imagerepo,
+		imagefile: imagefile,
+		token:     token,
+		done:      make(chan error, 1),
+	}
+
+	r.uploadOffsetOp <- data
+	err := <-data.done
+
+	return data.offset, data.status, err
+}
+
+type FinalizeUploadData struct {
+	// Input
+	imagerepo string
+	imagefile string
+	token     string
+	size      uint64
+
+	// Output
+	status int
+	done   chan error
+}
+
+func (r *Service) FinalizeUpload(imagerepo, imagefile, token string, size uint64) (int, error) {
+	data := &FinalizeUploadData{
+		imagerepo: imagerepo,
+		imagefile: imagefile,
+		token:     token,
+		size:      size,
+		done:      make(chan error, 1),
+	}
+
+	glog.V(1).Infof("Queuing finalize request")
+	r.finalizeOp <- data
+
+	err := <-data.done
+
+	glog.V(1).Infof("Finalize response %d %s", data.status, err)
+
+	return data.status, err
 }
 
 type DownloadVolumeData struct {
@@ -176,20 +354,27 @@ type DownloadVolumeData struct {
 	imagerepo string
 	imagefile string
 	token     string
+	sparse    bool
+	format    string
+	rng       *VolumeRange
 
 	// Output
-	stream   *libvirtutil.StreamIO
+	stream   io.ReadCloser
+	convert  *convertedDownload
 	length   uint64
 	filename string
 	status   int
 	done     chan error
 }
 
-func (r *Service) DownloadVolume(imagerepo, imagefile, token string) (io.ReadCloser, uint64, string, int, error) {
+func (r *Service) DownloadVolume(imagerepo, imagefile, token string, sparse bool, format string, rng *VolumeRange) (io.ReadCloser, uint64, string, int, error) {
 	data := &DownloadVolumeData{
 		imagerepo: imagerepo,
 		imagefile: imagefile,
 		token:     token,
+		sparse:    sparse,
+		format:    format,
+		rng:       rng,
 		done:      make(chan error, 1),
 	}
 
@@ -201,9 +386,92 @@ func (r *Service) DownloadVolume(imagerepo, imagefile, token string) (io.ReadClo
 
 	glog.V(1).Infof("Download response %d %s", data.status, err)
 
+	if err == nil && data.convert != nil {
+		// Converted here rather than in the main
+		// loop, as it may take a while
+		data.stream, data.length, err = data.convert.open()
+		if err != nil {
+			data.status = http.StatusInternalServerError
+		}
+	}
+
 	return data.stream, data.length, data.filename, data.status, err
 }
 
+// Hand keys from a queue to the main loop, which
+// owns the repository state
+func runQueue(queue workqueue.Interface, keys chan<- string) {
+	for {
+		key, quit := queue.Get()
+		if quit {
+			return
+		}
+		keys <- key.(string)
+	}
+}
+
+func (s *Service) syncFile(key string) {
+	defer s.fileQueue.Done(key)
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		glog.Errorf("Invalid file key '%s': %s", key, err)
+		s.fileQueue.Forget(key)
+		return
+	}
+
+	file, err := s.fileLister.Get(namespace, name)
+	if errors.IsNotFound(err) {
+		glog.V(1).Infof("Image file %s deleted", key)
+		s.repo.DeleteFile(name)
+	} else if err != nil {
+		glog.Errorf("Unable to get image file %s: %s", key, err)
+		s.fileQueue.AddRateLimited(key)
+		return
+	} else {
+		glog.V(1).Infof("Image file %s changed", key)
+		s.repo.SyncFile(api.DeepCopyVirtimagefile(file))
+	}
+
+	s.fileQueue.Forget(key)
+}
+
+func (s *Service) syncSnapshot(key string) {
+	defer s.snapshotQueue.Done(key)
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		glog.Errorf("Invalid snapshot key '%s': %s", key, err)
+		s.snapshotQueue.Forget(key)
+		return
+	}
+
+	snapshot, err := s.snapshotLister.Get(namespace, name)
+	if errors.IsNotFound(err) {
+		glog.V(1).Infof("Image snapshot %s deleted", key)
+		s.repo.DeleteSnapshot(name)
+	} else if err != nil {
+		glog.Errorf("Unable to get image snapshot %s: %s", key, err)
+		s.snapshotQueue.AddRateLimited(key)
+		return
+	} else {
+		glog.V(1).Infof("Image snapshot %s changed", key)
+		s.repo.SyncSnapshot(api.DeepCopyVirtimagesnapshot(snapshot))
+	}
+
+	s.snapshotQueue.Forget(key)
+}
+
+// A machine starting or stopping may change which files
+// can be deleted, snapshotted or reverted
+func (s *Service) syncMachine(key string) {
+	defer s.machineQueue.Done(key)
+
+	glog.V(1).Infof("Machine %s changed", key)
+	s.repo.ProcessDeletions()
+	s.repo.ProcessSnapshots()
+}
+
 func (s *Service) Run() error {
 	glog.V(1).Info("Running image repo service")
 
@@ -213,10 +481,32 @@ func (s *Service) Run() error {
 
 	ticker := time.NewTicker(time.Second * 15)
 
+	stop := make(chan struct{})
+	defer close(stop)
+	s.informers.Start(stop)
+	s.machineInformers.Start(stop)
+	if err := s.informers.WaitForCacheSync(stop); err != nil {
+		return err
+	}
+	if err := s.machineInformers.WaitForCacheSync(stop); err != nil {
+		return err
+	}
+
+	defer s.fileQueue.ShutDown()
+	go runQueue(s.fileQueue, s.fileKeys)
+	defer s.snapshotQueue.ShutDown()
+	go runQueue(s.snapshotQueue, s.snapshotKeys)
+	defer s.machineQueue.ShutDown()
+	go runQueue(s.machineQueue, s.machineKeys)
+
 	err := s.repo.loadFileResources()
 	if err != nil {
 		return err
 	}
+	err = s.repo.loadSnapshotResources()
+	if err != nil {
+		return err
+	}
 
 	for {
 		select {
@@ -229,50 +519,33 @@ func (s *Service) Run() error {
 			case libvirtutil.ConnectReady:
 				s.connectReady(hypEvent.Conn)
 			case libvirtutil.ConnectFailed:
-				s.connectFailed()
+				s.connectFailed(hypEvent.Err)
+			case libvirtutil.ConnectError:
+				s.repo.ConnectError(hypEvent.Err)
 			}
-		case pool := <-s.poolManager.Notify:
-			glog.V(1).Infof("Got pool ready %v", pool)
-			if pool != nil {
+		case ev := <-s.poolManager.Notify:
+			glog.V(1).Infof("Got pool ready %v", ev.Pool)
+			if ev.Pool != nil {
 				// Connection might have closed in meanwhile so check
 				if s.conn != nil {
-					err := s.repo.SetPool(pool)
+					err := s.repo.SetPool(ev.Pool)
 					if err == nil {
 						s.repo.Refresh()
 					}
 				}
-				pool.Free()
-			}
-		case objEvent, more := <-s.fileMonitor.ResultChan():
-			if !more {
-				glog.V(1).Infof("Got EOF on file monitor")
-				fileMonitor, err := s.imagefileclient.Watch()
-				if err != nil {
-					return err
-				}
-				s.fileMonitor = fileMonitor
-				continue
-			}
-			if objEvent.Type == watch.Error {
-				glog.V(1).Infof("Got file error %s", objEvent.Object)
-				continue
+				ev.Pool.Free()
+			} else {
+				s.repo.PoolFailed(ev.Err)
 			}
-			glog.V(1).Infof("Object %s %s", objEvent.Type, objEvent.Object)
+		case key := <-s.fileKeys:
+			s.syncFile(key)
+
+		case key := <-s.snapshotKeys:
+			s.syncSnapshot(key)
+
+		case key := <-s.machineKeys:
+			s.syncMachine(key)
 
-			imagefile, ok := objEvent.Object.(*apiv1.Virtimagefile)
-			if !ok {
-				glog.V(1).Infof("Object wasn't virtimagefile %s", objEvent.Object, reflect.TypeOf(objEvent.Object))
-				continue
-			}
-			glog.V(1).Infof("Object %s %s", objEvent.Type, imagefile.Metadata.Name)
-			switch objEvent.Type {
-			case watch.Added:
-				s.repo.AddFile(imagefile)
-			case watch.Modified:
-				s.repo.ModifyFile(imagefile)
-			case watch.Deleted:
-				s.repo.DeleteFile(imagefile)
-			}
 		case <-ticker.C:
 			glog.V(1).Info("Updating repo")
 			s.repo.Refresh()
@@ -283,18 +556,38 @@ func (s *Service) Run() error {
 				data.done <- fmt.Errorf("Not currently connected to libvirtd")
 				continue
 			}
+			if data.format != "" {
+				stream, status, err := s.repo.UploadConvertedVolume(data.imagerepo, data.imagefile, data.token, data.format)
+				data.stream = stream
+				data.status = status
+				data.done <- err
+				continue
+			}
 			stream, err := s.conn.NewStream(0)
 			if err != nil {
 				data.done <- err
 				continue
 			}
-			length, status, err := s.repo.UploadVolume(stream, data.length, data.imagerepo, data.imagefile, data.token)
+			status, err := s.repo.UploadVolume(stream, data.imagerepo, data.imagefile, data.token, data.offset, data.length)
 			if err != nil {
 				stream.Free()
 			} else {
 				data.stream = libvirtutil.NewStreamIO(stream)
 			}
-			data.length = length
+			data.status = status
+			data.done <- err
+
+		case data := <-s.commitOp:
+			s.repo.CommitUpload(data.imagefile, data.offset, data.length)
+
+		case data := <-s.uploadOffsetOp:
+			offset, status, err := s.repo.UploadOffset(data.imagerepo, data.imagefile, data.token)
+			data.offset = offset
+			data.status = status
+			data.done <- err
+
+		case data := <-s.finalizeOp:
+			status, err := s.repo.FinalizeUpload(data.imagerepo, data.imagefile, data.token, data.size)
 			data.status = status
 			data.done <- err
 
@@ -304,15 +597,25 @@ func (s *Service) Run() error {
 				data.done <- fmt.Errorf("Not currently connected to libvirtd")
 				continue
 			}
+			if data.format != "" {
+				convert, filename, status, err := s.repo.DownloadConvertedVolume(data.imagerepo, data.imagefile, data.token, data.format)
+				data.convert = convert
+				data.filename = filename
+				data.status = status
+				data.done <- err
+				continue
+			}
 			stream, err := s.conn.NewStream(0)
 			if err != nil {
 				data.done <- err
 				continue
 			}
-			length, filename, status, err := s.repo.DownloadVolume(stream, data.imagerepo, data.imagefile, data.token)
+			length, filename, status, err := s.repo.DownloadVolume(stream, data.imagerepo, data.imagefile, data.token, data.sparse, data.rng)
 			glog.V(1).Infof("Send response %d, %s", status, err)
 			if err != nil {
 				stream.Free()
+			} else if data.sparse {
+				data.stream = libvirtutil.NewSparseStreamReader(stream)
 			} else {
 				data.stream = libvirtutil.NewStreamIO(stream)
 			}
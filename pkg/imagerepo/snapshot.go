@@ -0,0 +1,925 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package imagerepo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// Held on a snapshot until its content is deleted
+const snapshotFinalizer = "libvirt.org/virtimagesnapshot-content"
+
+type RepositorySnapshot struct {
+	resource *apiv2.Virtimagesnapshot
+	// The snapshot as the apiserver last gave it, which
+	// changes to the status are patched against
+	saved *apiv2.Virtimagesnapshot
+
+	// The snapshot is being deleted
+	deleting bool
+
+	// The job taking or deleting the snapshot,
+	// while it is running
+	job *RepositoryJobSnapshot
+}
+
+type snapshotOp string
+
+const (
+	snapshotCreate snapshotOp = "create"
+	snapshotDelete snapshotOp = "delete"
+	snapshotRevert snapshotOp = "revert"
+)
+
+type RepositoryJobSnapshot struct {
+	op       snapshotOp
+	name     string
+	file     *RepositoryFile
+	snapshot *RepositorySnapshot
+	typ      apiv2.VirtimagesnapshotType
+
+	// The file's volume, which is empty if it is
+	// gone, and the volume holding an external
+	// snapshot
+	volpath  string
+	snappath string
+	// The name of an internal snapshot in the image
+	tag string
+	// Other images which may be overlays of an
+	// external snapshot being deleted
+	chain []string
+
+	// The revert being done, and the capacity to
+	// grow the file back to afterwards
+	revert   apiv2.VirtimagefileRevert
+	capacity uint64
+
+	// output vars
+	size uint64
+	err  error
+}
+
+// The volume holding the content of an external snapshot
+func makeSnapshotVolName(filename, snapshotname, format string) string {
+	return fmt.Sprintf("%s@%s.%s", escapeObjname(filename), escapeObjname(snapshotname), format)
+}
+
+// Internal snapshots are named by UID, so a snapshot
+// deleted and created again can't be mistaken for
+// the old one
+func snapshotTag(snapshot *apiv2.Virtimagesnapshot) string {
+	return string(snapshot.Metadata.UID)
+}
+
+func stagedOverlay(volpath string) string {
+	return filepath.Join(filepath.Dir(volpath), ".snapshot-"+filepath.Base(volpath))
+}
+
+// Make the image at volpath the external snapshot at snappath,
+// replacing it with an overlay. Each step leaves the image at
+// volpath intact, so an interrupted snapshot can be finished
+// by running it again
+func createExternal(volpath, snappath string) (uint64, error) {
+	staged := stagedOverlay(volpath)
+
+	vinfo, err := os.Stat(volpath)
+	if err != nil {
+		return 0, err
+	}
+	if sinfo, err := os.Stat(snappath); err == nil {
+		if !os.SameFile(sinfo, vinfo) {
+			// Already done
+			info, err := queryImage(snappath)
+			if err != nil {
+				return 0, err
+			}
+			return info.VirtualSize, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	info, err := queryImage(volpath)
+	if err != nil {
+		return 0, err
+	}
+	if err := createOverlay(snappath, info.Format, staged, info.VirtualSize); err != nil {
+		return 0, err
+	}
+	if err := os.Link(volpath, snappath); err != nil && !os.IsExist(err) {
+		os.Remove(staged)
+		return 0, err
+	}
+	if err := os.Rename(staged, volpath); err != nil {
+		return 0, err
+	}
+	return info.VirtualSize, nil
+}
+
+// Remove an external snapshot, first merging its content
+// into any images which are overlays of it
+func deleteExternal(snappath string, chain []string) error {
+	if _, err := os.Stat(snappath); os.IsNotExist(err) {
+		return nil
+	}
+	info, err := queryImage(snappath)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range chain {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		child, err := queryImage(path)
+		if err != nil {
+			return err
+		}
+		if child.BackingFilename != snappath {
+			continue
+		}
+		glog.V(1).Infof("Rebasing %s onto '%s'", path, info.BackingFilename)
+		if err := rebaseImage(path, info.BackingFilename, info.BackingFormat); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(snappath)
+}
+
+// Discard the content of the image at volpath, replacing
+// it with a fresh overlay of the snapshot at snappath
+func revertExternal(volpath, snappath string) error {
+	info, err := queryImage(snappath)
+	if err != nil {
+		return err
+	}
+	staged := stagedOverlay(volpath)
+	if err := createOverlay(snappath, info.Format, staged, 0); err != nil {
+		return err
+	}
+	return os.Rename(staged, volpath)
+}
+
+func (j *RepositoryJobSnapshot) Process() error {
+	glog.V(1).Infof("Job snapshot %s %s %s", j.op, j.typ, j.name)
+
+	j.err = j.process()
+	return j.err
+}
+
+func (j *RepositoryJobSnapshot) process() error {
+	switch j.op {
+	case snapshotCreate:
+		if j.typ == apiv2.VirtimagesnapshotExternal {
+			size, err := createExternal(j.volpath, j.snappath)
+			j.size = size
+			return err
+		}
+		info, err := queryImage(j.volpath)
+		if err != nil {
+			return err
+		}
+		j.size = info.VirtualSize
+		if info.hasSnapshot(j.tag) {
+			return nil
+		}
+		_, err = qemuImg("snapshot", "-c", j.tag, j.volpath)
+		return err
+
+	case snapshotDelete:
+		if j.typ == apiv2.VirtimagesnapshotExternal {
+			return deleteExternal(j.snappath, j.chain)
+		}
+		if j.volpath == "" {
+			// Went along with the file
+			return nil
+		}
+		info, err := queryImage(j.volpath)
+		if err != nil {
+			return err
+		}
+		if !info.hasSnapshot(j.tag) {
+			return nil
+		}
+		_, err = qemuImg("snapshot", "-d", j.tag, j.volpath)
+		return err
+
+	case snapshotRevert:
+		var err error
+		if j.typ == apiv2.VirtimagesnapshotExternal {
+			err = revertExternal(j.volpath, j.snappath)
+		} else {
+			_, err = qemuImg("snapshot", "-a", j.tag, j.volpath)
+		}
+		if err != nil {
+			return err
+		}
+		// The file takes on the size it had when the
+		// snapshot was taken
+		info, err := queryImage(j.volpath)
+		if err != nil {
+			return err
+		}
+		if info.VirtualSize < j.capacity {
+			return resizeImage(j.volpath, info.Format, j.capacity)
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown snapshot operation '%s'", j.op)
+}
+
+func (j *RepositoryJobSnapshot) Finish(r *Repository) error {
+	glog.V(1).Infof("Finishing snapshot %s %s", j.op, j.name)
+	if j.file != nil && j.file.snapshotJob == j {
+		j.file.snapshotJob = nil
+	}
+	if j.snapshot != nil && j.snapshot.job == j {
+		j.snapshot.job = nil
+	}
+
+	switch j.op {
+	case snapshotCreate:
+		if r.snapshots[j.name] != j.snapshot || j.snapshot.deleting {
+			// Whatever was made is cleaned up when
+			// deletions are next processed
+			return nil
+		}
+		snapshot := j.snapshot.resource
+		if j.err != nil {
+			r.setSnapshotPhase(snapshot, apiv2.VirtimagesnapshotFailed, "SnapshotFailed", j.err)
+		} else {
+			now := v1.Now()
+			snapshot.Status.CreationTime = &now
+			snapshot.Status.Capacity = j.size
+			r.setSnapshotPhase(snapshot, apiv2.VirtimagesnapshotReady, "Created", nil)
+		}
+		r.saveSnapshot(j.snapshot)
+		if _, file := r.lookupFile(snapshot.Spec.FileName); j.file != nil && file == j.file {
+			r.saveFile(j.file)
+		}
+
+	case snapshotDelete:
+		if r.snapshots[j.name] != j.snapshot {
+			return nil
+		}
+		if j.err != nil {
+			// Retried when snapshots are next processed
+			glog.V(1).Infof("Delete of snapshot %s failed, will retry", j.name)
+			r.setSnapshotPhase(j.snapshot.resource, j.snapshot.resource.Status.Phase, "DeleteFailed", j.err)
+			r.saveSnapshot(j.snapshot)
+			return nil
+		}
+		r.releaseSnapshot(j.name, j.snapshot)
+
+	case snapshotRevert:
+		if j.file == nil || r.files[r.volName(j.file.resource)] != j.file {
+			return nil
+		}
+		file := j.file.resource
+		revert := j.revert
+		file.Status.Revert = &revert
+		if j.err != nil {
+			apiv2.SetCondition(&file.Status.Conditions, apiv2.ConditionReverted, apiv2.ConditionFalse, "RevertFailed", j.err.Error())
+			r.recorder.Eventf(file, api.EventWarning, "RevertFailed",
+				"Unable to revert to snapshot %s: %s", revert.Snapshot, j.err)
+		} else {
+			apiv2.SetCondition(&file.Status.Conditions, apiv2.ConditionReverted, apiv2.ConditionTrue, "Reverted", "")
+			r.recorder.Eventf(file, api.EventNormal, "Reverted",
+				"Reverted to snapshot %s", revert.Snapshot)
+		}
+		r.saveFile(j.file)
+	}
+	return nil
+}
+
+func (r *Repository) setSnapshotPhase(snapshot *apiv2.Virtimagesnapshot, phase apiv2.VirtimagesnapshotPhase, reason string, err error) {
+	snapshot.Status.Phase = phase
+	status := apiv2.ConditionFalse
+	if phase == apiv2.VirtimagesnapshotReady {
+		status = apiv2.ConditionTrue
+	}
+	r.setReady(snapshot, &snapshot.Status.Conditions, status, reason, err,
+		fmt.Sprintf("Snapshot of image file %s is %s", snapshot.Spec.FileName, phase))
+}
+
+// Write the status of a snapshot, as for files
+func (r *Repository) saveSnapshot(snapshot *RepositorySnapshot) error {
+	obj, err := r.snapshotclient.PatchStatus(snapshot.saved, snapshot.resource)
+	if err != nil {
+		glog.Errorf("Unable to update image snapshot status %s", err)
+		return err
+	}
+	snapshot.saved = api.DeepCopyVirtimagesnapshot(obj)
+	return nil
+}
+
+// The snapshots of a file which have been taken, for
+// listing in its status
+func (r *Repository) fileSnapshots(file *apiv2.Virtimagefile) []apiv2.VirtimagefileSnapshotStatus {
+	var list []apiv2.VirtimagefileSnapshotStatus
+	for _, snapshot := range r.snapshots {
+		if snapshot.resource.Spec.FileName != file.Metadata.Name ||
+			snapshot.resource.Status.Phase != apiv2.VirtimagesnapshotReady ||
+			snapshot.resource.Status.CreationTime == nil {
+			continue
+		}
+		list = append(list, apiv2.VirtimagefileSnapshotStatus{
+			Name:         snapshot.resource.Metadata.Name,
+			Type:         snapshot.resource.Spec.Type,
+			CreationTime: *snapshot.resource.Status.CreationTime,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := list[i].CreationTime.Time, list[j].CreationTime.Time
+		if ti.Equal(tj) {
+			return list[i].Name < list[j].Name
+		}
+		return ti.Before(tj)
+	})
+	return list
+}
+
+// Whether a file has external snapshots, so that its volume
+// only holds the changes made since the last one
+func (r *Repository) hasExternalSnapshots(file *apiv2.Virtimagefile) bool {
+	for _, snapshot := range r.snapshots {
+		if snapshot.resource.Spec.FileName == file.Metadata.Name &&
+			snapshot.resource.Spec.Type == apiv2.VirtimagesnapshotExternal &&
+			snapshot.resource.Status.Phase != apiv2.VirtimagesnapshotFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// The snapshot a file is created from, if any
+func snapshotSource(file *apiv2.Virtimagefile) string {
+	if file.Spec.Source == nil || file.Spec.Source.Snapshot == nil {
+		return ""
+	}
+	return file.Spec.Source.Snapshot.Name
+}
+
+// The files still being created from a snapshot
+func (r *Repository) snapshotUsers(snapshot *apiv2.Virtimagesnapshot) ([]string, error) {
+	files, err := r.filelister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var users []string
+	for _, other := range files {
+		if snapshotSource(other) != snapshot.Metadata.Name || !needsImport(other) ||
+			other.Status.Phase == apiv2.VirtimagefileFailed || isDeleting(&other.Metadata) {
+			continue
+		}
+		users = append(users, "virtimagefile "+other.Metadata.Namespace+"/"+other.Metadata.Name)
+	}
+	return users, nil
+}
+
+// Whether a job is using the file's volume, either on
+// the file itself or copying one of its snapshots
+func (r *Repository) fileBusy(file *RepositoryFile) bool {
+	if file.snapshotJob != nil || file.importJob != nil {
+		return true
+	}
+	for _, other := range r.files {
+		if other.importJob != nil && other.importJob.snapshotFile == file {
+			return true
+		}
+	}
+	return false
+}
+
+// The path of the volume of a file, as seen by qemu-img
+func (r *Repository) filePath(file *RepositoryFile) (string, error) {
+	if file == nil || file.vol == nil {
+		return "", nil
+	}
+	return file.vol.GetPath()
+}
+
+func (r *Repository) snapshotPath(snapshot *apiv2.Virtimagesnapshot) string {
+	// Only files in the qcow2 format have snapshots
+	return filepath.Join(r.path, makeSnapshotVolName(snapshot.Spec.FileName, snapshot.Metadata.Name, "qcow2"))
+}
+
+// Say where a file is copied from when created from a
+// snapshot, if the snapshot can be read
+func (r *Repository) snapshotFrom(job *RepositoryJobImport, file *apiv2.Virtimagefile) error {
+	name := snapshotSource(file)
+	snapshot, ok := r.snapshots[name]
+	if !ok || snapshot.resource.Status.Phase != apiv2.VirtimagesnapshotReady {
+		return fmt.Errorf("Source snapshot %s is not yet ready", name)
+	}
+
+	_, src := r.lookupFile(snapshot.resource.Spec.FileName)
+	if src == nil || src.vol == nil {
+		return fmt.Errorf("Image file %s of source snapshot %s is not available", snapshot.resource.Spec.FileName, name)
+	}
+	if src.snapshotJob != nil {
+		return fmt.Errorf("Image file %s of source snapshot %s is busy", snapshot.resource.Spec.FileName, name)
+	}
+
+	if snapshot.resource.Spec.Type == apiv2.VirtimagesnapshotExternal {
+		job.snapshotPath = r.snapshotPath(snapshot.resource)
+	} else {
+		// Machines write to the image holding the
+		// snapshot while they run
+		users, err := r.machineUsers(src.resource)
+		if err != nil {
+			return err
+		}
+		if len(users) != 0 {
+			return fmt.Errorf("Image file %s of source snapshot %s is used by %s",
+				snapshot.resource.Spec.FileName, name, strings.Join(users, ", "))
+		}
+		path, err := src.vol.GetPath()
+		if err != nil {
+			return err
+		}
+		job.snapshotPath = path
+		job.snapshotTag = snapshotTag(snapshot.resource)
+	}
+	job.snapshotFile = src
+	return nil
+}
+
+func (r *Repository) snapshotRepoMatches(snapshot *apiv2.Virtimagesnapshot) bool {
+	if snapshot.Status.RepoName != "" {
+		return snapshot.Status.RepoName == r.resource.Metadata.Name
+	}
+	_, file := r.lookupFile(snapshot.Spec.FileName)
+	return file != nil
+}
+
+func (r *Repository) isSnapshotClaimed(snapshot *apiv2.Virtimagesnapshot) bool {
+	return isDeleting(&snapshot.Metadata) || hasFinalizer(&snapshot.Metadata, snapshotFinalizer)
+}
+
+// claimSnapshot makes the snapshot owned by its file, so it
+// is garbage collected along with the file, and adds the
+// finalizer which holds on to it until its content is deleted
+func (r *Repository) claimSnapshot(snapshot *apiv2.Virtimagesnapshot) *apiv2.Virtimagesnapshot {
+	if r.isSnapshotClaimed(snapshot) {
+		return snapshot
+	}
+
+	_, file := r.lookupFile(snapshot.Spec.FileName)
+	if file == nil {
+		return snapshot
+	}
+
+	glog.V(1).Infof("Claiming image snapshot %s", snapshot.Metadata.Name)
+	err := api.RetryOnConflict(func() error {
+		latest, err := r.snapshotclient.Get(snapshot.Metadata.Name)
+		if err != nil {
+			return err
+		}
+		if r.isSnapshotClaimed(latest) {
+			snapshot = latest
+			return nil
+		}
+
+		owned := false
+		for _, ref := range latest.Metadata.OwnerReferences {
+			if ref.UID == file.resource.Metadata.UID {
+				owned = true
+			}
+		}
+		if !owned {
+			latest.Metadata.OwnerReferences = append(latest.Metadata.OwnerReferences, v1.OwnerReference{
+				APIVersion: apiv2.SchemeGroupVersion.String(),
+				Kind:       "Virtimagefile",
+				Name:       file.resource.Metadata.Name,
+				UID:        file.resource.Metadata.UID,
+			})
+		}
+		latest.Metadata.Finalizers = append(latest.Metadata.Finalizers, snapshotFinalizer)
+
+		obj, err := r.snapshotclient.Update(latest)
+		if err != nil {
+			return err
+		}
+		snapshot = obj
+		return nil
+	})
+	if err != nil {
+		// The next sync of the snapshot will try again
+		glog.Errorf("Unable to claim image snapshot %s: %s", snapshot.Metadata.Name, err)
+	}
+	return snapshot
+}
+
+// Drop the finalizer of a snapshot whose content is gone
+func (r *Repository) releaseSnapshot(name string, snapshot *RepositorySnapshot) {
+	err := api.RetryOnConflict(func() error {
+		latest, err := r.snapshotclient.Get(name)
+		if err != nil {
+			return err
+		}
+		if !hasFinalizer(&latest.Metadata, snapshotFinalizer) {
+			return nil
+		}
+		removeFinalizer(&latest.Metadata, snapshotFinalizer)
+		_, err = r.snapshotclient.Update(latest)
+		return err
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		glog.Errorf("Unable to release image snapshot %s: %s", name, err)
+		r.recorder.Eventf(snapshot.resource, api.EventWarning, "ReleaseFailed",
+			"Unable to remove finalizer: %s", err)
+		return
+	}
+
+	glog.V(1).Infof("Released image snapshot %s", name)
+	delete(r.snapshots, name)
+
+	_, file := r.lookupFile(snapshot.resource.Spec.FileName)
+	if file != nil && !file.deleting {
+		r.saveFile(file)
+	}
+}
+
+func (r *Repository) loadSnapshotResources() error {
+	snapshots, err := r.snapshotlister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	r.snapshots = make(map[string]*RepositorySnapshot)
+
+	for _, snapshot := range snapshots {
+		if !r.snapshotRepoMatches(snapshot) {
+			continue
+		}
+		snapshot = r.claimSnapshot(api.DeepCopyVirtimagesnapshot(snapshot))
+		glog.V(1).Infof("Loaded snapshot resource %s", snapshot.Metadata.Name)
+		state := &RepositorySnapshot{
+			resource: snapshot,
+			saved:    api.DeepCopyVirtimagesnapshot(snapshot),
+			deleting: isDeleting(&snapshot.Metadata),
+		}
+		r.snapshots[snapshot.Metadata.Name] = state
+		if !state.deleting {
+			r.adoptSnapshot(state)
+		}
+	}
+
+	return nil
+}
+
+// SyncSnapshot takes or deletes a snapshot to match its resource
+func (r *Repository) SyncSnapshot(snapshot *apiv2.Virtimagesnapshot) {
+	if !r.snapshotRepoMatches(snapshot) {
+		return
+	}
+
+	name := snapshot.Metadata.Name
+	state, ok := r.snapshots[name]
+	if !ok {
+		state = &RepositorySnapshot{resource: snapshot}
+		r.snapshots[name] = state
+	}
+	state.saved = api.DeepCopyVirtimagesnapshot(snapshot)
+	if ok {
+		// Ours is never older than the cached one
+		snapshot.Status = state.resource.Status
+	}
+
+	if isDeleting(&snapshot.Metadata) {
+		glog.V(1).Infof("Image snapshot %s is being deleted", name)
+		state.resource = snapshot
+		state.deleting = true
+		r.ProcessSnapshots()
+		return
+	}
+
+	state.resource = r.claimSnapshot(snapshot)
+	r.adoptSnapshot(state)
+	r.ProcessSnapshots()
+}
+
+// Record that the repo holds the content of a new snapshot,
+// before any is made
+func (r *Repository) adoptSnapshot(snapshot *RepositorySnapshot) {
+	if snapshot.resource.Status.RepoName != "" {
+		return
+	}
+	snapshot.resource.Status.RepoName = r.resource.Metadata.Name
+	if snapshot.resource.Status.Phase == "" {
+		r.setSnapshotPhase(snapshot.resource, apiv2.VirtimagesnapshotPending, "Pending", nil)
+	}
+	r.saveSnapshot(snapshot)
+}
+
+// DeleteSnapshot forgets a snapshot which has vanished without
+// waiting for its finalizer. Any external volume is deleted
+// once the pool is next loaded
+func (r *Repository) DeleteSnapshot(name string) {
+	snapshot, ok := r.snapshots[name]
+	if !ok {
+		return
+	}
+	delete(r.snapshots, name)
+
+	_, file := r.lookupFile(snapshot.resource.Spec.FileName)
+	if file != nil && !file.deleting {
+		r.saveFile(file)
+	}
+}
+
+// ProcessSnapshots takes pending snapshots, deletes those
+// which are being deleted and reverts files, as far as the
+// files are free to be changed
+func (r *Repository) ProcessSnapshots() {
+	if r.pool == nil {
+		return
+	}
+
+	for name, snapshot := range r.snapshots {
+		if snapshot.job != nil {
+			continue
+		}
+		_, file := r.lookupFile(snapshot.resource.Spec.FileName)
+		if snapshot.deleting {
+			r.deleteSnapshot(name, snapshot, file)
+		} else if snapshot.resource.Status.Phase == apiv2.VirtimagesnapshotPending {
+			r.createSnapshot(name, snapshot, file)
+		}
+	}
+
+	for name, file := range r.files {
+		r.revertFile(name, file)
+	}
+}
+
+// Record why a snapshot is waiting, saving it if that changed
+func (r *Repository) snapshotWaiting(snapshot *RepositorySnapshot, reason string, err error) {
+	ready := apiv2.GetCondition(snapshot.resource.Status.Conditions, apiv2.ConditionReady)
+	if ready != nil && ready.Reason == reason && (err == nil || ready.Message == err.Error()) {
+		return
+	}
+	r.setSnapshotPhase(snapshot.resource, snapshot.resource.Status.Phase, reason, err)
+	r.saveSnapshot(snapshot)
+}
+
+func (r *Repository) createSnapshot(name string, snapshot *RepositorySnapshot, file *RepositoryFile) {
+	resource := snapshot.resource
+	fail := func(reason string, err error) {
+		r.setSnapshotPhase(resource, apiv2.VirtimagesnapshotFailed, reason, err)
+		r.saveSnapshot(snapshot)
+	}
+
+	if file == nil || file.deleting {
+		fail("FileDeleted", fmt.Errorf("Image file %s is gone", resource.Spec.FileName))
+		return
+	}
+	if format := r.fileFormat(file.resource); format != "qcow2" {
+		fail("UnsupportedFormat", fmt.Errorf("Snapshots need a file using the qcow2 format, not %s", format))
+		return
+	}
+	for _, other := range r.snapshots {
+		if other.resource.Spec.FileName == resource.Spec.FileName &&
+			other.resource.Spec.Type != resource.Spec.Type &&
+			other.resource.Status.Phase != apiv2.VirtimagesnapshotFailed {
+			fail("MixedTypes", fmt.Errorf("Image file already has %s snapshot %s",
+				strings.ToLower(string(other.resource.Spec.Type)), other.resource.Metadata.Name))
+			return
+		}
+	}
+
+	if file.vol == nil || file.resource.Status.Phase != apiv2.VirtimagefileAvailable || needsImport(file.resource) {
+		r.snapshotWaiting(snapshot, "WaitingForFile", nil)
+		return
+	}
+
+	// The disk can't be snapshotted through the VM shim, and
+	// qemu-img must not touch an image a machine is using
+	users, err := r.machineUsers(file.resource)
+	if err != nil {
+		glog.Errorf("Unable to check users of image file %s: %s", file.resource.Metadata.Name, err)
+		return
+	}
+	if len(users) != 0 {
+		fail("FileInUse", fmt.Errorf("Used by %s, and live snapshots are not supported", strings.Join(users, ", ")))
+		return
+	}
+	if r.fileBusy(file) {
+		r.snapshotWaiting(snapshot, "WaitingForFile", nil)
+		return
+	}
+
+	volpath, err := file.vol.GetPath()
+	if err != nil {
+		fail("SnapshotFailed", err)
+		return
+	}
+
+	job := &RepositoryJobSnapshot{
+		op:       snapshotCreate,
+		name:     name,
+		file:     file,
+		snapshot: snapshot,
+		typ:      resource.Spec.Type,
+		volpath:  volpath,
+		snappath: r.snapshotPath(resource),
+		tag:      snapshotTag(resource),
+	}
+	file.snapshotJob = job
+	snapshot.job = job
+
+	r.setSnapshotPhase(resource, apiv2.VirtimagesnapshotPending, "Creating", nil)
+	r.saveSnapshot(snapshot)
+
+	glog.V(1).Infof("Queueing snapshot %s of %s", name, resource.Spec.FileName)
+	r.pendingJobs <- job
+}
+
+func (r *Repository) deleteSnapshot(name string, snapshot *RepositorySnapshot, file *RepositoryFile) {
+	resource := snapshot.resource
+	if !hasFinalizer(&resource.Metadata, snapshotFinalizer) {
+		delete(r.snapshots, name)
+		return
+	}
+
+	users, err := r.snapshotUsers(resource)
+	if err != nil {
+		glog.Errorf("Unable to check users of image snapshot %s: %s", name, err)
+		return
+	}
+	if file != nil {
+		if file.vol == nil && !file.deleting {
+			// Can't see the volume yet
+			return
+		}
+		if file.vol != nil {
+			machines, err := r.machineUsers(file.resource)
+			if err != nil {
+				glog.Errorf("Unable to check users of image file %s: %s", file.resource.Metadata.Name, err)
+				return
+			}
+			users = append(users, machines...)
+		}
+	}
+	if len(users) != 0 {
+		glog.V(1).Infof("Image snapshot %s in use by %s, deferring delete", name, users)
+		r.snapshotWaiting(snapshot, "InUse", fmt.Errorf("Used by %s", strings.Join(users, ", ")))
+		return
+	}
+	if file != nil && r.fileBusy(file) {
+		return
+	}
+
+	volpath, err := r.filePath(file)
+	if err != nil {
+		glog.Errorf("Unable to get path of image file %s: %s", resource.Spec.FileName, err)
+		return
+	}
+
+	job := &RepositoryJobSnapshot{
+		op:       snapshotDelete,
+		name:     name,
+		snapshot: snapshot,
+		typ:      resource.Spec.Type,
+		volpath:  volpath,
+		snappath: r.snapshotPath(resource),
+		tag:      snapshotTag(resource),
+	}
+	if resource.Spec.Type == apiv2.VirtimagesnapshotExternal {
+		if volpath != "" {
+			job.chain = append(job.chain, volpath)
+		}
+		for _, other := range r.snapshots {
+			if other != snapshot && other.resource.Spec.FileName == resource.Spec.FileName &&
+				other.resource.Spec.Type == apiv2.VirtimagesnapshotExternal {
+				job.chain = append(job.chain, r.snapshotPath(other.resource))
+			}
+		}
+	}
+	if file != nil {
+		job.file = file
+		file.snapshotJob = job
+	}
+	snapshot.job = job
+
+	glog.V(1).Infof("Queueing delete of snapshot %s", name)
+	r.pendingJobs <- job
+}
+
+// Revert a file to the snapshot its spec asks for, once
+// no running machine uses it
+func (r *Repository) revertFile(name string, file *RepositoryFile) {
+	want := file.resource.Spec.Revert
+	if want == nil || file.deleting || reflect.DeepEqual(want, file.resource.Status.Revert) ||
+		reflect.DeepEqual(want, file.lastRevert) {
+		return
+	}
+	if file.vol == nil || r.fileBusy(file) {
+		return
+	}
+
+	revert := *want
+	fail := func(err error) {
+		file.lastRevert = &revert
+		file.resource.Status.Revert = &revert
+		apiv2.SetCondition(&file.resource.Status.Conditions, apiv2.ConditionReverted, apiv2.ConditionFalse, "RevertFailed", err.Error())
+		r.recorder.Eventf(file.resource, api.EventWarning, "RevertFailed",
+			"Unable to revert to snapshot %s: %s", revert.Snapshot, err)
+		r.saveFile(file)
+	}
+
+	snapshot := r.snapshots[revert.Snapshot]
+	if snapshot == nil || snapshot.deleting || snapshot.resource.Spec.FileName != file.resource.Metadata.Name ||
+		snapshot.resource.Status.Phase != apiv2.VirtimagesnapshotReady {
+		fail(fmt.Errorf("No snapshot %s of the file is ready", revert.Snapshot))
+		return
+	}
+
+	// Overlays of the file would have their
+	// backing content change underneath them
+	files, err := r.filelister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Unable to list image files: %s", err)
+		return
+	}
+	for _, other := range files {
+		if other.Spec.BackingImageFile == file.resource.Metadata.Name {
+			fail(fmt.Errorf("Image file is the backing image file of %s", other.Metadata.Name))
+			return
+		}
+	}
+
+	users, err := r.machineUsers(file.resource)
+	if err != nil {
+		glog.Errorf("Unable to check users of image file %s: %s", file.resource.Metadata.Name, err)
+		return
+	}
+	if len(users) != 0 {
+		message := fmt.Sprintf("Used by %s", strings.Join(users, ", "))
+		cond := apiv2.GetCondition(file.resource.Status.Conditions, apiv2.ConditionReverted)
+		if cond == nil || cond.Reason != "WaitingForStop" || cond.Message != message {
+			apiv2.SetCondition(&file.resource.Status.Conditions, apiv2.ConditionReverted, apiv2.ConditionFalse, "WaitingForStop", message)
+			r.saveFile(file)
+		}
+		return
+	}
+
+	volpath, err := file.vol.GetPath()
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	job := &RepositoryJobSnapshot{
+		op:       snapshotRevert,
+		name:     revert.Snapshot,
+		file:     file,
+		typ:      snapshot.resource.Spec.Type,
+		volpath:  volpath,
+		snappath: r.snapshotPath(snapshot.resource),
+		tag:      snapshotTag(snapshot.resource),
+		revert:   revert,
+		capacity: file.resource.Spec.Capacity,
+	}
+	file.snapshotJob = job
+	file.lastRevert = &revert
+
+	apiv2.SetCondition(&file.resource.Status.Conditions, apiv2.ConditionReverted, apiv2.ConditionFalse, "Reverting", "")
+	r.saveFile(file)
+
+	glog.V(1).Infof("Queueing revert of %s to %s", name, revert.Snapshot)
+	r.pendingJobs <- job
+}
@@ -24,18 +24,158 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
+
+	"libvirt.org/libvirt-kube/pkg/libvirtutil"
 )
 
 // XXX kind of ugly to include the http status code as an return param
 // but mapping error -> status codes in a fine grained manner is fugly
 // too
+//
+// A format may be given to stream the image in, converting it
+// from or to the format of the file, otherwise it is streamed
+// as it is held
 type VolumeIOResolver interface {
-	UploadVolume(imagerepo, imagefile, token string) (io.WriteCloser, uint64, int, error)
+	// An upload as it is held writes length bytes at the
+	// offset, so a large image can be sent in chunks, each
+	// of which can be sent again if the connection drops.
+	// An upload to be converted is sent whole, from zero
+	UploadVolume(imagerepo, imagefile, token, format string, offset, length uint64) (io.WriteCloser, int, error)
+
+	// Where the next chunk of an upload carries on from,
+	// so an upload can be resumed by a new client
+	UploadOffset(imagerepo, imagefile, token string) (uint64, int, error)
+
+	// Record the size of an image uploaded in chunks,
+	// once they have all been sent
+	FinalizeUpload(imagerepo, imagefile, token string, size uint64) (int, error)
+
+	// A sparse download is encoded as frames, and its
+	// length is not known up front. A range may be given
+	// for a download as it is held
+	DownloadVolume(imagerepo, imagefile, token string, sparse bool, format string, rng *VolumeRange) (io.ReadCloser, uint64, string, int, error)
+}
+
+// Implemented by the streams of a VolumeIOResolver which can
+// be abandoned part way, rather than closed as though the
+// transfer was complete. An upload as it is held keeps the
+// bytes which arrived, so it can carry on after them
+type streamAborter interface {
+	Abort() error
+}
+
+// Abandon a stream whose transfer failed
+func abortStream(stream io.Closer) error {
+	if aborter, ok := stream.(streamAborter); ok {
+		return aborter.Abort()
+	}
+	return stream.Close()
+}
+
+// VolumeRange is the part of a volume a download asks for with
+// a Range header. It is resolved by whoever knows the volume's
+// size and version, which are filled in along with the part to
+// send
+type VolumeRange struct {
+	// Input
+	Range   string
+	IfRange string
+
+	// Output
+	Offset   uint64
+	Length   uint64
+	Size     uint64
+	Partial  bool
+	ETag     string
+	Modified time.Time
+}
+
+// Parse a single 'bytes=' range, giving ok false for anything
+// else, which is ignored in favour of sending the whole volume
+func parseRange(spec string, size uint64) (start, end uint64, ok, satisfiable bool) {
+	if !strings.HasPrefix(spec, "bytes=") {
+		return 0, 0, false, false
+	}
+	spec = strings.TrimSpace(strings.TrimPrefix(spec, "bytes="))
+	if strings.Contains(spec, ",") {
+		// Multipart responses aren't worth it for
+		// disk images
+		return 0, 0, false, false
+	}
+	dash := strings.Index(spec, "-")
+	if dash == -1 {
+		return 0, 0, false, false
+	}
+	first, last := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	if first == "" {
+		// The final bytes
+		n, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			return 0, 0, false, false
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true, true
+	}
 
-	DownloadVolume(imagerepo, imagefile, token string) (io.ReadCloser, uint64, string, int, error)
+	start, err := strconv.ParseUint(first, 10, 64)
+	if err != nil {
+		return 0, 0, false, false
+	}
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseUint(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	return start, end, true, true
+}
+
+// Resolve the range against the volume, once its size
+// and version are filled in
+func (r *VolumeRange) resolve() (int, error) {
+	r.Offset = 0
+	r.Length = r.Size
+	r.Partial = false
+
+	if r.Range == "" {
+		return 0, nil
+	}
+	// The whole volume is sent if it changed since
+	// the client got the part it has
+	if r.IfRange != "" && r.IfRange != r.ETag && r.IfRange != r.Modified.UTC().Format(http.TimeFormat) {
+		return 0, nil
+	}
+
+	start, end, ok, satisfiable := parseRange(r.Range, r.Size)
+	if !ok {
+		return 0, nil
+	}
+	if !satisfiable {
+		return http.StatusRequestedRangeNotSatisfiable, fmt.Errorf("Range %s is outside volume size %d", r.Range, r.Size)
+	}
+	r.Offset = start
+	r.Length = end - start + 1
+	r.Partial = true
+	return 0, nil
 }
 
 type VolumeStreamer struct {
@@ -64,6 +204,27 @@ func NewVolumeStreamer(listenAddr string, insecure bool, tlsConfig *tls.Config,
 	return s
 }
 
+// Report the outcome of a request which doesn't send an image.
+// Errors the client can act on, such as an image being too
+// large, are described, others only logged
+func streamStatus(res http.ResponseWriter, what string, code int, err error) {
+	if err == nil {
+		res.Header().Set("Content-Type", "text/plain")
+		res.Header().Set("Content-Length", "3")
+		res.WriteHeader(http.StatusOK)
+		io.WriteString(res, "OK\n")
+		return
+	}
+
+	glog.V(1).Infof("Unable to %s volume code=%d msg=%s", what, code, err)
+	switch code {
+	case http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusRequestedRangeNotSatisfiable:
+		http.Error(res, fmt.Sprintf("Unable to %s volume: %s", what, err), code)
+	default:
+		http.Error(res, fmt.Sprintf("Unable to %s volume", what), code)
+	}
+}
+
 func (s *VolumeStreamer) handle(res http.ResponseWriter, req *http.Request) {
 	bits := strings.Split(req.URL.Path, "/")
 	if len(bits) != 5 {
@@ -79,73 +240,174 @@ func (s *VolumeStreamer) handle(res http.ResponseWriter, req *http.Request) {
 
 	// XXX spawn goroutine. safety ?
 
+	query := req.URL.Query()
+	format := query.Get("format")
+
 	switch req.Method {
 	case http.MethodGet:
-		glog.V(1).Infof("Try download repo=%s file=%s token=%s", bits[2], bits[3], bits[4])
-		volio, length, filename, code, err := s.ioresolver.DownloadVolume(bits[2], bits[3], bits[4])
+		glog.V(1).Infof("Try download repo=%s file=%s token=%s format=%s", bits[2], bits[3], bits[4], format)
+		// Other repos ask for holes to be kept when
+		// they clone a file. Converted images are
+		// sent as they are written
+		sparse := format == "" && req.Header.Get("Accept") == libvirtutil.SparseContentType
+		// Only an image as it is held has a
+		// stable size to take ranges of
+		var rng *VolumeRange
+		if format == "" && !sparse {
+			rng = &VolumeRange{
+				Range:   req.Header.Get("Range"),
+				IfRange: req.Header.Get("If-Range"),
+			}
+		}
+		volio, length, filename, code, err := s.ioresolver.DownloadVolume(bits[2], bits[3], bits[4], sparse, format, rng)
 
 		if err != nil {
-			glog.V(1).Infof("Unable to download volume code=%d msg=%s", code, err)
-			http.Error(res, "Unable to download volume", code)
+			if code == http.StatusRequestedRangeNotSatisfiable {
+				res.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", rng.Size))
+			}
+			streamStatus(res, "download", code, err)
 			return
 		}
 
+		// Abandoned unless all of it is sent, so neither
+		// the stream nor a staged conversion is left open
+		sent := false
+		defer func() {
+			if !sent {
+				abortStream(volio)
+			}
+		}()
+
 		glog.V(1).Infof("Running download %p %s %d", volio, filename, length)
-		res.Header().Set("Content-Type", "application/octet-stream")
+		if sparse {
+			res.Header().Set("Content-Type", libvirtutil.SparseContentType)
+		} else {
+			res.Header().Set("Content-Type", imageContentType(strings.TrimPrefix(path.Ext(filename), ".")))
+			res.Header().Set("Content-Length", fmt.Sprintf("%d", length))
+		}
 		res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-		res.Header().Set("Content-Length", fmt.Sprintf("%d", length))
 
-		res.WriteHeader(http.StatusOK)
+		status := http.StatusOK
+		if rng != nil {
+			res.Header().Set("Accept-Ranges", "bytes")
+			res.Header().Set("ETag", rng.ETag)
+			res.Header().Set("Last-Modified", rng.Modified.UTC().Format(http.TimeFormat))
+			if rng.Partial {
+				res.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d",
+					rng.Offset, rng.Offset+rng.Length-1, rng.Size))
+				status = http.StatusPartialContent
+			}
+		}
+
+		res.WriteHeader(status)
 
 		copied, err := io.Copy(res, volio)
 		if err != nil {
 			glog.V(1).Infof("Aborted sending prematurely %s", err)
 			return
 		}
-		if uint64(copied) != length {
+		if !sparse && uint64(copied) != length {
 			glog.V(1).Infof("Volume was too short %d, expected %d", copied, length)
 			return
 		}
-		volio.Close()
+		sent = true
+		if err := volio.Close(); err != nil {
+			glog.V(1).Infof("Unable to finish sending volume %s", err)
+		}
 
 	case http.MethodPut:
 		glog.V(1).Infof("Try upload repo=%s file=%s token=%s", bits[2], bits[3], bits[4])
-		volio, length, code, err := s.ioresolver.UploadVolume(bits[2], bits[3], bits[4])
 
-		if err != nil {
-			glog.V(1).Infof("Unable to upload volume code=%d msg=%s", code, err)
-			http.Error(res, "Unable to upload volume", code)
-			return
+		// A chunk is written at its offset, while a whole
+		// image is written from the start and its size
+		// recorded once it is all there
+		var offset uint64
+		chunked := query.Get("offset") != ""
+		if chunked {
+			var err error
+			offset, err = strconv.ParseUint(query.Get("offset"), 10, 64)
+			if err != nil {
+				http.Error(res, "Invalid upload offset", http.StatusBadRequest)
+				return
+			}
+			if format != "" {
+				http.Error(res, "Converted uploads must be sent whole", http.StatusBadRequest)
+				return
+			}
 		}
 
-		glog.V(1).Infof("Running upload %p %s %d", volio, length)
-		if req.ContentLength == -1 {
-			http.Error(res, fmt.Sprintf("Volume length required %d", length), http.StatusLengthRequired)
+		if format == "" && req.ContentLength == -1 {
+			http.Error(res, "Volume length required", http.StatusLengthRequired)
 			return
 		}
+		var length uint64
+		if format == "" {
+			length = uint64(req.ContentLength)
+		}
 
-		if uint64(req.ContentLength) != length {
-			glog.V(1).Infof("Incorrect volume length %d, expected %d", req.ContentLength, length)
-			http.Error(res, fmt.Sprintf("Incorrect volume length, expected %d", length), http.StatusRequestEntityTooLarge)
+		volio, code, err := s.ioresolver.UploadVolume(bits[2], bits[3], bits[4], format, offset, length)
+		if err != nil {
+			streamStatus(res, "upload", code, err)
 			return
 		}
 
+		// Abandoned unless all of it arrives, which for an
+		// upload as it is held keeps what was written, so
+		// the upload offset says where to carry on from
+		saved := false
+		defer func() {
+			if !saved {
+				abortStream(volio)
+			}
+		}()
+
+		glog.V(1).Infof("Running upload %p %d at %d", volio, length, offset)
 		copied, err := io.Copy(volio, req.Body)
 		if err != nil {
-			glog.V(1).Infof("Aborted recving prematurely %s", err)
+			glog.V(1).Infof("Aborted recving prematurely after %d bytes %s", copied, err)
+			http.Error(res, "Unable to save volume", http.StatusInternalServerError)
+			return
+		}
+		if format == "" && uint64(copied) != length {
+			glog.V(1).Infof("Upload was too short %d, expected %d", copied, length)
 			http.Error(res, "Unable to save volume", http.StatusInternalServerError)
 			return
 		}
-		if uint64(copied) != length {
+		saved = true
+		if err := volio.Close(); err != nil {
+			glog.V(1).Infof("Unable to save volume %s", err)
 			http.Error(res, "Unable to save volume", http.StatusInternalServerError)
 			return
 		}
-		volio.Close()
 
-		res.Header().Set("Content-Type", "text/plain")
-		res.Header().Set("Content-Length", "3")
+		if format == "" && !chunked {
+			code, err = s.ioresolver.FinalizeUpload(bits[2], bits[3], bits[4], length)
+		}
+		streamStatus(res, "upload", code, err)
+
+	case http.MethodHead:
+		// Reports where an upload carries on from
+		glog.V(1).Infof("Try upload offset repo=%s file=%s token=%s", bits[2], bits[3], bits[4])
+		offset, code, err := s.ioresolver.UploadOffset(bits[2], bits[3], bits[4])
+		if err != nil {
+			glog.V(1).Infof("Unable to query upload code=%d msg=%s", code, err)
+			res.WriteHeader(code)
+			return
+		}
+		res.Header().Set("Upload-Offset", fmt.Sprintf("%d", offset))
 		res.WriteHeader(http.StatusOK)
-		io.WriteString(res, "OK\n")
+
+	case http.MethodPost:
+		// Finishes an upload sent in chunks
+		glog.V(1).Infof("Try finalize upload repo=%s file=%s token=%s", bits[2], bits[3], bits[4])
+		size, err := strconv.ParseUint(query.Get("size"), 10, 64)
+		if err != nil {
+			http.Error(res, "Upload size required", http.StatusBadRequest)
+			return
+		}
+
+		code, err := s.ioresolver.FinalizeUpload(bits[2], bits[3], bits[4], size)
+		streamStatus(res, "finalize", code, err)
 
 	default:
 		glog.V(1).Infof("Rejecting request for unsupported method %s", req.Method)
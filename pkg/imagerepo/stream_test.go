@@ -0,0 +1,475 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package imagerepo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStreamContent = []byte("libvirt-kube streamed volume")
+
+// A volume held by testResolver
+type testVolume struct {
+	data     []byte
+	offset   uint64
+	length   uint64
+	modified time.Time
+
+	closed  int
+	aborted int
+}
+
+// A stream to or from a testVolume, which keeps the bytes
+// written to it when aborted, as chunkWriter does
+type testStream struct {
+	io.Reader
+	vol     *testVolume
+	offset  uint64
+	written uint64
+}
+
+func (s *testStream) Write(p []byte) (int, error) {
+	copy(s.vol.data[s.offset+s.written:], p)
+	s.written += uint64(len(p))
+	return len(p), nil
+}
+
+func (s *testStream) Close() error {
+	s.vol.closed++
+	if s.Reader == nil {
+		s.vol.offset = s.offset + s.written
+	}
+	return nil
+}
+
+func (s *testStream) Abort() error {
+	s.vol.aborted++
+	if s.Reader == nil {
+		s.vol.offset = s.offset + s.written
+	}
+	return nil
+}
+
+type testResolver struct {
+	vol *testVolume
+	// Claim the volume is longer than the data sent
+	short bool
+}
+
+func newTestResolver(capacity int) *testResolver {
+	return &testResolver{
+		vol: &testVolume{
+			data:     make([]byte, capacity),
+			modified: time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func (r *testResolver) UploadVolume(imagerepo, imagefile, token, format string, offset, length uint64) (io.WriteCloser, int, error) {
+	if token != "token" {
+		return nil, http.StatusForbidden, fmt.Errorf("Invalid token")
+	}
+	if format != "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("Unsupported image format %s", format)
+	}
+	if offset+length > uint64(len(r.vol.data)) {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("Upload ends beyond the capacity")
+	}
+	if offset > r.vol.offset {
+		return nil, http.StatusConflict, fmt.Errorf("Upload must carry on from offset %d, not %d", r.vol.offset, offset)
+	}
+	return &testStream{vol: r.vol, offset: offset}, 0, nil
+}
+
+func (r *testResolver) UploadOffset(imagerepo, imagefile, token string) (uint64, int, error) {
+	if token != "token" {
+		return 0, http.StatusForbidden, fmt.Errorf("Invalid token")
+	}
+	return r.vol.offset, 0, nil
+}
+
+func (r *testResolver) FinalizeUpload(imagerepo, imagefile, token string, size uint64) (int, error) {
+	if r.vol.offset != size {
+		return http.StatusConflict, fmt.Errorf("Upload has %d bytes, not %d", r.vol.offset, size)
+	}
+	r.vol.length = size
+	r.vol.offset = 0
+	return 0, nil
+}
+
+func (r *testResolver) DownloadVolume(imagerepo, imagefile, token string, sparse bool, format string, rng *VolumeRange) (io.ReadCloser, uint64, string, int, error) {
+	offset, length := uint64(0), r.vol.length
+	if rng != nil {
+		rng.Size = r.vol.length
+		rng.Modified = r.vol.modified
+		rng.ETag = "\"v1\""
+		if status, err := rng.resolve(); err != nil {
+			return nil, 0, "", status, err
+		}
+		offset, length = rng.Offset, rng.Length
+	}
+
+	data := r.vol.data[offset : offset+length]
+	if r.short {
+		data = data[:len(data)/2]
+	}
+	stream := &testStream{Reader: bytes.NewReader(data), vol: r.vol}
+	return stream, length, imagefile + ".raw", 0, nil
+}
+
+// Fill the volume as though it had been uploaded
+func (r *testResolver) fill(data []byte) {
+	copy(r.vol.data, data)
+	r.vol.length = uint64(len(data))
+}
+
+// A request body which breaks off after its content
+type brokenBody struct {
+	io.Reader
+}
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func serveStream(r *testResolver, req *http.Request) *httptest.ResponseRecorder {
+	s := NewVolumeStreamer("", true, nil, r)
+	res := httptest.NewRecorder()
+	s.mux.ServeHTTP(res, req)
+	return res
+}
+
+func uploadChunk(r *testResolver, query string, data []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/stream/repo/file/token"+query, bytes.NewReader(data))
+	return serveStream(r, req)
+}
+
+func uploadOffset(t *testing.T, r *testResolver) string {
+	res := serveStream(r, httptest.NewRequest(http.MethodHead, "/stream/repo/file/token", nil))
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected upload offset status 200, got %d", res.Code)
+	}
+	return res.Header().Get("Upload-Offset")
+}
+
+func TestStreamUploadChunks(t *testing.T) {
+	r := newTestResolver(64)
+
+	res := uploadChunk(r, "?offset=0", testStreamContent[:10])
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected first chunk status 200, got %d: %s", res.Code, res.Body)
+	}
+	if offset := uploadOffset(t, r); offset != "10" {
+		t.Errorf("Expected upload offset 10, got %s", offset)
+	}
+
+	// The next chunk can't leave a gap
+	res = uploadChunk(r, "?offset=12", testStreamContent[12:])
+	if res.Code != http.StatusConflict {
+		t.Errorf("Expected gapped chunk status 409, got %d", res.Code)
+	}
+
+	// Overlapping what was sent is fine
+	res = uploadChunk(r, "?offset=8", testStreamContent[8:])
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected second chunk status 200, got %d: %s", res.Code, res.Body)
+	}
+	size := len(testStreamContent)
+	if offset := uploadOffset(t, r); offset != fmt.Sprintf("%d", size) {
+		t.Errorf("Expected upload offset %d, got %s", size, offset)
+	}
+	if r.vol.length != 0 {
+		t.Errorf("Expected chunks to leave the upload unfinished")
+	}
+
+	res = serveStream(r, httptest.NewRequest(http.MethodPost, "/stream/repo/file/token?size=4", nil))
+	if res.Code != http.StatusConflict {
+		t.Errorf("Expected finalize with the wrong size status 409, got %d", res.Code)
+	}
+	res = serveStream(r, httptest.NewRequest(http.MethodPost, "/stream/repo/file/token", nil))
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("Expected finalize without a size status 400, got %d", res.Code)
+	}
+
+	res = serveStream(r, httptest.NewRequest(http.MethodPost,
+		fmt.Sprintf("/stream/repo/file/token?size=%d", size), nil))
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected finalize status 200, got %d: %s", res.Code, res.Body)
+	}
+	if r.vol.length != uint64(size) {
+		t.Errorf("Expected length %d, got %d", size, r.vol.length)
+	}
+	if !bytes.Equal(r.vol.data[:size], testStreamContent) {
+		t.Errorf("Expected volume content '%s', got '%s'", testStreamContent, r.vol.data[:size])
+	}
+	if r.vol.aborted != 0 {
+		t.Errorf("Expected no stream to be aborted, got %d", r.vol.aborted)
+	}
+}
+
+func TestStreamUploadWhole(t *testing.T) {
+	r := newTestResolver(64)
+
+	res := uploadChunk(r, "", testStreamContent)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected upload status 200, got %d: %s", res.Code, res.Body)
+	}
+	if r.vol.length != uint64(len(testStreamContent)) {
+		t.Errorf("Expected upload to be finalized with length %d, got %d", len(testStreamContent), r.vol.length)
+	}
+	if r.vol.closed != 1 {
+		t.Errorf("Expected stream to be closed once, got %d", r.vol.closed)
+	}
+}
+
+func TestStreamUploadShort(t *testing.T) {
+	r := newTestResolver(64)
+
+	req := httptest.NewRequest(http.MethodPut, "/stream/repo/file/token?offset=0",
+		&brokenBody{bytes.NewReader(testStreamContent[:6])})
+	req.ContentLength = int64(len(testStreamContent))
+	res := serveStream(r, req)
+	if res.Code != http.StatusInternalServerError {
+		t.Errorf("Expected short upload status 500, got %d", res.Code)
+	}
+	if r.vol.aborted != 1 || r.vol.closed != 0 {
+		t.Errorf("Expected stream to be aborted, got %d aborted %d closed", r.vol.aborted, r.vol.closed)
+	}
+
+	// Carries on from what arrived
+	if offset := uploadOffset(t, r); offset != "6" {
+		t.Errorf("Expected upload offset 6, got %s", offset)
+	}
+	res = uploadChunk(r, "?offset=6", testStreamContent[6:])
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected resumed chunk status 200, got %d: %s", res.Code, res.Body)
+	}
+	if !bytes.Equal(r.vol.data[:len(testStreamContent)], testStreamContent) {
+		t.Errorf("Expected volume content '%s', got '%s'", testStreamContent, r.vol.data[:len(testStreamContent)])
+	}
+}
+
+func TestStreamUploadRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		length int64
+		code   int
+	}{
+		{
+			name:   "bad token",
+			url:    "/stream/repo/file/other?offset=0",
+			length: 4,
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "bad offset",
+			url:    "/stream/repo/file/token?offset=x",
+			length: 4,
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "converted chunk",
+			url:    "/stream/repo/file/token?offset=0&format=qcow2",
+			length: 4,
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "no length",
+			url:    "/stream/repo/file/token?offset=0",
+			length: -1,
+			code:   http.StatusLengthRequired,
+		},
+		{
+			name:   "beyond capacity",
+			url:    "/stream/repo/file/token?offset=0",
+			length: 128,
+			code:   http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "bad path",
+			url:    "/stream/repo/file",
+			length: 4,
+			code:   http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestResolver(64)
+			req := httptest.NewRequest(http.MethodPut, test.url, strings.NewReader("data"))
+			req.ContentLength = test.length
+			res := serveStream(r, req)
+			if res.Code != test.code {
+				t.Errorf("Expected status %d, got %d", test.code, res.Code)
+			}
+			if r.vol.offset != 0 {
+				t.Errorf("Expected nothing to be uploaded, got offset %d", r.vol.offset)
+			}
+		})
+	}
+}
+
+func TestStreamDownloadRange(t *testing.T) {
+	size := len(testStreamContent)
+	modified := "Wed, 01 Mar 2017 12:00:00 GMT"
+
+	tests := []struct {
+		name    string
+		rng     string
+		ifRange string
+		code    int
+		content []byte
+		crange  string
+	}{
+		{
+			name:    "whole",
+			code:    http.StatusOK,
+			content: testStreamContent,
+		},
+		{
+			name:    "range",
+			rng:     "bytes=2-5",
+			code:    http.StatusPartialContent,
+			content: testStreamContent[2:6],
+			crange:  fmt.Sprintf("bytes 2-5/%d", size),
+		},
+		{
+			name:    "open range",
+			rng:     "bytes=20-",
+			code:    http.StatusPartialContent,
+			content: testStreamContent[20:],
+			crange:  fmt.Sprintf("bytes 20-%d/%d", size-1, size),
+		},
+		{
+			name:    "suffix",
+			rng:     "bytes=-3",
+			code:    http.StatusPartialContent,
+			content: testStreamContent[size-3:],
+			crange:  fmt.Sprintf("bytes %d-%d/%d", size-3, size-1, size),
+		},
+		{
+			name:    "past end",
+			rng:     "bytes=4-1000",
+			code:    http.StatusPartialContent,
+			content: testStreamContent[4:],
+			crange:  fmt.Sprintf("bytes 4-%d/%d", size-1, size),
+		},
+		{
+			name:   "unsatisfiable",
+			rng:    fmt.Sprintf("bytes=%d-", size),
+			code:   http.StatusRequestedRangeNotSatisfiable,
+			crange: fmt.Sprintf("bytes */%d", size),
+		},
+		{
+			name:    "multiple ranges",
+			rng:     "bytes=0-1,4-5",
+			code:    http.StatusOK,
+			content: testStreamContent,
+		},
+		{
+			name:    "if-range etag",
+			rng:     "bytes=2-5",
+			ifRange: "\"v1\"",
+			code:    http.StatusPartialContent,
+			content: testStreamContent[2:6],
+			crange:  fmt.Sprintf("bytes 2-5/%d", size),
+		},
+		{
+			name:    "if-range date",
+			rng:     "bytes=2-5",
+			ifRange: modified,
+			code:    http.StatusPartialContent,
+			content: testStreamContent[2:6],
+			crange:  fmt.Sprintf("bytes 2-5/%d", size),
+		},
+		{
+			name:    "if-range changed",
+			rng:     "bytes=2-5",
+			ifRange: "\"v0\"",
+			code:    http.StatusOK,
+			content: testStreamContent,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestResolver(64)
+			r.fill(testStreamContent)
+
+			req := httptest.NewRequest(http.MethodGet, "/stream/repo/file/token", nil)
+			if test.rng != "" {
+				req.Header.Set("Range", test.rng)
+			}
+			if test.ifRange != "" {
+				req.Header.Set("If-Range", test.ifRange)
+			}
+			res := serveStream(r, req)
+
+			if res.Code != test.code {
+				t.Fatalf("Expected status %d, got %d: %s", test.code, res.Code, res.Body)
+			}
+			if crange := res.Header().Get("Content-Range"); crange != test.crange {
+				t.Errorf("Expected Content-Range '%s', got '%s'", test.crange, crange)
+			}
+			if test.content == nil {
+				return
+			}
+			if !bytes.Equal(res.Body.Bytes(), test.content) {
+				t.Errorf("Expected content '%s', got '%s'", test.content, res.Body.Bytes())
+			}
+			if length := res.Header().Get("Content-Length"); length != fmt.Sprintf("%d", len(test.content)) {
+				t.Errorf("Expected Content-Length %d, got %s", len(test.content), length)
+			}
+			if res.Header().Get("ETag") != "\"v1\"" || res.Header().Get("Last-Modified") != modified {
+				t.Errorf("Expected volume version headers, got '%s' '%s'",
+					res.Header().Get("ETag"), res.Header().Get("Last-Modified"))
+			}
+			if r.vol.closed != 1 || r.vol.aborted != 0 {
+				t.Errorf("Expected stream to be closed, got %d aborted %d closed", r.vol.aborted, r.vol.closed)
+			}
+		})
+	}
+}
+
+func TestStreamDownloadShort(t *testing.T) {
+	r := newTestResolver(64)
+	r.fill(testStreamContent)
+	r.short = true
+
+	res := serveStream(r, httptest.NewRequest(http.MethodGet, "/stream/repo/file/token", nil))
+	if res.Body.Len() >= len(testStreamContent) {
+		t.Errorf("Expected a short body, got %d bytes", res.Body.Len())
+	}
+	if r.vol.aborted != 1 || r.vol.closed != 0 {
+		t.Errorf("Expected stream to be aborted, got %d aborted %d closed", r.vol.aborted, r.vol.closed)
+	}
+}
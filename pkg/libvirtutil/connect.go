@@ -20,6 +20,7 @@
 package libvirtutil
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/golang/glog"
@@ -37,12 +38,29 @@ type ConnectEventType string
 var (
 	ConnectReady  ConnectEventType = "ready"
 	ConnectFailed ConnectEventType = "failed"
+	// An attempt to connect failed, and will be retried
+	ConnectError ConnectEventType = "error"
 )
 
 type ConnectEvent struct {
 	Type ConnectEventType
 	URI  string
 	Conn *libvirt.Connect
+	// Why the connection closed, or could not be opened
+	Err error
+}
+
+func closeReason(reason libvirt.ConnectCloseReason) error {
+	switch reason {
+	case libvirt.CONNECT_CLOSE_REASON_ERROR:
+		return fmt.Errorf("Connection to libvirt closed: I/O error")
+	case libvirt.CONNECT_CLOSE_REASON_EOF:
+		return fmt.Errorf("Connection to libvirt closed: end of file")
+	case libvirt.CONNECT_CLOSE_REASON_KEEPALIVE:
+		return fmt.Errorf("Connection to libvirt closed: keepalive timer triggered")
+	default:
+		return fmt.Errorf("Connection to libvirt closed by client")
+	}
 }
 
 func lazyUnregister(conn *libvirt.Connect) {
@@ -67,6 +85,7 @@ func connect(uri string, notify chan ConnectEvent) error {
 			Type: ConnectFailed,
 			URI:  uri,
 			Conn: nil,
+			Err:  closeReason(reason),
 		}
 
 		go connector(uri, notify)
@@ -96,6 +115,11 @@ func connector(uri string, notify chan ConnectEvent) {
 
 		glog.V(1).Infof("Unable to connect to %s, retry in %d seconds: %s",
 			uri, reconnectDelay[delayIndex], err)
+		notify <- ConnectEvent{
+			Type: ConnectError,
+			URI:  uri,
+			Err:  err,
+		}
 		time.Sleep(time.Duration(reconnectDelay[delayIndex]) * time.Second)
 		if delayIndex < (len(reconnectDelay) - 1) {
 			delayIndex++
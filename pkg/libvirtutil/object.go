@@ -23,6 +23,11 @@ import (
 	"regexp"
 )
 
+// Directory within an image repo holding overlays for
+// transient disks. Since object names are always escaped,
+// it can never clash with a real volume
+const ScratchDirName = ".scratch"
+
 func EscapeObjectName(path string) string {
 	re := regexp.MustCompile("[^a-zA-Z0-9_-]")
 	return re.ReplaceAllLiteralString(path, "_")
@@ -20,9 +20,28 @@
 package libvirtutil
 
 import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
 	"github.com/libvirt/libvirt-go"
 )
 
+// Sparse streams are carried over plain byte streams, such
+// as HTTP bodies, as a sequence of frames. Each frame is a
+// kind byte and a big endian 64-bit length, followed by that
+// many bytes of content for data frames. An end frame
+// follows the last, so a truncated stream is noticed
+const (
+	SparseContentType = "application/x-libvirt-kube-sparse"
+
+	sparseFrameData   byte = 'D'
+	sparseFrameHole   byte = 'H'
+	sparseFrameEnd    byte = 'E'
+	sparseFrameHeader      = 9
+)
+
 type StreamIO struct {
 	stream *libvirt.Stream
 	err    bool
@@ -57,3 +76,110 @@ func (s *StreamIO) Close() error {
 		return s.stream.Finish()
 	}
 }
+
+// Abort abandons the stream, eg when the other end of a
+// copy failed, rather than finishing it
+func (s *StreamIO) Abort() error {
+	s.err = true
+	return s.Close()
+}
+
+func writeFrame(w io.Writer, kind byte, length uint64) error {
+	hdr := make([]byte, sparseFrameHeader)
+	hdr[0] = kind
+	binary.BigEndian.PutUint64(hdr[1:], length)
+	_, err := w.Write(hdr)
+	return err
+}
+
+// SparseStreamReader encodes a libvirt stream, opened for
+// a sparse download, as frames
+type SparseStreamReader struct {
+	stream *libvirt.Stream
+	pipe   *io.PipeReader
+	done   chan error
+}
+
+func NewSparseStreamReader(s *libvirt.Stream) *SparseStreamReader {
+	pr, pw := io.Pipe()
+	r := &SparseStreamReader{
+		stream: s,
+		pipe:   pr,
+		done:   make(chan error, 1),
+	}
+
+	go func() {
+		err := s.SparseRecvAll(
+			func(st *libvirt.Stream, data []byte) (int, error) {
+				if err := writeFrame(pw, sparseFrameData, uint64(len(data))); err != nil {
+					return 0, err
+				}
+				return pw.Write(data)
+			},
+			func(st *libvirt.Stream, length int64) error {
+				return writeFrame(pw, sparseFrameHole, uint64(length))
+			})
+		if err == nil {
+			err = writeFrame(pw, sparseFrameEnd, 0)
+		}
+		pw.CloseWithError(err)
+		r.done <- err
+	}()
+
+	return r
+}
+
+func (r *SparseStreamReader) Read(p []byte) (int, error) {
+	return r.pipe.Read(p)
+}
+
+func (r *SparseStreamReader) Close() error {
+	// Stops the copy if the reader gave up early
+	r.pipe.Close()
+	if err := <-r.done; err != nil {
+		r.stream.Abort()
+		return err
+	}
+	return r.stream.Finish()
+}
+
+// CopySparse decodes frames into a file, seeking over holes
+// so they stay unallocated. It returns the length of the
+// content
+func CopySparse(dst *os.File, src io.Reader) (int64, error) {
+	var offset int64
+	hdr := make([]byte, sparseFrameHeader)
+	for {
+		_, err := io.ReadFull(src, hdr)
+		if err == io.EOF {
+			return offset, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return offset, err
+		}
+		if hdr[0] == sparseFrameEnd {
+			break
+		}
+
+		length := int64(binary.BigEndian.Uint64(hdr[1:]))
+		switch hdr[0] {
+		case sparseFrameData:
+			n, err := io.CopyN(dst, src, length)
+			offset += n
+			if err != nil {
+				return offset, err
+			}
+		case sparseFrameHole:
+			if _, err := dst.Seek(length, io.SeekCurrent); err != nil {
+				return offset, err
+			}
+			offset += length
+		default:
+			return offset, fmt.Errorf("Unknown sparse frame kind %d", hdr[0])
+		}
+	}
+
+	// A trailing hole is never written, so
+	// set the length explicitly
+	return offset, dst.Truncate(offset)
+}
@@ -23,10 +23,10 @@ import (
 	"github.com/libvirt/libvirt-go"
 	"github.com/libvirt/libvirt-go-xml"
 
-	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
 )
 
-func VirtNodeUpdateFromHypervisor(node *apiv1.Virtnode, conn *libvirt.Connect) error {
+func VirtNodeUpdateFromHypervisor(node *apiv2.Virtnode, conn *libvirt.Connect) error {
 	capsxml, err := conn.GetCapabilities()
 	if err != nil {
 		return err
@@ -37,7 +37,7 @@ func VirtNodeUpdateFromHypervisor(node *apiv1.Virtnode, conn *libvirt.Connect) e
 		return err
 	}
 
-	guests := make([]apiv1.VirtnodeGuest, 0)
+	guests := make([]apiv2.VirtnodeGuest, 0)
 
 	for _, cguest := range caps.Guests {
 		for _, cdom := range cguest.Arch.Domains {
@@ -51,7 +51,7 @@ func VirtNodeUpdateFromHypervisor(node *apiv1.Virtnode, conn *libvirt.Connect) e
 			for _, cmach := range cmachines {
 				machines = append(machines, cmach.Name)
 			}
-			guests = append(guests, apiv1.VirtnodeGuest{
+			guests = append(guests, apiv2.VirtnodeGuest{
 				Hypervisor: cdom.Type,
 				Arch:       cguest.Arch.Name,
 				Type:       cguest.OSType,
@@ -60,26 +60,26 @@ func VirtNodeUpdateFromHypervisor(node *apiv1.Virtnode, conn *libvirt.Connect) e
 		}
 	}
 
-	cells := make([]apiv1.VirtnodeNUMACell, 0)
+	cells := make([]apiv2.VirtnodeNUMACell, 0)
 	if caps.Host.NUMA != nil {
 		for _, lvcell := range caps.Host.NUMA.Cells {
 			ncpus := len(lvcell.CPUS)
-			memory := make([]apiv1.VirtnodeMemory, 0)
+			memory := make([]apiv2.VirtnodeMemory, 0)
 			if lvcell.PageInfo == nil {
-				memory = append(memory, apiv1.VirtnodeMemory{
+				memory = append(memory, apiv2.VirtnodeMemory{
 					PageSize: 4096,
 					Present:  lvcell.Memory.Size / 4,
 				})
 			} else {
 				for _, lvpage := range lvcell.PageInfo {
-					memory = append(memory, apiv1.VirtnodeMemory{
+					memory = append(memory, apiv2.VirtnodeMemory{
 						PageSize: lvpage.Size,
 						Present:  lvpage.Count,
 					})
 				}
 			}
-			cells = append(cells, apiv1.VirtnodeNUMACell{
-				CPU: apiv1.VirtnodeCPU{
+			cells = append(cells, apiv2.VirtnodeNUMACell{
+				CPU: apiv2.VirtnodeCPU{
 					Avail: ncpus,
 					Used:  0,
 				},
@@ -92,13 +92,13 @@ func VirtNodeUpdateFromHypervisor(node *apiv1.Virtnode, conn *libvirt.Connect) e
 			return err
 		}
 		ncpus := int(nodeinfo.Nodes * nodeinfo.Sockets * nodeinfo.Cores * nodeinfo.Threads)
-		memory := make([]apiv1.VirtnodeMemory, 0)
-		memory = append(memory, apiv1.VirtnodeMemory{
+		memory := make([]apiv2.VirtnodeMemory, 0)
+		memory = append(memory, apiv2.VirtnodeMemory{
 			PageSize: 4096,
 			Present:  nodeinfo.Memory / 4,
 		})
-		cells = append(cells, apiv1.VirtnodeNUMACell{
-			CPU: apiv1.VirtnodeCPU{
+		cells = append(cells, apiv2.VirtnodeNUMACell{
+			CPU: apiv2.VirtnodeCPU{
 				Avail: ncpus,
 				Used:  0,
 			},
@@ -106,11 +106,11 @@ func VirtNodeUpdateFromHypervisor(node *apiv1.Virtnode, conn *libvirt.Connect) e
 		})
 	}
 
-	resources := apiv1.VirtnodeResources{
+	resources := apiv2.VirtnodeResources{
 		NUMACells: cells,
 	}
 
-	node.Spec = apiv1.VirtnodeSpec{
+	node.Spec = apiv2.VirtnodeSpec{
 		UUID:      caps.Host.UUID,
 		Arch:      caps.Host.CPU.Arch,
 		Guests:    guests,
@@ -20,6 +20,7 @@
 package nodeinfo
 
 import (
+	"reflect"
 	"time"
 
 	"github.com/golang/glog"
@@ -29,15 +30,22 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 
 	"libvirt.org/libvirt-kube/pkg/api"
-	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
 	"libvirt.org/libvirt-kube/pkg/libvirtutil"
 )
 
+// How often the node cache is relisted
+const nodeResyncPeriod = 5 * time.Minute
+
 type Service struct {
 	conn           *libvirt.Connect
 	connNotify     chan libvirtutil.ConnectEvent
-	nodeinfo       *apiv1.Virtnode
-	nodeinfoclient *api.VirtnodeinfoClient
+	nodename       string
+	namespace      string
+	informers      *api.InformerFactory
+	nodeLister     *api.VirtnodeLister
+	nodeinfoclient api.VirtnodeinfoInterface
+	recorder       *api.EventRecorder
 }
 
 func eventloop() {
@@ -74,20 +82,28 @@ func NewService(libvirtURI string, kubeconfigfile string, nodename, namespace st
 		return nil, err
 	}
 
-	nodeinfoclient, err := api.NewVirtnodeinfoClient(namespace, kubeconfig)
+	apiclientset, err := api.NewClientset(kubeconfig)
 	if err != nil {
 		return nil, err
 	}
 
-	nodeinfo, err := nodeinfoclient.Get(nodename)
-	if err != nil {
-		return nil, err
-	}
+	return NewServiceWithClients(libvirtURI, clientset, apiclientset, nodename, namespace)
+}
+
+// NewServiceWithClients creates the service using the clients given,
+// which may be fakes. The resource definition must already be
+// registered
+func NewServiceWithClients(libvirtURI string, clientset kubernetes.Interface, apiclientset api.Interface, nodename, namespace string) (*Service, error) {
+	informers := api.NewInformerFactory(apiclientset, namespace, nodeResyncPeriod)
 
 	svc := &Service{
 		connNotify:     make(chan libvirtutil.ConnectEvent, 1),
-		nodeinfoclient: nodeinfoclient,
-		nodeinfo:       nodeinfo,
+		nodename:       nodename,
+		namespace:      namespace,
+		informers:      informers,
+		nodeLister:     informers.VirtnodeLister(),
+		nodeinfoclient: apiclientset.Virtnodes(namespace),
+		recorder:       api.NewEventRecorder(clientset, "virtkubenodeinfo"),
 	}
 
 	libvirtutil.OpenConnect(libvirtURI, svc.connNotify)
@@ -95,24 +111,83 @@ func NewService(libvirtURI string, kubeconfigfile string, nodename, namespace st
 	return svc, nil
 }
 
-func (s *Service) updateNode(phase apiv1.VirtnodePhase) error {
-	s.nodeinfo.Status.Phase = phase
-	if phase == apiv1.VirtnodeReady {
-		err := VirtNodeUpdateFromHypervisor(s.nodeinfo, s.conn)
+// Record the phase of the node, along with the reason
+// it is, or is not, ready to run guests, posting an
+// event when that changes
+func (s *Service) setNodePhase(node *apiv2.Virtnode, phase apiv2.VirtnodePhase, reason string, err error) {
+	node.Status.Phase = phase
+	status := apiv2.ConditionFalse
+	if phase == apiv2.VirtnodeReady {
+		status = apiv2.ConditionTrue
+	}
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+
+	prev := apiv2.GetCondition(node.Status.Conditions, apiv2.ConditionReady)
+	changed := prev == nil || prev.Status != status || prev.Reason != reason || prev.Message != message
+	apiv2.SetCondition(&node.Status.Conditions, apiv2.ConditionReady, status, reason, message)
+	if !changed {
+		return
+	}
+
+	if err != nil {
+		s.recorder.Event(node, api.EventWarning, reason, message)
+	} else {
+		s.recorder.Eventf(node, api.EventNormal, reason, "Node is %s", phase)
+	}
+}
+
+// Write the hardware of the node to the latest version of its
+// record, so that metadata edits made meanwhile are kept
+func (s *Service) updateSpec(spec apiv2.VirtnodeSpec) error {
+	return api.RetryOnConflict(func() error {
+		latest, err := s.nodeinfoclient.Get(s.nodename)
 		if err != nil {
-			s.nodeinfo.Status.Phase = apiv1.VirtnodeFailed
+			return err
 		}
-	}
+		latest.Spec = spec
+		_, err = s.nodeinfoclient.Update(latest)
+		return err
+	})
+}
 
-	glog.V(1).Info("Updating existing record")
-	obj, err := s.nodeinfoclient.Update(s.nodeinfo)
+// Report the node's phase. When offline, connErr says why
+func (s *Service) updateNode(phase apiv2.VirtnodePhase, connErr error) error {
+	cached, err := s.nodeLister.Get(s.namespace, s.nodename)
+	if err != nil {
+		glog.Errorf("Unable to get node info %s", err)
+		return err
+	}
+	nodeinfo := api.DeepCopyVirtnode(cached)
+
+	reason := "Disconnected"
+	hvErr := connErr
+	if phase == apiv2.VirtnodeReady {
+		reason = "Connected"
+		hvErr = VirtNodeUpdateFromHypervisor(nodeinfo, s.conn)
+		if hvErr != nil {
+			glog.Errorf("Unable to query hypervisor %s", hvErr)
+			phase = apiv2.VirtnodeFailed
+			reason = "CapabilitiesFailed"
+		} else if !reflect.DeepEqual(nodeinfo.Spec, cached.Spec) {
+			glog.V(1).Info("Updating existing record")
+			err = s.updateSpec(nodeinfo.Spec)
+			if err != nil {
+				glog.Errorf("Unable to update node info %s", err)
+				return err
+			}
+		}
+	}
 
+	s.setNodePhase(nodeinfo, phase, reason, hvErr)
+	obj, err := s.nodeinfoclient.PatchStatus(cached, nodeinfo)
 	if err != nil {
-		glog.Errorf("Unable to update node info %s", err)
+		glog.Errorf("Unable to update node status %s", err)
 		return err
 	}
 	glog.V(1).Infof("Result %s", obj)
-	s.nodeinfo = obj
 
 	return nil
 }
@@ -120,6 +195,13 @@ func (s *Service) updateNode(phase apiv1.VirtnodePhase) error {
 func (s *Service) Run() error {
 	glog.V(1).Info("Running node service")
 
+	stop := make(chan struct{})
+	defer close(stop)
+	s.informers.Start(stop)
+	if err := s.informers.WaitForCacheSync(stop); err != nil {
+		return err
+	}
+
 	ticker := time.NewTicker(time.Second * 15)
 
 	for {
@@ -129,18 +211,21 @@ func (s *Service) Run() error {
 			case libvirtutil.ConnectReady:
 				glog.V(1).Info("Got connection ready event")
 				s.conn = hypEvent.Conn
-				s.updateNode(apiv1.VirtnodeReady)
+				s.updateNode(apiv2.VirtnodeReady, nil)
 
 			case libvirtutil.ConnectFailed:
 				s.conn.Close()
 				s.conn = nil
 				glog.V(1).Info("Got connection failed event")
-				s.updateNode(apiv1.VirtnodeOffline)
+				s.updateNode(apiv2.VirtnodeOffline, hypEvent.Err)
+
+			case libvirtutil.ConnectError:
+				s.updateNode(apiv2.VirtnodeOffline, hypEvent.Err)
 			}
 		case <-ticker.C:
 			if s.conn != nil {
 				glog.V(1).Info("Updating node info")
-				s.updateNode(apiv1.VirtnodeReady)
+				s.updateNode(apiv2.VirtnodeReady, nil)
 			} else {
 				glog.V(1).Info("Not connected, skipping update")
 			}
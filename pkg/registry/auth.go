@@ -0,0 +1,112 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	kubeapiv1 "k8s.io/api/core/v1"
+)
+
+// Credentials to log into a registry with
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// One registry's entry in a docker config
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+// The registry host a docker config key refers to. Keys
+// may be URLs, as the docker CLI writes for docker.io
+func configKeyHost(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	if idx := strings.Index(key, "/"); idx != -1 {
+		key = key[:idx]
+	}
+	switch key {
+	case "index.docker.io", defaultRegistryHost:
+		return DefaultRegistry
+	}
+	return key
+}
+
+func (e *dockerConfigEntry) credentials() (*Credentials, error) {
+	if e.Auth == "" {
+		return &Credentials{e.Username, e.Password}, nil
+	}
+
+	auth, err := base64.StdEncoding.DecodeString(e.Auth)
+	if err != nil {
+		return nil, err
+	}
+	bits := strings.SplitN(string(auth), ":", 2)
+	if len(bits) != 2 {
+		return nil, fmt.Errorf("Auth must be username:password")
+	}
+	return &Credentials{bits[0], bits[1]}, nil
+}
+
+// CredentialsFromSecret finds the credentials for a registry in
+// a pull secret, of either the dockerconfigjson or the older
+// dockercfg type. If the secret has no entry for the registry,
+// nil is returned so the pull is attempted anonymously
+func CredentialsFromSecret(secret *kubeapiv1.Secret, registry string) (*Credentials, error) {
+	var auths map[string]dockerConfigEntry
+	switch secret.Type {
+	case kubeapiv1.SecretTypeDockerConfigJson:
+		var config dockerConfigJSON
+		if err := json.Unmarshal(secret.Data[kubeapiv1.DockerConfigJsonKey], &config); err != nil {
+			return nil, fmt.Errorf("Unable to parse pull secret %s: %s", secret.Name, err)
+		}
+		auths = config.Auths
+	case kubeapiv1.SecretTypeDockercfg:
+		if err := json.Unmarshal(secret.Data[kubeapiv1.DockerConfigKey], &auths); err != nil {
+			return nil, fmt.Errorf("Unable to parse pull secret %s: %s", secret.Name, err)
+		}
+	default:
+		return nil, fmt.Errorf("Pull secret %s type is %s but want %s", secret.Name,
+			secret.Type, kubeapiv1.SecretTypeDockerConfigJson)
+	}
+
+	for key, entry := range auths {
+		if configKeyHost(key) != registry {
+			continue
+		}
+		creds, err := entry.credentials()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse pull secret %s entry %s: %s", secret.Name, key, err)
+		}
+		return creds, nil
+	}
+	return nil, nil
+}
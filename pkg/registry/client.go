@@ -0,0 +1,334 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	MediaTypeOCIIndex          = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest       = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerList        = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerManifest    = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeAcceptedManifests = MediaTypeOCIIndex + ", " + MediaTypeOCIManifest + ", " +
+		MediaTypeDockerList + ", " + MediaTypeDockerManifest
+)
+
+// Descriptor refers to a manifest or blob by its digest
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// Covers both image manifests and indexes of them,
+// which are told apart by their media type
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []Descriptor `json:"layers"`
+	Manifests []Descriptor `json:"manifests"`
+}
+
+// Client fetches the content of one image from a registry,
+// speaking the docker registry v2 protocol which OCI
+// registries share
+type Client struct {
+	ref    *Reference
+	scheme string
+	client *http.Client
+	creds  *Credentials
+	// Bearer token from the registry's auth service
+	token string
+	// Closed to abort any request in progress
+	cancel <-chan struct{}
+}
+
+// NewClient creates a client for the image. Plain HTTP is
+// only used if insecure is set, as for the registry deployed
+// in the cluster
+func NewClient(ref *Reference, creds *Credentials, insecure bool, cancel <-chan struct{}) *Client {
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	return &Client{
+		ref:    ref,
+		scheme: scheme,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+			},
+		},
+		creds:  creds,
+		cancel: cancel,
+	}
+}
+
+// Split a WWW-Authenticate challenge such as 'Bearer
+// realm="https://auth",service="registry"' into its scheme
+// and parameters
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	bits := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(bits) != 2 {
+		return bits[0], params
+	}
+
+	rest := bits[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(strings.TrimLeft(rest[:eq], ",")))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			// Quoted values may contain commas,
+			// as scopes do
+			end := strings.Index(rest[1:], "\"")
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma != -1 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return bits[0], params
+}
+
+// Fetch a bearer token from the auth service named in the
+// challenge, logging in if we have credentials
+func (c *Client) authorize(challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("Registry %s wants unsupported auth scheme '%s'", c.ref.Registry, scheme)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("Registry %s gave bad auth realm '%s'", c.ref.Registry, params["realm"])
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", c.ref.Repository))
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Cancel = c.cancel
+	if c.creds != nil {
+		req.SetBasicAuth(c.creds.Username, c.creds.Password)
+	}
+
+	glog.V(1).Infof("Fetching token for %s from %s", c.ref, realm)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to log into registry %s: %s", c.ref.Registry, res.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return fmt.Errorf("Unable to parse token from registry %s: %s", c.ref.Registry, err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	return nil
+}
+
+// Make a request to the registry, logging in when it
+// first asks us to
+func (c *Client) get(path, accept string) (*http.Response, error) {
+	target := fmt.Sprintf("%s://%s/v2/%s/%s", c.scheme, c.ref.host(), c.ref.Repository, path)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Cancel = c.cancel
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.creds != nil {
+			req.SetBasicAuth(c.creds.Username, c.creds.Password)
+		}
+
+		res, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := res.Header.Get("WWW-Authenticate")
+			res.Body.Close()
+			if err := c.authorize(challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("Unable to fetch %s from %s: %s", path, c.ref, res.Status)
+		}
+		return res, nil
+	}
+}
+
+func (c *Client) getManifest(version string) (*manifest, error) {
+	res, err := c.get("manifests/"+version, mediaTypeAcceptedManifests)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var m manifest
+	if err := json.NewDecoder(io.LimitReader(res.Body, 4*1024*1024)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("Unable to parse manifest of %s: %s", c.ref, err)
+	}
+	if m.MediaType == "" {
+		// Optional in OCI manifests, so go by the header
+		m.MediaType = strings.TrimSpace(strings.Split(res.Header.Get("Content-Type"), ";")[0])
+	}
+	return &m, nil
+}
+
+// Pick the image to use from an index. Disk images rarely
+// depend on the architecture, so any image is used if none
+// match the host
+func pickManifest(manifests []Descriptor, arch string) (*Descriptor, error) {
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("Image index lists no images")
+	}
+	for i := range manifests {
+		platform := manifests[i].Platform
+		if platform != nil && platform.OS == "linux" && platform.Architecture == arch {
+			return &manifests[i], nil
+		}
+	}
+	return &manifests[0], nil
+}
+
+// Layers lists the layers of the image, from the bottom up.
+// Where the image is an index, the image for the architecture
+// given is picked, in GOARCH style
+func (c *Client) Layers(arch string) ([]Descriptor, error) {
+	m, err := c.getManifest(c.ref.version())
+	if err != nil {
+		return nil, err
+	}
+
+	switch m.MediaType {
+	case MediaTypeOCIIndex, MediaTypeDockerList:
+		desc, err := pickManifest(m.Manifests, arch)
+		if err != nil {
+			return nil, err
+		}
+		glog.V(1).Infof("Using image %s from index of %s", desc.Digest, c.ref)
+		m, err = c.getManifest(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch m.MediaType {
+	case MediaTypeOCIManifest, MediaTypeDockerManifest:
+		return m.Layers, nil
+	}
+	return nil, fmt.Errorf("Unsupported manifest type '%s' for %s", m.MediaType, c.ref)
+}
+
+// Checks the content of a blob against its digest as it is
+// read, failing at the end if they don't match
+type verifiedReader struct {
+	body   io.ReadCloser
+	hash   hash.Hash
+	digest string
+}
+
+func (v *verifiedReader) Read(buf []byte) (int, error) {
+	n, err := v.body.Read(buf)
+	v.hash.Write(buf[:n])
+	if err == io.EOF {
+		got := "sha256:" + hex.EncodeToString(v.hash.Sum(nil))
+		if got != v.digest {
+			return n, fmt.Errorf("Blob digest is %s, expected %s", got, v.digest)
+		}
+	}
+	return n, err
+}
+
+func (v *verifiedReader) Close() error {
+	return v.body.Close()
+}
+
+// Blob fetches the content of a layer. It is checked against
+// its digest as it is read, so must be read to the end
+func (c *Client) Blob(desc *Descriptor) (io.ReadCloser, error) {
+	if !strings.HasPrefix(desc.Digest, "sha256:") {
+		return nil, fmt.Errorf("Unsupported digest '%s'", desc.Digest)
+	}
+
+	res, err := c.get("blobs/"+desc.Digest, "")
+	if err != nil {
+		return nil, err
+	}
+	return &verifiedReader{res.Body, sha256.New(), desc.Digest}, nil
+}
@@ -0,0 +1,126 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Where images without a registry host come from
+	DefaultRegistry = "docker.io"
+	// The host actually serving the default registry
+	defaultRegistryHost = "registry-1.docker.io"
+)
+
+var (
+	repositoryRE = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRE        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRE     = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// Reference names an image in a registry, such as
+// 'registry.example.com:5000/images/fedora:26'
+type Reference struct {
+	// Host and optional port of the registry
+	Registry string
+	// Path of the repository in the registry
+	Repository string
+	// Either the tag or the digest is set
+	Tag    string
+	Digest string
+}
+
+// ParseReference splits an image reference into its parts,
+// filling in the defaults docker applies
+func ParseReference(image string) (*Reference, error) {
+	ref := &Reference{}
+	rest := image
+
+	if idx := strings.Index(rest, "@"); idx != -1 {
+		ref.Digest = rest[idx+1:]
+		rest = rest[:idx]
+		if !digestRE.MatchString(ref.Digest) {
+			return nil, fmt.Errorf("Invalid digest '%s' in image '%s'", ref.Digest, image)
+		}
+	}
+
+	if idx := strings.LastIndex(rest, ":"); idx != -1 && !strings.Contains(rest[idx:], "/") {
+		ref.Tag = rest[idx+1:]
+		rest = rest[:idx]
+		if !tagRE.MatchString(ref.Tag) {
+			return nil, fmt.Errorf("Invalid tag '%s' in image '%s'", ref.Tag, image)
+		}
+	}
+
+	// The first component is only a host if it
+	// looks like one
+	bits := strings.SplitN(rest, "/", 2)
+	if len(bits) == 2 && (strings.ContainsAny(bits[0], ".:") || bits[0] == "localhost") {
+		ref.Registry = bits[0]
+		ref.Repository = bits[1]
+	} else {
+		ref.Registry = DefaultRegistry
+		ref.Repository = rest
+		if len(bits) == 1 {
+			ref.Repository = "library/" + rest
+		}
+	}
+
+	if !repositoryRE.MatchString(ref.Repository) {
+		return nil, fmt.Errorf("Invalid repository '%s' in image '%s'", ref.Repository, image)
+	}
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	return ref, nil
+}
+
+// The host to contact for the registry
+func (r *Reference) host() string {
+	if r.Registry == DefaultRegistry {
+		return defaultRegistryHost
+	}
+	return r.Registry
+}
+
+// The tag or digest to ask the registry for, preferring
+// the digest since it can't change
+func (r *Reference) version() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r *Reference) String() string {
+	name := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+	return name
+}
@@ -0,0 +1,137 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+// Package virtkubectl implements the operations of the
+// virtkubectl command line client
+package virtkubectl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+)
+
+type Client struct {
+	// Namespace holding the machines and their pods. Image
+	// files, repos and classes are always in the default
+	// namespace
+	Namespace string
+
+	// Base URL of the image repo streamer, eg http://host:9000
+	StreamURL string
+
+	// Libvirt connection URI for a node, with '%s' replaced
+	// by the node's address
+	LibvirtURI string
+
+	// Image for the pods started to run machines
+	AngelImage string
+
+	Out      io.Writer
+	Progress io.Writer
+
+	clientset    kubernetes.Interface
+	apiclientset api.Interface
+	httpClient   *http.Client
+}
+
+// NewClient connects using the kube config file, or the usual
+// kubectl config if empty. The namespace defaults to that of
+// the config's current context
+func NewClient(kubeconfigfile, namespace string) (*Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfigfile
+	overrides := &clientcmd.ConfigOverrides{}
+	if namespace != "" {
+		overrides.Context.Namespace = namespace
+	}
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return nil, err
+	}
+
+	kubeconfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	apiclientset, err := api.NewClientset(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientWithClients(clientset, apiclientset, namespace), nil
+}
+
+// NewClientWithClients creates the client using the clients
+// given, which may be fakes
+func NewClientWithClients(clientset kubernetes.Interface, apiclientset api.Interface, namespace string) *Client {
+	return &Client{
+		Namespace:  namespace,
+		StreamURL:  "http://localhost:9000",
+		LibvirtURI: "qemu+tls://%s/system",
+		AngelImage: "localhost:5000/libvirtkubevmangel",
+		Out:        os.Stdout,
+		Progress:   os.Stderr,
+
+		clientset:    clientset,
+		apiclientset: apiclientset,
+		httpClient:   http.DefaultClient,
+	}
+}
+
+// SetStreamCA makes streaming trust only the CA certs in
+// the PEM file
+func (c *Client) SetStreamCA(caFile string) error {
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return err
+	}
+	calist := x509.NewCertPool()
+
+	ok := calist.AppendCertsFromPEM(ca)
+	if !ok {
+		return fmt.Errorf("Error loading CA certs from %s", caFile)
+	}
+
+	c.httpClient = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: calist,
+			},
+		},
+	}
+	return nil
+}
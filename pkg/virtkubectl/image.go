@@ -0,0 +1,435 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtkubectl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	kubeapiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"libvirt.org/libvirt-kube/pkg/api"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+const streamSecretType = "libvirt.org/kube/virtimagefile/stream"
+
+// Reports how much of a stream has been copied
+type progress struct {
+	out    io.Writer
+	name   string
+	total  int64
+	copied int64
+	last   time.Time
+}
+
+func (p *progress) add(n int) {
+	p.copied += int64(n)
+	now := time.Now()
+	if now.Sub(p.last) < 500*time.Millisecond && p.copied != p.total {
+		return
+	}
+	p.last = now
+
+	if p.total > 0 {
+		fmt.Fprintf(p.out, "\r%s: %3d%% %d/%d bytes", p.name, p.copied*100/p.total, p.copied, p.total)
+	} else {
+		fmt.Fprintf(p.out, "\r%s: %d bytes", p.name, p.copied)
+	}
+}
+
+func (p *progress) done() {
+	fmt.Fprintln(p.out)
+}
+
+type progressReader struct {
+	io.Reader
+	progress *progress
+}
+
+func (r *progressReader) Read(data []byte) (int, error) {
+	n, err := r.Reader.Read(data)
+	r.progress.add(n)
+	return n, err
+}
+
+// The URL streaming the file, authorized by the token in its
+// stream secret
+func (c *Client) fileStreamURL(file *apiv2.Virtimagefile) (string, error) {
+	if file.Spec.Stream.TokenSecret == "" {
+		return "", fmt.Errorf("Image file %s has no stream token secret", file.Metadata.Name)
+	}
+
+	token, err := api.GetSecretValue(c.clientset, file.Spec.Stream.TokenSecret, file.Metadata.Namespace,
+		streamSecretType, "token")
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/stream/%s/%s/%s", strings.TrimRight(c.StreamURL, "/"),
+		url.PathEscape(file.Spec.RepoName), url.PathEscape(file.Metadata.Name),
+		url.PathEscape(string(token))), nil
+}
+
+func (c *Client) getAvailableFile(name string) (*apiv2.Virtimagefile, error) {
+	file, err := c.apiclientset.Virtimagefiles(metav1.NamespaceDefault).Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Status.Phase != apiv2.VirtimagefileAvailable {
+		return nil, fmt.Errorf("Image file %s is %s, not %s", name, file.Status.Phase, apiv2.VirtimagefileAvailable)
+	}
+	return file, nil
+}
+
+// An error the streamer replied with, which sending the same
+// request again won't fix
+type streamStatusError struct {
+	status string
+	msg    string
+}
+
+func (e *streamStatusError) Error() string {
+	return fmt.Sprintf("Stream failed: %s: %s", e.status, e.msg)
+}
+
+func streamError(resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(resp.Body)
+	return &streamStatusError{
+		status: resp.Status,
+		msg:    strings.TrimSpace(string(msg)),
+	}
+}
+
+// The URL streaming the file converted to or from the format,
+// if one is given
+func (c *Client) fileFormatURL(file *apiv2.Virtimagefile, format string) (string, error) {
+	streamURL, err := c.fileStreamURL(file)
+	if err != nil || format == "" {
+		return streamURL, err
+	}
+	return streamURL + "?format=" + url.QueryEscape(format), nil
+}
+
+const (
+	// Uploads are sent in chunks of this size, so a
+	// dropped connection only loses the chunk it was
+	// sending
+	uploadChunkSize = 64 * 1024 * 1024
+
+	// How many times a chunk, or the rest of a
+	// download, is tried before giving up
+	streamAttempts = 5
+)
+
+// Send a single upload request, giving an error unless the
+// streamer accepts it
+func (c *Client) streamRequest(method, streamURL string, body io.Reader, length int64) error {
+	req, err := http.NewRequest(method, streamURL, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return streamError(resp)
+	}
+	return nil
+}
+
+// Whether a failed stream request may succeed if sent again
+func retryable(err error) bool {
+	_, ok := err.(*streamStatusError)
+	return !ok
+}
+
+// Ask the streamer how much of an upload it has received
+func (c *Client) uploadOffset(streamURL string) (int64, error) {
+	resp, err := c.httpClient.Head(streamURL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, &streamStatusError{status: resp.Status}
+	}
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+// Upload replaces the content of the image file with that of the
+// local file. Unless the local file's format is given, to convert
+// it from, it is sent as it is in chunks, each retried if the
+// connection drops, and must fit in the image file's capacity.
+// An upload which was cut short, even by an earlier run, carries
+// on from what the streamer received
+func (c *Client) Upload(name, path, format string) error {
+	file, err := c.getAvailableFile(name)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	streamURL, err := c.fileFormatURL(file, format)
+	if err != nil {
+		return err
+	}
+
+	prog := &progress{out: c.Progress, name: name, total: info.Size()}
+	defer prog.done()
+
+	if format != "" {
+		return c.streamRequest(http.MethodPut, streamURL, &progressReader{src, prog}, info.Size())
+	}
+
+	if uint64(info.Size()) > file.Spec.Capacity {
+		return fmt.Errorf("File %s is %d bytes, larger than the capacity %d of image file %s",
+			path, info.Size(), file.Spec.Capacity, name)
+	}
+
+	start, err := c.uploadOffset(streamURL)
+	if err != nil {
+		return err
+	}
+	if start > info.Size() {
+		// Left by an upload of something else
+		start = 0
+	}
+	if start != 0 {
+		fmt.Fprintf(c.Progress, "%s: resuming upload from %d\n", name, start)
+	}
+
+	for offset := start; offset < info.Size(); offset += uploadChunkSize {
+		length := info.Size() - offset
+		if length > uploadChunkSize {
+			length = uploadChunkSize
+		}
+		chunkURL := fmt.Sprintf("%s?offset=%d", streamURL, offset)
+
+		for attempt := 1; ; attempt++ {
+			prog.copied = offset
+			chunk := io.NewSectionReader(src, offset, length)
+			err = c.streamRequest(http.MethodPut, chunkURL, &progressReader{chunk, prog}, length)
+			if err == nil {
+				break
+			}
+			if attempt == streamAttempts || !retryable(err) {
+				return err
+			}
+			fmt.Fprintf(c.Progress, "\n%s: resending from %d after: %s\n", name, offset, err)
+		}
+	}
+
+	return c.streamRequest(http.MethodPost, fmt.Sprintf("%s?size=%d", streamURL, info.Size()), nil, 0)
+}
+
+// Download saves the content of the image file to the local file,
+// converted to the format if one is given. Otherwise a download
+// which is cut short carries on from where it got to, unless the
+// image file changed meanwhile
+func (c *Client) Download(name, path, format string) error {
+	file, err := c.getAvailableFile(name)
+	if err != nil {
+		return err
+	}
+
+	streamURL, err := c.fileFormatURL(file, format)
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	prog := &progress{out: c.Progress, name: name}
+	defer prog.done()
+
+	var copied int64
+	var etag string
+	for attempt := 1; ; attempt++ {
+		err = c.downloadFrom(streamURL, dst, prog, &copied, &etag, format == "")
+		if err == nil {
+			break
+		}
+		if attempt == streamAttempts || !retryable(err) || format != "" || etag == "" {
+			dst.Close()
+			return err
+		}
+		fmt.Fprintf(c.Progress, "\n%s: resuming from %d after: %s\n", name, copied, err)
+	}
+
+	return dst.Close()
+}
+
+// Fetch what's left of a download, from where it got to if the
+// content is still the version the part already saved is of
+func (c *Client) downloadFrom(streamURL string, dst *os.File, prog *progress, copied *int64, etag *string, ranged bool) error {
+	req, err := http.NewRequest(http.MethodGet, streamURL, nil)
+	if err != nil {
+		return err
+	}
+	if ranged && *copied > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", *copied))
+		req.Header.Set("If-Range", *etag)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The whole content, so start over
+		if err := dst.Truncate(0); err != nil {
+			return err
+		}
+		*copied = 0
+		prog.total = resp.ContentLength
+	case http.StatusPartialContent:
+		prog.total = *copied + resp.ContentLength
+	default:
+		return streamError(resp)
+	}
+	if ranged {
+		*etag = resp.Header.Get("ETag")
+	}
+
+	if _, err := dst.Seek(*copied, io.SeekStart); err != nil {
+		return err
+	}
+	prog.copied = *copied
+	n, err := io.Copy(dst, &progressReader{resp.Body, prog})
+	*copied += n
+	if err != nil {
+		return err
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("Download ended after %d of %d bytes", n, resp.ContentLength)
+	}
+	return nil
+}
+
+func newToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// CreateFile creates an image file in the repo sized to hold the
+// local disk image, then uploads it. A stream token secret is
+// created alongside, named after the file
+func (c *Client) CreateFile(name, reponame, path string, accessMode apiv2.VirtimagefileAccessMode) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	secretName := name + "-stream"
+	secret := &kubeapiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: secretName,
+		},
+		Type: streamSecretType,
+		Data: map[string][]byte{
+			"token": []byte(token),
+		},
+	}
+	if _, err := c.clientset.CoreV1().Secrets(metav1.NamespaceDefault).Create(secret); err != nil {
+		return err
+	}
+
+	file := &apiv2.Virtimagefile{
+		Metadata: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: apiv2.VirtimagefileSpec{
+			RepoName:   reponame,
+			AccessMode: accessMode,
+			Capacity:   uint64(info.Size()),
+			Stream: apiv2.VirtimagefileStream{
+				TokenSecret: secretName,
+				AccessMode:  apiv2.VirtimagefileStreamBoth,
+			},
+		},
+	}
+	if _, err := c.apiclientset.Virtimagefiles(metav1.NamespaceDefault).Create(file); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.Progress, "Waiting for image file %s to be created\n", name)
+	err = wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		file, err := c.apiclientset.Virtimagefiles(metav1.NamespaceDefault).Get(name)
+		if err != nil {
+			return false, err
+		}
+		if file.Status.Phase == apiv2.VirtimagefileFailed {
+			cond := apiv2.GetCondition(file.Status.Conditions, apiv2.ConditionReady)
+			if cond != nil {
+				return false, fmt.Errorf("Image file %s failed: %s", name, cond.Message)
+			}
+			return false, fmt.Errorf("Image file %s failed", name)
+		}
+		return file.Status.Phase == apiv2.VirtimagefileAvailable, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Upload(name, path, "")
+}
@@ -0,0 +1,306 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtkubectl
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/libvirt/libvirt-go"
+	kubeapiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+// Label identifying the pods started for machines
+const machineLabel = "libvirt.org/virtmachine"
+
+func (c *Client) getRunningMachine(name string) (*apiv2.Virtmachine, error) {
+	machine, err := c.apiclientset.Virtmachines(c.Namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cond := apiv2.GetCondition(machine.Status.Conditions, apiv2.ConditionRunning)
+	if cond == nil || cond.Status != apiv2.ConditionTrue || machine.Status.DomainUUID == "" {
+		return nil, fmt.Errorf("Machine %s is not running", name)
+	}
+	return machine, nil
+}
+
+// The libvirt URI for the node running the machine's pod
+func (c *Client) machineURI(machine *apiv2.Virtmachine) (string, error) {
+	pod, err := c.clientset.CoreV1().Pods(c.Namespace).Get(machine.Status.Pod, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if pod.Spec.NodeName == "" {
+		return "", fmt.Errorf("Pod %s is not scheduled to a node", pod.Name)
+	}
+
+	node, err := c.clientset.CoreV1().Nodes().Get(pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	addr := ""
+	for _, nodeaddr := range node.Status.Addresses {
+		switch nodeaddr.Type {
+		case kubeapiv1.NodeInternalIP:
+			addr = nodeaddr.Address
+		case kubeapiv1.NodeHostName:
+			if addr == "" {
+				addr = nodeaddr.Address
+			}
+		}
+	}
+	if addr == "" {
+		addr = node.Name
+	}
+
+	return fmt.Sprintf(c.LibvirtURI, addr), nil
+}
+
+func (c *Client) runTool(tool string, args ...string) error {
+	cmd := exec.Command(tool, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Console attaches the terminal to the machine's first console
+func (c *Client) Console(name string) error {
+	machine, err := c.getRunningMachine(name)
+	if err != nil {
+		return err
+	}
+
+	uri, err := c.machineURI(machine)
+	if err != nil {
+		return err
+	}
+
+	return c.runTool("virsh", "--connect", uri, "console", machine.Status.DomainUUID)
+}
+
+// Display opens a graphical session on the machine
+func (c *Client) Display(name string) error {
+	machine, err := c.getRunningMachine(name)
+	if err != nil {
+		return err
+	}
+
+	uri, err := c.machineURI(machine)
+	if err != nil {
+		return err
+	}
+
+	return c.runTool("virt-viewer", "--connect", uri, "--uuid", machine.Status.DomainUUID)
+}
+
+func (c *Client) withDomain(name string, fn func(dom *libvirt.Domain) error) error {
+	machine, err := c.getRunningMachine(name)
+	if err != nil {
+		return err
+	}
+
+	uri, err := c.machineURI(machine)
+	if err != nil {
+		return err
+	}
+
+	conn, err := libvirt.NewConnect(uri)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	dom, err := conn.LookupDomainByUUIDString(machine.Status.DomainUUID)
+	if err != nil {
+		return err
+	}
+	defer dom.Free()
+
+	return fn(dom)
+}
+
+// Pause suspends the machine's CPUs, leaving its pod running
+func (c *Client) Pause(name string) error {
+	return c.withDomain(name, func(dom *libvirt.Domain) error {
+		return dom.Suspend()
+	})
+}
+
+func (c *Client) Resume(name string) error {
+	return c.withDomain(name, func(dom *libvirt.Domain) error {
+		return dom.Resume()
+	})
+}
+
+func (c *Client) newMachinePod(name string) *kubeapiv1.Pod {
+	return &kubeapiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				machineLabel: name,
+			},
+		},
+		Spec: kubeapiv1.PodSpec{
+			RestartPolicy: kubeapiv1.RestartPolicyNever,
+			Containers: []kubeapiv1.Container{
+				{
+					Name:  "libvirtkubevmangel",
+					Image: c.AngelImage,
+					Args: []string{
+						"/usr/local/bin/virtkubevmangel",
+						"--machine", name,
+						"--logtostderr",
+					},
+					Env: []kubeapiv1.EnvVar{
+						{
+							Name: "LIBVIRT_KUBE_VM_ANGEL_POD",
+							ValueFrom: &kubeapiv1.EnvVarSource{
+								FieldRef: &kubeapiv1.ObjectFieldSelector{
+									FieldPath: "metadata.name",
+								},
+							},
+						},
+						{
+							Name: "LIBVIRT_KUBE_VM_ANGEL_NAMESPACE",
+							ValueFrom: &kubeapiv1.EnvVarSource{
+								FieldRef: &kubeapiv1.ObjectFieldSelector{
+									FieldPath: "metadata.namespace",
+								},
+							},
+						},
+					},
+					VolumeMounts: []kubeapiv1.VolumeMount{
+						{
+							Name:      "vmshim",
+							MountPath: "/run/virtkubevmshim",
+						},
+					},
+				},
+			},
+			Volumes: []kubeapiv1.Volume{
+				{
+					Name: "vmshim",
+					VolumeSource: kubeapiv1.VolumeSource{
+						HostPath: &kubeapiv1.HostPathVolumeSource{
+							Path: "/srv/vmshim",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Start creates a pod running the machine, named after it
+func (c *Client) Start(name string) error {
+	if _, err := c.apiclientset.Virtmachines(c.Namespace).Get(name); err != nil {
+		return err
+	}
+
+	_, err := c.clientset.CoreV1().Pods(c.Namespace).Create(c.newMachinePod(name))
+	return err
+}
+
+// The pod running the machine, or the one Start would create
+// if it isn't running
+func (c *Client) machinePodName(name string) (string, error) {
+	machine, err := c.apiclientset.Virtmachines(c.Namespace).Get(name)
+	if err != nil {
+		return "", err
+	}
+
+	if machine.Status.Pod != "" {
+		return machine.Status.Pod, nil
+	}
+	return name, nil
+}
+
+func (c *Client) deletePod(podname string) error {
+	pods := c.clientset.CoreV1().Pods(c.Namespace)
+	if err := pods.Delete(podname, &metav1.DeleteOptions{}); err != nil {
+		return err
+	}
+
+	return wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		_, err := pods.Get(podname, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+// Stop deletes the machine's pod, which makes the shim kill
+// the guest, and waits for it to go
+func (c *Client) Stop(name string) error {
+	podname, err := c.machinePodName(name)
+	if err != nil {
+		return err
+	}
+
+	return c.deletePod(podname)
+}
+
+// Restart replaces the machine's pod with a copy of itself,
+// keeping any changes made to the pod Start would create
+func (c *Client) Restart(name string) error {
+	podname, err := c.machinePodName(name)
+	if err != nil {
+		return err
+	}
+
+	pods := c.clientset.CoreV1().Pods(c.Namespace)
+	pod, err := pods.Get(podname, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return c.Start(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.deletePod(podname); err != nil {
+		return err
+	}
+
+	newpod := &kubeapiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pod.Name,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: pod.Spec,
+	}
+	// Let the scheduler pick again
+	newpod.Spec.NodeName = ""
+
+	_, err = pods.Create(newpod)
+	return err
+}
@@ -0,0 +1,151 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtkubectl
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
+)
+
+func conditionStatus(conds []apiv2.Condition, typ apiv2.ConditionType) (string, string) {
+	cond := apiv2.GetCondition(conds, typ)
+	if cond == nil {
+		return string(apiv2.ConditionUnknown), ""
+	}
+	return string(cond.Status), cond.Reason
+}
+
+// How far an import has got, as a percentage if the
+// total is known
+func importProgress(status *apiv2.VirtimagefileStatus) string {
+	if status.Import == nil {
+		return "-"
+	}
+	if status.Import.Total == 0 {
+		return fmt.Sprintf("%d", status.Import.Transferred)
+	}
+	return fmt.Sprintf("%d%%", status.Import.Transferred*100/status.Import.Total)
+}
+
+func (c *Client) table(fn func(w io.Writer)) {
+	w := tabwriter.NewWriter(c.Out, 0, 8, 2, ' ', 0)
+	fn(w)
+	w.Flush()
+}
+
+func (c *Client) ShowMachines() error {
+	machines, err := c.apiclientset.Virtmachines(c.Namespace).List(v1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	c.table(func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tCLASS\tRUNNING\tREASON\tPOD")
+		for _, machine := range machines.Items {
+			running, reason := conditionStatus(machine.Status.Conditions, apiv2.ConditionRunning)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", machine.Metadata.Name, machine.Spec.Class,
+				running, reason, machine.Status.Pod)
+		}
+	})
+	return nil
+}
+
+func (c *Client) ShowNodes() error {
+	nodes, err := c.apiclientset.Virtnodes(v1.NamespaceAll).List(v1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	c.table(func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tPHASE\tREADY\tREASON\tARCH\tCELLS\tCPUS")
+		for _, node := range nodes.Items {
+			ready, reason := conditionStatus(node.Status.Conditions, apiv2.ConditionReady)
+			cpus := 0
+			for _, cell := range node.Spec.Resources.NUMACells {
+				cpus += cell.CPU.Avail
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\n", node.Metadata.Name, node.Status.Phase,
+				ready, reason, node.Spec.Arch, len(node.Spec.Resources.NUMACells), cpus)
+		}
+	})
+	return nil
+}
+
+func (c *Client) ShowFiles() error {
+	files, err := c.apiclientset.Virtimagefiles(v1.NamespaceDefault).List(v1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	c.table(func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tREPO\tPHASE\tREADY\tREASON\tCAPACITY\tLENGTH\tIMPORTED")
+		for _, file := range files.Items {
+			ready, reason := conditionStatus(file.Status.Conditions, apiv2.ConditionReady)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n", file.Metadata.Name, file.Spec.RepoName,
+				file.Status.Phase, ready, reason, file.Status.Capacity, file.Status.Length,
+				importProgress(&file.Status))
+		}
+	})
+	return nil
+}
+
+func (c *Client) ShowRepos() error {
+	repos, err := c.apiclientset.Virtimagerepos(v1.NamespaceDefault).List(v1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	c.table(func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tFORMAT\tPHASE\tREADY\tREASON\tCAPACITY\tALLOCATION")
+		for _, repo := range repos.Items {
+			ready, reason := conditionStatus(repo.Status.Conditions, apiv2.ConditionReady)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\n", repo.Metadata.Name, repo.Spec.Format,
+				repo.Status.Phase, ready, reason, repo.Status.Capacity, repo.Status.Allocation)
+		}
+	})
+	return nil
+}
+
+func (c *Client) ShowSnapshots() error {
+	snapshots, err := c.apiclientset.Virtimagesnapshots(v1.NamespaceDefault).List(v1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	c.table(func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tFILE\tTYPE\tPHASE\tREADY\tREASON\tCAPACITY\tCREATED")
+		for _, snapshot := range snapshots.Items {
+			ready, reason := conditionStatus(snapshot.Status.Conditions, apiv2.ConditionReady)
+			created := "-"
+			if snapshot.Status.CreationTime != nil {
+				created = snapshot.Status.CreationTime.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", snapshot.Metadata.Name, snapshot.Spec.FileName,
+				snapshot.Spec.Type, snapshot.Status.Phase, ready, reason, snapshot.Status.Capacity, created)
+		}
+	})
+	return nil
+}
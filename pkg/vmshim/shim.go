@@ -33,12 +33,11 @@ import (
 	"github.com/golang/glog"
 	"github.com/libvirt/libvirt-go"
 	"k8s.io/client-go/kubernetes"
-	kubeapi "k8s.io/client-go/pkg/api"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"libvirt.org/libvirt-kube/pkg/api"
-	apiv1 "libvirt.org/libvirt-kube/pkg/api/v1alpha1"
+	apiv2 "libvirt.org/libvirt-kube/pkg/api/v1alpha2"
 	"libvirt.org/libvirt-kube/pkg/designer"
 	"libvirt.org/libvirt-kube/pkg/libvirtutil"
 	"libvirt.org/libvirt-kube/pkg/resource"
@@ -46,25 +45,40 @@ import (
 )
 
 type Machine struct {
-	uuid     string
-	client   *api.VirtmachineClient
-	machine  *apiv1.Virtmachine
-	domain   *libvirt.Domain
-	shutdown chan bool
+	uuid    string
+	client  api.VirtmachineInterface
+	machine *apiv2.Virtmachine
+	// The machine as the apiserver gave it once started,
+	// which the stop is patched against
+	saved          *apiv2.Virtmachine
+	domain         *libvirt.Domain
+	transientDisks []*libvirt.StorageVol
+	shutdown       chan apiv2.VirtmachineStopReason
+	// Whether libvirt boots the guest again in place
+	// when it crashes
+	restartOnCrash bool
 }
 
+// How often the informer caches are relisted
+const informerResyncPeriod = 10 * time.Minute
+
 type Shim struct {
 	shimAddr        string
-	clientset       *kubernetes.Clientset
-	kubeconfig      *rest.Config
+	clientset       kubernetes.Interface
+	apiClientset    api.Interface
+	informers       *api.InformerFactory
 	imageRepoPath   string
-	imageRepoClient *api.VirtimagerepoClient
-	imageFileClient *api.VirtimagefileClient
+	machineLister   *api.VirtmachineLister
+	imageRepoLister *api.VirtimagerepoLister
+	imageFileLister *api.VirtimagefileLister
+	classLister     *api.VirtmachineclassLister
 	conn            *libvirt.Connect
 	connNotify      chan libvirtutil.ConnectEvent
 	machines        map[string]*Machine // UUID is key
 	lock            sync.Mutex
 	skipValidate    bool
+	overridePolicy  *designer.OverridePolicy
+	recorder        *api.EventRecorder
 }
 
 func getKubeConfig(kubeconfig string) (*rest.Config, error) {
@@ -74,7 +88,7 @@ func getKubeConfig(kubeconfig string) (*rest.Config, error) {
 	return rest.InClusterConfig()
 }
 
-func NewShim(shimAddr string, skipValidate bool, libvirtURI string, imageRepoPath string, kubeconfigfile string) (*Shim, error) {
+func NewShim(shimAddr string, skipValidate bool, libvirtURI string, imageRepoPath string, kubeconfigfile string, overrideAllow []string) (*Shim, error) {
 	kubeconfig, err := getKubeConfig(kubeconfigfile)
 	if err != nil {
 		return nil, err
@@ -100,26 +114,41 @@ func NewShim(shimAddr string, skipValidate bool, libvirtURI string, imageRepoPat
 		return nil, err
 	}
 
-	imageRepoClient, err := api.NewVirtimagerepoClient(kubeapi.NamespaceDefault, kubeconfig)
+	err = api.RegisterVirtmachineclass(clientset)
 	if err != nil {
 		return nil, err
 	}
 
-	imageFileClient, err := api.NewVirtimagefileClient(kubeapi.NamespaceDefault, kubeconfig)
+	apiClientset, err := api.NewClientset(kubeconfig)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewShimWithClients(shimAddr, skipValidate, libvirtURI, imageRepoPath, clientset, apiClientset, overrideAllow)
+}
+
+// NewShimWithClients creates the shim using the clients given,
+// which may be fakes. The resource definitions must already be
+// registered
+func NewShimWithClients(shimAddr string, skipValidate bool, libvirtURI string, imageRepoPath string, clientset kubernetes.Interface, apiClientset api.Interface, overrideAllow []string) (*Shim, error) {
+	// Machines may be in any namespace, so watch them all
+	informers := api.NewInformerFactory(apiClientset, "", informerResyncPeriod)
+
 	shim := &Shim{
 		skipValidate:    skipValidate,
 		shimAddr:        shimAddr,
-		kubeconfig:      kubeconfig,
 		clientset:       clientset,
+		apiClientset:    apiClientset,
+		informers:       informers,
 		imageRepoPath:   imageRepoPath,
-		imageFileClient: imageFileClient,
-		imageRepoClient: imageRepoClient,
+		machineLister:   informers.VirtmachineLister(),
+		imageFileLister: informers.VirtimagefileLister(),
+		imageRepoLister: informers.VirtimagerepoLister(),
+		classLister:     informers.VirtmachineclassLister(),
 		connNotify:      make(chan libvirtutil.ConnectEvent, 1),
 		machines:        make(map[string]*Machine),
+		overridePolicy:  designer.NewOverridePolicy(overrideAllow),
+		recorder:        api.NewEventRecorder(clientset, "virtkubevmshim"),
 	}
 
 	libvirtutil.OpenConnect(libvirtURI, shim.connNotify)
@@ -179,7 +208,7 @@ func (s *Shim) runClientImpl(conn net.Conn) error {
 		return fmt.Errorf("Cannot unmarshal info buf: %s", err)
 	}
 
-	dom, err := s.startMachine(info.Namespace, info.Machine, partition)
+	dom, err := s.startMachine(info.Namespace, info.Machine, info.Pod, partition)
 	if err != nil {
 		return err
 	}
@@ -222,6 +251,13 @@ func (s *Shim) Run() error {
 		return err
 	}
 
+	stop := make(chan struct{})
+	defer close(stop)
+	s.informers.Start(stop)
+	if err := s.informers.WaitForCacheSync(stop); err != nil {
+		return err
+	}
+
 	sock, err := net.Listen("unix", s.shimAddr)
 	if err != nil {
 		return err
@@ -238,12 +274,19 @@ func (s *Shim) Run() error {
 				glog.V(1).Infof("Setup new connection")
 				s.conn = hypEvent.Conn
 				s.lock.Unlock()
+				_, err := hypEvent.Conn.DomainEventLifecycleRegister(nil, s.domainLifecycleEvent)
+				if err != nil {
+					glog.Errorf("Unable to register for domain lifecycle events: %s", err)
+				}
+				s.purgeTransientDisks(hypEvent.Conn)
 			case libvirtutil.ConnectFailed:
 				s.lock.Lock()
 				glog.V(1).Infof("Discard old connection")
 				s.conn.Close()
 				s.conn = nil
 				s.lock.Unlock()
+			case libvirtutil.ConnectError:
+				glog.Errorf("Unable to connect to %s: %s", hypEvent.URI, hypEvent.Err)
 			}
 		}
 	}
@@ -257,35 +300,143 @@ func (s *Shim) domainLifecycleEvent(c *libvirt.Connect, d *libvirt.Domain, ev *l
 		glog.V(1).Infof("Error getting domain UUID", err)
 		return
 	}
-	if ev.Event == libvirt.DOMAIN_EVENT_STOPPED {
-		s.lock.Lock()
-		machine, ok := s.machines[uuid]
-		s.lock.Unlock()
-		glog.V(1).Infof("Notify shutdown domain %s", uuid)
-		if ok {
-			machine.shutdown <- true
-		}
+	if ev.Event != libvirt.DOMAIN_EVENT_STOPPED {
+		return
+	}
+
+	detail := libvirt.DomainEventStoppedDetailType(ev.Detail)
+	reason := stopReason(detail)
+
+	// Sent under the lock, so the machine can't be
+	// forgotten meanwhile
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	machine, ok := s.machines[uuid]
+	if !ok {
+		return
+	}
+	if detail == libvirt.DOMAIN_EVENT_STOPPED_CRASHED && machine.restartOnCrash {
+		glog.V(1).Infof("Domain %s crashed and is restarting in place", uuid)
+		return
+	}
+	glog.V(1).Infof("Notify shutdown domain %s reason %s", uuid, reason)
+	select {
+	case machine.shutdown <- reason:
+	default:
+		// Already told it stopped, such as when
+		// the shim destroyed it
+	}
+}
+
+func stopReason(detail libvirt.DomainEventStoppedDetailType) apiv2.VirtmachineStopReason {
+	switch detail {
+	case libvirt.DOMAIN_EVENT_STOPPED_SHUTDOWN:
+		return apiv2.VirtmachineStopShutdown
+	case libvirt.DOMAIN_EVENT_STOPPED_CRASHED:
+		return apiv2.VirtmachineStopCrashed
+	case libvirt.DOMAIN_EVENT_STOPPED_FAILED:
+		return apiv2.VirtmachineStopFailed
+	default:
+		return apiv2.VirtmachineStopDestroyed
 	}
 }
 
-func (s *Shim) startMachine(namespace, name, partition string) (*Machine, error) {
-	glog.V(1).Infof("Start machine='%s', namespace='%s'", name, namespace)
+// The reason for a guest which stopped before we could
+// register for its lifecycle events
+func shutoffReason(dom *libvirt.Domain) apiv2.VirtmachineStopReason {
+	state, reason, err := dom.GetState()
+	if err != nil || state != libvirt.DOMAIN_SHUTOFF {
+		// Transient domains vanish once stopped, so
+		// there's nothing to tell us why
+		return ""
+	}
+
+	switch libvirt.DomainShutoffReason(reason) {
+	case libvirt.DOMAIN_SHUTOFF_SHUTDOWN:
+		return apiv2.VirtmachineStopShutdown
+	case libvirt.DOMAIN_SHUTOFF_CRASHED:
+		return apiv2.VirtmachineStopCrashed
+	case libvirt.DOMAIN_SHUTOFF_FAILED:
+		return apiv2.VirtmachineStopFailed
+	default:
+		return apiv2.VirtmachineStopDestroyed
+	}
+}
 
-	machineClient, err := api.NewVirtmachineClient(namespace, s.kubeconfig)
+// Forget the hardware of an instance which is no longer
+// running, recording why
+func setMachineStopped(machine *apiv2.Virtmachine, reason string, err error) {
+	machine.Status.Hardware = apiv2.VirtmachineHardware{}
+	machine.Status.Class = ""
+	machine.Status.ClassRevision = ""
+	machine.Status.Overrides = nil
+	machine.Status.Pod = ""
+	machine.Status.DomainUUID = ""
+
+	message := ""
 	if err != nil {
-		return nil, err
+		message = err.Error()
 	}
+	apiv2.SetCondition(&machine.Status.Conditions, apiv2.ConditionRunning, apiv2.ConditionFalse, reason, message)
+}
 
-	machine, err := machineClient.Get(name)
+// The condition reason for a stop reason, eg 'Crashed'
+func stopConditionReason(reason apiv2.VirtmachineStopReason) string {
+	if reason == "" {
+		return "Stopped"
+	}
+	return strings.Title(string(reason))
+}
+
+func (s *Shim) startMachine(namespace, name, pod, partition string) (info *Machine, err error) {
+	glog.V(1).Infof("Start machine='%s', namespace='%s', pod='%s'", name, namespace, pod)
+
+	machineClient := s.apiClientset.Virtmachines(namespace)
+
+	cached, err := s.machineLister.Get(namespace, name)
 	if err != nil {
 		return nil, err
 	}
+	machine := api.DeepCopyVirtmachine(cached)
+
+	// Report why the instance didn't start, so it's not
+	// buried in the shim's logs
+	defer func() {
+		if err == nil {
+			return
+		}
+		setMachineStopped(machine, "StartFailed", err)
+		s.recorder.Event(machine, api.EventWarning, "StartFailed", err.Error())
+		if _, uerr := machineClient.PatchStatus(cached, machine); uerr != nil {
+			glog.Errorf("Unable to record start failure %s", uerr)
+		}
+	}()
 
-	domdesign := designer.NewDomainDesigner(s.clientset, s.imageRepoPath, s.imageRepoClient, s.imageFileClient)
+	domdesign := designer.NewDomainDesigner(s.clientset, s.imageRepoPath, s.imageRepoLister, s.imageFileLister)
 	if partition != "" {
 		domdesign.SetResourcePartition(partition)
 	}
-	err = domdesign.ApplyVirtMachine(&machine.Spec.Hardware)
+	hardware := machine.Spec.Hardware
+	classRevision := ""
+	if machine.Spec.Class != "" {
+		cached, err := s.classLister.Get(machine.Spec.Class)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load machine class '%s': %s", machine.Spec.Class, err)
+		}
+		class := api.DeepCopyVirtmachineclass(cached)
+		hardware = designer.MergeHardware(&class.Spec.Hardware, &machine.Spec.Hardware)
+		classRevision = class.Metadata.ResourceVersion
+	}
+
+	err = domdesign.ApplyVirtMachine(&hardware)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range domdesign.Warnings {
+		s.recorder.Event(machine, api.EventWarning, "GuestOSMismatch", warning)
+	}
+
+	overrides, err := domdesign.ApplyOverrides(machine.Spec.Overrides, s.overridePolicy)
 	if err != nil {
 		return nil, err
 	}
@@ -332,31 +483,57 @@ func (s *Shim) startMachine(namespace, name, partition string) (*Machine, error)
 		}
 	}
 
+	var transientDisks []*libvirt.StorageVol
+	for i := range domdesign.TransientDisks {
+		vol, err := createTransientDisk(conn, cfg, &domdesign.TransientDisks[i])
+		if err != nil {
+			deleteTransientDisks(transientDisks)
+			return nil, err
+		}
+		transientDisks = append(transientDisks, vol)
+	}
+
 	cfgXML, err := cfg.Marshal()
 	if err != nil {
+		deleteTransientDisks(transientDisks)
 		return nil, err
 	}
 	glog.V(1).Infof("Creating domain %s: %s", cfg.UUID, cfgXML)
 	domain, err := conn.DomainCreateXML(cfgXML,
 		libvirt.DOMAIN_START_AUTODESTROY|libvirt.DOMAIN_START_VALIDATE)
 	if err != nil {
+		deleteTransientDisks(transientDisks)
 		return nil, err
 	}
 
-	machine.Status.Hardware = machine.Spec.Hardware
+	machine.Status.Hardware = hardware
+	machine.Status.Class = machine.Spec.Class
+	machine.Status.ClassRevision = classRevision
+	machine.Status.StopReason = ""
+	machine.Status.Overrides = overrides
+	machine.Status.Pod = pod
+	machine.Status.DomainUUID = cfg.UUID
+	apiv2.SetCondition(&machine.Status.Conditions, apiv2.ConditionRunning, apiv2.ConditionTrue, "Started", "")
 
-	machine, err = machineClient.Update(machine)
+	updated, err := machineClient.PatchStatus(cached, machine)
 	if err != nil {
 		s.stopMachine(domain)
+		domain.Free()
+		deleteTransientDisks(transientDisks)
 		return nil, err
 	}
 
+	s.recorder.Eventf(updated, api.EventNormal, "Started", "Started domain %s in pod %s", cfg.UUID, pod)
+
 	machineInfo := &Machine{
-		uuid:     cfg.UUID,
-		machine:  machine,
-		client:   machineClient,
-		domain:   domain,
-		shutdown: make(chan bool, 1),
+		uuid:           cfg.UUID,
+		machine:        updated,
+		saved:          api.DeepCopyVirtmachine(updated),
+		client:         machineClient,
+		domain:         domain,
+		transientDisks: transientDisks,
+		shutdown:       make(chan apiv2.VirtmachineStopReason, 1),
+		restartOnCrash: cfg.OnCrash == "restart" || cfg.OnCrash == "coredump-restart",
 	}
 	s.lock.Lock()
 	s.machines[cfg.UUID] = machineInfo
@@ -377,8 +554,12 @@ func (s *Shim) waitForMachineStop(conn net.Conn, machine *Machine) error {
 
 	defer func() {
 		machine.domain.Free()
+		// The guest is gone, so nothing can be using
+		// the overlays any more
+		deleteTransientDisks(machine.transientDisks)
+		// Left open, since a late event may still
+		// have found the machine
 		s.lock.Lock()
-		close(machine.shutdown)
 		delete(s.machines, machine.uuid)
 		s.lock.Unlock()
 	}()
@@ -392,26 +573,40 @@ func (s *Shim) waitForMachineStop(conn net.Conn, machine *Machine) error {
 	}
 	eofNotify := make(chan bool, 1)
 	go s.waitForClientEOF(conn, eofNotify)
+	var reason apiv2.VirtmachineStopReason
 	if isActive {
 		// We're running now, so block until we
 		// either see the guest shutdown event,
 		// or get a signal indicating we should
-		// quit.
+		// quit. Guests whose lifecycle actions
+		// restart them in place don't count as
+		// stopped, so keep waiting.
 		select {
 		case _ = <-eofNotify:
 			glog.V(1).Info("Saw client exit, killing guest")
 			s.stopMachine(machine.domain)
+			reason = apiv2.VirtmachineStopDestroyed
 
-		case _ = <-machine.shutdown:
-			glog.V(1).Info("Saw guest shutdown, exiting")
-			// nada
+		case reason = <-machine.shutdown:
+			glog.V(1).Infof("Saw guest shutdown (%s), exiting", reason)
 		}
 	} else {
 		glog.V(1).Info("Guest already shutdown, exiting")
+		reason = shutoffReason(machine.domain)
+	}
+
+	machine.machine.Status.StopReason = reason
+	condReason := stopConditionReason(reason)
+	setMachineStopped(machine.machine, condReason, nil)
+	if reason == apiv2.VirtmachineStopCrashed || reason == apiv2.VirtmachineStopFailed {
+		s.recorder.Eventf(machine.machine, api.EventWarning, condReason, "Domain %s stopped unexpectedly", machine.uuid)
+	} else {
+		s.recorder.Eventf(machine.machine, api.EventNormal, condReason, "Domain %s stopped", machine.uuid)
 	}
 
-	machine.machine.Status.Hardware = apiv1.VirtmachineHardware{}
-	_, err = machine.client.Update(machine.machine)
+	// Only the stop is sent, so status written by others
+	// while the guest ran is left alone
+	_, err = machine.client.PatchStatus(machine.saved, machine.machine)
 	if err != nil {
 		return err
 	}
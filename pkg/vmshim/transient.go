@@ -0,0 +1,262 @@
+/*
+ * This file is part of the libvirt-kube project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package vmshim
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"libvirt.org/libvirt-kube/pkg/designer"
+	"libvirt.org/libvirt-kube/pkg/libvirtutil"
+)
+
+// Overlays are named after the domain they belong to, which
+// lets stale ones be identified after the shim restarts
+func transientVolName(domname, dev string) string {
+	return fmt.Sprintf("%s-%s.qcow2", domname, dev)
+}
+
+// The UUID of the domain owning an overlay, if the volume
+// name looks like one created by transientVolName
+func transientVolUUID(volname string) (string, bool) {
+	// kube-<36 char uuid>-<dev>.qcow2
+	if !strings.HasPrefix(volname, "kube-") || len(volname) < 43 {
+		return "", false
+	}
+	if volname[41] != '-' || !strings.HasSuffix(volname, ".qcow2") {
+		return "", false
+	}
+	return volname[5:41], true
+}
+
+func scratchPoolName(dir string) string {
+	// Escaped names can't contain a '.', so a suffix
+	// of ScratchDirName never clashes with repo pools
+	parent := libvirtutil.EscapeObjectName(path.Base(path.Dir(dir)))
+	return parent + libvirtutil.ScratchDirName
+}
+
+// Find, or create, a transient pool for a scratch dir
+func getScratchPool(conn *libvirt.Connect, dir string) (*libvirt.StoragePool, error) {
+	name := scratchPoolName(dir)
+
+	pool, err := conn.LookupStoragePoolByName(name)
+	if err == nil {
+		return pool, nil
+	}
+	lverr, ok := err.(libvirt.Error)
+	if !ok || lverr.Code != libvirt.ERR_NO_STORAGE_POOL {
+		return nil, err
+	}
+
+	poolCFG := libvirtxml.StoragePool{
+		Type: "dir",
+		Name: name,
+		Target: &libvirtxml.StoragePoolTarget{
+			Path: dir,
+		},
+	}
+
+	poolXML, err := poolCFG.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	glog.V(1).Infof("Creating scratch pool '%s' at '%s'", name, dir)
+	return conn.StoragePoolCreateXML(poolXML, libvirt.STORAGE_POOL_CREATE_WITH_BUILD)
+}
+
+// The path & format of a disk source, as understood
+// by qemu-img when recorded as a backing file
+func transientBacking(disk *libvirtxml.DomainDisk) (string, string, error) {
+	switch disk.Type {
+	case "file":
+		format := "raw"
+		if disk.Driver != nil && disk.Driver.Type != "" {
+			format = disk.Driver.Type
+		}
+		return disk.Source.File, format, nil
+	default:
+		// Network sources are refused by the designer,
+		// since a backing path can't carry their host
+		// or credentials
+		return "", "", fmt.Errorf("Unsupported source type '%s' for transient disk", disk.Type)
+	}
+}
+
+// Create an overlay for a transient disk and rewrite the
+// disk to use it, keeping the original source as the
+// backing store
+func createTransientDisk(conn *libvirt.Connect, dom *libvirtxml.Domain, tdisk *designer.DomainDesignerTransientDisk) (*libvirt.StorageVol, error) {
+	disk := &dom.Devices.Disks[tdisk.Index]
+
+	backingPath, backingFormat, err := transientBacking(disk)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := getScratchPool(conn, tdisk.ScratchDir)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Free()
+
+	volCFG := &libvirtxml.StorageVolume{
+		Type: "file",
+		Name: transientVolName(dom.Name, disk.Target.Dev),
+		Capacity: &libvirtxml.StorageVolumeSize{
+			Unit:  "bytes",
+			Value: tdisk.Capacity,
+		},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeTargetFormat{
+				Type: "qcow2",
+			},
+		},
+		BackingStore: &libvirtxml.StorageVolumeBackingStore{
+			Path: backingPath,
+			Format: &libvirtxml.StorageVolumeTargetFormat{
+				Type: backingFormat,
+			},
+		},
+	}
+
+	volXML, err := volCFG.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	glog.V(1).Infof("Creating transient overlay %s on %s", volCFG.Name, backingPath)
+	vol, err := pool.StorageVolCreateXML(volXML, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	volPath, err := vol.GetPath()
+	if err != nil {
+		deleteTransientDisk(vol)
+		return nil, err
+	}
+
+	disk.BackingStore = &libvirtxml.DomainDiskBackingStore{
+		Type: disk.Type,
+		Format: &libvirtxml.DomainDiskFormat{
+			Type: backingFormat,
+		},
+		Source: disk.Source,
+	}
+	disk.Type = "file"
+	disk.Source = &libvirtxml.DomainDiskSource{
+		File: volPath,
+	}
+	disk.Driver = &libvirtxml.DomainDiskDriver{
+		Name: "qemu",
+		Type: "qcow2",
+	}
+
+	return vol, nil
+}
+
+func deleteTransientDisk(vol *libvirt.StorageVol) {
+	name, _ := vol.GetName()
+	glog.V(1).Infof("Deleting transient overlay %s", name)
+	if err := vol.Delete(0); err != nil {
+		glog.Errorf("Unable to delete transient overlay %s: %s", name, err)
+	}
+	vol.Free()
+}
+
+func deleteTransientDisks(vols []*libvirt.StorageVol) {
+	for _, vol := range vols {
+		deleteTransientDisk(vol)
+	}
+}
+
+// Delete overlays left behind by machines which are no longer
+// running, eg if the shim or libvirtd crashed while they were
+func (s *Shim) purgeTransientDisks(conn *libvirt.Connect) {
+	var dirs []string
+
+	repos, err := s.imageRepoLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Unable to list image repos for transient disk cleanup: %s", err)
+	} else {
+		for _, repo := range repos {
+			dirs = append(dirs, path.Join(s.imageRepoPath, repo.Metadata.Name, libvirtutil.ScratchDirName))
+		}
+	}
+
+	for _, dir := range dirs {
+		pool, err := getScratchPool(conn, dir)
+		if err != nil {
+			glog.Errorf("Unable to load scratch pool %s: %s", dir, err)
+			continue
+		}
+
+		if err := pool.Refresh(0); err != nil {
+			glog.Errorf("Unable to refresh scratch pool %s: %s", dir, err)
+		}
+
+		vols, err := pool.ListAllStorageVolumes(0)
+		pool.Free()
+		if err != nil {
+			glog.Errorf("Unable to list scratch pool %s: %s", dir, err)
+			continue
+		}
+
+		for i := range vols {
+			vol := &vols[i]
+			name, err := vol.GetName()
+			if err != nil {
+				vol.Free()
+				continue
+			}
+
+			uuid, ok := transientVolUUID(name)
+			if !ok {
+				vol.Free()
+				continue
+			}
+
+			s.lock.Lock()
+			_, running := s.machines[uuid]
+			s.lock.Unlock()
+			if !running {
+				dom, err := conn.LookupDomainByUUIDString(uuid)
+				if err == nil {
+					dom.Free()
+					running = true
+				}
+			}
+
+			if running {
+				vol.Free()
+			} else {
+				deleteTransientDisk(vol)
+			}
+		}
+	}
+}